@@ -13,9 +13,26 @@ type contextKey string
 
 const authContextKey contextKey = "auth"
 
-func SetSessionContext(parents context.Context, m *ldap.Message) context.Context {
+// SetSessionContext returns the context with the auth session of the operation.
+// The session is substituted with the proxied identity if the proxied authorization control is requested.
+func (s *Server) SetSessionContext(parents context.Context, m *ldap.Message) (context.Context, error) {
 	session := getAuthSession(m)
-	return context.WithValue(parents, authContextKey, session)
+
+	authzID, ok, err := parseProxiedAuthzControl(m)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		proxied, err := s.resolveProxiedAuthSession(context.WithValue(parents, authContextKey, session), session, authzID)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("info: Proxied authorization. authorizedDN: %s, authzId: %s", session.DN.DNNormStr(), authzID)
+
+		session = proxied
+	}
+
+	return context.WithValue(parents, authContextKey, session), nil
 }
 
 func AuthSessionContext(ctx context.Context) (*AuthSession, error) {
@@ -37,6 +54,8 @@ const (
 	ModRDNOps
 	DeleteOps
 	SearchOps
+	CompareOps
+	TreeDeleteOps
 )
 
 func (c LDAPAction) String() string {
@@ -51,13 +70,21 @@ func (c LDAPAction) String() string {
 		return "delete"
 	case SearchOps:
 		return "search"
+	case CompareOps:
+		return "compare"
+	case TreeDeleteOps:
+		return "treedelete"
 	default:
 		return "unknown"
 	}
 }
 
-func (s *Server) RequiredAuthz(m *ldap.Message, ops LDAPAction, targetDN *DN) bool {
-	session := getAuthSession(m)
+func (s *Server) RequiredAuthz(ctx context.Context, ops LDAPAction, targetDN *DN) bool {
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		log.Printf("error: Not Authorized without session. targetDN: %s, err: %v", targetDN.DNNormStr(), err)
+		return false
+	}
 	if session.DN != nil {
 		authorized := false
 
@@ -72,6 +99,10 @@ func (s *Server) RequiredAuthz(m *ldap.Message, ops LDAPAction, targetDN *DN) bo
 			authorized = s.simpleACL.CanWrite(session)
 		case SearchOps:
 			authorized = s.simpleACL.CanRead(session)
+		case CompareOps:
+			authorized = s.simpleACL.CanRead(session)
+		case TreeDeleteOps:
+			authorized = s.simpleACL.CanWrite(session) && s.simpleACL.CanTreeDelete(session)
 		}
 
 		log.Printf("info: Authorized: %v, action: %s, authorizedDN: %s, targetDN: %s", authorized, ops.String(), session.DN.DNNormStr(), targetDN.DNNormStr())
@@ -97,6 +128,8 @@ type SimpleACLScope int
 const (
 	ReadScope SimpleACLScope = iota
 	WriteScope
+	TreeDeleteScope
+	ProxyScope
 )
 
 func (c SimpleACLScope) String() string {
@@ -105,6 +138,10 @@ func (c SimpleACLScope) String() string {
 		return "R"
 	case WriteScope:
 		return "W"
+	case TreeDeleteScope:
+		return "D"
+	case ProxyScope:
+		return "P"
 	default:
 		return "unknown"
 	}
@@ -127,7 +164,7 @@ func NewSimpleACL(server *Server) (*SimpleACL, error) {
 	for _, d := range server.config.SimpleACL {
 		s := strings.Split(d, ":")
 		if len(s) != 3 {
-			return nil, xerrors.Errorf("Invalid format. Need <DN(User, Group or empty(everyone))>:<Scope(R, W or RW)>:<Invisible Attributes>: %s", d)
+			return nil, xerrors.Errorf("Invalid format. Need <DN(User, Group or empty(everyone))>:<Scope(R, W, D, P or combination)>:<Invisible Attributes>: %s", d)
 		}
 
 		scopeSet := SimpleACLScopeSet{}
@@ -139,8 +176,12 @@ func NewSimpleACL(server *Server) (*SimpleACL, error) {
 				scopeSet.Add(ReadScope)
 			case "W":
 				scopeSet.Add(WriteScope)
+			case "D":
+				scopeSet.Add(TreeDeleteScope)
+			case "P":
+				scopeSet.Add(ProxyScope)
 			default:
-				return nil, xerrors.Errorf(`Invalid scope. Need "R", "W": %s`, d)
+				return nil, xerrors.Errorf(`Invalid scope. Need "R", "W", "D", "P": %s`, d)
 			}
 		}
 
@@ -211,15 +252,59 @@ func (s *SimpleACL) CanWrite(session *AuthSession) bool {
 	return false
 }
 
-func (s *SimpleACL) CanVisible(session *AuthSession, attrName string) bool {
-	a := strings.ToLower(attrName)
+// CanTreeDelete returns whether the session can delete the subtree with the subtree delete control.
+func (s *SimpleACL) CanTreeDelete(session *AuthSession) bool {
+	if session.IsRoot {
+		return true
+	}
+
+	if v, ok := s.list[session.DN.DNNormStr()]; ok {
+		return v.Scope.Contains(TreeDeleteScope)
+	}
+	for _, m := range session.Groups {
+		if v, ok := s.list[m.DNNormStr()]; ok {
+			return v.Scope.Contains(TreeDeleteScope)
+		}
+	}
+	if v, ok := s.list["_DEFAULT_"]; ok {
+		return v.Scope.Contains(TreeDeleteScope)
+	}
+	return false
+}
 
+// CanProxy returns whether the session can request the proxied authorization control.
+func (s *SimpleACL) CanProxy(session *AuthSession) bool {
 	if session.IsRoot {
 		return true
 	}
 
 	if v, ok := s.list[session.DN.DNNormStr()]; ok {
-		return !v.InvisibleAttributes.Contains(a)
+		return v.Scope.Contains(ProxyScope)
+	}
+	for _, m := range session.Groups {
+		if v, ok := s.list[m.DNNormStr()]; ok {
+			return v.Scope.Contains(ProxyScope)
+		}
+	}
+	if v, ok := s.list["_DEFAULT_"]; ok {
+		return v.Scope.Contains(ProxyScope)
+	}
+	return false
+}
+
+func (s *SimpleACL) CanVisible(session *AuthSession, attrName string) bool {
+	// The subtypes are invisible too, e.g. userPassword;lang-ja
+	a := strings.ToLower(strings.SplitN(attrName, ";", 2)[0])
+
+	if session.IsRoot {
+		return true
+	}
+
+	// The anonymous session can search the root DSE
+	if session.DN != nil {
+		if v, ok := s.list[session.DN.DNNormStr()]; ok {
+			return !v.InvisibleAttributes.Contains(a)
+		}
 	}
 	for _, m := range session.Groups {
 		if v, ok := s.list[m.DNNormStr()]; ok {
@@ -17,22 +17,25 @@ func NewAddEntry(schemaMap *SchemaMap, dn *DN) *AddEntry {
 }
 
 func (j *AddEntry) HasAttr(attrName string) bool {
-	s, ok := j.schemaMap.AttributeType(attrName)
+	s, options, ok := j.schemaMap.AttributeDescription(attrName)
 	if !ok {
 		return false
 	}
 
-	_, ok = j.attributes[s.Name]
+	_, ok = j.attributes[s.Name+options]
 	return ok
 }
 
 func (j *AddEntry) SetDN(dn *DN) {
 	j.dn = dn
 
-	rdn := dn.RDN()
-	for k, v := range rdn {
+	if len(dn.RDNs) == 0 {
+		return
+	}
+	for _, a := range dn.RDNs[0].Attributes {
 		// rdn is validated already
-		j.attributes[k], _ = NewSchemaValue(j.schemaMap, k, []string{v.Orig})
+		sv, _ := NewSchemaValue(j.schemaMap, a.TypeNorm, []string{a.ValueOrig})
+		j.addsv(sv)
 	}
 }
 
@@ -64,6 +67,11 @@ func (j *AddEntry) Validate() error {
 		return err
 	}
 
+	// Validate RDN
+	if err := j.schemaMap.ValidateRDN(j.dn, j.attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -92,8 +100,19 @@ func (j *AddEntry) addsv(value *SchemaValue) error {
 		return nil
 	} else {
 		// When adding the attribute with same value as both DN and attribute,
-		// we need to ignore the duplicate error.
-		current.Add(value)
+		// we need to ignore the duplicate value.
+		for _, v := range value.Orig() {
+			sv, err := NewSchemaValue(j.schemaMap, name, []string{v})
+			if err != nil {
+				return err
+			}
+			if current.HasDuplicate(sv) {
+				continue
+			}
+			if err := current.Add(sv); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -105,5 +124,6 @@ func (j *AddEntry) Attrs() (map[string][]interface{}, map[string][]string) {
 		norm[k] = v.Norm()
 		orig[k] = v.Orig()
 	}
+	addSubtypeNorm(norm, j.attributes)
 	return norm, orig
 }
@@ -75,6 +75,22 @@ func TestAddEntryValidate(t *testing.T) {
 			},
 			NewInvalidPerSyntax("objectClass", 1),
 		},
+		{
+			"uid=abc,ou=Groups,dc=example,dc=com",
+			map[string][]string{
+				"objectClass":       {"alias"},
+				"aliasedObjectName": {"uid=abc,ou=Users,dc=example,dc=com"},
+			},
+			NewObjectClassViolationNotAllowed("uid"),
+		},
+		{
+			"uid=abc,ou=Groups,dc=example,dc=com",
+			map[string][]string{
+				"objectClass":       {"alias", "extensibleObject"},
+				"aliasedObjectName": {"uid=abc,ou=Users,dc=example,dc=com"},
+			},
+			nil,
+		},
 	}
 	server := NewServer(&ServerConfig{
 		Suffix: "dc=example,dc=com",
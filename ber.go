@@ -0,0 +1,215 @@
+package main
+
+import (
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/openstandia/goldap/message"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// goldap doesn't provide setters for some fields (e.g. responseValue of the extended response).
+// To build such messages, we encode them as BER packet using asn1-ber then decode it by goldap.
+
+func newLDAPMessagePacket(op *ber.Packet, controls ...*ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "MessageID"))
+	packet.AppendChild(op)
+
+	if len(controls) > 0 {
+		cp := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		for _, c := range controls {
+			cp.AppendChild(c)
+		}
+		packet.AppendChild(cp)
+	}
+	return packet
+}
+
+func decodeLDAPMessage(packet *ber.Packet) (*message.LDAPMessage, error) {
+	m, err := message.ReadLDAPMessage(message.NewBytes(0, packet.Bytes()))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decode LDAP message. err: %w", err)
+	}
+	return &m, nil
+}
+
+func appendLDAPResultPacket(op *ber.Packet, code int) {
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+}
+
+// newExtendedResponse returns the extended response with the responseName and the responseValue.
+// The responseName and the responseValue are omitted if they are empty.
+func newExtendedResponse(code int, name string, value []byte) (message.ExtendedResponse, error) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, message.TagExtendedResponse, nil, "Extended Response")
+	appendLDAPResultPacket(op, code)
+
+	if name != "" {
+		op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, message.TagExtendedResponseName, name, "responseName"))
+	}
+	if value != nil {
+		op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, message.TagExtendedResponseValue, string(value), "responseValue"))
+	}
+
+	m, err := decodeLDAPMessage(newLDAPMessagePacket(op))
+	if err != nil {
+		return message.ExtendedResponse{}, err
+	}
+
+	res, ok := m.ProtocolOp().(message.ExtendedResponse)
+	if !ok {
+		return message.ExtendedResponse{}, xerrors.Errorf("Unexpected protocolOp. op: %v", m.ProtocolOpName())
+	}
+	return res, nil
+}
+
+// newIntermediateResponse returns the intermediate response with the responseName and the responseValue.
+// The responseValue is omitted if it's nil.
+func newIntermediateResponse(name string, value []byte) (message.IntermediateResponse, error) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, message.TagIntermediateResponse, nil, "Intermediate Response")
+	op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, message.TagIntermediateResponseName, name, "responseName"))
+	if value != nil {
+		op.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, message.TagIntermediateResponseValue, string(value), "responseValue"))
+	}
+
+	m, err := decodeLDAPMessage(newLDAPMessagePacket(op))
+	if err != nil {
+		return message.IntermediateResponse{}, err
+	}
+
+	res, ok := m.ProtocolOp().(message.IntermediateResponse)
+	if !ok {
+		return message.IntermediateResponse{}, xerrors.Errorf("Unexpected protocolOp. op: %v", m.ProtocolOpName())
+	}
+	return res, nil
+}
+
+// compileFilter returns the filter parsed from the string representation (e.g. "(uid=foo)").
+func compileFilter(filter string) (message.Filter, error) {
+	fp, err := goldap.CompileFilter(filter)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid filter: %s, err: %w", filter, err)
+	}
+	f, err := decodeFilter(fp.Bytes())
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decode filter: %s, err: %w", filter, err)
+	}
+	return f, nil
+}
+
+// decodeFilter returns the filter decoded from the BER encoded Filter (e.g. the value of the assertion control).
+func decodeFilter(b []byte) (message.Filter, error) {
+	fpacket, err := ber.DecodePacketErr(b)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decode filter packet. err: %w", err)
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, message.TagSearchRequest, nil, "Search Request")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "baseObject"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 0, "scope"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, 0, "derefAliases"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "sizeLimit"))
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "timeLimit"))
+	op.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "typesOnly"))
+	op.AppendChild(fpacket)
+	op.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes"))
+
+	m, err := decodeLDAPMessage(newLDAPMessagePacket(op))
+	if err != nil {
+		return nil, err
+	}
+
+	req, ok := m.ProtocolOp().(message.SearchRequest)
+	if !ok {
+		return nil, xerrors.Errorf("Unexpected protocolOp. op: %v", m.ProtocolOpName())
+	}
+	return req.Filter(), nil
+}
+
+// newControl returns the control with the controlValue encoded by the caller.
+// The criticality is omitted if it's false and the controlValue is omitted if it's nil.
+func newControl(oid string, criticality bool, value []byte) (message.Control, error) {
+	cp := newControlPacket(oid, criticality, value)
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, message.TagSearchResultDone, nil, "Search Result Done")
+	appendLDAPResultPacket(op, 0)
+
+	m, err := decodeLDAPMessage(newLDAPMessagePacket(op, cp))
+	if err != nil {
+		return message.Control{}, err
+	}
+
+	controls := m.Controls()
+	if controls == nil || len(*controls) != 1 {
+		return message.Control{}, xerrors.Errorf("Unexpected controls. oid: %s", oid)
+	}
+	return (*controls)[0], nil
+}
+
+func newControlPacket(oid string, criticality bool, value []byte) *ber.Packet {
+	cp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	cp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, oid, "controlType"))
+	if criticality {
+		cp.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, criticality, "criticality"))
+	}
+	if value != nil {
+		cp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(value), "controlValue"))
+	}
+	return cp
+}
+
+// encodeControl returns the BER encoded control.
+// It's used when the controls are returned in the value (e.g. the end transaction response).
+func encodeControl(c message.Control) *ber.Packet {
+	var value []byte
+	if c.ControlValue() != nil {
+		value = []byte(*c.ControlValue())
+	}
+	return newControlPacket(string(c.ControlType()), bool(c.Criticality()), value)
+}
+
+// resultCode returns the result code of the response.
+// goldap doesn't provide the getter, so we encode the response then read the first component.
+func resultCode(po message.ProtocolOp) (int, bool) {
+	b, err := message.NewLDAPMessageWithProtocolOp(po).Write()
+	if err != nil {
+		return 0, false
+	}
+
+	// LDAPMessage => [messageID, protocolOp => [resultCode, ...]]
+	packet, err := ber.DecodePacketErr(b.Bytes())
+	if err != nil || len(packet.Children) < 2 || len(packet.Children[1].Children) == 0 {
+		return 0, false
+	}
+
+	code, ok := packet.Children[1].Children[0].Value.(int64)
+	if !ok {
+		return 0, false
+	}
+	return int(code), true
+}
+
+// encodeSearchResultEntry returns the BER encoded SearchResultEntry.
+// It's used as the value of the controls which return the entry (e.g. post-read control).
+func encodeSearchResultEntry(dn string, e message.SearchResultEntry) []byte {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, message.TagSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "objectName"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, a := range e.Attributes() {
+		ap := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PartialAttribute")
+		ap.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(a.Type_()), "type"))
+
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range a.Vals() {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(v), "value"))
+		}
+		ap.AppendChild(vals)
+
+		attrs.AppendChild(ap)
+	}
+	op.AppendChild(attrs)
+
+	return op.Bytes()
+}
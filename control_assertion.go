@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// LDAP Assertion Control
+// https://datatracker.ietf.org/doc/html/rfc4528
+const (
+	AssertionControlOID = "1.3.6.1.1.12"
+
+	LDAPResultAssertionFailed = 122
+)
+
+func init() {
+	RegisterSupportedControl(AssertionControlOID, nil)
+}
+
+const assertionContextKey contextKey = "assertion"
+
+func SetAssertionContext(parent context.Context, filter message.Filter) context.Context {
+	return context.WithValue(parent, assertionContextKey, filter)
+}
+
+func AssertionContext(ctx context.Context) (message.Filter, bool) {
+	filter, ok := ctx.Value(assertionContextKey).(message.Filter)
+	return filter, ok
+}
+
+// parseAssertionControl returns the filter of the assertion control.
+// It returns nil if the control isn't requested.
+//
+//	controlValue ::= Filter
+func parseAssertionControl(m *ldap.Message) (message.Filter, error) {
+	if m.Controls() == nil {
+		return nil, nil
+	}
+
+	for _, con := range *m.Controls() {
+		if string(con.ControlType()) != AssertionControlOID {
+			continue
+		}
+
+		if con.ControlValue() == nil {
+			return nil, NewProtocolError("assertion control value is required")
+		}
+
+		filter, err := decodeFilter([]byte(*con.ControlValue()))
+		if err != nil {
+			return nil, NewProtocolError("invalid assertion control value")
+		}
+		return filter, nil
+	}
+
+	return nil, nil
+}
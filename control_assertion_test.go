@@ -0,0 +1,58 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newMessageWithControl(t *testing.T, oid string, criticality bool, value []byte) *ldap.Message {
+	op := ber.NewString(ber.ClassApplication, ber.TypePrimitive, message.TagDelRequest, "uid=user1,dc=example,dc=com", "Del Request")
+
+	var controls []*ber.Packet
+	if oid != "" {
+		cp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+		cp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, oid, "controlType"))
+		if criticality {
+			cp.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "criticality"))
+		}
+		cp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(value), "controlValue"))
+		controls = append(controls, cp)
+	}
+
+	m, err := decodeLDAPMessage(newLDAPMessagePacket(op, controls...))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding message: %+v", err)
+	}
+	return &ldap.Message{LDAPMessage: m}
+}
+
+func TestParseAssertionControl(t *testing.T) {
+	fp, err := goldap.CompileFilter("(&(objectClass=inetOrgPerson)(sn=foo))")
+	if err != nil {
+		t.Fatalf("Unexpected error on CompileFilter: %+v", err)
+	}
+
+	filter, err := parseAssertionControl(newMessageWithControl(t, AssertionControlOID, true, fp.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error on parseAssertionControl: %+v", err)
+	}
+	if f, ok := filter.(message.FilterAnd); !ok || len(f) != 2 {
+		t.Errorf("Unexpected filter: %#v", filter)
+	}
+
+	filter, err = parseAssertionControl(newMessageWithControl(t, "", false, nil))
+	if err != nil || filter != nil {
+		t.Errorf("Unexpected result without the control. filter: %#v, err: %+v", filter, err)
+	}
+
+	_, err = parseAssertionControl(newMessageWithControl(t, AssertionControlOID, true, []byte("invalid")))
+	if err == nil {
+		t.Errorf("Unexpected success of parsing invalid filter")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// ManageDsaIT Control
+// https://datatracker.ietf.org/doc/html/rfc3296#section-3
+const ManageDsaITControlOID = "2.16.840.1.113730.3.4.2"
+
+func init() {
+	RegisterSupportedControl(ManageDsaITControlOID, nil)
+}
+
+// hasManageDsaITControl returns whether the request has the ManageDsaIT control.
+// With the control, the referral entries are managed as the normal entries.
+// The control doesn't have the control value.
+func hasManageDsaITControl(m *ldap.Message) bool {
+	if m.Controls() == nil {
+		return false
+	}
+
+	for _, con := range *m.Controls() {
+		if string(con.ControlType()) == ManageDsaITControlOID {
+			return true
+		}
+	}
+	return false
+}
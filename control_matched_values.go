@@ -0,0 +1,252 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/openstandia/goldap/message"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// Lightweight Directory Access Protocol (LDAP): Matched Values Control
+// https://datatracker.ietf.org/doc/html/rfc3876
+const MatchedValuesControlOID = "1.2.826.0.1.3344810.2.3"
+
+func init() {
+	RegisterSupportedControl(MatchedValuesControlOID, nil)
+}
+
+// parseMatchedValuesControl returns the simple filter items of the matched values control.
+// Each item is decoded as the search filter since the choice tags are the same as the filter.
+//
+//	ValuesReturnFilter ::= SEQUENCE OF SimpleFilterItem
+//
+//	SimpleFilterItem ::= CHOICE {
+//	        equalityMatch   [3] AttributeValueAssertion,
+//	        substrings      [4] SubstringFilter,
+//	        greaterOrEqual  [5] AttributeValueAssertion,
+//	        lessOrEqual     [6] AttributeValueAssertion,
+//	        present         [7] AttributeDescription,
+//	        approxMatch     [8] AttributeValueAssertion,
+//	        extensibleMatch [9] SimpleMatchingAssertion }
+func parseMatchedValuesControl(con *message.Control) ([]message.Filter, error) {
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("matched values control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence {
+		return nil, NewProtocolError("invalid matched values control value")
+	}
+	if len(packet.Children) == 0 {
+		return nil, NewProtocolError("matched values control requires at least one filter item")
+	}
+
+	filters := make([]message.Filter, len(packet.Children))
+
+	for i, v := range packet.Children {
+		// and, or and not aren't allowed
+		if v.ClassType != ber.ClassContext || v.Tag < 3 || v.Tag > 9 {
+			return nil, NewProtocolError("invalid matched values filter item")
+		}
+
+		f, err := decodeFilter(v.Bytes())
+		if err != nil {
+			log.Printf("info: Invalid matched values filter item. err: %v", err)
+			return nil, NewProtocolError("invalid matched values filter item")
+		}
+		filters[i] = f
+	}
+
+	return filters, nil
+}
+
+// filterMatchedValues returns the entry which has only the values matching the filter items.
+// The attribute which isn't referred by any filter item returns all values,
+// and the attribute which has no matched value isn't returned.
+func (s *Server) filterMatchedValues(filters []message.Filter, entry *SearchEntry) *SearchEntry {
+	attrs := make(map[string][]string, len(entry.GetAttrsOrig()))
+
+	for k, v := range entry.GetAttrsOrig() {
+		at, ok := s.schemaMap.AttributeType(k)
+		if !ok {
+			attrs[k] = v
+			continue
+		}
+
+		items := matchedValuesFilterItems(s.schemaMap, filters, at)
+		if len(items) == 0 {
+			attrs[k] = v
+			continue
+		}
+
+		var matched []string
+		for _, vv := range v {
+			for _, f := range items {
+				if matchValue(at, f, vv) {
+					matched = append(matched, vv)
+					break
+				}
+			}
+		}
+
+		if len(matched) > 0 {
+			attrs[k] = matched
+		}
+	}
+
+	filtered := NewSearchEntry(entry.schemaMap, entry.DNOrig(), attrs)
+	filtered.base = entry.base
+	return filtered
+}
+
+// matchedValuesFilterItems returns the filter items which refer to the attribute type.
+// The extensible match item isn't supported, it doesn't refer to any attribute type.
+func matchedValuesFilterItems(schemaMap *SchemaMap, filters []message.Filter, at *AttributeType) []message.Filter {
+	var items []message.Filter
+
+	for _, f := range filters {
+		if s, ok := schemaMap.AttributeType(filterItemAttributeName(f)); ok && s.Name == at.Name {
+			items = append(items, f)
+		}
+	}
+
+	return items
+}
+
+// filterItemAttributeName returns the attribute description of the simple filter item.
+func filterItemAttributeName(f message.Filter) string {
+	switch ff := f.(type) {
+	case message.FilterEqualityMatch:
+		return string(ff.AttributeDesc())
+	case message.FilterSubstrings:
+		return string(ff.Type_())
+	case message.FilterGreaterOrEqual:
+		return string(ff.AttributeDesc())
+	case message.FilterLessOrEqual:
+		return string(ff.AttributeDesc())
+	case message.FilterPresent:
+		return string(ff)
+	case message.FilterApproxMatch:
+		return string(ff.AttributeDesc())
+	}
+	return ""
+}
+
+// matchValue evaluates the filter item against the value with the normalized values.
+// The item which can't be evaluated is treated as Undefined, it means the value doesn't match.
+func matchValue(at *AttributeType, f message.Filter, value string) bool {
+	if _, ok := f.(message.FilterPresent); ok {
+		return true
+	}
+
+	sv, err := NewSchemaValue(at.schemaDef, at.Name, []string{value})
+	if err != nil {
+		log.Printf("warn: Unexpected normalization error of the stored value. attrName: %s, value: %s, err: %v", at.Name, value, err)
+		return false
+	}
+	norm := sv.NormStr()[0]
+
+	switch ff := f.(type) {
+	case message.FilterEqualityMatch:
+		av, err := NewSchemaValue(at.schemaDef, at.Name, []string{string(ff.AssertionValue())})
+		if err != nil {
+			return false
+		}
+		return norm == av.NormStr()[0]
+
+	case message.FilterApproxMatch:
+		return strings.Contains(norm, normalizeSubstringValue(at, string(ff.AssertionValue())))
+
+	case message.FilterSubstrings:
+		initial, middle, final := substringValues(at, ff)
+		return matchSubstrings(norm, initial, middle, final)
+
+	case message.FilterGreaterOrEqual:
+		c, ok := compareOrdering(at, sv, string(ff.AssertionValue()))
+		return ok && c >= 0
+
+	case message.FilterLessOrEqual:
+		c, ok := compareOrdering(at, sv, string(ff.AssertionValue()))
+		return ok && c <= 0
+	}
+
+	log.Printf("info: Unsupported matched values filter item, treat as undefined. attrName: %s, filter: %#v", at.Name, f)
+	return false
+}
+
+// substringValues returns the normalized initial, middle and final values of the substrings filter.
+func substringValues(at *AttributeType, f message.FilterSubstrings) (string, []string, string) {
+	var initial, final string
+	var middle []string
+
+	for _, fs := range f.Substrings() {
+		switch fsv := fs.(type) {
+		case message.SubstringInitial:
+			initial = normalizeSubstringValue(at, string(fsv))
+		case message.SubstringAny:
+			middle = append(middle, normalizeSubstringValue(at, string(fsv)))
+		case message.SubstringFinal:
+			final = normalizeSubstringValue(at, string(fsv))
+		}
+	}
+
+	return initial, middle, final
+}
+
+// normalizeSubstringValue returns the normalized value of the substring.
+// The substring of DN or time isn't always valid as the value, it falls back to the case insensitive form.
+func normalizeSubstringValue(at *AttributeType, value string) string {
+	sv, err := NewSchemaValue(at.schemaDef, at.Name, []string{value})
+	if err != nil {
+		return strings.ToLower(normalizeSpace(value))
+	}
+	return sv.NormStr()[0]
+}
+
+func matchSubstrings(value, initial string, middle []string, final string) bool {
+	if !strings.HasPrefix(value, initial) {
+		return false
+	}
+	rest := value[len(initial):]
+
+	for _, v := range middle {
+		i := strings.Index(rest, v)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(v):]
+	}
+
+	return strings.HasSuffix(rest, final)
+}
+
+// compareOrdering compares the value with the assertion value by the ordering rule.
+// It returns false if the attribute doesn't have the ordering rule.
+func compareOrdering(at *AttributeType, sv *SchemaValue, assertion string) (int, bool) {
+	if at.Ordering == "" {
+		return 0, false
+	}
+
+	av, err := NewSchemaValue(at.schemaDef, at.Name, []string{assertion})
+	if err != nil {
+		return 0, false
+	}
+
+	if at.IsNumberOrdering() {
+		v, ok1 := sv.Norm()[0].(int64)
+		a, ok2 := av.Norm()[0].(int64)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch {
+		case v < a:
+			return -1, true
+		case v > a:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	return strings.Compare(sv.NormStr()[0], av.NormStr()[0]), true
+}
@@ -0,0 +1,152 @@
+//go:build test
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newMatchedValuesControlValue(t *testing.T, filters ...string) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ValuesReturnFilter")
+	for _, f := range filters {
+		fp, err := goldap.CompileFilter(f)
+		if err != nil {
+			t.Fatalf("Unexpected error on CompileFilter: %+v", err)
+		}
+		packet.AppendChild(ber.DecodePacket(fp.Bytes()))
+	}
+	return packet.Bytes()
+}
+
+func TestParseMatchedValuesControl(t *testing.T) {
+	con, err := newControl(MatchedValuesControlOID, true, newMatchedValuesControlValue(t, "(member=uid=user*)", "(cn=foo)"))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	filters, err := parseMatchedValuesControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseMatchedValuesControl: %+v", err)
+	}
+	if len(filters) != 2 {
+		t.Errorf("Unexpected filters: %#v", filters)
+	}
+
+	// The filter item doesn't allow and, or and not
+	con, err = newControl(MatchedValuesControlOID, true, newMatchedValuesControlValue(t, "(&(cn=foo)(sn=bar))"))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseMatchedValuesControl(&con); err == nil {
+		t.Errorf("Unexpected success of parsing and filter")
+	}
+
+	con, err = newControl(MatchedValuesControlOID, true, newMatchedValuesControlValue(t))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseMatchedValuesControl(&con); err == nil {
+		t.Errorf("Unexpected success of parsing empty filter")
+	}
+}
+
+func TestFilterMatchedValues(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	entry := NewSearchEntry(server.schemaMap, "cn=group1,ou=Groups,dc=example,dc=com", map[string][]string{
+		"cn": {"group1"},
+		"member": {
+			"uid=user1,ou=Users,dc=example,dc=com",
+			"uid=User2,ou=Users,dc=example,dc=com",
+			"uid=admin1,ou=Admins,dc=example,dc=com",
+		},
+		"description": {"Foo", "Bar"},
+	})
+
+	testcases := []struct {
+		Filters []string
+		Expect  map[string][]string
+	}{
+		{
+			[]string{"(member=uid=user*)"},
+			map[string][]string{
+				"cn":          {"group1"},
+				"member":      {"uid=user1,ou=Users,dc=example,dc=com", "uid=User2,ou=Users,dc=example,dc=com"},
+				"description": {"Foo", "Bar"},
+			},
+		},
+		{
+			[]string{"(member=uid=ADMIN1,ou=admins,dc=example,dc=com)", "(description=foo)"},
+			map[string][]string{
+				"cn":          {"group1"},
+				"member":      {"uid=admin1,ou=Admins,dc=example,dc=com"},
+				"description": {"Foo"},
+			},
+		},
+		{
+			[]string{"(member=*,ou=Users,dc=example,dc=com)", "(description=*a*)", "(cn=*)"},
+			map[string][]string{
+				"cn":          {"group1"},
+				"member":      {"uid=user1,ou=Users,dc=example,dc=com", "uid=User2,ou=Users,dc=example,dc=com"},
+				"description": {"Bar"},
+			},
+		},
+		{
+			// The attribute which has no matched value isn't returned
+			[]string{"(description=baz)"},
+			map[string][]string{
+				"cn": {"group1"},
+				"member": {
+					"uid=user1,ou=Users,dc=example,dc=com",
+					"uid=User2,ou=Users,dc=example,dc=com",
+					"uid=admin1,ou=Admins,dc=example,dc=com",
+				},
+			},
+		},
+	}
+
+	for i, tc := range testcases {
+		con, err := newControl(MatchedValuesControlOID, true, newMatchedValuesControlValue(t, tc.Filters...))
+		if err != nil {
+			t.Fatalf("Unexpected error on newControl: %+v", err)
+		}
+		filters, err := parseMatchedValuesControl(&con)
+		if err != nil {
+			t.Fatalf("Unexpected error on parseMatchedValuesControl: %+v", err)
+		}
+
+		e := server.filterMatchedValues(filters, entry)
+		if !reflect.DeepEqual(e.GetAttrsOrig(), tc.Expect) {
+			t.Errorf("Unexpected attributes on %d: %v", i, e.GetAttrsOrig())
+		}
+	}
+}
+
+func TestMatchSubstrings(t *testing.T) {
+	testcases := []struct {
+		Value   string
+		Initial string
+		Middle  []string
+		Final   string
+		Expect  bool
+	}{
+		{"uid=user1,ou=users", "uid=", nil, "", true},
+		{"uid=user1,ou=users", "", []string{"user", "ou"}, "users", true},
+		{"uid=user1,ou=users", "", []string{"ou", "user1"}, "", false},
+		{"uid=user1,ou=users", "", []string{"users"}, "users", false},
+		{"foo", "foo", nil, "foo", false},
+	}
+
+	for i, tc := range testcases {
+		if got := matchSubstrings(tc.Value, tc.Initial, tc.Middle, tc.Final); got != tc.Expect {
+			t.Errorf("Unexpected result on %d: %v", i, got)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// Persistent Search: A Simple LDAP Change Notification Mechanism
+// https://datatracker.ietf.org/doc/html/draft-ietf-ldapext-psearch-03
+const (
+	PersistentSearchControlOID        = "2.16.840.1.113730.3.4.3"
+	EntryChangeNotificationControlOID = "2.16.840.1.113730.3.4.7"
+)
+
+func init() {
+	RegisterSupportedControl(PersistentSearchControlOID, nil)
+}
+
+const (
+	ChangeTypeAdd    = 1
+	ChangeTypeDelete = 2
+	ChangeTypeModify = 4
+	ChangeTypeModDN  = 8
+)
+
+// The buffer size of the entry changes for each persistent search
+const entryChangeBufferSize = 1000
+
+// PersistentSearchControl is the parsed persistent search request control.
+//
+//	PersistentSearch ::= SEQUENCE {
+//	        changeTypes INTEGER,
+//	        changesOnly BOOLEAN,
+//	        returnECs BOOLEAN }
+type PersistentSearchControl struct {
+	ChangeTypes int
+	ChangesOnly bool
+	ReturnECs   bool
+}
+
+func parsePersistentSearchControl(con *message.Control) (*PersistentSearchControl, error) {
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("persistent search control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence || len(packet.Children) != 3 {
+		return nil, NewProtocolError("invalid persistent search control value")
+	}
+
+	changeTypes, ok := packet.Children[0].Value.(int64)
+	if !ok || changeTypes < ChangeTypeAdd || changeTypes > ChangeTypeAdd|ChangeTypeDelete|ChangeTypeModify|ChangeTypeModDN {
+		return nil, NewProtocolError("invalid persistent search changeTypes")
+	}
+	changesOnly, ok := packet.Children[1].Value.(bool)
+	if !ok {
+		return nil, NewProtocolError("invalid persistent search changesOnly")
+	}
+	returnECs, ok := packet.Children[2].Value.(bool)
+	if !ok {
+		return nil, NewProtocolError("invalid persistent search returnECs")
+	}
+
+	return &PersistentSearchControl{
+		ChangeTypes: int(changeTypes),
+		ChangesOnly: changesOnly,
+		ReturnECs:   returnECs,
+	}, nil
+}
+
+// newEntryChangeNotificationControl returns the entry change notification control.
+// The previous DN is included only for the modDN.
+//
+//	EntryChangeNotification ::= SEQUENCE {
+//	        changeType ENUMERATED { ... },
+//	        previousDN   LDAPDN OPTIONAL,
+//	        changeNumber INTEGER OPTIONAL }
+func newEntryChangeNotificationControl(change *EntryChange) (message.Control, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "EntryChangeNotification")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, change.ChangeType, "changeType"))
+	if change.ChangeType == ChangeTypeModDN && change.PreviousDN != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, change.PreviousDN, "previousDN"))
+	}
+
+	c, err := newControl(EntryChangeNotificationControlOID, false, packet.Bytes())
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create entry change notification control. err: %w", err)
+	}
+	return c, nil
+}
+
+// EntryChangeHub dispatches the entry changes to the running persistent searches.
+type EntryChangeHub struct {
+	mutex       sync.RWMutex
+	subscribers map[*EntryChangeSubscription]struct{}
+}
+
+// EntryChangeSubscription receives the entry changes from the hub.
+// Overflowed is closed when a change is dropped since the buffer is full,
+// then the subscriber can't follow all changes anymore.
+type EntryChangeSubscription struct {
+	Changes    chan *EntryChange
+	Overflowed chan struct{}
+	once       sync.Once
+}
+
+func NewEntryChangeHub() *EntryChangeHub {
+	return &EntryChangeHub{
+		subscribers: map[*EntryChangeSubscription]struct{}{},
+	}
+}
+
+func (h *EntryChangeHub) Subscribe() *EntryChangeSubscription {
+	sub := &EntryChangeSubscription{
+		Changes:    make(chan *EntryChange, entryChangeBufferSize),
+		Overflowed: make(chan struct{}),
+	}
+
+	h.mutex.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mutex.Unlock()
+
+	return sub
+}
+
+func (h *EntryChangeHub) Unsubscribe(sub *EntryChangeSubscription) {
+	h.mutex.Lock()
+	delete(h.subscribers, sub)
+	h.mutex.Unlock()
+}
+
+// Publish sends the change to all subscribers.
+// The change is dropped for the slow subscriber to avoid blocking others, and the subscriber is notified of the overflow.
+func (h *EntryChangeHub) Publish(change *EntryChange) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for sub := range h.subscribers {
+		select {
+		case sub.Changes <- change:
+		default:
+			log.Printf("warn: Dropped the entry change for the slow persistent search. id: %d, dn: %s", change.ID, change.DNOrig)
+			sub.once.Do(func() {
+				close(sub.Overflowed)
+			})
+		}
+	}
+}
+
+// listenEntryChanges listens the entry changes from the repository and keeps listening even if an error occurs.
+func (s *Server) listenEntryChanges() {
+	for {
+		if err := s.Repo().ListenEntryChanges(context.Background(), s.entryChanges.Publish); err != nil {
+			log.Printf("error: Failed to listen entry changes, retry after 10 seconds. err: %+v", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// persistentSearch returns the entries of the initial search if requested,
+// then keeps returning the changed entries which match the search until the request is abandoned.
+func (s *Server) persistentSearch(ctx context.Context, w ldap.ResponseWriter, m *ldap.Message, baseDN *DN, option *SearchOption,
+	sizeLimit int, c *PersistentSearchControl, handler func(entry *SearchEntry, controls *message.Controls) error) {
+
+	// Subscribe before the initial search not to miss the changes
+	sub := s.entryChanges.Subscribe()
+	defer s.entryChanges.Unsubscribe(sub)
+
+	// The size limit and time limit are applied to the initial search only
+	if !c.ChangesOnly {
+		initialHandler := sizeLimitedHandler(sizeLimit, handler)
+		for {
+			count, nextID, err := s.Repo().Search(ctx, baseDN, option, func(entry *SearchEntry) error {
+				return initialHandler(entry, nil)
+			})
+			if err != nil {
+				responseSearchError(w, err)
+				return
+			}
+			if count <= option.PageSize {
+				break
+			}
+			*option.Cursor = nextID
+		}
+	}
+	option.Deadline = time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Print("info: Leaving persistent search...")
+			w.Write(ldap.NewSearchResultDoneResponse(LDAPResultCanceled))
+			return
+
+		case <-sub.Overflowed:
+			// The client needs to restart the search since some changes were dropped
+			log.Print("warn: Leaving persistent search due to too many changes...")
+			responseSearchError(w, NewAdminLimitExceeded("too many changes to follow, restart the persistent search"))
+			return
+
+		case change := <-sub.Changes:
+			if c.ChangeTypes&change.ChangeType == 0 || !s.isChangeInNamingContext(baseDN, change) {
+				continue
+			}
+
+			var controls *message.Controls
+			if c.ReturnECs {
+				ec, err := newEntryChangeNotificationControl(change)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				controls = &message.Controls{ec}
+			}
+
+			if err := s.searchEntryChange(ctx, baseDN, option, change, func(entry *SearchEntry) error {
+				return handler(entry, controls)
+			}); err != nil {
+				responseSearchError(w, err)
+				return
+			}
+		}
+	}
+}
+
+// searchEntryChange executes the handler if the changed entry matches the search.
+// The deleted entry is evaluated in the server since it was already deleted from the repository.
+func (s *Server) searchEntryChange(ctx context.Context, baseDN *DN, option *SearchOption, change *EntryChange, handler func(entry *SearchEntry) error) error {
+	if change.ChangeType == ChangeTypeDelete {
+		dn, err := s.NormalizeDN(resolveSuffix(change.Base, change.DNOrig))
+		if err != nil {
+			log.Printf("warn: Invalid DN of the deleted entry. dn: %s, err: %v", change.DNOrig, err)
+			return nil
+		}
+		if !isInScope(baseDN, option.Scope, dn) {
+			return nil
+		}
+
+		attrs := change.AttrsOrig
+		if attrs == nil {
+			// The attributes were dropped due to the size limit of the notification, match by the scope only
+			attrs = map[string][]string{}
+		} else if !matchEntry(s.schemaMap, option.Filter, attrs) {
+			return nil
+		}
+		entry := NewSearchEntry(s.schemaMap, change.DNOrig, attrs)
+		entry.base = change.Base
+		return handler(entry)
+	}
+
+	var cursor int64
+	o := *option
+	o.EntryID = change.ID
+	o.Cursor = &cursor
+	o.PageSize = 1
+
+	_, _, err := s.Repo().Search(ctx, baseDN, &o, handler)
+	return err
+}
+
+func isInScope(baseDN *DN, scope int, dn *DN) bool {
+	switch scope {
+	case 0:
+		return dn.Equal(baseDN)
+	case 1:
+		return len(dn.RDNs) > 1 && dn.ParentDN().Equal(baseDN)
+	case 2:
+		return dn.Equal(baseDN) || dn.IsSubOf(baseDN)
+	case 3:
+		return dn.IsSubOf(baseDN)
+	}
+	return false
+}
+
+// matchEntry evaluates the filter against the attributes of the entry in the server.
+// The association attributes aren't evaluated since they are stored separately.
+func matchEntry(schemaMap *SchemaMap, f message.Filter, attrs map[string][]string) bool {
+	switch ff := f.(type) {
+	case message.FilterAnd:
+		for _, child := range ff {
+			if !matchEntry(schemaMap, child, attrs) {
+				return false
+			}
+		}
+		return true
+	case message.FilterOr:
+		for _, child := range ff {
+			if matchEntry(schemaMap, child, attrs) {
+				return true
+			}
+		}
+		return false
+	case message.FilterNot:
+		return !matchEntry(schemaMap, ff.Filter, attrs)
+	}
+
+	at, options, ok := schemaMap.AttributeDescription(filterItemAttributeName(f))
+	if !ok {
+		return false
+	}
+
+	// The filter of the attribute type matches the subtypes too, e.g. cn matches cn;lang-ja
+	for _, values := range attrsOrigWithSubtypes(attrs, at.Name+options) {
+		if matchValues(schemaMap, at, f, values) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValues evaluates the filter item against the values of the attribute.
+func matchValues(schemaMap *SchemaMap, at *AttributeType, f message.Filter, values []string) bool {
+	// Use the normalized values of all values, e.g. objectClass has the superior classes.
+	// The first normalized value of the assertion is the requested one.
+	if eq, ok := f.(message.FilterEqualityMatch); ok {
+		sv, err := NewSchemaValue(schemaMap, at.Name, values)
+		if err != nil {
+			return false
+		}
+		av, err := NewSchemaValue(schemaMap, at.Name, []string{string(eq.AssertionValue())})
+		if err != nil {
+			return false
+		}
+		for _, v := range sv.NormStr() {
+			if v == av.NormStr()[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, v := range values {
+		if matchValue(at, f, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newPersistentSearchControlValue(changeTypes int64, changesOnly, returnECs bool) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PersistentSearch")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, changeTypes, "changeTypes"))
+	packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, changesOnly, "changesOnly"))
+	packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, returnECs, "returnECs"))
+	return packet.Bytes()
+}
+
+func TestParsePersistentSearchControl(t *testing.T) {
+	con, err := newControl(PersistentSearchControlOID, true, newPersistentSearchControlValue(ChangeTypeAdd|ChangeTypeModDN, true, false))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	pc, err := parsePersistentSearchControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parsePersistentSearchControl: %+v", err)
+	}
+	if pc.ChangeTypes != 9 || !pc.ChangesOnly || pc.ReturnECs {
+		t.Errorf("Unexpected control: %#v", pc)
+	}
+
+	for _, changeTypes := range []int64{0, 16} {
+		con, err = newControl(PersistentSearchControlOID, true, newPersistentSearchControlValue(changeTypes, false, true))
+		if err != nil {
+			t.Fatalf("Unexpected error on newControl: %+v", err)
+		}
+		if _, err := parsePersistentSearchControl(&con); err == nil {
+			t.Errorf("Unexpected success of parsing changeTypes: %d", changeTypes)
+		}
+	}
+}
+
+func TestNewEntryChangeNotificationControl(t *testing.T) {
+	c, err := newEntryChangeNotificationControl(&EntryChange{
+		ChangeType: ChangeTypeModDN,
+		PreviousDN: "uid=user1,ou=Users,dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if string(c.ControlType()) != EntryChangeNotificationControlOID {
+		t.Errorf("Unexpected control type: %s", c.ControlType())
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 2 ||
+		packet.Children[0].Value.(int64) != ChangeTypeModDN ||
+		packet.Children[1].Value.(string) != "uid=user1,ou=Users,dc=example,dc=com" {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+
+	// The previous DN is returned only for the modDN
+	c, err = newEntryChangeNotificationControl(&EntryChange{
+		ChangeType: ChangeTypeModify,
+		PreviousDN: "uid=user1,ou=Users,dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	packet, err = ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 1 || packet.Children[0].Value.(int64) != ChangeTypeModify {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
+
+func TestIsInScope(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	baseDN, _ := server.NormalizeDN("ou=Users,dc=example,dc=com")
+	child, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+	grandchild, _ := server.NormalizeDN("cn=foo,uid=user1,ou=Users,dc=example,dc=com")
+	other, _ := server.NormalizeDN("uid=user1,ou=Groups,dc=example,dc=com")
+
+	testcases := []struct {
+		Scope  int
+		DN     *DN
+		Expect bool
+	}{
+		{0, baseDN, true},
+		{0, child, false},
+		{1, baseDN, false},
+		{1, child, true},
+		{1, grandchild, false},
+		{2, baseDN, true},
+		{2, grandchild, true},
+		{2, other, false},
+		{3, baseDN, false},
+		{3, child, true},
+	}
+
+	for i, tc := range testcases {
+		if got := isInScope(baseDN, tc.Scope, tc.DN); got != tc.Expect {
+			t.Errorf("Unexpected result on %d: %v", i, got)
+		}
+	}
+}
+
+func TestMatchEntry(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	attrs := map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"uid":         {"User1"},
+		"sn":          {"Foo"},
+		"cn":          {"Foo Bar"},
+		"cn;lang-ja":  {"山田 太郎"},
+	}
+
+	testcases := []struct {
+		Filter string
+		Expect bool
+	}{
+		{"(uid=user1)", true},
+		{"(objectClass=person)", true},
+		{"(objectClass=groupOfNames)", false},
+		{"(&(uid=user1)(cn=foo*))", true},
+		{"(&(uid=user1)(cn=*baz))", false},
+		{"(|(uid=user2)(sn=*o*))", true},
+		{"(!(uid=user1))", false},
+		{"(mail=*)", false},
+		{"(unknown=foo)", false},
+		{"(cn=山田*)", true},
+		{"(cn;lang-ja=山田 太郎)", true},
+		{"(cn;lang-ja=foo bar)", false},
+		{"(cn;lang-en=*)", false},
+	}
+
+	for _, tc := range testcases {
+		f, err := compileFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("Unexpected error on compileFilter: %+v", err)
+		}
+		if got := matchEntry(server.schemaMap, f, attrs); got != tc.Expect {
+			t.Errorf("Unexpected result on %s: %v", tc.Filter, got)
+		}
+	}
+}
+
+func TestEntryChangeHub(t *testing.T) {
+	hub := NewEntryChangeHub()
+
+	sub1 := hub.Subscribe()
+	sub2 := hub.Subscribe()
+
+	hub.Publish(&EntryChange{ChangeType: ChangeTypeAdd, ID: 1})
+
+	for _, sub := range []*EntryChangeSubscription{sub1, sub2} {
+		select {
+		case c := <-sub.Changes:
+			if c.ID != 1 {
+				t.Errorf("Unexpected change: %#v", c)
+			}
+		default:
+			t.Errorf("Not received the change")
+		}
+	}
+
+	hub.Unsubscribe(sub2)
+	hub.Publish(&EntryChange{ChangeType: ChangeTypeDelete, ID: 2})
+
+	if len(sub1.Changes) != 1 || len(sub2.Changes) != 0 {
+		t.Errorf("Unexpected received changes: %d, %d", len(sub1.Changes), len(sub2.Changes))
+	}
+}
+
+func TestEntryChangeHubOverflow(t *testing.T) {
+	hub := NewEntryChangeHub()
+
+	sub := hub.Subscribe()
+	defer hub.Unsubscribe(sub)
+
+	for i := 0; i < entryChangeBufferSize; i++ {
+		hub.Publish(&EntryChange{ChangeType: ChangeTypeModify, ID: int64(i)})
+	}
+	select {
+	case <-sub.Overflowed:
+		t.Errorf("Unexpected overflow within the buffer size")
+	default:
+	}
+
+	// Dropped changes close the overflow channel only once
+	hub.Publish(&EntryChange{ChangeType: ChangeTypeModify, ID: entryChangeBufferSize})
+	hub.Publish(&EntryChange{ChangeType: ChangeTypeModify, ID: entryChangeBufferSize + 1})
+	select {
+	case <-sub.Overflowed:
+	default:
+		t.Errorf("Not notified the overflow")
+	}
+	if len(sub.Changes) != entryChangeBufferSize {
+		t.Errorf("Unexpected buffered changes: %d", len(sub.Changes))
+	}
+}
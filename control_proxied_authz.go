@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+)
+
+// Lightweight Directory Access Protocol (LDAP) Proxied Authorization Control
+// https://datatracker.ietf.org/doc/html/rfc4370
+const (
+	ProxiedAuthzControlOID = "2.16.840.1.113730.3.4.18"
+
+	LDAPResultAuthorizationDenied = 123
+)
+
+func init() {
+	RegisterSupportedControl(ProxiedAuthzControlOID, nil)
+}
+
+// parseProxiedAuthzControl returns the authorization identity of the proxied authorization control.
+// It returns false if the control isn't requested. The empty authzId means anonymous.
+//
+//	controlValue ::= authzId
+func parseProxiedAuthzControl(m *ldap.Message) (string, bool, error) {
+	if m.Controls() == nil {
+		return "", false, nil
+	}
+
+	for _, con := range *m.Controls() {
+		if string(con.ControlType()) != ProxiedAuthzControlOID {
+			continue
+		}
+
+		// The criticality must be TRUE
+		if !con.Criticality() {
+			return "", false, NewProtocolError("proxied authorization control must be critical")
+		}
+
+		if con.ControlValue() == nil {
+			return "", true, nil
+		}
+
+		authzID := string(*con.ControlValue())
+		if authzID != "" && !strings.HasPrefix(authzID, "dn:") && !strings.HasPrefix(authzID, "u:") {
+			return "", false, NewProtocolError("invalid proxied authorization identity")
+		}
+		return authzID, true, nil
+	}
+
+	return "", false, nil
+}
+
+// resolveProxiedAuthSession returns the session of the proxied authorization identity.
+// The bound identity requires the proxy permission of the simple ACL.
+func (s *Server) resolveProxiedAuthSession(ctx context.Context, session *AuthSession, authzID string) (*AuthSession, error) {
+	if session.DN == nil || !s.simpleACL.CanProxy(session) {
+		log.Printf("info: Not allowed proxied authorization. authzId: %s", authzID)
+		return nil, NewAuthorizationDenied()
+	}
+
+	// Anonymous
+	if authzID == "" {
+		return &AuthSession{}, nil
+	}
+
+	dn, err := s.resolveAuthcID(ctx, authzID)
+	if err != nil {
+		var lerr *LDAPError
+		if ok := xerrors.As(err, &lerr); ok {
+			log.Printf("info: Unknown proxied authorization identity. authzId: %s, err: %v", authzID, err)
+			return nil, NewAuthorizationDenied()
+		}
+		return nil, err
+	}
+
+	// Only the root can proxy as the root
+	if dn.Equal(s.GetRootDN()) {
+		if !session.IsRoot {
+			log.Printf("info: Not allowed proxied authorization as the root. authzId: %s", authzID)
+			return nil, NewAuthorizationDenied()
+		}
+		return &AuthSession{DN: dn, IsRoot: true}, nil
+	}
+
+	groups, found, err := s.findGroupsByDN(ctx, dn)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		log.Printf("info: Not found proxied authorization identity. authzId: %s", authzID)
+		return nil, NewAuthorizationDenied()
+	}
+
+	return &AuthSession{DN: dn, Groups: groups}, nil
+}
+
+// findGroupsByDN returns the DN of the groups which the entry is a member of.
+func (s *Server) findGroupsByDN(ctx context.Context, dn *DN) ([]*DN, bool, error) {
+	f, err := compileFilter("(objectClass=*)")
+	if err != nil {
+		return nil, false, err
+	}
+
+	var cursor int64
+	var found bool
+	var groups []*DN
+
+	_, _, err = s.Repo().Search(ctx, dn, &SearchOption{
+		Scope:               0, // base
+		Filter:              f,
+		PageSize:            1,
+		Cursor:              &cursor,
+		IsMemberOfRequested: true,
+	}, func(entry *SearchEntry) error {
+		found = true
+		if _, v, ok := entry.GetAttrOrig("memberOf"); ok {
+			for _, g := range v {
+				gdn, err := s.NormalizeDN(g)
+				if err != nil {
+					return xerrors.Errorf("Invalid memberOf. dn_norm: %s, memberOf: %s, err: %w", dn.DNNormStr(), g, err)
+				}
+				groups = append(groups, gdn)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var lerr *LDAPError
+		if ok := xerrors.As(err, &lerr); ok && lerr.IsNoSuchObjectError() {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return groups, found, nil
+}
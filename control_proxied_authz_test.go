@@ -0,0 +1,97 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func TestParseProxiedAuthzControl(t *testing.T) {
+	testcases := []struct {
+		Message *ldap.Message
+		AuthzID string
+		Found   bool
+		Code    int
+	}{
+		{
+			newMessageWithControl(t, ProxiedAuthzControlOID, true, []byte("dn:uid=user1,dc=example,dc=com")),
+			"dn:uid=user1,dc=example,dc=com",
+			true,
+			ldap.LDAPResultSuccess,
+		},
+		{
+			newMessageWithControl(t, ProxiedAuthzControlOID, true, []byte("u:user1")),
+			"u:user1",
+			true,
+			ldap.LDAPResultSuccess,
+		},
+		// Anonymous
+		{
+			newMessageWithControl(t, ProxiedAuthzControlOID, true, []byte("")),
+			"",
+			true,
+			ldap.LDAPResultSuccess,
+		},
+		{
+			newMessageWithControl(t, "", false, nil),
+			"",
+			false,
+			ldap.LDAPResultSuccess,
+		},
+		// The criticality must be TRUE
+		{
+			newMessageWithControl(t, ProxiedAuthzControlOID, false, []byte("dn:uid=user1,dc=example,dc=com")),
+			"",
+			false,
+			ldap.LDAPResultProtocolError,
+		},
+		{
+			newMessageWithControl(t, ProxiedAuthzControlOID, true, []byte("uid=user1,dc=example,dc=com")),
+			"",
+			false,
+			ldap.LDAPResultProtocolError,
+		},
+	}
+
+	for i, tc := range testcases {
+		authzID, found, err := parseProxiedAuthzControl(tc.Message)
+		if tc.Code != ldap.LDAPResultSuccess {
+			lerr, ok := err.(*LDAPError)
+			if !ok || lerr.Code != tc.Code {
+				t.Errorf("Unexpected error on %d: %+v", i, err)
+			}
+			continue
+		}
+		if err != nil || authzID != tc.AuthzID || found != tc.Found {
+			t.Errorf("Unexpected result on %d: authzId: %s, found: %v, err: %+v", i, authzID, found, err)
+		}
+	}
+}
+
+func TestCanProxy(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+		SimpleACL: []string{
+			"cn=portal,dc=example,dc=com:RWP:",
+			"cn=writer,dc=example,dc=com:RW:",
+		},
+	})
+	server.LoadSchema()
+
+	acl, err := NewSimpleACL(server)
+	if err != nil {
+		t.Fatalf("Unexpected error on NewSimpleACL: %+v", err)
+	}
+
+	portal, _ := server.NormalizeDN("cn=portal,dc=example,dc=com")
+	writer, _ := server.NormalizeDN("cn=writer,dc=example,dc=com")
+
+	if !acl.CanProxy(&AuthSession{DN: portal}) {
+		t.Errorf("Expected the portal can proxy")
+	}
+	if acl.CanProxy(&AuthSession{DN: writer}) {
+		t.Errorf("Unexpected the writer can proxy")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// LDAP Read Entry Controls
+// https://datatracker.ietf.org/doc/html/rfc4527
+const (
+	PreReadControlOID  = "1.3.6.1.1.13.1"
+	PostReadControlOID = "1.3.6.1.1.13.2"
+)
+
+func init() {
+	RegisterSupportedControl(PreReadControlOID, nil)
+	RegisterSupportedControl(PostReadControlOID, nil)
+}
+
+const readEntryContextKey contextKey = "readEntry"
+
+// ReadEntryControl is the parsed pre-read or post-read request control.
+type ReadEntryControl struct {
+	Criticality bool
+	Attributes  message.AttributeSelection
+}
+
+// ReadEntryRequest holds the requested read entry controls of the update operation.
+// The repository sets the entries read in the transaction of the operation.
+type ReadEntryRequest struct {
+	PreRead       *ReadEntryControl
+	PostRead      *ReadEntryControl
+	PreReadEntry  *SearchEntry
+	PostReadEntry *SearchEntry
+}
+
+func SetReadEntryContext(parent context.Context, req *ReadEntryRequest) context.Context {
+	return context.WithValue(parent, readEntryContextKey, req)
+}
+
+func ReadEntryContext(ctx context.Context) (*ReadEntryRequest, bool) {
+	req, ok := ctx.Value(readEntryContextKey).(*ReadEntryRequest)
+	return req, ok
+}
+
+// parseReadEntryControls returns the read entry request from the controls.
+// The pre-read control can be used with modify, delete and modifyDN, the post-read control can be used with add, modify and modifyDN.
+// The unsupported control is ignored if it isn't critical.
+func parseReadEntryControls(m *ldap.Message, allowPreRead, allowPostRead bool) (*ReadEntryRequest, error) {
+	if m.Controls() == nil {
+		return nil, nil
+	}
+
+	var req *ReadEntryRequest
+
+	for _, con := range *m.Controls() {
+		oid := string(con.ControlType())
+		if oid != PreReadControlOID && oid != PostReadControlOID {
+			continue
+		}
+
+		if (oid == PreReadControlOID && !allowPreRead) || (oid == PostReadControlOID && !allowPostRead) {
+			if con.Criticality() {
+				return nil, NewUnavailableCriticalExtension(oid)
+			}
+			log.Printf("info: Ignore unsupported read entry control: %s", oid)
+			continue
+		}
+
+		c, err := parseReadEntryControl(&con)
+		if err != nil {
+			return nil, err
+		}
+
+		if req == nil {
+			req = &ReadEntryRequest{}
+		}
+		if oid == PreReadControlOID {
+			req.PreRead = c
+		} else {
+			req.PostRead = c
+		}
+	}
+
+	return req, nil
+}
+
+// parseReadEntryControl parses the control value which is AttributeSelection.
+//
+//	controlValue ::= SEQUENCE OF LDAPString
+func parseReadEntryControl(con *message.Control) (*ReadEntryControl, error) {
+	c := &ReadEntryControl{
+		Criticality: bool(con.Criticality()),
+	}
+
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("read entry control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence {
+		return nil, NewProtocolError("invalid read entry control value")
+	}
+
+	for _, v := range packet.Children {
+		c.Attributes = append(c.Attributes, message.LDAPString(v.Data.String()))
+	}
+
+	return c, nil
+}
+
+// readEntryResponseControls returns the response controls with the entries read by the repository.
+func (s *Server) readEntryResponseControls(ctx context.Context, req *ReadEntryRequest) (*message.Controls, error) {
+	if req == nil {
+		return nil, nil
+	}
+
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var controls message.Controls
+
+	if req.PreRead != nil && req.PreReadEntry != nil {
+		c, err := s.newReadEntryResponseControl(session, PreReadControlOID, req.PreRead, req.PreReadEntry)
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, c)
+	}
+
+	if req.PostRead != nil && req.PostReadEntry != nil {
+		c, err := s.newReadEntryResponseControl(session, PostReadControlOID, req.PostRead, req.PostReadEntry)
+		if err != nil {
+			return nil, err
+		}
+		controls = append(controls, c)
+	}
+
+	if len(controls) == 0 {
+		return nil, nil
+	}
+	return &controls, nil
+}
+
+func (s *Server) newReadEntryResponseControl(session *AuthSession, oid string, c *ReadEntryControl, entry *SearchEntry) (message.Control, error) {
+	e := newSearchResultEntry(s, session, c.Attributes, entry)
+
+	control, err := newControl(oid, false, encodeSearchResultEntry(entry.DNOrigWithSuffix(), e))
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create read entry response control. err: %w", err)
+	}
+	return control, nil
+}
+
+// writeWithReadEntry writes the response with the read entry response controls if requested.
+func (s *Server) writeWithReadEntry(ctx context.Context, w ldap.ResponseWriter, res message.ProtocolOp, req *ReadEntryRequest) {
+	controls, err := s.readEntryResponseControls(ctx, req)
+	if err != nil {
+		// The operation was already committed, return the response without the controls
+		log.Printf("error: Failed to create read entry response controls. err: %+v", err)
+	}
+
+	if controls != nil {
+		w.WriteControls(res, controls)
+	} else {
+		w.Write(res)
+	}
+}
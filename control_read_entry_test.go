@@ -0,0 +1,80 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newReadEntryControlValue(attrs ...string) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "AttributeSelection")
+	for _, a := range attrs {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a, "attribute"))
+	}
+	return packet.Bytes()
+}
+
+func TestParseReadEntryControl(t *testing.T) {
+	con, err := newControl(PostReadControlOID, true, newReadEntryControlValue("cn", "+"))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	c, err := parseReadEntryControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseReadEntryControl: %+v", err)
+	}
+	if !c.Criticality || len(c.Attributes) != 2 || c.Attributes[0] != "cn" || c.Attributes[1] != "+" {
+		t.Errorf("Unexpected control: %#v", c)
+	}
+
+	// Empty selection means all user attributes
+	con, err = newControl(PreReadControlOID, false, newReadEntryControlValue())
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	c, err = parseReadEntryControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseReadEntryControl: %+v", err)
+	}
+	if c.Criticality || len(c.Attributes) != 0 {
+		t.Errorf("Unexpected control: %#v", c)
+	}
+
+	con, err = newControl(PreReadControlOID, false, []byte("invalid"))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseReadEntryControl(&con); err == nil {
+		t.Errorf("Unexpected success of parsing invalid control value")
+	}
+}
+
+func TestEncodeSearchResultEntry(t *testing.T) {
+	e := ldap.NewSearchResultEntry("uid=user1,dc=example,dc=com")
+	e.AddAttribute("cn", message.AttributeValue("user1"))
+	e.AddAttribute("mail", message.AttributeValue("user1@example.com"), message.AttributeValue("user1@example.org"))
+
+	packet, err := ber.DecodePacketErr(encodeSearchResultEntry("uid=user1,dc=example,dc=com", e))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if packet.ClassType != ber.ClassApplication || packet.Tag != message.TagSearchResultEntry || len(packet.Children) != 2 {
+		t.Fatalf("Unexpected packet: %s", ber.DecodeString(packet.Bytes()))
+	}
+	if packet.Children[0].Data.String() != "uid=user1,dc=example,dc=com" {
+		t.Errorf("Unexpected dn: %s", packet.Children[0].Data.String())
+	}
+
+	attrs := packet.Children[1].Children
+	if len(attrs) != 2 ||
+		attrs[0].Children[0].Data.String() != "cn" ||
+		len(attrs[1].Children[1].Children) != 2 ||
+		attrs[1].Children[1].Children[1].Data.String() != "user1@example.org" {
+		t.Errorf("Unexpected attributes: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
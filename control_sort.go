@@ -0,0 +1,139 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// Server Side Sorting of Search Results
+// https://datatracker.ietf.org/doc/html/rfc2891
+const (
+	SortRequestControlOID  = "1.2.840.113556.1.4.473"
+	SortResponseControlOID = "1.2.840.113556.1.4.474"
+)
+
+func init() {
+	RegisterSupportedControl(SortRequestControlOID, nil)
+}
+
+// SortKeyRequest is the sort key requested by the client.
+//
+//	SortKeyList ::= SEQUENCE OF SEQUENCE {
+//	           attributeType   AttributeDescription,
+//	           orderingRule    [0] MatchingRuleId OPTIONAL,
+//	           reverseOrder    [1] BOOLEAN DEFAULT FALSE }
+type SortKeyRequest struct {
+	AttributeType string
+	OrderingRule  string
+	ReverseOrder  bool
+}
+
+// SortControl is the parsed server side sort request control.
+type SortControl struct {
+	Criticality bool
+	Keys        []*SortKeyRequest
+}
+
+func parseSortControl(con *message.Control) (*SortControl, error) {
+	c := &SortControl{
+		Criticality: bool(con.Criticality()),
+	}
+
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("sort control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence {
+		return nil, NewProtocolError("invalid sort control value")
+	}
+	if len(packet.Children) == 0 {
+		return nil, NewProtocolError("sort control requires at least one key")
+	}
+
+	for _, kp := range packet.Children {
+		if len(kp.Children) == 0 || kp.Children[0].Tag != ber.TagOctetString {
+			return nil, NewProtocolError("invalid sort key")
+		}
+
+		key := &SortKeyRequest{
+			AttributeType: kp.Children[0].Data.String(),
+		}
+
+		for _, v := range kp.Children[1:] {
+			if v.ClassType != ber.ClassContext {
+				return nil, NewProtocolError("invalid sort key")
+			}
+			switch v.Tag {
+			case 0:
+				key.OrderingRule = v.Data.String()
+			case 1:
+				key.ReverseOrder = len(v.Data.Bytes()) > 0 && v.Data.Bytes()[0] != 0
+			default:
+				return nil, NewProtocolError("invalid sort key")
+			}
+		}
+
+		c.Keys = append(c.Keys, key)
+	}
+
+	return c, nil
+}
+
+// resolveSortKeys returns the sort keys with the schema.
+// If some key isn't sortable, it returns the sortResult code and the attribute type.
+func (s *Server) resolveSortKeys(keys []*SortKeyRequest) ([]*SortKey, int, string) {
+	sortKeys := make([]*SortKey, len(keys))
+
+	for i, k := range keys {
+		// Attribute options aren't supported for sorting
+		name := strings.SplitN(k.AttributeType, ";", 2)[0]
+
+		sv, ok := s.schemaMap.AttributeType(name)
+		if !ok {
+			log.Printf("info: Unsortable attribute, no such attribute. attr: %s", k.AttributeType)
+			return nil, ldap.LDAPResultNoSuchAttribute, k.AttributeType
+		}
+
+		if !sv.IsSortable() {
+			log.Printf("info: Unsortable attribute, no ordering. attr: %s", k.AttributeType)
+			return nil, ldap.LDAPResultInappropriateMatching, k.AttributeType
+		}
+
+		if k.OrderingRule != "" && !strings.EqualFold(k.OrderingRule, sv.Ordering) {
+			log.Printf("info: Unsortable attribute, unsupported ordering rule. attr: %s, orderingRule: %s", k.AttributeType, k.OrderingRule)
+			return nil, ldap.LDAPResultInappropriateMatching, k.AttributeType
+		}
+
+		sortKeys[i] = &SortKey{
+			AttributeType: sv,
+			ReverseOrder:  k.ReverseOrder,
+		}
+	}
+
+	return sortKeys, ldap.LDAPResultSuccess, ""
+}
+
+// newSortResponseControl returns the sort response control.
+//
+//	SortResult ::= SEQUENCE {
+//	   sortResult  ENUMERATED { ... },
+//	   attributeType [0] AttributeDescription OPTIONAL }
+func newSortResponseControl(code int, attr string) (message.Control, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortResult")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "sortResult"))
+	if attr != "" {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, attr, "attributeType"))
+	}
+
+	c, err := newControl(SortResponseControlOID, false, packet.Bytes())
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create sort response control. err: %w", err)
+	}
+	return c, nil
+}
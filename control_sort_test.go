@@ -0,0 +1,159 @@
+//go:build test
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newSortControlValue(keys ...*SortKeyRequest) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKeyList")
+	for _, k := range keys {
+		kp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKey")
+		kp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, k.AttributeType, "attributeType"))
+		if k.OrderingRule != "" {
+			kp.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, k.OrderingRule, "orderingRule"))
+		}
+		if k.ReverseOrder {
+			kp.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, 1, true, "reverseOrder"))
+		}
+		packet.AppendChild(kp)
+	}
+	return packet.Bytes()
+}
+
+func TestParseSortControl(t *testing.T) {
+	keys := []*SortKeyRequest{
+		{AttributeType: "sn"},
+		{AttributeType: "employeeNumber", OrderingRule: "integerOrderingMatch", ReverseOrder: true},
+	}
+
+	con, err := newControl(SortRequestControlOID, true, newSortControlValue(keys...))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	sc, err := parseSortControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseSortControl: %+v", err)
+	}
+	if !sc.Criticality {
+		t.Errorf("Expected critical")
+	}
+	if !reflect.DeepEqual(sc.Keys, keys) {
+		t.Errorf("Unexpected keys: %#v", sc.Keys)
+	}
+
+	invalid, err := newControl(SortRequestControlOID, false, newSortControlValue())
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseSortControl(&invalid); err == nil {
+		t.Errorf("Unexpected success of parsing empty sort keys")
+	}
+}
+
+func TestResolveSortKeys(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	testcases := []struct {
+		Keys   []*SortKeyRequest
+		Result int
+		Attr   string
+	}{
+		{
+			[]*SortKeyRequest{{AttributeType: "cn"}, {AttributeType: "createTimestamp", ReverseOrder: true}},
+			ldap.LDAPResultSuccess,
+			"",
+		},
+		{
+			[]*SortKeyRequest{{AttributeType: "cn"}, {AttributeType: "unknown"}},
+			ldap.LDAPResultNoSuchAttribute,
+			"unknown",
+		},
+		{
+			[]*SortKeyRequest{{AttributeType: "member"}},
+			ldap.LDAPResultInappropriateMatching,
+			"member",
+		},
+		{
+			[]*SortKeyRequest{{AttributeType: "cn", OrderingRule: "integerOrderingMatch"}},
+			ldap.LDAPResultInappropriateMatching,
+			"cn",
+		},
+	}
+
+	for i, tc := range testcases {
+		keys, result, attr := server.resolveSortKeys(tc.Keys)
+		if result != tc.Result || attr != tc.Attr {
+			t.Errorf("Unexpected result on %d: result: %d, attr: %s", i, result, attr)
+			continue
+		}
+		if result == ldap.LDAPResultSuccess && len(keys) != len(tc.Keys) {
+			t.Errorf("Unexpected keys on %d: %#v", i, keys)
+		}
+	}
+}
+
+func TestNewSortResponseControl(t *testing.T) {
+	c, err := newSortResponseControl(ldap.LDAPResultInappropriateMatching, "cn")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if string(c.ControlType()) != SortResponseControlOID {
+		t.Errorf("Unexpected control type: %s", c.ControlType())
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 2 ||
+		packet.Children[0].Value.(int64) != ldap.LDAPResultInappropriateMatching ||
+		packet.Children[1].Data.String() != "cn" {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
+
+func TestCollectSortCursorSQL(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	keys, _, _ := server.resolveSortKeys([]*SortKeyRequest{{AttributeType: "cn"}, {AttributeType: "createTimestamp", ReverseOrder: true}})
+	r := &HybridRepository{}
+
+	cn := "user1"
+	option := &SearchOption{
+		SortKeys:   keys,
+		SortCursor: &SortCursor{Values: []*string{&cn, nil}, ID: 10},
+	}
+	params := map[string]interface{}{}
+	r.collectSortSQL(option, params)
+
+	cnExpr := sortKeySQL(keys[0], "sortKey0")
+	tsExpr := sortKeySQL(keys[1], "sortKey1")
+	expected := `((` + cnExpr + ` > :sortCursor0 COLLATE "C" OR ` + cnExpr + ` IS NULL)) OR ` +
+		`(` + cnExpr + ` = :sortCursor0 COLLATE "C" AND ` + tsExpr + ` IS NOT NULL) OR ` +
+		`(` + cnExpr + ` = :sortCursor0 COLLATE "C" AND ` + tsExpr + ` IS NULL AND e.id > :sortCursorID)`
+
+	if got := r.collectSortCursorSQL(option, params); got != expected {
+		t.Errorf("Unexpected sort cursor SQL.\nexpected: %s\ngot:      %s", expected, got)
+	}
+	if !reflect.DeepEqual(params, map[string]interface{}{
+		"sortKey0":     "cn",
+		"sortKey1":     "createTimestamp",
+		"sortCursor0":  "user1",
+		"sortCursorID": int64(10),
+	}) {
+		t.Errorf("Unexpected params: %v", params)
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// Lightweight Directory Access Protocol (LDAP) Content Synchronization Operation
+// https://datatracker.ietf.org/doc/html/rfc4533
+const (
+	SyncRequestControlOID = "1.3.6.1.4.1.4203.1.9.1.1"
+	SyncStateControlOID   = "1.3.6.1.4.1.4203.1.9.1.2"
+	SyncDoneControlOID    = "1.3.6.1.4.1.4203.1.9.1.3"
+	SyncInfoMessageOID    = "1.3.6.1.4.1.4203.1.9.1.4"
+)
+
+func init() {
+	RegisterSupportedControl(SyncRequestControlOID, nil)
+}
+
+// e-syncRefreshRequired
+const LDAPResultSyncRefreshRequired = 4096
+
+// The persist stage reads the change log by the notification of the change,
+// and also polls it at this interval since the notification may be lost.
+const syncPollInterval = 30 * time.Second
+
+// The interval for pruning the change log which is older than the retention.
+const changeLogPruneInterval = time.Hour
+
+const (
+	SyncModeRefreshOnly       = 1
+	SyncModeRefreshAndPersist = 3
+)
+
+const (
+	SyncStatePresent = 0
+	SyncStateAdd     = 1
+	SyncStateModify  = 2
+	SyncStateDelete  = 3
+)
+
+// The choice tags of the sync info message
+const (
+	syncInfoNewCookie      = 0
+	syncInfoRefreshDelete  = 1
+	syncInfoRefreshPresent = 2
+)
+
+// SyncRequestControl is the parsed sync request control.
+//
+//	syncRequestValue ::= SEQUENCE {
+//	        mode ENUMERATED {
+//	            -- 0 unused
+//	            refreshOnly       (1),
+//	            -- 2 reserved
+//	            refreshAndPersist (3)
+//	        },
+//	        cookie     syncCookie OPTIONAL,
+//	        reloadHint BOOLEAN DEFAULT FALSE
+//	}
+type SyncRequestControl struct {
+	Mode       int
+	Cookie     *SyncCookie
+	ReloadHint bool
+}
+
+// SyncCookie is the cookie of the content synchronization.
+// The format is compatible with OpenLDAP (e.g. rid=001,csn=20211015123456.123456Z#000001#000#000000).
+// The replica ID is returned as is, and the CSN is the latest change in the change log.
+type SyncCookie struct {
+	RID string
+	CSN string
+}
+
+func parseSyncCookie(cookie string) *SyncCookie {
+	c := &SyncCookie{}
+
+	for _, v := range strings.Split(cookie, ",") {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "rid":
+			c.RID = kv[1]
+		case "csn":
+			// The cookie from the multi-provider has multiple CSNs, use the latest one
+			csns := strings.Split(kv[1], ";")
+			sort.Strings(csns)
+			c.CSN = csns[len(csns)-1]
+		}
+	}
+
+	return c
+}
+
+func (c *SyncCookie) String() string {
+	var s []string
+	if c.RID != "" {
+		s = append(s, "rid="+c.RID)
+	}
+	if c.CSN != "" {
+		s = append(s, "csn="+c.CSN)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseSyncRequestControl(con *message.Control) (*SyncRequestControl, error) {
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("sync request control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence || len(packet.Children) == 0 || len(packet.Children) > 3 {
+		return nil, NewProtocolError("invalid sync request control value")
+	}
+
+	mode, ok := packet.Children[0].Value.(int64)
+	if !ok || (mode != SyncModeRefreshOnly && mode != SyncModeRefreshAndPersist) {
+		return nil, NewProtocolError("invalid sync request mode")
+	}
+
+	c := &SyncRequestControl{
+		Mode:   int(mode),
+		Cookie: &SyncCookie{},
+	}
+
+	for _, v := range packet.Children[1:] {
+		switch v.Tag {
+		case ber.TagOctetString:
+			c.Cookie = parseSyncCookie(v.Data.String())
+		case ber.TagBoolean:
+			b, ok := v.Value.(bool)
+			if !ok {
+				return nil, NewProtocolError("invalid sync request reloadHint")
+			}
+			c.ReloadHint = b
+		default:
+			return nil, NewProtocolError("invalid sync request control value")
+		}
+	}
+
+	return c, nil
+}
+
+// newSyncStateControl returns the sync state control of the entry.
+//
+//	syncStateValue ::= SEQUENCE {
+//	        state ENUMERATED {
+//	            present (0),
+//	            add (1),
+//	            modify (2),
+//	            delete (3)
+//	        },
+//	        entryUUID syncUUID,
+//	        cookie    syncCookie OPTIONAL
+//	}
+func newSyncStateControl(state int, entryUUID string, cookie *SyncCookie) (message.Control, error) {
+	u, err := uuid.Parse(entryUUID)
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Invalid entryUUID. entryUUID: %s, err: %w", entryUUID, err)
+	}
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "syncStateValue")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, state, "state"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(u[:]), "entryUUID"))
+	if cookie != nil && cookie.CSN != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie.String(), "cookie"))
+	}
+
+	c, err := newControl(SyncStateControlOID, false, packet.Bytes())
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create sync state control. err: %w", err)
+	}
+	return c, nil
+}
+
+// newSyncDoneControl returns the sync done control for the refreshOnly mode.
+//
+//	syncDoneValue ::= SEQUENCE {
+//	        cookie          syncCookie OPTIONAL,
+//	        refreshDeletes  BOOLEAN DEFAULT FALSE
+//	}
+func newSyncDoneControl(cookie *SyncCookie, refreshDeletes bool) (message.Control, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "syncDoneValue")
+	if cookie.CSN != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie.String(), "cookie"))
+	}
+	if refreshDeletes {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, refreshDeletes, "refreshDeletes"))
+	}
+
+	c, err := newControl(SyncDoneControlOID, false, packet.Bytes())
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create sync done control. err: %w", err)
+	}
+	return c, nil
+}
+
+// newSyncInfoMessage returns the sync info message which ends the refresh stage of the refreshAndPersist mode.
+// The refreshDone is omitted since it's TRUE by default.
+//
+//	syncInfoValue ::= CHOICE {
+//	        newcookie      [0] syncCookie,
+//	        refreshDelete  [1] SEQUENCE {
+//	            cookie         syncCookie OPTIONAL,
+//	            refreshDone    BOOLEAN DEFAULT TRUE
+//	        },
+//	        refreshPresent [2] SEQUENCE {
+//	            cookie         syncCookie OPTIONAL,
+//	            refreshDone    BOOLEAN DEFAULT TRUE
+//	        },
+//	        ...
+//	}
+func newSyncInfoMessage(tag int, cookie *SyncCookie) (message.IntermediateResponse, error) {
+	var packet *ber.Packet
+	if tag == syncInfoNewCookie {
+		packet = ber.NewString(ber.ClassContext, ber.TypePrimitive, ber.Tag(tag), cookie.String(), "newcookie")
+	} else {
+		packet = ber.Encode(ber.ClassContext, ber.TypeConstructed, ber.Tag(tag), nil, "syncInfoValue")
+		if cookie.CSN != "" {
+			packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie.String(), "cookie"))
+		}
+	}
+
+	res, err := newIntermediateResponse(SyncInfoMessageOID, packet.Bytes())
+	if err != nil {
+		return message.IntermediateResponse{}, xerrors.Errorf("Failed to create sync info message. err: %w", err)
+	}
+	return res, nil
+}
+
+// syncSearch executes the content synchronization.
+// The refresh stage returns the changed entries since the CSN of the cookie if it's found in the change log.
+// Otherwise, it returns all entries as the present phase. Then the persist stage keeps returning the changes
+// in the refreshAndPersist mode until the request is abandoned.
+func (s *Server) syncSearch(ctx context.Context, w ldap.ResponseWriter, m *ldap.Message, baseDN *DN, option *SearchOption,
+	sizeLimit int, c *SyncRequestControl, handler func(entry *SearchEntry, controls *message.Controls) error) {
+
+	// Subscribe before the refresh not to miss the changes.
+	// The notified changes are used only for waking up the persist stage, the changes are read from the change log.
+	// So the overflow of the notification is ignored.
+	var changes chan *EntryChange
+	if c.Mode == SyncModeRefreshAndPersist {
+		sub := s.entryChanges.Subscribe()
+		defer s.entryChanges.Unsubscribe(sub)
+		changes = sub.Changes
+	}
+
+	contextCSN, err := s.Repo().FindContextCSN(ctx, baseDN)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
+	cookie := &SyncCookie{RID: c.Cookie.RID, CSN: contextCSN.CSN}
+
+	// Phase 1: refresh stage, the size limit and time limit are applied to this stage only
+	var refreshDeletes bool
+	refreshHandler := sizeLimitedHandler(sizeLimit, handler)
+
+	if c.Cookie.CSN != "" {
+		entryChanges, ok, err := s.Repo().FindEntryChanges(ctx, baseDN, c.Cookie.CSN, contextCSN)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+
+		if !ok && !c.ReloadHint {
+			log.Printf("info: The CSN of the sync cookie isn't found in the change log. cookie: %s", c.Cookie.String())
+
+			res := ldap.NewSearchResultDoneResponse(LDAPResultSyncRefreshRequired)
+			res.SetDiagnosticMessage("sync cookie is invalid or old, the full refresh is required")
+			w.Write(res)
+			return
+		}
+
+		// The delete phase
+		if ok {
+			for _, change := range entryChanges {
+				if err := s.syncEntryChange(ctx, baseDN, option, change, nil, refreshHandler); err != nil {
+					responseSearchError(w, err)
+					return
+				}
+			}
+			refreshDeletes = true
+		}
+	}
+
+	// The present phase, all entries are returned and the client removes the entries which aren't returned
+	if !refreshDeletes {
+		for {
+			count, nextID, err := s.Repo().Search(ctx, baseDN, option, func(entry *SearchEntry) error {
+				return s.syncEntry(entry, SyncStateAdd, nil, refreshHandler)
+			})
+			if err != nil {
+				responseSearchError(w, err)
+				return
+			}
+			if count <= option.PageSize {
+				break
+			}
+			*option.Cursor = nextID
+		}
+	}
+
+	option.Deadline = time.Time{}
+
+	if c.Mode == SyncModeRefreshOnly {
+		dc, err := newSyncDoneControl(cookie, refreshDeletes)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultSuccess)
+		w.WriteControls(res, &message.Controls{dc})
+		return
+	}
+
+	tag := syncInfoRefreshPresent
+	if refreshDeletes {
+		tag = syncInfoRefreshDelete
+	}
+	info, err := newSyncInfoMessage(tag, cookie)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
+	w.Write(info)
+
+	// Phase 2: persist stage
+	ticker := time.NewTicker(syncPollInterval)
+	defer ticker.Stop()
+
+	last := contextCSN
+	for {
+		select {
+		case <-ctx.Done():
+			log.Print("info: Leaving sync search...")
+			w.Write(ldap.NewSearchResultDoneResponse(LDAPResultCanceled))
+			return
+
+		case change := <-changes:
+			// Already returned
+			if !s.isChangeInNamingContext(baseDN, change) || change.Seq <= last.Seq {
+				continue
+			}
+
+		case <-ticker.C:
+		}
+
+		next, err := s.syncEntryChanges(ctx, baseDN, option, c, last, handler)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		if next == nil {
+			log.Printf("info: The CSN of the last change isn't found in the change log. csn: %s", last.CSN)
+
+			res := ldap.NewSearchResultDoneResponse(LDAPResultSyncRefreshRequired)
+			res.SetDiagnosticMessage("the changes were pruned from the change log, the full refresh is required")
+			w.Write(res)
+			return
+		}
+		last = next
+	}
+}
+
+// syncEntryChanges returns the changes after the last CSN in the change log for the persist stage.
+// It returns the new last CSN, or nil if the last CSN was already pruned from the change log.
+func (s *Server) syncEntryChanges(ctx context.Context, baseDN *DN, option *SearchOption, c *SyncRequestControl, last *ContextCSN,
+	handler func(entry *SearchEntry, controls *message.Controls) error) (*ContextCSN, error) {
+
+	to, err := s.Repo().FindContextCSN(ctx, baseDN)
+	if err != nil {
+		return nil, err
+	}
+	if to.Seq <= last.Seq {
+		return last, nil
+	}
+
+	entryChanges, ok, err := s.Repo().FindEntryChanges(ctx, baseDN, last.CSN, to)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	for _, change := range entryChanges {
+		if err := s.syncEntryChange(ctx, baseDN, option, change, &SyncCookie{RID: c.Cookie.RID, CSN: change.CSN}, handler); err != nil {
+			return nil, err
+		}
+	}
+	return to, nil
+}
+
+// pruneEntryChanges deletes the changes which are older than the retention from the change log periodically.
+func (s *Server) pruneEntryChanges() {
+	retention := s.config.ChangeLogRetention
+
+	for {
+		before := time.Now().AddDate(0, 0, -retention)
+		count, err := s.Repo().PruneEntryChanges(context.Background(), before)
+		if err != nil {
+			log.Printf("error: Failed to prune the change log. err: %+v", err)
+		} else if count > 0 {
+			log.Printf("info: Pruned the change log. count: %d, before: %v", count, before)
+		}
+
+		time.Sleep(changeLogPruneInterval)
+	}
+}
+
+// syncEntryChange returns the changed entry with the sync state.
+// The entry which was deleted or doesn't match the search anymore is returned as deleted with only the DN,
+// the client ignores it if the client doesn't have the entry.
+func (s *Server) syncEntryChange(ctx context.Context, baseDN *DN, option *SearchOption, change *EntryChange, cookie *SyncCookie,
+	handler func(entry *SearchEntry, controls *message.Controls) error) error {
+
+	if change.ChangeType != ChangeTypeDelete {
+		var matched *SearchEntry
+		if err := s.searchEntryChange(ctx, baseDN, option, change, func(entry *SearchEntry) error {
+			matched = entry
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if matched != nil {
+			state := SyncStateAdd
+			if cookie != nil && change.ChangeType != ChangeTypeAdd {
+				// The persist stage distinguishes the modification
+				state = SyncStateModify
+			}
+			return s.syncEntry(matched, state, cookie, handler)
+		}
+	} else {
+		dn, err := s.NormalizeDN(resolveSuffix(change.Base, change.DNOrig))
+		if err != nil {
+			log.Printf("warn: Invalid DN of the deleted entry. dn: %s, err: %v", change.DNOrig, err)
+			return nil
+		}
+		if !isInScope(baseDN, option.Scope, dn) {
+			return nil
+		}
+	}
+
+	sc, err := newSyncStateControl(SyncStateDelete, change.EntryUUID, cookie)
+	if err != nil {
+		log.Printf("warn: Ignore the entry change without valid entryUUID. dn: %s, err: %v", change.DNOrig, err)
+		return nil
+	}
+	entry := NewSearchEntry(s.schemaMap, change.DNOrig, map[string][]string{})
+	entry.base = change.Base
+	return handler(entry, &message.Controls{sc})
+}
+
+// syncEntry returns the entry with the sync state control.
+func (s *Server) syncEntry(entry *SearchEntry, state int, cookie *SyncCookie, handler func(entry *SearchEntry, controls *message.Controls) error) error {
+	_, entryUUID, ok := entry.GetAttrOrig("entryUUID")
+	if !ok {
+		log.Printf("warn: Ignore the entry without entryUUID. dn: %s", entry.DNOrig())
+		return nil
+	}
+
+	sc, err := newSyncStateControl(state, entryUUID[0], cookie)
+	if err != nil {
+		log.Printf("warn: Ignore the entry without valid entryUUID. dn: %s, err: %v", entry.DNOrig(), err)
+		return nil
+	}
+	return handler(entry, &message.Controls{sc})
+}
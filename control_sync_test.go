@@ -0,0 +1,166 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newSyncRequestControlValue(mode int64, cookie string, reloadHint bool) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "syncRequestValue")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, mode, "mode"))
+	if cookie != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie, "cookie"))
+	}
+	if reloadHint {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, reloadHint, "reloadHint"))
+	}
+	return packet.Bytes()
+}
+
+func TestParseSyncRequestControl(t *testing.T) {
+	con, err := newControl(SyncRequestControlOID, true, newSyncRequestControlValue(SyncModeRefreshAndPersist, "rid=001,csn=20211015123456.123456Z#000001#000#000000", true))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	sc, err := parseSyncRequestControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseSyncRequestControl: %+v", err)
+	}
+	if sc.Mode != SyncModeRefreshAndPersist || !sc.ReloadHint ||
+		sc.Cookie.RID != "001" || sc.Cookie.CSN != "20211015123456.123456Z#000001#000#000000" {
+		t.Errorf("Unexpected control: %#v, cookie: %#v", sc, sc.Cookie)
+	}
+
+	con, err = newControl(SyncRequestControlOID, true, newSyncRequestControlValue(SyncModeRefreshOnly, "", false))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	sc, err = parseSyncRequestControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseSyncRequestControl: %+v", err)
+	}
+	if sc.Mode != SyncModeRefreshOnly || sc.ReloadHint || sc.Cookie.CSN != "" {
+		t.Errorf("Unexpected control: %#v", sc)
+	}
+
+	// 2 is reserved
+	con, err = newControl(SyncRequestControlOID, true, newSyncRequestControlValue(2, "", false))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseSyncRequestControl(&con); err == nil {
+		t.Errorf("Unexpected success of parsing reserved mode")
+	}
+}
+
+func TestParseSyncCookie(t *testing.T) {
+	testcases := []struct {
+		Cookie string
+		RID    string
+		CSN    string
+		String string
+	}{
+		{"rid=001", "001", "", "rid=001"},
+		{"rid=001,sid=002,csn=20211015123456.123456Z#000001#000#000000", "001", "20211015123456.123456Z#000001#000#000000", "rid=001,csn=20211015123456.123456Z#000001#000#000000"},
+		{"csn=20211015123456.123456Z#000001#000#000000;20211016123456.123456Z#000001#001#000000", "", "20211016123456.123456Z#000001#001#000000", "csn=20211016123456.123456Z#000001#001#000000"},
+		{"", "", "", ""},
+	}
+
+	for i, tc := range testcases {
+		c := parseSyncCookie(tc.Cookie)
+		if c.RID != tc.RID || c.CSN != tc.CSN || c.String() != tc.String {
+			t.Errorf("Unexpected cookie on %d: %#v, %s", i, c, c.String())
+		}
+	}
+}
+
+func TestNewSyncStateControl(t *testing.T) {
+	c, err := newSyncStateControl(SyncStateModify, "0b05df74-1219-495d-9d95-dc0c05e00aa9", &SyncCookie{RID: "001", CSN: "20211015123456.123456Z#000001#000#000000"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if string(c.ControlType()) != SyncStateControlOID {
+		t.Errorf("Unexpected control type: %s", c.ControlType())
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 3 ||
+		packet.Children[0].Value.(int64) != SyncStateModify ||
+		packet.Children[1].Data.Len() != 16 ||
+		packet.Children[2].Data.String() != "rid=001,csn=20211015123456.123456Z#000001#000#000000" {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+
+	if _, err := newSyncStateControl(SyncStateAdd, "invalid", nil); err == nil {
+		t.Errorf("Unexpected success of invalid entryUUID")
+	}
+}
+
+func TestNewSyncDoneControl(t *testing.T) {
+	c, err := newSyncDoneControl(&SyncCookie{CSN: "20211015123456.123456Z#000001#000#000000"}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 2 ||
+		packet.Children[0].Data.String() != "csn=20211015123456.123456Z#000001#000#000000" ||
+		packet.Children[1].Value.(bool) != true {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+
+	// The empty cookie and the default refreshDeletes are omitted
+	c, err = newSyncDoneControl(&SyncCookie{RID: "001"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	packet, err = ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 0 {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
+
+func TestNewSyncInfoMessage(t *testing.T) {
+	res, err := newSyncInfoMessage(syncInfoRefreshDelete, &SyncCookie{CSN: "20211015123456.123456Z#000001#000#000000"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	b, err := message.NewLDAPMessageWithProtocolOp(res).Write()
+	if err != nil {
+		t.Fatalf("Unexpected error on encoding: %+v", err)
+	}
+
+	// LDAPMessage => IntermediateResponse => [responseName, responseValue]
+	m, err := ber.DecodePacketErr(b.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	op := m.Children[1]
+	if len(op.Children) != 2 || op.Children[0].Data.String() != SyncInfoMessageOID {
+		t.Fatalf("Unexpected response: %s", ber.DecodeString(op.Bytes()))
+	}
+
+	packet, err := ber.DecodePacketErr(op.Children[1].Data.Bytes())
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if packet.ClassType != ber.ClassContext || packet.Tag != syncInfoRefreshDelete || len(packet.Children) != 1 ||
+		packet.Children[0].Data.String() != "csn=20211015123456.123456Z#000001#000#000000" {
+		t.Errorf("Unexpected response value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
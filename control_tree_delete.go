@@ -0,0 +1,28 @@
+package main
+
+import (
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// Tree Delete Control
+// https://datatracker.ietf.org/doc/html/draft-armijo-ldap-treedelete-02
+const TreeDeleteControlOID = "1.2.840.113556.1.4.805"
+
+func init() {
+	RegisterSupportedControl(TreeDeleteControlOID, nil)
+}
+
+// hasTreeDeleteControl returns whether the delete request has the tree delete control.
+// The control doesn't have the control value.
+func hasTreeDeleteControl(m *ldap.Message) bool {
+	if m.Controls() == nil {
+		return false
+	}
+
+	for _, con := range *m.Controls() {
+		if string(con.ControlType()) == TreeDeleteControlOID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+)
+
+func TestHasTreeDeleteControl(t *testing.T) {
+	if !hasTreeDeleteControl(newMessageWithControl(t, TreeDeleteControlOID, false, nil)) {
+		t.Errorf("Expected the tree delete control")
+	}
+	if hasTreeDeleteControl(newMessageWithControl(t, "", false, nil)) {
+		t.Errorf("Unexpected tree delete control")
+	}
+}
+
+func TestCanTreeDelete(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+		SimpleACL: []string{
+			"cn=admin,dc=example,dc=com:RWD:",
+			"cn=writer,dc=example,dc=com:RW:",
+		},
+	})
+	server.LoadSchema()
+
+	acl, err := NewSimpleACL(server)
+	if err != nil {
+		t.Fatalf("Unexpected error on NewSimpleACL: %+v", err)
+	}
+
+	admin, _ := server.NormalizeDN("cn=admin,dc=example,dc=com")
+	writer, _ := server.NormalizeDN("cn=writer,dc=example,dc=com")
+
+	if !acl.CanTreeDelete(&AuthSession{DN: admin}) {
+		t.Errorf("Expected the admin can delete the subtree")
+	}
+	if acl.CanTreeDelete(&AuthSession{DN: writer}) {
+		t.Errorf("Unexpected the writer can delete the subtree")
+	}
+	if !acl.CanTreeDelete(&AuthSession{DN: writer, IsRoot: true}) {
+		t.Errorf("Expected the root can delete the subtree")
+	}
+}
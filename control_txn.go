@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// Lightweight Directory Access Protocol (LDAP) Transactions
+// https://datatracker.ietf.org/doc/html/rfc5805
+const (
+	StartTransactionOID                = "1.3.6.1.1.21.1"
+	TransactionSpecificationControlOID = "1.3.6.1.1.21.2"
+	EndTransactionOID                  = "1.3.6.1.1.21.3"
+)
+
+func init() {
+	RegisterSupportedControl(TransactionSpecificationControlOID, nil)
+	RegisterSupportedExtension(StartTransactionOID, nil)
+	RegisterSupportedExtension(EndTransactionOID, nil)
+}
+
+// The max number of the update operations queued in one transaction
+const maxTxnOperations = 1000
+
+// Transaction holds the update operations queued in the LDAP transaction.
+// They are applied in one repository transaction when the transaction is committed.
+type Transaction struct {
+	ID         string
+	mutex      sync.Mutex
+	operations []*TxnOperation
+}
+
+// TxnOperation is the queued update operation to the DN.
+// The context keeps the auth session and the controls of the request.
+type TxnOperation struct {
+	MessageID int
+	DN        *DN
+	ctx       context.Context
+	readEntry *ReadEntryRequest
+	execute   func(ctx context.Context) error
+}
+
+// Queue appends the update operation to the transaction.
+func (t *Transaction) Queue(ctx context.Context, m *ldap.Message, dn *DN, readEntry *ReadEntryRequest, execute func(ctx context.Context) error) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.operations) >= maxTxnOperations {
+		return NewAdminLimitExceeded("too many operations in the transaction")
+	}
+
+	t.operations = append(t.operations, &TxnOperation{
+		MessageID: m.MessageID().Int(),
+		DN:        dn,
+		ctx:       ctx,
+		readEntry: readEntry,
+		execute:   execute,
+	})
+	return nil
+}
+
+// Operations returns the queued update operations in the requested order.
+func (t *Transaction) Operations() []*TxnOperation {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.operations
+}
+
+// TxnSession holds the outstanding transactions of the connection.
+type TxnSession struct {
+	mutex sync.Mutex
+	txns  map[string]*Transaction
+}
+
+func getTxnSession(m *ldap.Message) *TxnSession {
+	session := getSession(m)
+	if txnSession, ok := session["txn"]; ok {
+		return txnSession.(*TxnSession)
+	} else {
+		txnSession := &TxnSession{
+			txns: map[string]*Transaction{},
+		}
+		session["txn"] = txnSession
+		return txnSession
+	}
+}
+
+// Start returns the new transaction with the unique identifier.
+func (s *TxnSession) Start() *Transaction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	txn := &Transaction{
+		ID: uuid.New().String(),
+	}
+	s.txns[txn.ID] = txn
+	return txn
+}
+
+// Get returns the outstanding transaction by the identifier.
+func (s *TxnSession) Get(id string) (*Transaction, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	txn, ok := s.txns[id]
+	return txn, ok
+}
+
+// End removes the transaction, it can't be used after that.
+func (s *TxnSession) End(id string) (*Transaction, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	txn, ok := s.txns[id]
+	if ok {
+		delete(s.txns, id)
+	}
+	return txn, ok
+}
+
+// lookupTransaction returns the transaction specified by the transaction specification control.
+// It returns nil if the request doesn't have the control.
+//
+//	controlValue ::= txnID
+func lookupTransaction(m *ldap.Message) (*Transaction, error) {
+	if m.Controls() == nil {
+		return nil, nil
+	}
+
+	for _, con := range *m.Controls() {
+		if string(con.ControlType()) != TransactionSpecificationControlOID {
+			continue
+		}
+
+		if con.ControlValue() == nil {
+			return nil, NewProtocolError("transaction specification control value is required")
+		}
+
+		txn, ok := getTxnSession(m).Get(string(*con.ControlValue()))
+		if !ok {
+			return nil, NewUnwillingToPerform("invalid transaction identifier")
+		}
+		return txn, nil
+	}
+
+	return nil, nil
+}
+
+// joinedContext is the context of the queued operation which joins the transaction.
+// The values are looked up from the context of the operation first, then the context of the transaction.
+type joinedContext struct {
+	context.Context
+	txn context.Context
+}
+
+func joinContext(op, txn context.Context) context.Context {
+	return &joinedContext{
+		Context: op,
+		txn:     txn,
+	}
+}
+
+func (c *joinedContext) Deadline() (time.Time, bool) {
+	return c.txn.Deadline()
+}
+
+func (c *joinedContext) Done() <-chan struct{} {
+	return c.txn.Done()
+}
+
+func (c *joinedContext) Err() error {
+	return c.txn.Err()
+}
+
+func (c *joinedContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.txn.Value(key)
+}
@@ -0,0 +1,137 @@
+//go:build test
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newEndTransactionRequestValue(commit *bool, id string) *message.OCTETSTRING {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "txnEndReq")
+	if commit != nil {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, *commit, "commit"))
+	}
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, id, "identifier"))
+
+	v := message.OCTETSTRING(packet.Bytes())
+	return &v
+}
+
+func TestParseEndTransactionRequest(t *testing.T) {
+	f := false
+
+	testcases := []struct {
+		Value  *message.OCTETSTRING
+		Commit bool
+		ID     string
+	}{
+		{newEndTransactionRequestValue(nil, "txn1"), true, "txn1"},
+		{newEndTransactionRequestValue(&f, "txn2"), false, "txn2"},
+	}
+
+	for i, tc := range testcases {
+		commit, id, err := parseEndTransactionRequest(tc.Value)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+		if commit != tc.Commit || id != tc.ID {
+			t.Errorf("Unexpected result on %d: %v, %s", i, commit, id)
+		}
+	}
+
+	if _, _, err := parseEndTransactionRequest(nil); err == nil {
+		t.Errorf("Unexpected success of parsing no value")
+	}
+}
+
+func TestTransactionQueue(t *testing.T) {
+	txn := &Transaction{ID: "txn1"}
+
+	for i := 1; i <= maxTxnOperations; i++ {
+		lm := message.NewLDAPMessage()
+		lm.SetMessageID(i)
+
+		if err := txn.Queue(context.Background(), &ldap.Message{LDAPMessage: lm}, nil, nil, func(ctx context.Context) error {
+			return nil
+		}); err != nil {
+			t.Fatalf("Unexpected error on queueing %d: %+v", i, err)
+		}
+	}
+
+	ops := txn.Operations()
+	if len(ops) != maxTxnOperations || ops[0].MessageID != 1 || ops[maxTxnOperations-1].MessageID != maxTxnOperations {
+		t.Errorf("Unexpected operations: %d", len(ops))
+	}
+
+	lm := message.NewLDAPMessage()
+	lm.SetMessageID(maxTxnOperations + 1)
+	if err := txn.Queue(context.Background(), &ldap.Message{LDAPMessage: lm}, nil, nil, func(ctx context.Context) error {
+		return nil
+	}); err == nil {
+		t.Errorf("Unexpected success of queueing over the limit")
+	}
+}
+
+func TestJoinContext(t *testing.T) {
+	op := context.WithValue(context.Background(), authContextKey, &AuthSession{})
+	txn, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("tx"), "tx"))
+
+	ctx := joinContext(op, txn)
+
+	if _, err := AuthSessionContext(ctx); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+	if v := ctx.Value(contextKey("tx")); v != "tx" {
+		t.Errorf("Unexpected value of the transaction: %v", v)
+	}
+
+	cancel()
+	if ctx.Err() == nil {
+		t.Errorf("Not canceled by the transaction")
+	}
+}
+
+func TestEncodeControl(t *testing.T) {
+	c, err := newControl(PostReadControlOID, true, []byte("value"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	packet := encodeControl(c)
+	if len(packet.Children) != 3 ||
+		packet.Children[0].Value.(string) != PostReadControlOID ||
+		packet.Children[1].Value.(bool) != true ||
+		packet.Children[2].Value.(string) != "value" {
+		t.Errorf("Unexpected control: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
+
+func TestTxnNamingContextDN(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners:partners"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	user1, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+	user2, _ := server.NormalizeDN("uid=user2,ou=Users,dc=example,dc=com")
+	partner, _ := server.NormalizeDN("uid=user1,o=partners")
+
+	if dn, err := server.txnNamingContextDN(nil); dn != nil || err != nil {
+		t.Errorf("Unexpected result without operations: %v, err: %v", dn, err)
+	}
+	if dn, err := server.txnNamingContextDN([]*TxnOperation{{DN: user1}, {DN: user2}}); dn != user1 || err != nil {
+		t.Errorf("Unexpected result in one naming context: %v, err: %v", dn, err)
+	}
+
+	_, err := server.txnNamingContextDN([]*TxnOperation{{DN: user1}, {DN: partner}})
+	if lerr, ok := err.(*LDAPError); !ok || lerr.Code != ldap.LDAPResultAffectsMultipleDSAs {
+		t.Errorf("Expected affectsMultipleDSAs, got: %v", err)
+	}
+}
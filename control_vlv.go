@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// LDAP Extensions for Scrolling View Browsing of Search Results
+// https://datatracker.ietf.org/doc/html/draft-ietf-ldapext-ldapv3-vlv-09
+const (
+	VLVRequestControlOID  = "2.16.840.1.113730.3.4.9"
+	VLVResponseControlOID = "2.16.840.1.113730.3.4.10"
+
+	LDAPResultSortControlMissing = 60
+	LDAPResultOffsetRangeError   = 61
+)
+
+func init() {
+	RegisterSupportedControl(VLVRequestControlOID, nil)
+}
+
+// VLVControl is the parsed virtual list view request control.
+//
+//	VirtualListViewRequest ::= SEQUENCE {
+//	       beforeCount    INTEGER (0..maxInt),
+//	       afterCount     INTEGER (0..maxInt),
+//	       target       CHOICE {
+//	                      byOffset        [0] SEQUENCE {
+//	                           offset          INTEGER (1 .. maxInt),
+//	                           contentCount    INTEGER (0 .. maxInt) },
+//	                      greaterThanOrEqual [1] AssertionValue },
+//	       contextID     OCTET STRING OPTIONAL }
+type VLVControl struct {
+	Criticality    bool
+	BeforeCount    int64
+	AfterCount     int64
+	Offset         int64
+	ContentCount   int64
+	AssertionValue *string
+	ContextID      string
+}
+
+func parseVLVControl(con *message.Control) (*VLVControl, error) {
+	c := &VLVControl{
+		Criticality: bool(con.Criticality()),
+	}
+
+	if con.ControlValue() == nil {
+		return nil, NewProtocolError("VLV control value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*con.ControlValue()))
+	if err != nil || packet.Tag != ber.TagSequence || len(packet.Children) < 3 {
+		return nil, NewProtocolError("invalid VLV control value")
+	}
+
+	var ok bool
+	if c.BeforeCount, ok = packet.Children[0].Value.(int64); !ok || c.BeforeCount < 0 {
+		return nil, NewProtocolError("invalid VLV beforeCount")
+	}
+	if c.AfterCount, ok = packet.Children[1].Value.(int64); !ok || c.AfterCount < 0 {
+		return nil, NewProtocolError("invalid VLV afterCount")
+	}
+
+	target := packet.Children[2]
+	if target.ClassType != ber.ClassContext {
+		return nil, NewProtocolError("invalid VLV target")
+	}
+
+	switch target.Tag {
+	case 0:
+		if len(target.Children) != 2 {
+			return nil, NewProtocolError("invalid VLV byOffset")
+		}
+		offset, err := ber.ParseInt64(target.Children[0].Data.Bytes())
+		if err != nil || offset < 0 {
+			return nil, NewProtocolError("invalid VLV offset")
+		}
+		count, err := ber.ParseInt64(target.Children[1].Data.Bytes())
+		if err != nil || count < 0 {
+			return nil, NewProtocolError("invalid VLV contentCount")
+		}
+		c.Offset = offset
+		c.ContentCount = count
+	case 1:
+		v := target.Data.String()
+		c.AssertionValue = &v
+	default:
+		return nil, NewProtocolError("invalid VLV target")
+	}
+
+	if len(packet.Children) > 3 {
+		c.ContextID = packet.Children[3].Data.String()
+	}
+
+	return c, nil
+}
+
+// resolveVLVOption returns the VLV option for the search.
+// If the request can't be handled, it returns the virtualListViewResult code.
+func (s *Server) resolveVLVOption(c *VLVControl, sortKeys []*SortKey) (*VLVOption, int) {
+	// The too large window is rejected before counting the entries
+	if vlvWindowExceeds(c.BeforeCount, c.AfterCount, int64(s.config.MaxVLVWindowSize)) {
+		log.Printf("info: Exceeded VLV window size. beforeCount: %d, afterCount: %d, limit: %d", c.BeforeCount, c.AfterCount, s.config.MaxVLVWindowSize)
+		return nil, ldap.LDAPResultAdminLimitExceeded
+	}
+
+	option := &VLVOption{
+		BeforeCount:  c.BeforeCount,
+		AfterCount:   c.AfterCount,
+		Offset:       c.Offset,
+		ContentCount: c.ContentCount,
+	}
+
+	if c.AssertionValue != nil {
+		sv, err := NewSchemaValue(s.schemaMap, sortKeys[0].AttributeType.Name, []string{*c.AssertionValue})
+		if err != nil {
+			log.Printf("info: Invalid VLV assertion value. attr: %s, value: %s, err: %v", sortKeys[0].AttributeType.Name, *c.AssertionValue, err)
+			return nil, ldap.LDAPResultOther
+		}
+		v := sv.NormStr()[0]
+		option.AssertionValue = &v
+	} else if c.Offset == 0 || (c.ContentCount > 0 && c.Offset > c.ContentCount) {
+		log.Printf("info: VLV offset range error. offset: %d, contentCount: %d", c.Offset, c.ContentCount)
+		return nil, LDAPResultOffsetRangeError
+	}
+
+	return option, ldap.LDAPResultSuccess
+}
+
+// vlvWindowExceeds returns true if the window which is beforeCount + afterCount + 1 is larger than the limit.
+// The limit 0 means unlimited.
+func vlvWindowExceeds(beforeCount, afterCount, limit int64) bool {
+	if limit <= 0 {
+		return false
+	}
+	// Avoid the overflow of the sum
+	return beforeCount >= limit || afterCount >= limit || beforeCount+afterCount+1 > limit
+}
+
+// newVLVResponseControl returns the virtual list view response control.
+//
+//	VirtualListViewResponse ::= SEQUENCE {
+//	       targetPosition    INTEGER (0 .. maxInt),
+//	       contentCount     INTEGER (0 .. maxInt),
+//	       virtualListViewResult ENUMERATED { ... },
+//	       contextID     OCTET STRING OPTIONAL }
+//
+// The contextID of the request is returned as it is, so the client can keep the scroll context.
+func newVLVResponseControl(targetPosition, contentCount int64, code int, contextID string) (message.Control, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewResponse")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, targetPosition, "targetPosition"))
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, contentCount, "contentCount"))
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "virtualListViewResult"))
+	if contextID != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, contextID, "contextID"))
+	}
+
+	c, err := newControl(VLVResponseControlOID, false, packet.Bytes())
+	if err != nil {
+		return message.Control{}, xerrors.Errorf("Failed to create VLV response control. err: %w", err)
+	}
+	return c, nil
+}
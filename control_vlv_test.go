@@ -0,0 +1,169 @@
+//go:build test
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newVLVControlValue(before, after int64, target *ber.Packet) []byte {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewRequest")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, before, "beforeCount"))
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, after, "afterCount"))
+	packet.AppendChild(target)
+	return packet.Bytes()
+}
+
+func newVLVByOffset(offset, count int64) *ber.Packet {
+	target := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "byOffset")
+	target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, offset, "offset"))
+	target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, count, "contentCount"))
+	return target
+}
+
+func TestParseVLVControl(t *testing.T) {
+	con, err := newControl(VLVRequestControlOID, true, newVLVControlValue(1, 2, newVLVByOffset(10, 100)))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	vc, err := parseVLVControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseVLVControl: %+v", err)
+	}
+	if vc.BeforeCount != 1 || vc.AfterCount != 2 || vc.Offset != 10 || vc.ContentCount != 100 || vc.AssertionValue != nil {
+		t.Errorf("Unexpected control: %#v", vc)
+	}
+
+	target := ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, "foo", "greaterThanOrEqual")
+	con, err = newControl(VLVRequestControlOID, false, newVLVControlValue(0, 5, target))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+
+	vc, err = parseVLVControl(&con)
+	if err != nil {
+		t.Fatalf("Unexpected error on parseVLVControl: %+v", err)
+	}
+	if vc.AfterCount != 5 || vc.AssertionValue == nil || *vc.AssertionValue != "foo" {
+		t.Errorf("Unexpected control: %#v", vc)
+	}
+
+	target = ber.NewString(ber.ClassContext, ber.TypePrimitive, 2, "foo", "unknown")
+	con, err = newControl(VLVRequestControlOID, false, newVLVControlValue(0, 5, target))
+	if err != nil {
+		t.Fatalf("Unexpected error on newControl: %+v", err)
+	}
+	if _, err := parseVLVControl(&con); err == nil {
+		t.Errorf("Unexpected success of parsing unknown target")
+	}
+}
+
+func TestResolveVLVOption(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix:           "dc=example,dc=com",
+		MaxVLVWindowSize: 10,
+	})
+	server.LoadSchema()
+
+	sortKeys, _, _ := server.resolveSortKeys([]*SortKeyRequest{{AttributeType: "cn"}})
+
+	v := "Foo  Bar"
+	option, result := server.resolveVLVOption(&VLVControl{AssertionValue: &v}, sortKeys)
+	if result != ldap.LDAPResultSuccess || *option.AssertionValue != "foo bar" {
+		t.Errorf("Unexpected result: %d, option: %#v", result, option)
+	}
+
+	_, result = server.resolveVLVOption(&VLVControl{Offset: 0, ContentCount: 10}, sortKeys)
+	if result != LDAPResultOffsetRangeError {
+		t.Errorf("Unexpected result of zero offset: %d", result)
+	}
+
+	_, result = server.resolveVLVOption(&VLVControl{Offset: 11, ContentCount: 10}, sortKeys)
+	if result != LDAPResultOffsetRangeError {
+		t.Errorf("Unexpected result of offset greater than content count: %d", result)
+	}
+
+	option, result = server.resolveVLVOption(&VLVControl{BeforeCount: 1, AfterCount: 2, Offset: 5}, sortKeys)
+	if result != ldap.LDAPResultSuccess || option.Offset != 5 || option.BeforeCount != 1 || option.AfterCount != 2 {
+		t.Errorf("Unexpected result: %d, option: %#v", result, option)
+	}
+
+	_, result = server.resolveVLVOption(&VLVControl{BeforeCount: 4, AfterCount: 5, Offset: 5}, sortKeys)
+	if result != ldap.LDAPResultSuccess {
+		t.Errorf("Unexpected result of the max window: %d", result)
+	}
+
+	_, result = server.resolveVLVOption(&VLVControl{BeforeCount: 5, AfterCount: 5, Offset: 5}, sortKeys)
+	if result != ldap.LDAPResultAdminLimitExceeded {
+		t.Errorf("Unexpected result of the too large window: %d", result)
+	}
+
+	_, result = server.resolveVLVOption(&VLVControl{BeforeCount: math.MaxInt64, AfterCount: math.MaxInt64, Offset: 5}, sortKeys)
+	if result != ldap.LDAPResultAdminLimitExceeded {
+		t.Errorf("Unexpected result of the overflowed window: %d", result)
+	}
+}
+
+func TestVLVWindowExceeds(t *testing.T) {
+	testcases := []struct {
+		before   int64
+		after    int64
+		limit    int64
+		expected bool
+	}{
+		{0, 0, 0, false},
+		{math.MaxInt64, math.MaxInt64, 0, false},
+		{0, 0, 1, false},
+		{0, 1, 1, true},
+		{1, 1, 3, false},
+		{2, 1, 3, true},
+		{math.MaxInt64, 0, 3, true},
+	}
+
+	for i, tc := range testcases {
+		if got := vlvWindowExceeds(tc.before, tc.after, tc.limit); got != tc.expected {
+			t.Errorf("#%d: unexpected result. expected: %v, got: %v", i, tc.expected, got)
+		}
+	}
+}
+
+func TestNewVLVResponseControl(t *testing.T) {
+	c, err := newVLVResponseControl(3, 100, ldap.LDAPResultSuccess, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if string(c.ControlType()) != VLVResponseControlOID {
+		t.Errorf("Unexpected control type: %s", c.ControlType())
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 3 ||
+		packet.Children[0].Value.(int64) != 3 ||
+		packet.Children[1].Value.(int64) != 100 ||
+		packet.Children[2].Value.(int64) != ldap.LDAPResultSuccess {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
+
+func TestNewVLVResponseControlWithContextID(t *testing.T) {
+	c, err := newVLVResponseControl(3, 100, ldap.LDAPResultSuccess, "ctx1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*c.ControlValue()))
+	if err != nil {
+		t.Fatalf("Unexpected error on decoding: %+v", err)
+	}
+	if len(packet.Children) != 4 || packet.Children[3].Data.String() != "ctx1" {
+		t.Errorf("Unexpected control value: %s", ber.DecodeString(packet.Bytes()))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sort"
 	"strings"
 )
 
@@ -74,18 +75,30 @@ func encodeDN(str string) string {
 	return b.String()
 }
 
+// NormStr returns the normalized RDN.
+// The components of the multi-valued RDN are sorted to be canonical, e.g. cn=john smith+uid=jsmith.
 func (r *RelativeDN) NormStr() string {
-	var b strings.Builder
-	b.Grow(128)
+	if len(r.Attributes) == 1 {
+		return r.Attributes[0].TypeNorm + "=" + r.Attributes[0].ValueNorm
+	}
+
+	components := make([]string, len(r.Attributes))
 	for i, attr := range r.Attributes {
-		if i > 0 {
-			b.WriteString("+")
+		components[i] = attr.TypeNorm + "=" + attr.ValueNorm
+	}
+	sort.Strings(components)
+
+	return strings.Join(components, "+")
+}
+
+// Contains returns true if the RDN has the same component.
+func (r *RelativeDN) Contains(a *AttributeTypeAndValue) bool {
+	for _, attr := range r.Attributes {
+		if attr.TypeNorm == a.TypeNorm && attr.ValueNorm == a.ValueNorm {
+			return true
 		}
-		b.WriteString(attr.TypeNorm)
-		b.WriteString("=")
-		b.WriteString(attr.ValueNorm)
 	}
-	return b.String()
+	return false
 }
 
 type AttributeTypeAndValue struct {
@@ -127,6 +140,10 @@ func (d *DN) DNNormStr() string {
 }
 
 func (d *DN) DNNormStrWithoutSuffix(suffix *DN) string {
+	// The parent of the single RDN suffix
+	if d == nil {
+		return ""
+	}
 	sRDNs := suffix.RDNs
 	diff := len(d.RDNs) - len(sRDNs)
 
@@ -157,6 +174,10 @@ func (d *DN) DNOrigStr() string {
 }
 
 func (d *DN) DNOrigEncodedStrWithoutSuffix(suffix *DN) string {
+	// The parent of the single RDN suffix
+	if d == nil {
+		return ""
+	}
 	sRDNs := suffix.RDNs
 	diff := len(d.RDNs) - len(sRDNs)
 
@@ -175,17 +196,7 @@ func (d *DN) DNOrigEncodedStrWithoutSuffix(suffix *DN) string {
 }
 
 func (d *DN) RDNNormStr() string {
-	var b strings.Builder
-	b.Grow(128)
-	for i, attr := range d.RDNs[0].Attributes {
-		if i > 0 {
-			b.WriteString("+")
-		}
-		b.WriteString(attr.TypeNorm)
-		b.WriteString("=")
-		b.WriteString(attr.ValueNorm)
-	}
-	return b.String()
+	return d.RDNs[0].NormStr()
 }
 
 func (d *DN) RDNOrigEncodedStr() string {
@@ -245,20 +256,20 @@ func (d *DN) RDN() map[string]NormString {
 	return m
 }
 
-func (d *DN) ModifyRDN(schemaMap *SchemaMap, newRDN string, deleteOld bool) (*DN, *RelativeDN, error) {
+// ModifyRDN returns the DN which has the new RDN.
+func (d *DN) ModifyRDN(schemaMap *SchemaMap, newRDN string) (*DN, error) {
 	newDN, err := ParseDN(schemaMap, newRDN)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if len(newDN.RDNs) != 1 {
+		return nil, NewInvalidDNSyntax()
 	}
 
 	// Clone and apply the change
 	newRDNs := make([]*RelativeDN, len(d.RDNs))
-	var oldRDN *RelativeDN
 	for i, v := range d.RDNs {
 		if i == 0 {
-			if !deleteOld && v.NormStr() != newDN.RDNNormStr() {
-				oldRDN = v
-			}
 			newRDNs[i] = newDN.RDNs[0]
 		} else {
 			newRDNs[i] = v
@@ -267,7 +278,7 @@ func (d *DN) ModifyRDN(schemaMap *SchemaMap, newRDN string, deleteOld bool) (*DN
 
 	return &DN{
 		RDNs: newRDNs,
-	}, oldRDN, nil
+	}, nil
 }
 
 func (d *DN) Move(newParentDN *DN) (*DN, error) {
@@ -38,6 +38,11 @@ func TestDNNormalize(t *testing.T) {
 			"dc=example,dc=org",
 			"DC=example,DC=org",
 		},
+		{
+			"uid=jsmith+cn=John  Smith,ou=People,DC=example,DC=com",
+			"cn=john smith+uid=jsmith,ou=people,dc=example,dc=com",
+			"uid=jsmith+cn=John  Smith,ou=People,DC=example,DC=com",
+		},
 		{
 			"",
 			"",
@@ -69,3 +74,45 @@ func TestDNNormalize(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiValuedRDN(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	schemaMap := InitSchemaMap(server)
+
+	dn1, err := NormalizeDN(schemaMap, "cn=John Smith+uid=jsmith,ou=People,dc=example,dc=com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	dn2, err := NormalizeDN(schemaMap, "UID=JSmith+CN=john smith,ou=People,dc=example,dc=com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// The components are sorted in the normalized form
+	if !dn1.Equal(dn2) || dn1.RDNNormStr() != "cn=john smith+uid=jsmith" {
+		t.Errorf("Unexpected normalized RDN: %s, %s", dn1.RDNNormStr(), dn2.RDNNormStr())
+	}
+	if dn2.RDNOrigEncodedStr() != "UID=JSmith+CN=john smith" {
+		t.Errorf("Unexpected original RDN: %s", dn2.RDNOrigEncodedStr())
+	}
+
+	// Duplicate component
+	if _, err := NormalizeDN(schemaMap, "cn=foo+CN=Foo,ou=People,dc=example,dc=com"); err == nil {
+		t.Errorf("Unexpected success of duplicate RDN component")
+	}
+
+	newDN, err := dn1.ModifyRDN(schemaMap, "cn=John Smith+mail=jsmith@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if newDN.DNNormStr() != "cn=john smith+mail=jsmith@example.com,ou=people,dc=example,dc=com" {
+		t.Errorf("Unexpected new DN: %s", newDN.DNNormStr())
+	}
+
+	// Not a RDN
+	if _, err := dn1.ModifyRDN(schemaMap, "cn=foo,ou=bar"); err == nil {
+		t.Errorf("Unexpected success of invalid new RDN")
+	}
+}
@@ -11,6 +11,7 @@ type LDAPError struct {
 	Msg       string
 	MatchedDN string
 	Subtype   string
+	Referral  []string
 	err       error
 }
 
@@ -153,6 +154,20 @@ func NewNoGlobalSuperiorKnowledge() *LDAPError {
 	}
 }
 
+func NewReferral(urls []string) *LDAPError {
+	return &LDAPError{
+		Code:     ldap.LDAPResultReferral,
+		Referral: urls,
+	}
+}
+
+func NewAffectsMultipleDSAs() *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultAffectsMultipleDSAs,
+		Msg:  "moving the entry to the referral is not supported",
+	}
+}
+
 func NewObjectClassViolation() *LDAPError {
 	return &LDAPError{
 		Code: ldap.LDAPResultObjectClassViolation,
@@ -188,6 +203,13 @@ func NewObjectClassViolationInvalidStructualChain(oc1, oc2 string) *LDAPError {
 	}
 }
 
+func NewNamingViolation(attrName string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultNamingViolation,
+		Msg:  fmt.Sprintf("value of naming attribute '%s' is not present in entry", attrName),
+	}
+}
+
 func NewObjectClassModsProhibited(from, to string) *LDAPError {
 	return &LDAPError{
 		Code: ldap.LDAPResultObjectClassModsProhibited,
@@ -220,6 +242,99 @@ func NewOperationsError() *LDAPError {
 	}
 }
 
+func NewConfidentialityRequired() *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultConfidentialityRequired,
+		Msg:  "TLS confidentiality required",
+	}
+}
+
+func NewInappropriateAuthentication(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultInappropriateAuthentication,
+		Msg:  msg,
+	}
+}
+
+func NewProtocolError(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultProtocolError,
+		Msg:  msg,
+	}
+}
+
+func NewUnwillingToPerform(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultUnwillingToPerform,
+		Msg:  msg,
+	}
+}
+
+func NewUnavailableCriticalExtension(oid string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultUnavailableCriticalExtension,
+		Msg:  fmt.Sprintf("critical extension is unavailable: %s", oid),
+	}
+}
+
+func NewAdminLimitExceeded(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultAdminLimitExceeded,
+		Msg:  msg,
+	}
+}
+
+func NewSizeLimitExceeded() *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultSizeLimitExceeded,
+		Msg:  "size limit exceeded",
+	}
+}
+
+func NewTimeLimitExceeded(err error) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultTimeLimitExceeded,
+		Msg:  "time limit exceeded",
+		err:  err,
+	}
+}
+
+func NewCanceled(err error) *LDAPError {
+	return &LDAPError{
+		Code: LDAPResultCanceled,
+		Msg:  "operation was canceled",
+		err:  err,
+	}
+}
+
+func NewAuthorizationDenied() *LDAPError {
+	return &LDAPError{
+		Code: LDAPResultAuthorizationDenied,
+		Msg:  "not allowed to assume the authorization identity",
+	}
+}
+
+func NewAssertionFailed() *LDAPError {
+	return &LDAPError{
+		Code: LDAPResultAssertionFailed,
+		Msg:  "assertion control failed",
+	}
+}
+
+func NewAliasProblem(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultAliasProblem,
+		Msg:  msg,
+	}
+}
+
+func NewAliasDereferencingProblem(msg string) *LDAPError {
+	return &LDAPError{
+		Code: ldap.LDAPResultAliasDereferencingProblem,
+		Msg:  msg,
+	}
+}
+
 type RetryError struct {
 	err error
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/openstandia/goldap/message"
+)
+
+// Matching rules supported by the extensible match filter.
+// The bitwise matching rules are compatible with Active Directory.
+// https://docs.microsoft.com/en-us/windows/win32/adsi/search-filter-syntax
+const (
+	DistinguishedNameMatchOID = "2.5.13.1"
+	CaseIgnoreMatchOID        = "2.5.13.2"
+	CaseExactMatchOID         = "2.5.13.5"
+	NumericStringMatchOID     = "2.5.13.8"
+	IntegerMatchOID           = "2.5.13.14"
+	OctetStringMatchOID       = "2.5.13.17"
+	CaseExactIA5MatchOID      = "1.3.6.1.4.1.1466.109.114.1"
+	CaseIgnoreIA5MatchOID     = "1.3.6.1.4.1.1466.109.114.2"
+	IntegerBitAndMatchOID     = "1.2.840.113556.1.4.803"
+	IntegerBitOrMatchOID      = "1.2.840.113556.1.4.804"
+)
+
+var matchingRules = map[string]string{
+	DistinguishedNameMatchOID: "distinguishedNameMatch",
+	CaseIgnoreMatchOID:        "caseIgnoreMatch",
+	CaseExactMatchOID:         "caseExactMatch",
+	NumericStringMatchOID:     "numericStringMatch",
+	IntegerMatchOID:           "integerMatch",
+	OctetStringMatchOID:       "octetStringMatch",
+	CaseExactIA5MatchOID:      "caseExactIA5Match",
+	CaseIgnoreIA5MatchOID:     "caseIgnoreIA5Match",
+	IntegerBitAndMatchOID:     "integerBitAndMatch",
+	IntegerBitOrMatchOID:      "integerBitOrMatch",
+}
+
+// ExtensibleMatch is the extensible match filter, e.g. (cn:caseExactMatch:=Foo) or (ou:dn:=People).
+//
+//	MatchingRuleAssertion ::= SEQUENCE {
+//	        matchingRule    [1] MatchingRuleId OPTIONAL,
+//	        type            [2] AttributeDescription OPTIONAL,
+//	        matchValue      [3] AssertionValue,
+//	        dnAttributes    [4] BOOLEAN DEFAULT FALSE }
+type ExtensibleMatch struct {
+	MatchingRule string
+	Type         string
+	MatchValue   string
+	DNAttributes bool
+}
+
+// parseExtensibleMatch returns the components of the extensible match filter.
+// goldap doesn't provide the getters of MatchingRuleAssertion, so we read the unexported fields by reflection.
+func parseExtensibleMatch(f message.FilterExtensibleMatch) *ExtensibleMatch {
+	v := reflect.ValueOf(f)
+
+	m := &ExtensibleMatch{
+		MatchValue:   v.FieldByName("matchValue").String(),
+		DNAttributes: v.FieldByName("dnAttributes").Bool(),
+	}
+	if rule := v.FieldByName("matchingRule"); !rule.IsNil() {
+		m.MatchingRule = rule.Elem().String()
+	}
+	if type_ := v.FieldByName("type_"); !type_.IsNil() {
+		m.Type = type_.Elem().String()
+	}
+	return m
+}
+
+// resolveMatchingRule returns the name of the matching rule specified by the name or the OID.
+func resolveMatchingRule(rule string) (string, bool) {
+	if name, ok := matchingRules[rule]; ok {
+		return name, true
+	}
+	for _, name := range matchingRules {
+		if strings.EqualFold(name, rule) {
+			return name, true
+		}
+	}
+	return "", false
+}
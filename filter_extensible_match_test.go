@@ -0,0 +1,54 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+)
+
+func TestParseExtensibleMatch(t *testing.T) {
+	testcases := []struct {
+		Filter string
+		Expect ExtensibleMatch
+	}{
+		{"(cn:caseExactMatch:=Foo)", ExtensibleMatch{MatchingRule: "caseExactMatch", Type: "cn", MatchValue: "Foo"}},
+		{"(ou:dn:=People)", ExtensibleMatch{Type: "ou", MatchValue: "People", DNAttributes: true}},
+		{"(:dn:2.5.13.5:=People)", ExtensibleMatch{MatchingRule: "2.5.13.5", MatchValue: "People", DNAttributes: true}},
+	}
+
+	for i, tc := range testcases {
+		f, err := compileFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+		em, ok := f.(message.FilterExtensibleMatch)
+		if !ok {
+			t.Fatalf("Unexpected filter on %d: %T", i, f)
+		}
+		if m := parseExtensibleMatch(em); *m != tc.Expect {
+			t.Errorf("Unexpected extensible match on %d: %+v", i, m)
+		}
+	}
+}
+
+func TestResolveMatchingRule(t *testing.T) {
+	testcases := []struct {
+		Rule   string
+		Expect string
+		Found  bool
+	}{
+		{"2.5.13.5", "caseExactMatch", true},
+		{"caseexactmatch", "caseExactMatch", true},
+		{IntegerBitAndMatchOID, "integerBitAndMatch", true},
+		{"1.2.3.4", "", false},
+	}
+
+	for i, tc := range testcases {
+		name, ok := resolveMatchingRule(tc.Rule)
+		if name != tc.Expect || ok != tc.Found {
+			t.Errorf("Unexpected matching rule on %d: %s, %v", i, name, ok)
+		}
+	}
+}
@@ -4,12 +4,28 @@ import (
 	"context"
 	"log"
 
+	"github.com/openstandia/goldap/message"
 	ldap "github.com/openstandia/ldapserver"
 	"golang.org/x/xerrors"
 )
 
 func handleAdd(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
-	ctx := SetSessionContext(context.Background(), m)
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseAddError(w, err)
+		return
+	}
+
+	if !s.RequiredTLS(m) {
+		responseAddError(w, NewConfidentialityRequired())
+		return
+	}
+
+	txn, err := lookupTransaction(m)
+	if err != nil {
+		responseAddError(w, err)
+		return
+	}
 
 	r := m.GetAddRequest()
 
@@ -20,7 +36,7 @@ func handleAdd(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
-	if !s.RequiredAuthz(m, AddOps, dn) {
+	if !s.RequiredAuthz(ctx, AddOps, dn) {
 		// TODO return errror message
 		// ldap_add: Insufficient access (50)
 		// additional info: no write access to parent
@@ -28,9 +44,33 @@ func handleAdd(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
+	readEntry, err := parseReadEntryControls(m, false, true)
+	if err != nil {
+		responseAddError(w, err)
+		return
+	}
+	if readEntry != nil {
+		ctx = SetReadEntryContext(ctx, readEntry)
+	}
+
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseAddError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
 	// Invalid suffix
-	if !dn.Equal(s.Suffix) && !dn.IsSubOf(s.Suffix) {
-		responseAddError(w, NewNoGlobalSuperiorKnowledge())
+	if s.NamingContextOf(dn) == nil {
+		responseAddError(w, s.superiorReferral())
+		return
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		responseAddError(w, err)
 		return
 	}
 
@@ -42,6 +82,20 @@ func handleAdd(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
+	// LDAP transaction, the operation is applied when the transaction is committed
+	if txn != nil {
+		if err := txn.Queue(ctx, m, addEntry.DN(), readEntry, func(ctx context.Context) error {
+			_, err := s.Repo().Insert(ctx, addEntry)
+			return err
+		}); err != nil {
+			responseAddError(w, err)
+			return
+		}
+		log.Printf("info: Queued adding entry. txnID: %s, dn: %s", txn.ID, r.Entry())
+		w.Write(ldap.NewAddResponse(ldap.LDAPResultSuccess))
+		return
+	}
+
 	log.Printf("info: Adding entry: %s", r.Entry())
 
 	i := 0
@@ -66,7 +120,7 @@ Retry:
 	log.Printf("debug: Added. Id: %d, DN: %v", id, dn)
 
 	res := ldap.NewAddResponse(ldap.LDAPResultSuccess)
-	w.Write(res)
+	s.writeWithReadEntry(ctx, w, res, readEntry)
 
 	log.Printf("debug: End Adding entry: %s", r.Entry())
 }
@@ -80,6 +134,7 @@ func responseAddError(w ldap.ResponseWriter, err error) {
 		if ldapErr.Msg != "" {
 			res.SetDiagnosticMessage(ldapErr.Msg)
 		}
+		setReferral((*message.LDAPResult)(&res), ldapErr)
 		if ldapErr.MatchedDN != "" {
 			res.SetMatchedDN(ldapErr.MatchedDN)
 		}
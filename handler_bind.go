@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"log"
+	"math/big"
 	"strings"
 	"time"
 
@@ -19,7 +21,18 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	r := m.GetBindRequest()
 	res := ldap.NewBindResponse(ldap.LDAPResultSuccess)
 
+	if !s.RequiredTLS(m) {
+		log.Printf("info: Bind failed - TLS confidentiality required. request_dn: %s", r.Name())
+		res.SetResultCode(ldap.LDAPResultConfidentialityRequired)
+		res.SetDiagnosticMessage("TLS confidentiality required")
+		w.Write(res)
+		return
+	}
+
 	if r.AuthenticationChoice() == "simple" {
+		// Simple bind aborts the in-progress SASL bind
+		clearSASLBindState(m)
+
 		name := string(r.Name())
 		input := string(r.AuthenticationSimple())
 
@@ -32,24 +45,6 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 			return
 		}
 
-		// For rootdn
-		if dn.Equal(s.GetRootDN()) {
-			// TODO implement password policy for root user
-			if ok := validateCred(s, input, s.GetRootPW()); !ok {
-				log.Printf("info: Bind failed - Invalid credentials. dn_norm: %s", dn.DNNormStr())
-				res.SetResultCode(ldap.LDAPResultInvalidCredentials)
-				res.SetDiagnosticMessage("invalid credentials")
-				w.Write(res)
-				return
-			}
-			log.Printf("info: Bind ok. dn_norm: %s", dn.DNNormStr())
-
-			saveAuthencatedDNAsRoot(m, dn)
-
-			w.Write(res)
-			return
-		}
-
 		// Anonymous
 		if dn.IsAnonymous() {
 			log.Printf("info: Bind anonymous user.")
@@ -58,36 +53,7 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 			return
 		}
 
-		log.Printf("info: Find bind user. DN: %s", dn.DNNormStr())
-
-		err = s.Repo().Bind(ctx, dn, func(current *FetchedCredential) error {
-			// If the user doesn't have credentials, always return 'invalid credential'.
-			if len(current.Credential) == 0 {
-				log.Printf("info: Bind failed - Not found credentials. dn_norm: %s, err: %s", dn.DNNormStr(), err)
-				return NewInvalidCredentials()
-			}
-
-			if isLocked(current) {
-				log.Printf("info: Bind failed - Account locked. dn_norm: %s", dn.DNNormStr())
-				return NewAccountLocked()
-			}
-
-			bindOK := validateCreds(s, input, current)
-
-			if !bindOK {
-				if current.PPolicy.ShouldLockout(current.PwdFailureCount) {
-					log.Printf("info: Bind failed - Invalid credentials then locking now. dn_norm: %s", dn.DNNormStr())
-					return NewAccountLocking()
-				}
-
-				log.Printf("info: Bind failed - Invalid credentials. dn_norm: %s", dn.DNNormStr())
-				return NewInvalidCredentials()
-			}
-
-			saveAuthencatedDN(m, dn, current.MemberOf)
-
-			return nil
-		})
+		err = bindByPassword(ctx, s, m, dn, input)
 
 		// Bind failure
 		if err != nil {
@@ -99,6 +65,7 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 
 				res.SetResultCode(lerr.Code)
 				res.SetDiagnosticMessage(lerr.Msg)
+				setReferral(&res.LDAPResult, lerr)
 				w.Write(res)
 				return
 			} else {
@@ -117,6 +84,10 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		w.Write(res)
 		return
 
+	} else if r.AuthenticationChoice() == "sasl" {
+		handleSASLBind(s, w, m)
+		return
+
 	} else {
 		res.SetResultCode(ldap.LDAPResultUnwillingToPerform)
 		res.SetDiagnosticMessage("Authentication choice not supported")
@@ -125,6 +96,60 @@ func handleBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	w.Write(res)
 }
 
+// bindByPassword authenticates the user by the password.
+// It's used for simple bind and SASL mechanisms which use the password (e.g. PLAIN).
+func bindByPassword(ctx context.Context, s *Server, m *ldap.Message, dn *DN, input string) error {
+	// For rootdn
+	if dn.Equal(s.GetRootDN()) {
+		// TODO implement password policy for root user
+		if ok := validateCred(s, input, s.GetRootPW()); !ok {
+			log.Printf("info: Bind failed - Invalid credentials. dn_norm: %s", dn.DNNormStr())
+			return NewInvalidCredentials()
+		}
+
+		saveAuthencatedDNAsRoot(m, dn)
+
+		return nil
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		return err
+	}
+
+	log.Printf("info: Find bind user. DN: %s", dn.DNNormStr())
+
+	return s.Repo().Bind(ctx, dn, func(current *FetchedCredential) error {
+		// If the user doesn't have credentials, always return 'invalid credential'.
+		if len(current.Credential) == 0 {
+			log.Printf("info: Bind failed - Not found credentials. dn_norm: %s", dn.DNNormStr())
+			return NewInvalidCredentials()
+		}
+
+		if isLocked(current) {
+			log.Printf("info: Bind failed - Account locked. dn_norm: %s", dn.DNNormStr())
+			return NewAccountLocked()
+		}
+
+		bindOK := validateCreds(s, input, current)
+
+		if !bindOK {
+			if current.PPolicy.ShouldLockout(current.PwdFailureCount) {
+				log.Printf("info: Bind failed - Invalid credentials then locking now. dn_norm: %s", dn.DNNormStr())
+				return NewAccountLocking()
+			}
+
+			log.Printf("info: Bind failed - Invalid credentials. dn_norm: %s", dn.DNNormStr())
+			return NewInvalidCredentials()
+		}
+
+		// The dereferenced entry is authenticated if the bind DN is an alias
+		saveAuthencatedDN(m, current.DN, current.MemberOf)
+
+		return nil
+	})
+}
+
 // isLocked checks the account is locked if the lock is enabled in the password policy
 func isLocked(cred *FetchedCredential) bool {
 	if cred.PPolicy.IsLockoutEnabled() {
@@ -167,6 +192,13 @@ func validateCred(s *Server, input, cred string) bool {
 	} else if len(cred) > 10 && string(cred[0:9]) == "{SSHA512}" {
 		ok, err = ssha512.Validate(input, cred)
 
+	} else if strings.HasPrefix(cred, scramSHA256Prefix) {
+		var c *SCRAMCredential
+		c, err = ParseSCRAMCredential(cred)
+		if err == nil {
+			ok = c.ValidatePassword(input)
+		}
+
 	} else if len(cred) > 7 && string(cred[0:6]) == "{SASL}" {
 		ok, err = doPassThrough(s, input, cred[6:])
 	} else {
@@ -185,6 +217,39 @@ func validateCred(s *Server, input, cred string) bool {
 	return ok
 }
 
+// hashPassword returns the hashed password with the scheme prefix (e.g. {SSHA512}).
+func hashPassword(scheme, input string) (string, error) {
+	switch strings.ToUpper(scheme) {
+	case "SSHA":
+		return ssha.Generate(input, 20)
+	case "SSHA256":
+		return ssha256.Generate(input, 20)
+	case "SSHA512":
+		return ssha512.Generate(input, 20)
+	case "SCRAM-SHA-256":
+		return generateSCRAMCredential(input)
+	case "PLAIN":
+		return input, nil
+	}
+	return "", xerrors.Errorf("Unsupported password hash scheme: %s", scheme)
+}
+
+const generatedPasswordChars = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+// generatePassword returns the random password with the specified length.
+func generatePassword(length int) (string, error) {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(generatedPasswordChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", xerrors.Errorf("Failed to generate password. err: %w", err)
+		}
+		b[i] = generatedPasswordChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
 type InvalidCredentials struct {
 	err error
 }
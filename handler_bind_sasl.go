@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+)
+
+func handleSASLBind(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	ctx := context.Background()
+
+	r := m.GetBindRequest()
+	mechanism, cred := r.AuthenticationSasl()
+
+	mech, ok := getSASLMechanism(s, string(mechanism))
+	if !ok {
+		clearSASLBindState(m)
+
+		log.Printf("info: Bind failed - Unsupported SASL mechanism: %s", mechanism)
+		res := ldap.NewBindResponse(ldap.LDAPResultAuthMethodNotSupported)
+		res.SetDiagnosticMessage("SASL mechanism not supported")
+		w.Write(res)
+		return
+	}
+
+	// Continue the exchange only when the same mechanism is in progress
+	var state interface{}
+	if current := getSASLBindState(m); current != nil && current.Mechanism == mech.Name() {
+		state = current.State
+	}
+	clearSASLBindState(m)
+
+	var credBytes []byte
+	if cred != nil {
+		credBytes = []byte(*cred)
+	}
+
+	next, challenge, err := mech.Step(ctx, s, m, state, credBytes)
+	if err != nil {
+		responseBindError(w, err)
+		return
+	}
+
+	if next != nil {
+		saveSASLBindState(m, &SASLBindState{
+			Mechanism: mech.Name(),
+			State:     next,
+		})
+
+		serverCreds := message.OCTETSTRING(challenge)
+		res := ldap.NewBindResponseSasl(ldap.LDAPResultSaslBindInProgress, &serverCreds)
+		w.Write(res)
+		return
+	}
+
+	log.Printf("info: Bind ok by SASL/%s", mech.Name())
+
+	var serverCreds *message.OCTETSTRING
+	if len(challenge) > 0 {
+		v := message.OCTETSTRING(challenge)
+		serverCreds = &v
+	}
+	res := ldap.NewBindResponseSasl(ldap.LDAPResultSuccess, serverCreds)
+	w.Write(res)
+}
+
+func responseBindError(w ldap.ResponseWriter, err error) {
+	var ldapErr *LDAPError
+	if ok := xerrors.As(err, &ldapErr); ok {
+		if !ldapErr.IsInvalidCredentials() {
+			log.Printf("warn: Bind LDAP error. err: %+v", err)
+		}
+
+		res := ldap.NewBindResponse(ldapErr.Code)
+		if ldapErr.Msg != "" {
+			res.SetDiagnosticMessage(ldapErr.Msg)
+		}
+		setReferral(&res.LDAPResult, ldapErr)
+		w.Write(res)
+	} else {
+		log.Printf("error: Bind error. err: %+v", err)
+
+		res := ldap.NewBindResponse(ldap.LDAPResultUnavailable)
+		w.Write(res)
+	}
+}
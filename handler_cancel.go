@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// Lightweight Directory Access Protocol (LDAP) Cancel Operation
+// https://datatracker.ietf.org/doc/html/rfc3909
+const CancelOID = "1.3.6.1.1.8"
+
+func init() {
+	RegisterSupportedExtension(CancelOID, nil)
+}
+
+const (
+	LDAPResultCanceled        = 118
+	LDAPResultNoSuchOperation = 119
+	LDAPResultTooLate         = 120
+	LDAPResultCannotCancel    = 121
+)
+
+// handleCancel cancels the outstanding operation in the connection.
+// The canceled operation returns canceled result code, then the cancel operation returns success.
+// If the operation was already completed, the cancel operation returns tooLate.
+func handleCancel(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	r := m.GetExtendedRequest()
+	cancelID, err := parseCancelRequest(r.RequestValue())
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	target, ok := m.Client.GetMessageByID(cancelID)
+	if !ok {
+		log.Printf("info: No such operation to cancel. cancelID: %d", cancelID)
+		w.Write(ldap.NewExtendedResponse(LDAPResultNoSuchOperation))
+		return
+	}
+
+	op, ok := s.operations.Load(target)
+	if !ok {
+		log.Printf("info: No such operation to cancel. cancelID: %d", cancelID)
+		w.Write(ldap.NewExtendedResponse(LDAPResultNoSuchOperation))
+		return
+	}
+
+	log.Printf("info: Canceling the operation. cancelID: %d", cancelID)
+
+	code := op.(*Operation).Cancel()
+
+	log.Printf("info: Canceled the operation. cancelID: %d, resultCode: %d", cancelID, code)
+
+	w.Write(ldap.NewExtendedResponse(code))
+}
+
+// parseCancelRequest returns the message ID of the operation to be canceled.
+//
+//	cancelRequestValue ::= SEQUENCE {
+//	        cancelID        MessageID }
+func parseCancelRequest(value *message.OCTETSTRING) (int, error) {
+	if value == nil {
+		return 0, NewProtocolError("cancel request value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*value))
+	if err != nil || packet.Tag != ber.TagSequence || len(packet.Children) != 1 {
+		return 0, NewProtocolError("invalid cancel request value")
+	}
+
+	cancelID, ok := packet.Children[0].Value.(int64)
+	if !ok || cancelID < 0 {
+		return 0, NewProtocolError("invalid cancel request cancelID")
+	}
+
+	return int(cancelID), nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"log"
 
+	"github.com/openstandia/goldap/message"
 	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
 )
 
 // The resultCode is set to compareTrue, compareFalse, or an appropriate
@@ -14,14 +16,103 @@ import (
 // subtype did not match.  Other result codes indicate either that the
 // result of the comparison was Undefined, or that
 // some error occurred.
-func handleCompare(w ldap.ResponseWriter, m *ldap.Message) {
+func handleCompare(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseCompareError(w, err)
+		return
+	}
+
 	r := m.GetCompareRequest()
-	log.Printf("[INFO] Comparing entry: %s", r.Entry())
-	//attributes values
-	log.Printf(" attribute name to compare : \"%s\"", r.Ava().AttributeDesc())
-	log.Printf(" attribute value expected : \"%s\"", r.Ava().AssertionValue())
 
-	res := ldap.NewCompareResponse(ldap.LDAPResultCompareTrue)
+	dn, err := s.NormalizeDN(string(r.Entry()))
+	if err != nil {
+		log.Printf("warn: Invalid DN: %s err: %s", r.Entry(), err)
+		responseCompareError(w, NewInvalidDNSyntax())
+		return
+	}
+
+	if !s.RequiredAuthz(ctx, CompareOps, dn) {
+		responseCompareError(w, NewInsufficientAccess())
+		return
+	}
+
+	// Invalid suffix
+	if s.NamingContextOf(dn) == nil {
+		responseCompareError(w, s.superiorReferral())
+		return
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		responseCompareError(w, err)
+		return
+	}
+
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseCompareError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
+	attrName := string(r.Ava().AttributeDesc())
+
+	// Hidden attributes by the ACL can't be probed
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		responseCompareError(w, err)
+		return
+	}
+	if !s.simpleACL.CanVisible(session, attrName) {
+		responseCompareError(w, NewInsufficientAccess())
+		return
+	}
+
+	// Normalize the assertion value with the EQUALITY matching rule
+	sv, err := NewSchemaValue(s.schemaMap, attrName, []string{string(r.Ava().AssertionValue())})
+	if err != nil {
+		responseCompareError(w, err)
+		return
+	}
 
+	log.Printf("info: Comparing entry: %s, attr: %s", dn.DNNormStr(), sv.Name())
+
+	matched, err := s.Repo().Compare(ctx, dn, sv)
+	if err != nil {
+		responseCompareError(w, err)
+		return
+	}
+
+	code := ldap.LDAPResultCompareFalse
+	if matched {
+		code = ldap.LDAPResultCompareTrue
+	}
+
+	log.Printf("info: Compared. dn: %s, attr: %s, result: %d", dn.DNNormStr(), sv.Name(), code)
+
+	res := ldap.NewCompareResponse(code)
 	w.Write(res)
 }
+
+func responseCompareError(w ldap.ResponseWriter, err error) {
+	var ldapErr *LDAPError
+	if ok := xerrors.As(err, &ldapErr); ok {
+		log.Printf("warn: Compare LDAP error. err: %+v", err)
+
+		res := ldap.NewCompareResponse(ldapErr.Code)
+		if ldapErr.Msg != "" {
+			res.SetDiagnosticMessage(ldapErr.Msg)
+		}
+		setReferral((*message.LDAPResult)(&res), ldapErr)
+		w.Write(res)
+	} else {
+		log.Printf("error: Compare error. err: %+v", err)
+
+		// TODO
+		res := ldap.NewCompareResponse(ldap.LDAPResultOther)
+		w.Write(res)
+	}
+}
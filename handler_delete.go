@@ -4,12 +4,28 @@ import (
 	"context"
 	"log"
 
+	"github.com/openstandia/goldap/message"
 	ldap "github.com/openstandia/ldapserver"
 	"golang.org/x/xerrors"
 )
 
 func handleDelete(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
-	ctx := SetSessionContext(context.Background(), m)
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseDeleteError(w, err)
+		return
+	}
+
+	if !s.RequiredTLS(m) {
+		responseDeleteError(w, NewConfidentialityRequired())
+		return
+	}
+
+	txn, err := lookupTransaction(m)
+	if err != nil {
+		responseDeleteError(w, err)
+		return
+	}
 
 	r := m.GetDeleteRequest()
 	dn, err := s.NormalizeDN(string(r))
@@ -22,17 +38,63 @@ func handleDelete(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
-	if !s.RequiredAuthz(m, DeleteOps, dn) {
+	treeDelete := hasTreeDeleteControl(m)
+
+	if !s.RequiredAuthz(ctx, DeleteOps, dn) || (treeDelete && !s.RequiredAuthz(ctx, TreeDeleteOps, dn)) {
 		responseDeleteError(w, NewInsufficientAccess())
 		return
 	}
 
+	readEntry, err := parseReadEntryControls(m, true, false)
+	if err != nil {
+		responseDeleteError(w, err)
+		return
+	}
+	if readEntry != nil {
+		ctx = SetReadEntryContext(ctx, readEntry)
+	}
+
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseDeleteError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		responseDeleteError(w, err)
+		return
+	}
+
+	// LDAP transaction, the operation is applied when the transaction is committed
+	if txn != nil {
+		if err := txn.Queue(ctx, m, dn, readEntry, func(ctx context.Context) error {
+			if treeDelete {
+				return s.Repo().DeleteTreeByDN(ctx, dn)
+			}
+			return s.Repo().DeleteByDN(ctx, dn)
+		}); err != nil {
+			responseDeleteError(w, err)
+			return
+		}
+		log.Printf("info: Queued deleting entry. txnID: %s, dn: %s", txn.ID, dn.DNNormStr())
+		w.Write(ldap.NewDeleteResponse(ldap.LDAPResultSuccess))
+		return
+	}
+
 	log.Printf("info: Deleting entry: %s", dn.DNNormStr())
 
 	i := 0
 Retry:
 
-	err = s.Repo().DeleteByDN(ctx, dn)
+	if treeDelete {
+		err = s.Repo().DeleteTreeByDN(ctx, dn)
+	} else {
+		err = s.Repo().DeleteByDN(ctx, dn)
+	}
 	if err != nil {
 		var retryError *RetryError
 		if ok := xerrors.As(err, &retryError); ok {
@@ -53,7 +115,7 @@ Retry:
 	log.Printf("info: Deleted. dn: %s", dn.DNNormStr())
 
 	res := ldap.NewDeleteResponse(ldap.LDAPResultSuccess)
-	w.Write(res)
+	s.writeWithReadEntry(ctx, w, res, readEntry)
 }
 
 func responseDeleteError(w ldap.ResponseWriter, err error) {
@@ -65,6 +127,7 @@ func responseDeleteError(w ldap.ResponseWriter, err error) {
 		if ldapErr.Msg != "" {
 			res.SetDiagnosticMessage(ldapErr.Msg)
 		}
+		setReferral((*message.LDAPResult)(&res), ldapErr)
 		w.Write(res)
 	} else {
 		log.Printf("error: Delete error. err: %+v", err)
@@ -5,12 +5,28 @@ import (
 	"database/sql"
 	"log"
 
+	"github.com/openstandia/goldap/message"
 	ldap "github.com/openstandia/ldapserver"
 	"golang.org/x/xerrors"
 )
 
 func handleModify(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
-	ctx := SetSessionContext(context.Background(), m)
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseModifyError(w, err)
+		return
+	}
+
+	if !s.RequiredTLS(m) {
+		responseModifyError(w, NewConfidentialityRequired())
+		return
+	}
+
+	txn, err := lookupTransaction(m)
+	if err != nil {
+		responseModifyError(w, err)
+		return
+	}
 
 	r := m.GetModifyRequest()
 	dn, err := s.NormalizeDN(string(r.Object()))
@@ -24,17 +40,36 @@ func handleModify(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
-	if !s.RequiredAuthz(m, ModifyOps, dn) {
+	if !s.RequiredAuthz(ctx, ModifyOps, dn) {
 		responseModifyError(w, NewInsufficientAccess())
 		return
 	}
 
-	log.Printf("info: Modify entry: %s", dn.DNNormStr())
+	readEntry, err := parseReadEntryControls(m, true, true)
+	if err != nil {
+		responseModifyError(w, err)
+		return
+	}
+	if readEntry != nil {
+		ctx = SetReadEntryContext(ctx, readEntry)
+	}
 
-	i := 0
-Retry:
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseModifyError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		responseModifyError(w, err)
+		return
+	}
 
-	err = s.Repo().Update(ctx, dn, func(newEntry *ModifyEntry) error {
+	callback := func(newEntry *ModifyEntry) error {
 		for _, change := range r.Changes() {
 			modification := change.Modification()
 			attrName := string(modification.Type_())
@@ -74,9 +109,33 @@ Retry:
 			return err
 		}
 
+		// The values of the RDN can't be deleted
+		if err := s.schemaMap.ValidateRDN(newEntry.DN(), newEntry.attributes); err != nil {
+			return err
+		}
+
 		return nil
-	})
+	}
+
+	// LDAP transaction, the operation is applied when the transaction is committed
+	if txn != nil {
+		if err := txn.Queue(ctx, m, dn, readEntry, func(ctx context.Context) error {
+			return s.Repo().Update(ctx, dn, callback)
+		}); err != nil {
+			responseModifyError(w, err)
+			return
+		}
+		log.Printf("info: Queued modifying entry. txnID: %s, dn: %s", txn.ID, dn.DNNormStr())
+		w.Write(ldap.NewModifyResponse(ldap.LDAPResultSuccess))
+		return
+	}
+
+	log.Printf("info: Modify entry: %s", dn.DNNormStr())
+
+	i := 0
+Retry:
 
+	err = s.Repo().Update(ctx, dn, callback)
 	if err != nil {
 		var retryError *RetryError
 		if ok := xerrors.As(err, &retryError); ok {
@@ -97,7 +156,7 @@ Retry:
 	}
 
 	res := ldap.NewModifyResponse(ldap.LDAPResultSuccess)
-	w.Write(res)
+	s.writeWithReadEntry(ctx, w, res, readEntry)
 }
 
 func responseModifyError(w ldap.ResponseWriter, err error) {
@@ -109,6 +168,7 @@ func responseModifyError(w ldap.ResponseWriter, err error) {
 		if ldapErr.Msg != "" {
 			res.SetDiagnosticMessage(ldapErr.Msg)
 		}
+		setReferral((*message.LDAPResult)(&res), ldapErr)
 		w.Write(res)
 	} else {
 		log.Printf("error: Modify error. err: %+v", err)
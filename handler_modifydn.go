@@ -4,12 +4,28 @@ import (
 	"context"
 	"log"
 
+	"github.com/openstandia/goldap/message"
 	ldap "github.com/openstandia/ldapserver"
 	"golang.org/x/xerrors"
 )
 
 func handleModifyDN(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
-	ctx := SetSessionContext(context.Background(), m)
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseModifyDNError(w, err)
+		return
+	}
+
+	if !s.RequiredTLS(m) {
+		responseModifyDNError(w, NewConfidentialityRequired())
+		return
+	}
+
+	txn, err := lookupTransaction(m)
+	if err != nil {
+		responseModifyDNError(w, err)
+		return
+	}
 
 	r := m.GetModifyDNRequest()
 	dn, err := s.NormalizeDN(string(r.Entry()))
@@ -22,12 +38,36 @@ func handleModifyDN(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
-	if !s.RequiredAuthz(m, ModRDNOps, dn) {
+	if !s.RequiredAuthz(ctx, ModRDNOps, dn) {
 		responseModifyDNError(w, NewInsufficientAccess())
 		return
 	}
 
-	newDN, oldRDN, err := dn.ModifyRDN(s.schemaMap, string(r.NewRDN()), bool(r.DeleteOldRDN()))
+	readEntry, err := parseReadEntryControls(m, true, true)
+	if err != nil {
+		responseModifyDNError(w, err)
+		return
+	}
+	if readEntry != nil {
+		ctx = SetReadEntryContext(ctx, readEntry)
+	}
+
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseModifyDNError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
+	// The entry held by the other server is referred
+	if err := s.checkReferral(ctx, m, dn); err != nil {
+		responseModifyDNError(w, err)
+		return
+	}
+
+	newDN, err := dn.ModifyRDN(s.schemaMap, string(r.NewRDN()))
 
 	if err != nil {
 		// TODO return correct error
@@ -53,12 +93,35 @@ func handleModifyDN(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 			responseModifyDNError(w, NewInvalidDNSyntax())
 			return
 		}
+
+		// The entry can't be moved to the other server
+		if err := s.checkReferral(ctx, m, newParentDN); err != nil {
+			var ldapErr *LDAPError
+			if ok := xerrors.As(err, &ldapErr); ok && ldapErr.Code == ldap.LDAPResultReferral {
+				err = NewAffectsMultipleDSAs()
+			}
+			responseModifyDNError(w, err)
+			return
+		}
+	}
+
+	// LDAP transaction, the operation is applied when the transaction is committed
+	if txn != nil {
+		if err := txn.Queue(ctx, m, dn, readEntry, func(ctx context.Context) error {
+			return s.Repo().UpdateDN(ctx, dn, newDN, bool(r.DeleteOldRDN()))
+		}); err != nil {
+			responseModifyDNError(w, err)
+			return
+		}
+		log.Printf("info: Queued modifying DN. txnID: %s, dn: %s", txn.ID, dn.DNNormStr())
+		w.Write(ldap.NewModifyDNResponse(ldap.LDAPResultSuccess))
+		return
 	}
 
 	i := 0
 Retry:
 
-	err = s.Repo().UpdateDN(ctx, dn, newDN, oldRDN)
+	err = s.Repo().UpdateDN(ctx, dn, newDN, bool(r.DeleteOldRDN()))
 	if err != nil {
 		var retryError *RetryError
 		if ok := xerrors.As(err, &retryError); ok {
@@ -77,7 +140,7 @@ Retry:
 	}
 
 	res := ldap.NewModifyDNResponse(ldap.LDAPResultSuccess)
-	w.Write(res)
+	s.writeWithReadEntry(ctx, w, res, readEntry)
 }
 
 func responseModifyDNError(w ldap.ResponseWriter, err error) {
@@ -89,6 +152,7 @@ func responseModifyDNError(w ldap.ResponseWriter, err error) {
 		if ldapErr.Msg != "" {
 			res.SetDiagnosticMessage(ldapErr.Msg)
 		}
+		setReferral((*message.LDAPResult)(&res), ldapErr)
 		w.Write(res)
 	} else {
 		log.Printf("error: ModifyDN error. err: %+v", err)
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+const generatedPasswordLength = 12
+
+func init() {
+	RegisterSupportedExtension(string(ldap.NoticeOfPasswordModify), nil)
+}
+
+// PasswdModifyRequest is the request value of the password modify extended operation.
+// https://datatracker.ietf.org/doc/html/rfc3062#section-2
+//
+//	PasswdModifyRequestValue ::= SEQUENCE {
+//	  userIdentity    [0]  OCTET STRING OPTIONAL
+//	  oldPasswd       [1]  OCTET STRING OPTIONAL
+//	  newPasswd       [2]  OCTET STRING OPTIONAL }
+type PasswdModifyRequest struct {
+	UserIdentity *string
+	OldPasswd    *string
+	NewPasswd    *string
+}
+
+func parsePasswdModifyRequest(value *message.OCTETSTRING) (*PasswdModifyRequest, error) {
+	req := &PasswdModifyRequest{}
+
+	// All fields are optional
+	if value == nil || len(*value) == 0 {
+		return req, nil
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*value))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decode password modify request. err: %w", err)
+	}
+	if packet.ClassType != ber.ClassUniversal || packet.Tag != ber.TagSequence {
+		return nil, xerrors.Errorf("Invalid password modify request. class: %d, tag: %d", packet.ClassType, packet.Tag)
+	}
+
+	for _, child := range packet.Children {
+		if child.ClassType != ber.ClassContext {
+			return nil, xerrors.Errorf("Invalid password modify request field. class: %d", child.ClassType)
+		}
+		v := child.Data.String()
+
+		switch child.Tag {
+		case 0:
+			req.UserIdentity = &v
+		case 1:
+			req.OldPasswd = &v
+		case 2:
+			req.NewPasswd = &v
+		default:
+			return nil, xerrors.Errorf("Invalid password modify request field. tag: %d", child.Tag)
+		}
+	}
+
+	return req, nil
+}
+
+//	PasswdModifyResponseValue ::= SEQUENCE {
+//	  genPasswd       [0]     OCTET STRING OPTIONAL }
+func newPasswdModifyResponse(genPasswd string) (message.ExtendedResponse, error) {
+	if genPasswd == "" {
+		return ldap.NewExtendedResponse(ldap.LDAPResultSuccess), nil
+	}
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PasswdModifyResponseValue")
+	packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, genPasswd, "genPasswd"))
+
+	return newExtendedResponse(ldap.LDAPResultSuccess, "", packet.Bytes())
+}
+
+func handlePasswordModify(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	if !s.RequiredTLS(m) {
+		responseExtendedError(w, NewConfidentialityRequired())
+		return
+	}
+
+	r := m.GetExtendedRequest()
+
+	req, err := parsePasswdModifyRequest(r.RequestValue())
+	if err != nil {
+		log.Printf("warn: Invalid password modify request. err: %+v", err)
+		responseExtendedError(w, NewProtocolError("decoding error"))
+		return
+	}
+
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+	if session.DN == nil {
+		responseExtendedError(w, NewUnwillingToPerform("only authenticated users may change passwords"))
+		return
+	}
+
+	// Change own password if the userIdentity isn't specified
+	dn := session.DN
+	if req.UserIdentity != nil {
+		dn, err = s.NormalizeDN(strings.TrimPrefix(*req.UserIdentity, "dn:"))
+		if err != nil {
+			log.Printf("warn: Invalid userIdentity: %s, err: %s", *req.UserIdentity, err)
+			responseExtendedError(w, NewInvalidDNSyntax())
+			return
+		}
+	}
+
+	if !dn.Equal(session.DN) && !s.RequiredAuthz(ctx, ModifyOps, dn) {
+		responseExtendedError(w, NewInsufficientAccess())
+		return
+	}
+
+	// The password of the rootdn is managed by the configuration
+	if dn.Equal(s.GetRootDN()) {
+		responseExtendedError(w, NewUnwillingToPerform("unwilling to change the password of the rootdn"))
+		return
+	}
+
+	// Invalid suffix
+	if s.NamingContextOf(dn) == nil {
+		responseExtendedError(w, NewNoSuchObject())
+		return
+	}
+
+	var genPasswd string
+	var newPasswd string
+	if req.NewPasswd != nil && *req.NewPasswd != "" {
+		newPasswd = *req.NewPasswd
+	} else {
+		genPasswd, err = generatePassword(generatedPasswordLength)
+		if err != nil {
+			responseExtendedError(w, err)
+			return
+		}
+		newPasswd = genPasswd
+	}
+
+	hashed, err := hashPassword(s.config.PasswordHashScheme, newPasswd)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	log.Printf("info: Modify password: %s", dn.DNNormStr())
+
+	i := 0
+Retry:
+
+	err = s.Repo().Update(ctx, dn, func(current *ModifyEntry) error {
+		if req.OldPasswd != nil {
+			cred, ok := current.attributes["userPassword"]
+			if !ok || !validateCreds(s, *req.OldPasswd, &FetchedCredential{Credential: cred.Orig()}) {
+				log.Printf("info: Password modify failed - Invalid old password. dn_norm: %s", dn.DNNormStr())
+				return NewInvalidCredentials()
+			}
+		}
+
+		if err := current.Replace("userPassword", []string{hashed}); err != nil {
+			return err
+		}
+
+		// Reset the password policy state
+		if err := current.ReplaceOperational("pwdFailureTime", []string{}); err != nil {
+			return err
+		}
+		if err := current.ReplaceOperational("pwdAccountLockedTime", []string{}); err != nil {
+			return err
+		}
+		if err := current.ReplaceOperational("pwdChangedTime", []string{time.Now().In(time.UTC).Format(TIMESTAMP_FORMAT)}); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		var retryError *RetryError
+		if ok := xerrors.As(err, &retryError); ok {
+			if i < maxRetry {
+				i++
+				log.Printf("warn: Detect consistency error. Do retry. try_count: %d", i)
+				goto Retry
+			}
+			log.Printf("error: Give up to retry. try_count: %d", i)
+		}
+
+		responseExtendedError(w, err)
+		return
+	}
+
+	log.Printf("info: Modified password. dn: %s", dn.DNNormStr())
+
+	res, err := newPasswdModifyResponse(genPasswd)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+	w.Write(res)
+}
+
+func responseExtendedError(w ldap.ResponseWriter, err error) {
+	var ldapErr *LDAPError
+	if ok := xerrors.As(err, &ldapErr); ok {
+		log.Printf("warn: Extended LDAP error. err: %+v", err)
+
+		res := ldap.NewExtendedResponse(ldapErr.Code)
+		if ldapErr.Msg != "" {
+			res.SetDiagnosticMessage(ldapErr.Msg)
+		}
+		w.Write(res)
+	} else {
+		log.Printf("error: Extended error. err: %+v", err)
+
+		res := ldap.NewExtendedResponse(ldap.LDAPResultOperationsError)
+		w.Write(res)
+	}
+}
@@ -17,29 +17,32 @@ func handleSearchDSE(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	log.Printf("info: Request Attributes=%s", r.Attributes())
 	log.Printf("info: Request TimeLimit=%d", r.TimeLimit().Int())
 
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
+
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
+
 	e := ldap.NewSearchResultEntry("")
-	// e.AddAttribute("vendorName", "OpenStandia")
-	// e.AddAttribute("vendorVersion", "0.0.1")
-	// e.AddAttribute("objectClass", "top")
-	// e.AddAttribute("namingContexts", "ou=system", "ou=schema", "dc=example,dc=com", "ou=config")
-
-	searchEntry := NewSearchEntry(s.schemaMap, "", map[string][]string{
-		"objectClass":          {"top"},
-		"subschemaSubentry":    {"cn=Subschema"},
-		"namingContexts":       {s.GetSuffix()},
-		"supportedLDAPVersion": {"3"},
-		"supportedFeatures": {
-			"1.3.6.1.4.1.4203.1.5.1",
-		},
-		"supportedControl": {
-			"1.2.840.113556.1.4.319",
-		},
-	})
+
+	// The contextCSN is published on each suffix entry since it's the state of the naming context
+	searchEntry := NewSearchEntry(s.schemaMap, "", rootDSEAttrs(s))
 
 	sentAttrs := map[string]struct{}{}
 
 	if isAllAttributesRequested(r) {
 		for k, v := range searchEntry.GetAttrsOrigWithoutOperationalAttrs() {
+			if !s.simpleACL.CanVisible(session, k) {
+				log.Printf("- Ignore Attribute %s", k)
+				continue
+			}
+
 			log.Printf("- Attribute %s: %#v", k, v)
 
 			av := make([]message.AttributeValue, len(v))
@@ -55,6 +58,11 @@ func handleSearchDSE(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	for _, attr := range r.Attributes() {
 		a := string(attr)
 
+		if !s.simpleACL.CanVisible(session, a) {
+			log.Printf("- Ignore Attribute %s", a)
+			continue
+		}
+
 		log.Printf("Requested attr: %s", a)
 
 		if a != "+" {
@@ -83,6 +91,11 @@ func handleSearchDSE(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 
 	if isOperationalAttributesRequested(r) {
 		for k, v := range searchEntry.GetOperationalAttrsOrig() {
+			if !s.simpleACL.CanVisible(session, k) {
+				log.Printf("- Ignore Attribute %s", k)
+				continue
+			}
+
 			if _, ok := sentAttrs[k]; !ok {
 				av := make([]message.AttributeValue, len(v))
 				for i, vv := range v {
@@ -93,7 +106,6 @@ func handleSearchDSE(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		}
 	}
 
-	// e.AddAttribute("supportedExtension", "1.3.6.1.4.1.1466.20036", "1.3.6.1.4.1.4203.1.11.1", "1.3.6.1.4.1.18060.0.1.5", "1.3.6.1.4.1.18060.0.1.3", "1.3.6.1.4.1.1466.20037")
 	w.Write(e)
 
 	res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultSuccess)
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"context"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/openstandia/goldap/message"
@@ -10,12 +10,30 @@ import (
 	"golang.org/x/xerrors"
 )
 
+// Simple Paged Results Manipulation
+// https://datatracker.ietf.org/doc/html/rfc2696
+const PagedResultsControlOID = "1.2.840.113556.1.4.319"
+
+func init() {
+	RegisterSupportedControl(PagedResultsControlOID, nil)
+	RegisterSupportedFeature(AllOperationalAttributesFeatureOID, nil)
+}
+
 func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
-	ctx := SetSessionContext(context.Background(), m)
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
 
 	r := m.GetSearchRequest()
 
 	var pageControl *message.SimplePagedResultsControl
+	var sortControl *SortControl
+	var vlvControl *VLVControl
+	var matchedValues []message.Filter
+	var psearchControl *PersistentSearchControl
+	var syncControl *SyncRequestControl
 
 	if m.Controls() != nil {
 		for _, con := range *m.Controls() {
@@ -23,6 +41,46 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 			if pc, ok := con.PagedResultsControl(); ok {
 				pageControl = pc
 			}
+			if string(con.ControlType()) == SortRequestControlOID {
+				sc, err := parseSortControl(&con)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				sortControl = sc
+			}
+			if string(con.ControlType()) == VLVRequestControlOID {
+				vc, err := parseVLVControl(&con)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				vlvControl = vc
+			}
+			if string(con.ControlType()) == MatchedValuesControlOID {
+				mv, err := parseMatchedValuesControl(&con)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				matchedValues = mv
+			}
+			if string(con.ControlType()) == PersistentSearchControlOID {
+				pc, err := parsePersistentSearchControl(&con)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				psearchControl = pc
+			}
+			if string(con.ControlType()) == SyncRequestControlOID {
+				sc, err := parseSyncRequestControl(&con)
+				if err != nil {
+					responseSearchError(w, err)
+					return
+				}
+				syncControl = sc
+			}
 		}
 
 		if pageControl != nil {
@@ -30,13 +88,30 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		}
 	}
 
+	// The persistent search keeps the search open, it can't be used with the paged results, sort and virtual list view
+	if psearchControl != nil && (pageControl != nil || sortControl != nil || vlvControl != nil) {
+		res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultUnwillingToPerform)
+		res.SetDiagnosticMessage("persistent search can't be used with the paged results, sort or virtual list view")
+		w.Write(res)
+		return
+	}
+
+	// The content synchronization returns the entries in the change order
+	if syncControl != nil && (psearchControl != nil || pageControl != nil || sortControl != nil || vlvControl != nil) {
+		res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultUnwillingToPerform)
+		res.SetDiagnosticMessage("content synchronization can't be used with the persistent search, paged results, sort or virtual list view")
+		w.Write(res)
+		return
+	}
+
 	log.Printf("info: handleGenericSearch baseDN=%s, scope=%d, sizeLimit=%d, filter=%s, attributes=%s, timeLimit=%d",
 		r.BaseObject(), r.Scope(), r.SizeLimit(), r.FilterString(), r.Attributes(), r.TimeLimit().Int())
 
-	// Handle Stop Signal (server stop / client disconnected / Abandoned request....)
+	// Handle Stop Signal (server stop / client disconnected / Abandoned or canceled request....)
 	select {
-	case <-m.Done:
+	case <-ctx.Done():
 		log.Print("info: Leaving handleSearch...")
+		w.Write(ldap.NewSearchResultDoneResponse(LDAPResultCanceled))
 		return
 	default:
 	}
@@ -74,12 +149,81 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	}
 
 	// Phase 2: authorization
-	if !s.RequiredAuthz(m, SearchOps, baseDN) {
+	if !s.RequiredAuthz(ctx, SearchOps, baseDN) {
 		// Return 32 No such object
 		responseSearchError(w, NewNoSuchObject())
 		return
 	}
 
+	assertion, err := parseAssertionControl(m)
+	if err != nil {
+		responseSearchError(w, err)
+		return
+	}
+	if assertion != nil {
+		ctx = SetAssertionContext(ctx, assertion)
+	}
+
+	// The base object held by the other server is referred
+	if err := s.checkReferral(ctx, m, baseDN); err != nil {
+		responseSearchError(w, err)
+		return
+	}
+
+	// Phase 3: resolve sort keys
+	var sortKeys []*SortKey
+	var resControls message.Controls
+
+	if sortControl != nil {
+		var sortResult int
+		var sortAttr string
+		sortKeys, sortResult, sortAttr = s.resolveSortKeys(sortControl.Keys)
+
+		sc, err := newSortResponseControl(sortResult, sortAttr)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		resControls = append(resControls, sc)
+
+		// The server returns the entries without sorting if the control isn't critical
+		if sortResult != ldap.LDAPResultSuccess && sortControl.Criticality {
+			res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultUnavailableCriticalExtension)
+			res.SetDiagnosticMessage("unsortable attribute: " + sortAttr)
+			w.WriteControls(res, &resControls)
+			return
+		}
+	}
+
+	// Phase 3: resolve virtual list view
+	var vlvOption *VLVOption
+
+	if vlvControl != nil {
+		vlvResult := ldap.LDAPResultSuccess
+		if sortControl == nil {
+			log.Printf("info: VLV requires the sort control")
+			vlvResult = LDAPResultSortControlMissing
+		} else if len(sortKeys) == 0 || pageControl != nil {
+			log.Printf("info: VLV requires the sortable keys and can't be used with the paged results")
+			vlvResult = ldap.LDAPResultUnwillingToPerform
+		} else {
+			vlvOption, vlvResult = s.resolveVLVOption(vlvControl, sortKeys)
+		}
+
+		if vlvResult != ldap.LDAPResultSuccess {
+			vc, err := newVLVResponseControl(0, 0, vlvResult, vlvControl.ContextID)
+			if err != nil {
+				responseSearchError(w, err)
+				return
+			}
+			resControls = append(resControls, vc)
+
+			res := ldap.NewSearchResultDoneResponse(vlvResult)
+			w.WriteControls(res, &resControls)
+			return
+		}
+	}
+
 	// Phase 4: execute SQL and return entries
 	var pageSize int32 = s.config.DefaultPageSize
 	if pageControl != nil {
@@ -88,12 +232,16 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 
 	sessionMap := getPageSession(m)
 	var cusor int64
+	var sortCursor *SortCursor
+	var pageState *PageState
 	if pageControl != nil {
 		reqCookie := pageControl.Cookie()
 		if reqCookie != "" {
 			var ok bool
-			if cusor, ok = sessionMap[reqCookie]; ok {
+			if pageState, ok = sessionMap[reqCookie]; ok {
 				log.Printf("debug: paged results cookie is ok")
+				cusor = pageState.Cursor
+				sortCursor = pageState.SortCursor
 
 				// clear cookie
 				delete(sessionMap, reqCookie)
@@ -114,13 +262,119 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		Filter:                     r.Filter(),
 		PageSize:                   pageSize,
 		Cursor:                     &cusor,
+		SortKeys:                   sortKeys,
+		SortCursor:                 sortCursor,
+		VLV:                        vlvOption,
 		RequestedAssocation:        getRequestedMemberAttrs(r),
 		IsMemberOfRequested:        isMemberOfRequested(r),
 		IsHasSubordinatesRequested: isHasSubOrdinatesRequested(r),
+		MatchedValues:              matchedValues,
+		IsContextCSNRequested:      isContextCSNRequested(r),
+		DerefAliases:               int(r.DerefAliases()),
+		ManageDsaIT:                hasManageDsaITControl(m),
+	}
+
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		responseSearchError(w, err)
+		return
 	}
 
+	// Phase 5: resolve size limit and time limit, the administrative limits are used if they are smaller than the requested
+	adminLimit := s.searchLimits.Get(session)
+	sizeLimit, timeLimit := adminLimit.Resolve(int(r.SizeLimit().Int()), int(r.TimeLimit().Int()))
+	if timeLimit > 0 {
+		option.Deadline = time.Now().Add(time.Duration(timeLimit) * time.Second)
+	}
+
+	// The sync and persistent search apply the limits to the refresh phase only
+	if syncControl != nil {
+		s.syncSearch(ctx, w, m, baseDN, option, sizeLimit, syncControl, func(searchEntry *SearchEntry, controls *message.Controls) error {
+			if matchedValues != nil {
+				searchEntry = s.filterMatchedValues(matchedValues, searchEntry)
+			}
+			responseEntry(s, w, session, r, searchEntry, controls)
+			return nil
+		})
+		return
+	}
+
+	if psearchControl != nil {
+		s.persistentSearch(ctx, w, m, baseDN, option, sizeLimit, psearchControl, func(searchEntry *SearchEntry, controls *message.Controls) error {
+			if matchedValues != nil {
+				searchEntry = s.filterMatchedValues(matchedValues, searchEntry)
+			}
+			responseEntry(s, w, session, r, searchEntry, controls)
+			return nil
+		})
+		return
+	}
+
+	// The size limit applies to the total entries of the paged results, the remaining size is kept with the cookie
+	if pageState != nil {
+		sizeLimit = pageState.RemainingSize
+	}
+
+	// The virtual list view can't return the window larger than the administrative limit,
+	// and the window larger than the requested limit is truncated
+	if vlvOption != nil && vlvWindowExceeds(vlvOption.BeforeCount, vlvOption.AfterCount, int64(adminLimit.SizeLimit)) {
+		log.Printf("info: Exceeded administrative size limit by VLV window. sizeLimit: %d", adminLimit.SizeLimit)
+
+		vc, err := newVLVResponseControl(0, 0, ldap.LDAPResultAdminLimitExceeded, vlvControl.ContextID)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		resControls = append(resControls, vc)
+
+		res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultAdminLimitExceeded)
+		w.WriteControls(res, &resControls)
+		return
+	}
+
+	// The size limit is applied as the page size, then the remaining entry means exceeding the size limit
+	sizeLimited := false
+	if sizeLimit > 0 && sizeLimit <= int(option.PageSize) && vlvOption == nil {
+		option.PageSize = int32(sizeLimit)
+		sizeLimited = true
+	}
+
+	// The referral entries in the search scope are returned as the continuation references regardless of the filter
+	manageDsaIT := option.ManageDsaIT
+	if !manageDsaIT && scope != 0 {
+		referralFilter, err := compileFilter("(objectClass=referral)")
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		option.Filter = message.FilterOr{option.Filter, referralFilter}
+	}
+
+	sent := 0
+	vlvTruncated := false
+
 	count, nextId, err := s.Repo().Search(ctx, baseDN, option, func(searchEntry *SearchEntry) error {
-		responseEntry(s, w, m, r, searchEntry)
+		// The continuation references aren't entries, they don't count toward the size limit
+		if !manageDsaIT && isReferralEntry(searchEntry) {
+			ref, err := newSearchResultReference(s, searchEntry, scope)
+			if err != nil {
+				return err
+			}
+			if len(ref) > 0 {
+				w.Write(ref)
+			}
+			return nil
+		}
+
+		if vlvOption != nil && sizeLimit > 0 && sent >= sizeLimit {
+			vlvTruncated = true
+			return nil
+		}
+		sent++
+		if matchedValues != nil {
+			searchEntry = s.filterMatchedValues(matchedValues, searchEntry)
+		}
+		responseEntry(s, w, session, r, searchEntry, nil)
 		return nil
 	})
 	if err != nil {
@@ -128,49 +382,101 @@ func handleSearch(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 		return
 	}
 
+	if vlvOption != nil {
+		vc, err := newVLVResponseControl(vlvOption.TargetPosition, vlvOption.TotalCount, ldap.LDAPResultSuccess, vlvControl.ContextID)
+		if err != nil {
+			responseSearchError(w, err)
+			return
+		}
+		resControls = append(resControls, vc)
+	}
+
 	if count == 0 {
 		log.Printf("debug: Not found")
 
 		// Must return success if no hit
 		res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultSuccess)
-		w.Write(res)
+		if len(resControls) > 0 {
+			w.WriteControls(res, &resControls)
+		} else {
+			w.Write(res)
+		}
 		return
 	}
 
+	resultCode := ldap.LDAPResultSuccess
 	var nextCookie string
 
-	if count == option.PageSize+1 {
-		uuid, _ := uuid.NewRandom()
-		nextCookie = uuid.String()
+	if vlvTruncated {
+		// The returned window is partial results
+		log.Printf("info: Exceeded size limit by VLV window. sizeLimit: %d", sizeLimit)
+		resultCode = ldap.LDAPResultSizeLimitExceeded
+	}
+
+	// The virtual list view returns only the window of the target
+	if count == option.PageSize+1 && vlvOption == nil {
+		if sizeLimited {
+			// The returned entries are partial results
+			log.Printf("info: Exceeded size limit. sizeLimit: %d", sizeLimit)
+			resultCode = ldap.LDAPResultSizeLimitExceeded
+		} else {
+			uuid, _ := uuid.NewRandom()
+			nextCookie = uuid.String()
+
+			remainingSize := 0
+			if sizeLimit > 0 {
+				remainingSize = sizeLimit - int(option.PageSize)
+			}
 
-		sessionMap := getPageSession(m)
-		sessionMap[nextCookie] = nextId
+			sessionMap := getPageSession(m)
+			sessionMap[nextCookie] = &PageState{
+				Cursor:        nextId,
+				SortCursor:    option.SortCursor,
+				RemainingSize: remainingSize,
+			}
+		}
 	}
 
-	res := ldap.NewSearchResultDoneResponse(ldap.LDAPResultSuccess)
+	res := ldap.NewSearchResultDoneResponse(resultCode)
 
 	if pageControl != nil {
 		// https://www.ietf.org/rfc/rfc2696.txt
 		control := message.NewSimplePagedResultsControl(0, false, nextCookie)
-		var controls message.Controls = []message.Control{control}
+		resControls = append(resControls, control)
+	}
 
-		w.WriteControls(res, &controls)
+	if len(resControls) > 0 {
+		w.WriteControls(res, &resControls)
 	} else {
 		w.Write(res)
 	}
 }
 
-func responseEntry(s *Server, w ldap.ResponseWriter, m *ldap.Message, r message.SearchRequest, searchEntry *SearchEntry) {
+func responseEntry(s *Server, w ldap.ResponseWriter, session *AuthSession, r message.SearchRequest, searchEntry *SearchEntry, controls *message.Controls) {
 	log.Printf("Response Entry: %+v", searchEntry)
 
-	session := getAuthSession(m)
+	e := newSearchResultEntry(s, session, r.Attributes(), searchEntry)
+
+	if r.TypesOnly() {
+		e = newTypesOnlySearchResultEntry(searchEntry.DNOrigWithSuffix(), e)
+	}
+
+	if controls != nil {
+		w.WriteControls(e, controls)
+	} else {
+		w.Write(e)
+	}
+
+	log.Printf("Response an entry. dn: %s", searchEntry.DNOrig())
+}
 
-	dnOrig := searchEntry.DNOrig()
-	e := ldap.NewSearchResultEntry(resolveSuffix(s, dnOrig))
+// newSearchResultEntry returns the entry with the selected attributes which are visible for the session.
+func newSearchResultEntry(s *Server, session *AuthSession, attrs message.AttributeSelection, searchEntry *SearchEntry) message.SearchResultEntry {
+	e := ldap.NewSearchResultEntry(searchEntry.DNOrigWithSuffix())
 
 	sentAttrs := map[string]struct{}{}
 
-	if isAllAttributesRequested(r) {
+	if isAllAttributesSelected(attrs) {
 		for k, v := range searchEntry.GetAttrsOrigWithoutOperationalAttrs() {
 			if !s.simpleACL.CanVisible(session, k) {
 				log.Printf("- Ignore Attribute %s", k)
@@ -183,13 +489,13 @@ func responseEntry(s *Server, w ldap.ResponseWriter, m *ldap.Message, r message.
 			for i, vv := range v {
 				av[i] = message.AttributeValue(vv)
 			}
-			e.AddAttribute(message.AttributeDescription(k), av...)
+			e.AddAttribute(message.AttributeDescription(searchEntry.TransferAttributeDescription(k)), av...)
 
 			sentAttrs[k] = struct{}{}
 		}
 	}
 
-	for _, attr := range r.Attributes() {
+	for _, attr := range attrs {
 		a := string(attr)
 
 		if !s.simpleACL.CanVisible(session, a) {
@@ -200,30 +506,33 @@ func responseEntry(s *Server, w ldap.ResponseWriter, m *ldap.Message, r message.
 		log.Printf("Requested attr: %s", a)
 
 		if a != "+" {
-			k, values, ok := searchEntry.GetAttrOrig(a)
+			// The subtypes are also returned, e.g. cn returns cn;lang-ja
+			subtypes, ok := searchEntry.GetAttrsOrigWithSubtypes(a)
 			if !ok {
 				log.Printf("No schema for requested attr, ignore. attr: %s", a)
 				continue
 			}
 
-			if _, ok := sentAttrs[k]; ok {
-				log.Printf("Already sent, ignore. attr: %s", a)
-				continue
-			}
+			for k, values := range subtypes {
+				if _, ok := sentAttrs[k]; ok {
+					log.Printf("Already sent, ignore. attr: %s", k)
+					continue
+				}
 
-			log.Printf("- Attribute %s=%#v", a, values)
+				log.Printf("- Attribute %s=%#v", k, values)
 
-			av := make([]message.AttributeValue, len(values))
-			for i, vv := range values {
-				av[i] = message.AttributeValue(vv)
-			}
-			e.AddAttribute(message.AttributeDescription(k), av...)
+				av := make([]message.AttributeValue, len(values))
+				for i, vv := range values {
+					av[i] = message.AttributeValue(vv)
+				}
+				e.AddAttribute(message.AttributeDescription(searchEntry.TransferAttributeDescription(k)), av...)
 
-			sentAttrs[k] = struct{}{}
+				sentAttrs[k] = struct{}{}
+			}
 		}
 	}
 
-	if isOperationalAttributesRequested(r) {
+	if isOperationalAttributesSelected(attrs) {
 		for k, v := range searchEntry.GetOperationalAttrsOrig() {
 			if !s.simpleACL.CanVisible(session, k) {
 				log.Printf("- Ignore Attribute %s", k)
@@ -240,9 +549,16 @@ func responseEntry(s *Server, w ldap.ResponseWriter, m *ldap.Message, r message.
 		}
 	}
 
-	w.Write(e)
+	return e
+}
 
-	log.Printf("Response an entry. dn: %s", dnOrig)
+// newTypesOnlySearchResultEntry returns the entry which has only the attribute descriptions without the values.
+func newTypesOnlySearchResultEntry(dn string, e message.SearchResultEntry) message.SearchResultEntry {
+	typesOnly := ldap.NewSearchResultEntry(dn)
+	for _, attr := range e.Attributes() {
+		typesOnly.AddAttribute(attr.Type_())
+	}
+	return typesOnly
 }
 
 func responseSearchError(w ldap.ResponseWriter, err error) {
@@ -253,6 +569,7 @@ func responseSearchError(w ldap.ResponseWriter, err error) {
 		}
 
 		res := ldap.NewSearchResultDoneResponse(ldapErr.Code)
+		setReferral((*message.LDAPResult)(&res), ldapErr)
 		w.Write(res)
 	} else {
 		log.Printf("error: Search error. err: %+v", err)
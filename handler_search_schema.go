@@ -18,10 +18,11 @@ func handleSearchSubschema(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
 	log.Printf("Request Attributes=%s", r.Attributes())
 	log.Printf("Request TimeLimit=%d", r.TimeLimit().Int())
 
-	// Handle Stop Signal (server stop / client disconnected / Abandoned request....)
+	// Handle Stop Signal (server stop / client disconnected / Abandoned or canceled request....)
 	select {
-	case <-m.Done:
+	case <-s.RequestContext(m).Done():
 		log.Print("info: Leaving handleSearchSubschema...")
+		w.Write(ldap.NewSearchResultDoneResponse(LDAPResultCanceled))
 		return
 	default:
 	}
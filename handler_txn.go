@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+// handleStartTransaction starts the LDAP transaction in the connection.
+// https://datatracker.ietf.org/doc/html/rfc5805#section-2.1
+//
+// The response has the transaction identifier as the responseValue.
+func handleStartTransaction(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	if !s.RequiredTLS(m) {
+		responseExtendedError(w, NewConfidentialityRequired())
+		return
+	}
+
+	r := m.GetExtendedRequest()
+	if r.RequestValue() != nil {
+		responseExtendedError(w, NewProtocolError("start transaction request value must be absent"))
+		return
+	}
+
+	txn := getTxnSession(m).Start()
+
+	log.Printf("info: Started transaction. txnID: %s", txn.ID)
+
+	res, err := newExtendedResponse(ldap.LDAPResultSuccess, "", []byte(txn.ID))
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+	w.Write(res)
+}
+
+// handleEndTransaction commits or aborts the LDAP transaction.
+// https://datatracker.ietf.org/doc/html/rfc5805#section-3.2
+//
+// The queued update operations are applied in one repository transaction.
+// If one of them fails, nothing is applied and the response has the message ID of the failed operation.
+func handleEndTransaction(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	r := m.GetExtendedRequest()
+	commit, txnID, err := parseEndTransactionRequest(r.RequestValue())
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	txn, ok := getTxnSession(m).End(txnID)
+	if !ok {
+		responseExtendedError(w, NewUnwillingToPerform("invalid transaction identifier"))
+		return
+	}
+
+	if !commit {
+		log.Printf("info: Aborted transaction. txnID: %s", txnID)
+		w.Write(ldap.NewExtendedResponse(ldap.LDAPResultSuccess))
+		return
+	}
+
+	ops := txn.Operations()
+
+	// The queued operations are committed in one DB transaction of the naming context
+	dn, err := s.txnNamingContextDN(ops)
+	if err != nil {
+		log.Printf("info: Refused transaction. txnID: %s, err: %v", txnID, err)
+		responseExtendedError(w, err)
+		return
+	}
+
+	log.Printf("info: Committing transaction. txnID: %s, operations: %d", txnID, len(ops))
+
+	var failed *TxnOperation
+
+	i := 0
+Retry:
+
+	failed = nil
+	err = s.Repo().Transaction(s.RequestContext(m), dn, func(ctx context.Context) error {
+		for _, op := range ops {
+			if err := op.execute(joinContext(op.ctx, ctx)); err != nil {
+				failed = op
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		var retryError *RetryError
+		if ok := xerrors.As(err, &retryError); ok {
+			if i < maxRetry {
+				i++
+				log.Printf("warn: Detect consistency error. Do retry. try_count: %d", i)
+				goto Retry
+			}
+			log.Printf("error: Give up to retry. try_count: %d", i)
+		}
+
+		log.Printf("info: Failed to commit transaction. txnID: %s, err: %+v", txnID, err)
+
+		responseEndTransactionError(w, failed, err)
+		return
+	}
+
+	log.Printf("info: Committed transaction. txnID: %s", txnID)
+
+	// The operations were already committed, return the response without the controls if it fails
+	value, err := s.newEndTransactionResponseValue(ops)
+	if err != nil {
+		log.Printf("error: Failed to create update controls. err: %+v", err)
+	}
+
+	res, err := newExtendedResponse(ldap.LDAPResultSuccess, "", value)
+	if err != nil {
+		log.Printf("error: Failed to create end transaction response. err: %+v", err)
+		res = ldap.NewExtendedResponse(ldap.LDAPResultSuccess)
+	}
+	w.Write(res)
+}
+
+// txnNamingContextDN returns the DN of the queued operations to route the transaction to the naming context.
+// It returns affectsMultipleDSAs error if the operations span several naming contexts
+// since they can't be committed atomically. It returns nil if no operation is queued.
+func (s *Server) txnNamingContextDN(ops []*TxnOperation) (*DN, error) {
+	var dn *DN
+	var nc *NamingContext
+
+	for _, op := range ops {
+		opNC := s.NamingContextOf(op.DN)
+		if dn == nil {
+			dn, nc = op.DN, opNC
+			continue
+		}
+		if opNC != nc {
+			return nil, NewAffectsMultipleDSAs()
+		}
+	}
+	return dn, nil
+}
+
+// parseEndTransactionRequest returns the commit flag and the transaction identifier.
+//
+//	txnEndReq ::= SEQUENCE {
+//	        commit         BOOLEAN DEFAULT TRUE,
+//	        identifier     OCTET STRING }
+func parseEndTransactionRequest(value *message.OCTETSTRING) (bool, string, error) {
+	if value == nil {
+		return false, "", NewProtocolError("end transaction request value is required")
+	}
+
+	packet, err := ber.DecodePacketErr([]byte(*value))
+	if err != nil || packet.Tag != ber.TagSequence || len(packet.Children) == 0 || len(packet.Children) > 2 {
+		return false, "", NewProtocolError("invalid end transaction request value")
+	}
+
+	commit := true
+	if len(packet.Children) == 2 {
+		v, ok := packet.Children[0].Value.(bool)
+		if !ok {
+			return false, "", NewProtocolError("invalid end transaction commit")
+		}
+		commit = v
+	}
+
+	id := packet.Children[len(packet.Children)-1]
+	if id.Tag != ber.TagOctetString {
+		return false, "", NewProtocolError("invalid end transaction identifier")
+	}
+
+	return commit, id.Data.String(), nil
+}
+
+// newEndTransactionResponseValue returns the response controls of the committed operations, e.g. post-read control.
+// It returns nil if no operation has the response controls.
+//
+//	txnEndRes ::= SEQUENCE {
+//	        messageID MessageID OPTIONAL,
+//	        updatesControls SEQUENCE OF updateControls SEQUENCE {
+//	                messageID MessageID,
+//	                controls  Controls } OPTIONAL }
+func (s *Server) newEndTransactionResponseValue(ops []*TxnOperation) ([]byte, error) {
+	updatesControls := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "updatesControls")
+
+	for _, op := range ops {
+		controls, err := s.readEntryResponseControls(op.ctx, op.readEntry)
+		if err != nil {
+			return nil, err
+		}
+		if controls == nil {
+			continue
+		}
+
+		uc := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "updateControls")
+		uc.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, op.MessageID, "messageID"))
+
+		cp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "controls")
+		for _, c := range *controls {
+			cp.AppendChild(encodeControl(c))
+		}
+		uc.AppendChild(cp)
+
+		updatesControls.AppendChild(uc)
+	}
+
+	if len(updatesControls.Children) == 0 {
+		return nil, nil
+	}
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "txnEndRes")
+	packet.AppendChild(updatesControls)
+	return packet.Bytes(), nil
+}
+
+// responseEndTransactionError returns the error of the failed operation with its message ID.
+// The message ID is omitted if the transaction failed on committing.
+func responseEndTransactionError(w ldap.ResponseWriter, failed *TxnOperation, err error) {
+	if failed == nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	code := ldap.LDAPResultOperationsError
+	var ldapErr *LDAPError
+	if ok := xerrors.As(err, &ldapErr); ok {
+		code = ldapErr.Code
+	}
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "txnEndRes")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, failed.MessageID, "messageID"))
+
+	res, err := newExtendedResponse(code, "", packet.Bytes())
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+	w.Write(res)
+}
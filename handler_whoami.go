@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func init() {
+	RegisterSupportedExtension(string(ldap.NoticeOfWhoAmI), nil)
+}
+
+// handleWhoAmI returns the authorization identity of the client.
+// https://datatracker.ietf.org/doc/html/rfc4532#section-2.2
+//
+// The authzId is "dn:" followed by the bound DN, or empty for anonymous.
+// If the proxied authorization control is requested, the proxied identity is returned.
+func handleWhoAmI(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	ctx, err := s.SetSessionContext(s.RequestContext(m), m)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	session, err := AuthSessionContext(ctx)
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+
+	authzID := ""
+	if session.DN != nil && !session.DN.IsAnonymous() {
+		authzID = "dn:" + session.DN.DNOrigStr()
+	}
+
+	log.Printf("info: WhoAmI. authzId: %s", authzID)
+
+	res, err := newExtendedResponse(ldap.LDAPResultSuccess, "", []byte(authzID))
+	if err != nil {
+		responseExtendedError(w, err)
+		return
+	}
+	w.Write(res)
+}
@@ -277,10 +277,51 @@ func TestRootDSE(t *testing.T) {
 					M{
 						"objectClass":          A{"top"},
 						"subschemaSubentry":    A{"cn=Subschema"},
-						"namingContexts":       A{testServer.GetSuffix()},
+						"namingContexts":       A{testServer.GetSuffix(), "o=partners"},
 						"supportedLDAPVersion": A{"3"},
-						"supportedFeatures":    A{"1.3.6.1.4.1.4203.1.5.1"},
-						"supportedControl":     A{"1.2.840.113556.1.4.319"},
+						"supportedFeatures":    A{AllOperationalAttributesFeatureOID},
+						"vendorName":           A{"OpenStandia"},
+						// Sorted by OID
+						"supportedControl": A{
+							"1.2.826.0.1.3344810.2.3",
+							"1.2.840.113556.1.4.319",
+							"1.2.840.113556.1.4.473",
+							"1.2.840.113556.1.4.805",
+							"1.3.6.1.1.12",
+							"1.3.6.1.1.13.1",
+							"1.3.6.1.1.13.2",
+							"1.3.6.1.1.21.2",
+							"1.3.6.1.4.1.4203.1.9.1.1",
+							"2.16.840.1.113730.3.4.18",
+							"2.16.840.1.113730.3.4.2",
+							"2.16.840.1.113730.3.4.3",
+							"2.16.840.1.113730.3.4.9",
+						},
+						"supportedExtension": A{
+							"1.3.6.1.1.21.1",
+							"1.3.6.1.1.21.3",
+							"1.3.6.1.1.8",
+							"1.3.6.1.4.1.4203.1.11.1",
+							"1.3.6.1.4.1.4203.1.11.3",
+						},
+					},
+				},
+			},
+		},
+		// Only the requested attributes
+		Search{
+			"",
+			"objectclass=*",
+			ldap.ScopeBaseObject,
+			A{"namingContexts", "vendorName"},
+			&AssertEntries{
+				ExpectEntry{
+					"",
+					"",
+					M{
+						"namingContexts":   A{testServer.GetSuffix(), "o=partners"},
+						"vendorName":       A{"OpenStandia"},
+						"supportedControl": A{},
 					},
 				},
 			},
@@ -605,47 +646,1857 @@ func TestSearch(t *testing.T) {
 						"sn": A{"user1"},
 					},
 				},
-				ExpectEntry{
-					"uid=user2",
-					"ou=Users",
-					M{
-						"sn": A{"user2"},
+				ExpectEntry{
+					"uid=user2",
+					"ou=Users",
+					M{
+						"sn": A{"user2"},
+					},
+				},
+			},
+		},
+		// Substr by Single-value
+		Search{
+			"ou=Users," + testServer.GetSuffix(),
+			"employeeNumber=emp*",
+			ldap.ScopeWholeSubtree,
+			A{"*"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"sn": A{"user1"},
+					},
+				},
+				ExpectEntry{
+					"uid=user2",
+					"ou=Users",
+					M{
+						"sn": A{"user2"},
+					},
+				},
+			},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestSearchWithPaging(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":    A{"inetOrgPerson"},
+				"cn":             A{"user1"},
+				"sn":             A{"user1"},
+				"userPassword":   A{SSHA("password1")},
+				"employeeNumber": A{"emp1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass":    A{"inetOrgPerson"},
+				"cn":             A{"user2"},
+				"sn":             A{"user2"},
+				"userPassword":   A{SSHA("password2")},
+				"employeeNumber": A{"emp2"},
+			},
+			&AssertEntry{},
+		},
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"sn": A{"user1"},
+						},
+					},
+					ExpectEntry{
+						"uid=user2",
+						"ou=Users",
+						M{
+							"sn": A{"user2"},
+						},
+					},
+				},
+			},
+			limit: 1,
+		},
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"sn": A{"user1"},
+						},
+					},
+					ExpectEntry{
+						"uid=user2",
+						"ou=Users",
+						M{
+							"sn": A{"user2"},
+						},
+					},
+				},
+			},
+			limit: 2,
+		},
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"sn": A{"user1"},
+						},
+					},
+					ExpectEntry{
+						"uid=user2",
+						"ou=Users",
+						M{
+							"sn": A{"user2"},
+						},
+					},
+				},
+			},
+			limit: 3,
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestSearchWithSort(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"Bravo"},
+				"roomNumber":  A{"10"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"alpha"},
+				"roomNumber":  A{"9"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user3", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user3"},
+				"sn":          A{"Charlie"},
+			},
+			&AssertEntry{},
+		},
+		SearchWithSort{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:   A{"sn"},
+			expect: A{"uid=user2", "uid=user1", "uid=user3"},
+		},
+		SearchWithSort{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:   A{"-sn"},
+			expect: A{"uid=user3", "uid=user1", "uid=user2"},
+		},
+		// Entries without the attribute are sorted as the greatest value
+		SearchWithSort{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:   A{"roomNumber"},
+			expect: A{"uid=user1", "uid=user2", "uid=user3"},
+		},
+		// Combine with paging
+		SearchWithSort{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:   A{"-sn"},
+			limit:  1,
+			expect: A{"uid=user3", "uid=user1", "uid=user2"},
+		},
+		SearchWithSort{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:   A{"roomNumber", "sn"},
+			limit:  1,
+			expect: A{"uid=user1", "uid=user2", "uid=user3"},
+		},
+		// The entry added before the last entry of the page doesn't shift the next page
+		SearchWithSortBetweenPages{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:  A{"sn"},
+			limit: 1,
+			between: Add{
+				"uid=user0", "ou=Users",
+				M{
+					"objectClass": A{"inetOrgPerson"},
+					"cn":          A{"user0"},
+					"sn":          A{"Aaron"},
+				},
+				&AssertEntry{},
+			},
+			expect: A{"uid=user2", "uid=user1", "uid=user3"},
+		},
+		Delete{
+			"uid=user0", "ou=Users",
+			&AssertNoEntry{},
+		},
+		// Virtual list view by offset
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:        A{"sn"},
+			before:      1,
+			after:       0,
+			offset:      2,
+			expect:      A{"uid=user2", "uid=user1"},
+			expectCount: 3,
+		},
+		// Virtual list view by assertion value
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:        A{"sn"},
+			before:      0,
+			after:       1,
+			assertion:   "B",
+			expect:      A{"uid=user1", "uid=user3"},
+			expectCount: 3,
+		},
+		// The context ID is returned as it is
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:        A{"sn"},
+			before:      0,
+			after:       0,
+			offset:      1,
+			contextID:   "scroll1",
+			expect:      A{"uid=user2"},
+			expectCount: 3,
+		},
+		// The window larger than the max window size
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=*",
+				ldap.ScopeWholeSubtree,
+				A{"*"},
+				nil,
+			},
+			keys:            A{"sn"},
+			before:          5,
+			after:           5,
+			offset:          1,
+			expectErrorCode: ldap.LDAPResultAdminLimitExceeded,
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestModifyWithReadEntry(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"before"},
+			},
+			&AssertEntry{},
+		},
+		ModifyWithReadEntry{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"after"},
+			},
+			A{"sn"},
+			A{"sn", "cn"},
+			M{
+				"sn": A{"before"},
+			},
+			M{
+				"sn": A{"after"},
+				"cn": A{"user1"},
+			},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestModifyWithAssertion(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"rev1"},
+			},
+			&AssertEntry{},
+		},
+		ModifyWithAssertion{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"rev2"},
+			},
+			"sn=rev1",
+			&AssertResponse{},
+		},
+		// The entry was already modified by another client
+		ModifyWithAssertion{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"rev2"},
+			},
+			"sn=rev1",
+			&AssertResponse{LDAPResultAssertionFailed},
+		},
+		ModifyWithAssertion{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"rev3"},
+			},
+			"&(objectClass=inetOrgPerson)(sn=rev2)",
+			&AssertResponse{},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestDeleteTree(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	var cookie string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		AddOU("SubUsers", "ou=Users"),
+		AddOU("Groups"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=SubUsers,ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user3", "ou=Groups",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user3"},
+				"sn":          A{"user3"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"cn=A", "ou=Groups",
+			M{
+				"objectClass": A{"groupOfNames"},
+				"member": A{
+					"uid=user1,ou=Users," + testServer.GetSuffix(),
+					"uid=user2,ou=SubUsers,ou=Users," + testServer.GetSuffix(),
+					"uid=user3,ou=Groups," + testServer.GetSuffix(),
+				},
+			},
+			&AssertEntry{},
+		},
+		SearchWithSync{
+			Search{
+				"ou=Groups," + testServer.GetSuffix(),
+				"objectClass=groupOfNames",
+				ldap.ScopeWholeSubtree,
+				A{"member"},
+				&AssertEntries{
+					ExpectEntry{
+						"cn=A",
+						"ou=Groups",
+						M{
+							"member": A{
+								"uid=user1,ou=Users," + testServer.GetSuffix(),
+								"uid=user2,ou=SubUsers,ou=Users," + testServer.GetSuffix(),
+								"uid=user3,ou=Groups," + testServer.GetSuffix(),
+							},
+						},
+					},
+				},
+			},
+			&cookie,
+		},
+		// Non-leaf entry can't be deleted without the control
+		DeleteTree{
+			"ou=Users", "",
+			false,
+			&AssertResponse{ldap.LDAPResultNotAllowedOnNonLeaf},
+		},
+		DeleteTree{
+			"ou=Users", "",
+			true,
+			&AssertResponse{},
+		},
+		Search{
+			"ou=Users," + testServer.GetSuffix(),
+			"objectClass=*",
+			ldap.ScopeWholeSubtree,
+			A{"*"},
+			&AssertEntries{},
+		},
+		// The association to the deleted subtree is also deleted
+		Search{
+			"ou=Groups," + testServer.GetSuffix(),
+			"cn=A",
+			ldap.ScopeWholeSubtree,
+			A{"member"},
+			&AssertEntries{
+				ExpectEntry{
+					"cn=A",
+					"ou=Groups",
+					M{
+						"member": A{"uid=user3,ou=Groups," + testServer.GetSuffix()},
+					},
+				},
+			},
+		},
+		// The group outside the subtree is recorded as modified
+		SearchWithSync{
+			Search{
+				"ou=Groups," + testServer.GetSuffix(),
+				"objectClass=groupOfNames",
+				ldap.ScopeWholeSubtree,
+				A{"member"},
+				&AssertEntries{
+					ExpectEntry{
+						"cn=A",
+						"ou=Groups",
+						M{
+							"member": A{"uid=user3,ou=Groups," + testServer.GetSuffix()},
+						},
+					},
+				},
+			},
+			&cookie,
+		},
+		// Re-add the deleted entries
+		AddOU("Users"),
+		AddOU("SubUsers", "ou=Users"),
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestProxiedAuthz(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=proxy", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"proxy"},
+				"sn":           A{"proxy"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=op1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"op1"},
+				"sn":          A{"op1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user1"},
+				"sn":           A{"user1"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		// The root can proxy any user
+		WhoAmIWithProxiedAuthz{"dn:uid=user1,ou=Users," + testServer.GetSuffix(), "dn:uid=user1,ou=Users," + testServer.GetSuffix(), nil},
+		Bind{"uid=proxy,ou=Users", "password1", &AssertResponse{}},
+		WhoAmIWithProxiedAuthz{"dn:uid=op1,ou=Users," + testServer.GetSuffix(), "dn:uid=op1,ou=Users," + testServer.GetSuffix(), nil},
+		WhoAmIWithProxiedAuthz{"", "", nil},
+		// Not found the authorization identity
+		WhoAmIWithProxiedAuthz{"dn:uid=notfound,ou=Users," + testServer.GetSuffix(), "", &AssertResponse{LDAPResultAuthorizationDenied}},
+		// The operation is authorized as the proxied user
+		ModifyWithProxiedAuthz{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"rev1"},
+			},
+			"dn:uid=op1,ou=Users," + testServer.GetSuffix(),
+			&AssertResponse{},
+		},
+		ModifyWithProxiedAuthz{
+			"uid=op1", "ou=Users",
+			M{
+				"sn": A{"rev1"},
+			},
+			"dn:uid=user1,ou=Users," + testServer.GetSuffix(),
+			&AssertResponse{ldap.LDAPResultInsufficientAccessRights},
+		},
+		// The user who doesn't have the proxy permission
+		Bind{"uid=user1,ou=Users", "password1", &AssertResponse{}},
+		ModifyWithProxiedAuthz{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"rev2"},
+			},
+			"dn:uid=op1,ou=Users," + testServer.GetSuffix(),
+			&AssertResponse{LDAPResultAuthorizationDenied},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestSearchWithMatchedValues(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		AddOU("Groups"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=admin1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"admin1"},
+				"sn":          A{"admin1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"cn=A", "ou=Groups",
+			M{
+				"objectClass": A{"groupOfNames"},
+				"member": A{
+					"uid=user1,ou=Users," + testServer.GetSuffix(),
+					"uid=user2,ou=Users," + testServer.GetSuffix(),
+					"uid=admin1,ou=Users," + testServer.GetSuffix(),
+				},
+				"description": A{"foo", "bar"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"cn=B", "ou=Groups",
+			M{
+				"objectClass": A{"groupOfNames"},
+				"member": A{
+					"uid=user1,ou=Users," + testServer.GetSuffix(),
+				},
+			},
+			&AssertEntry{},
+		},
+		SearchWithMatchedValues{
+			Search{
+				"ou=Groups," + testServer.GetSuffix(),
+				"cn=A",
+				ldap.ScopeWholeSubtree,
+				A{"cn", "member", "description"},
+				&AssertEntries{
+					ExpectEntry{
+						"cn=A",
+						"ou=Groups",
+						M{
+							"cn":          A{"A"},
+							"member":      A{"uid=admin1,ou=Users," + testServer.GetSuffix()},
+							"description": A{"foo", "bar"},
+						},
+					},
+				},
+			},
+			A{"(member=uid=admin*)"},
+		},
+		SearchWithMatchedValues{
+			Search{
+				"ou=Groups," + testServer.GetSuffix(),
+				"cn=A",
+				ldap.ScopeWholeSubtree,
+				A{"member", "description"},
+				&AssertEntries{
+					ExpectEntry{
+						"cn=A",
+						"ou=Groups",
+						M{
+							"member":      A{"uid=user2,ou=Users," + testServer.GetSuffix()},
+							"description": A{"bar"},
+						},
+					},
+				},
+			},
+			A{"(member=UID=user2,ou=users," + testServer.GetSuffix() + ")", "(description=Bar)"},
+		},
+		// The attribute which has no matched value isn't returned
+		SearchWithMatchedValues{
+			Search{
+				"ou=Groups," + testServer.GetSuffix(),
+				"cn=A",
+				ldap.ScopeWholeSubtree,
+				A{"member"},
+				&AssertEntries{
+					ExpectEntry{
+						"cn=A",
+						"ou=Groups",
+						M{
+							"member": A{},
+						},
+					},
+				},
+			},
+			A{"(member=uid=notfound*)"},
+		},
+		SearchWithMatchedValues{
+			Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=user1",
+				ldap.ScopeWholeSubtree,
+				A{"memberOf"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"memberOf": A{"cn=B,ou=Groups," + testServer.GetSuffix()},
+						},
+					},
+				},
+			},
+			A{"(memberOf=cn=b*)"},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestSearchWithLimits(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=limited", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"limited"},
+				"sn":           A{"limited"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		// Exceeded the size limit requested by the client
+		SearchWithLimits{
+			Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+					ExpectEntry{
+						"uid=user2",
+						"ou=Users",
+						M{
+							"cn": A{"user2"},
+						},
+					},
+				},
+			},
+			2,
+			false,
+			ldap.LDAPResultSizeLimitExceeded,
+		},
+		SearchWithLimits{
+			Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"uid=user1",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{},
+						},
+					},
+				},
+			},
+			1,
+			true,
+			0,
+		},
+		// The size limit applies to the total entries across the pages
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			limit:           1,
+			sizeLimit:       2,
+			expectErrorCode: ldap.LDAPResultSizeLimitExceeded,
+		},
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{"uid=user1", "ou=Users", M{"cn": A{"user1"}}},
+					ExpectEntry{"uid=user2", "ou=Users", M{"cn": A{"user2"}}},
+					ExpectEntry{"uid=limited", "ou=Users", M{"cn": A{"limited"}}},
+				},
+			},
+			limit:     1,
+			sizeLimit: 3,
+		},
+		// The VLV window is truncated by the size limit requested by the client
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				nil,
+			},
+			keys:            A{"sn"},
+			before:          0,
+			after:           2,
+			offset:          1,
+			sizeLimit:       2,
+			expect:          A{"uid=limited", "uid=user1"},
+			expectErrorCode: ldap.LDAPResultSizeLimitExceeded,
+		},
+		// Exceeded the administrative size limit
+		Bind{"uid=limited,ou=Users", "password1", &AssertResponse{}},
+		SearchWithLimits{
+			Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			0,
+			false,
+			ldap.LDAPResultSizeLimitExceeded,
+		},
+		SearchWithPaging{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{},
+			},
+			limit:           2,
+			expectErrorCode: ldap.LDAPResultSizeLimitExceeded,
+		},
+		// The VLV window larger than the administrative size limit is rejected
+		SearchWithVLV{
+			Search: Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				nil,
+			},
+			keys:            A{"sn"},
+			before:          0,
+			after:           1,
+			offset:          1,
+			expectErrorCode: ldap.LDAPResultAdminLimitExceeded,
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestSearchWithExtensibleMatch(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		AddOU("Groups"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":   A{"inetOrgPerson", "posixAccount"},
+				"cn":            A{"Foo"},
+				"sn":            A{"user1"},
+				"uidNumber":     A{"514"},
+				"gidNumber":     A{"100"},
+				"homeDirectory": A{"/home/user1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass":   A{"inetOrgPerson", "posixAccount"},
+				"cn":            A{"foo"},
+				"sn":            A{"user2"},
+				"uidNumber":     A{"512"},
+				"gidNumber":     A{"100"},
+				"homeDirectory": A{"/home/user2"},
+			},
+			&AssertEntry{},
+		},
+		// Match the RDN components of the DN
+		Search{
+			testServer.GetSuffix(),
+			"ou:dn:=users",
+			ldap.ScopeWholeSubtree,
+			A{"cn"},
+			&AssertEntries{
+				ExpectEntry{
+					"ou=Users",
+					"",
+					M{},
+				},
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"cn": A{"Foo"},
+					},
+				},
+				ExpectEntry{
+					"uid=user2",
+					"ou=Users",
+					M{
+						"cn": A{"foo"},
+					},
+				},
+			},
+		},
+		Search{
+			testServer.GetSuffix(),
+			"cn:caseExactMatch:=Foo",
+			ldap.ScopeWholeSubtree,
+			A{"cn"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"cn": A{"Foo"},
+					},
+				},
+			},
+		},
+		// Bitwise AND
+		Search{
+			testServer.GetSuffix(),
+			"uidNumber:1.2.840.113556.1.4.803:=2",
+			ldap.ScopeWholeSubtree,
+			A{"uidNumber"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"uidNumber": A{"514"},
+					},
+				},
+			},
+		},
+		// Bitwise OR
+		Search{
+			testServer.GetSuffix(),
+			"uidNumber:1.2.840.113556.1.4.804:=514",
+			ldap.ScopeWholeSubtree,
+			A{"uidNumber"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"uidNumber": A{"514"},
+					},
+				},
+				ExpectEntry{
+					"uid=user2",
+					"ou=Users",
+					M{
+						"uidNumber": A{"512"},
+					},
+				},
+			},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestAttributeOptions(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":         A{"inetOrgPerson"},
+				"cn":                  A{"Taro Yamada"},
+				"cn;lang-ja":          A{"山田 太郎"},
+				"sn":                  A{"Yamada"},
+				"displayName;lang-en": A{"Taro"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"Hanako Suzuki"},
+				"sn":          A{"Suzuki"},
+			},
+			&AssertEntry{},
+		},
+		// Unsupported option
+		Add{
+			"uid=user3", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user3"},
+				"cn;binary":   A{"user3"},
+				"sn":          A{"user3"},
+			},
+			&AssertLDAPError{
+				expectErrorCode: ldap.LDAPResultUndefinedAttributeType,
+			},
+		},
+		ModifyAdd{
+			"uid=user2", "ou=Users",
+			M{
+				"cn;lang-ja": A{"鈴木 花子"},
+			},
+			&AssertEntry{},
+		},
+		// The filter of the attribute type matches the subtypes
+		Search{
+			testServer.GetSuffix(),
+			"cn=鈴木*",
+			ldap.ScopeWholeSubtree,
+			A{"cn"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user2",
+					"ou=Users",
+					M{
+						"cn":         A{"Hanako Suzuki"},
+						"cn;lang-ja": A{"鈴木 花子"},
+					},
+				},
+			},
+		},
+		// The filter of the subtype doesn't match the attribute type
+		Search{
+			testServer.GetSuffix(),
+			"cn;lang-ja=*Yamada*",
+			ldap.ScopeWholeSubtree,
+			A{"cn"},
+			&AssertEntries{},
+		},
+		Search{
+			testServer.GetSuffix(),
+			"displayName;lang-en=taro",
+			ldap.ScopeWholeSubtree,
+			A{"cn;lang-ja"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=user1",
+					"ou=Users",
+					M{
+						"cn":         A{},
+						"cn;lang-ja": A{"山田 太郎"},
+					},
+				},
+			},
+		},
+		ModifyReplace{
+			"uid=user1", "ou=Users",
+			M{
+				"cn;lang-ja": A{"山田 次郎"},
+			},
+			&AssertEntry{
+				expectAttrs: M{
+					"cn":         A{"Taro Yamada"},
+					"cn;lang-ja": A{"山田 次郎"},
+				},
+			},
+		},
+		// Deleting the subtype doesn't delete the attribute type
+		ModifyDelete{
+			"uid=user1", "ou=Users",
+			M{
+				"cn;lang-ja": A{},
+			},
+			&AssertEntry{
+				expectAttrs: M{
+					"cn":         A{"Taro Yamada"},
+					"cn;lang-ja": A{},
+				},
+			},
+		},
+		Compare{
+			"uid=user2", "ou=Users",
+			"cn", "鈴木 花子", true,
+			&AssertResponse{},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestMultiValuedRDN(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"cn=John Smith+uid=jsmith", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"sn":          A{"Smith"},
+			},
+			&AssertResponse{},
+		},
+		// Same RDN with the different order of the components
+		Add{
+			"UID=JSmith+CN=john smith", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"sn":          A{"Smith"},
+			},
+			&AssertResponse{ldap.LDAPResultEntryAlreadyExists},
+		},
+		// The values of the RDN are added to the entry
+		Search{
+			"ou=Users," + testServer.GetSuffix(),
+			"(&(cn=john smith)(uid=jsmith))",
+			ldap.ScopeWholeSubtree,
+			A{"cn", "uid"},
+			&AssertEntries{
+				ExpectEntry{
+					"cn=John Smith+uid=jsmith",
+					"ou=Users",
+					M{
+						"cn":  A{"John Smith"},
+						"uid": A{"jsmith"},
+					},
+				},
+			},
+		},
+		// The value of the RDN can't be deleted
+		ModifyDelete{
+			"uid=jsmith+cn=John Smith", "ou=Users",
+			M{
+				"uid": A{"jsmith"},
+			},
+			&AssertLDAPError{
+				expectErrorCode: ldap.LDAPResultNamingViolation,
+			},
+		},
+		// Delete the old RDN value which isn't in the new RDN
+		ModifyDN{
+			"cn=John Smith+uid=jsmith", "ou=Users",
+			"cn=John Smith+uid=john",
+			true,
+			"",
+			false,
+			&AssertRename{},
+		},
+		Search{
+			"ou=Users," + testServer.GetSuffix(),
+			"(cn=john smith)",
+			ldap.ScopeWholeSubtree,
+			A{"cn", "uid"},
+			&AssertEntries{
+				ExpectEntry{
+					"cn=John Smith+uid=john",
+					"ou=Users",
+					M{
+						"cn":  A{"John Smith"},
+						"uid": A{"john"},
+					},
+				},
+			},
+		},
+		// Keep the old RDN values
+		ModifyDN{
+			"cn=John Smith+uid=john", "ou=Users",
+			"uid=john",
+			false,
+			"",
+			false,
+			&AssertRename{},
+		},
+		Search{
+			"ou=Users," + testServer.GetSuffix(),
+			"(uid=john)",
+			ldap.ScopeWholeSubtree,
+			A{"cn", "uid"},
+			&AssertEntries{
+				ExpectEntry{
+					"uid=john",
+					"ou=Users",
+					M{
+						"cn":  A{"John Smith"},
+						"uid": A{"john"},
+					},
+				},
+			},
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestAliases(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	testServer.config.DerefAliasBindCompare = true
+	defer func() {
+		testServer.config.DerefAliasBindCompare = false
+	}()
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		AddOU("Sales"),
+		AddOU("Loops"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user1"},
+				"sn":           A{"user1"},
+				"userPassword": A{"password1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
+			},
+			&AssertEntry{},
+		},
+		// The same person is placed under the other OU
+		Add{
+			"uid=user1", "ou=Sales",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"uid=user1,ou=Users," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		// The alias to the alias
+		Add{
+			"uid=sales-user1", "ou=Users",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"uid=user1,ou=Sales," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		// The aliases which refer to each other
+		Add{
+			"cn=loop1", "ou=Loops",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"cn=loop2,ou=Loops," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"cn=loop2", "ou=Loops",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"cn=loop1,ou=Loops," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		// The alias isn't dereferenced with neverDerefAliases
+		SearchWithDerefAliases{
+			Search{
+				"ou=Sales," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeSingleLevel,
+				A{"aliasedObjectName"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Sales",
+						M{
+							"aliasedObjectName": A{"uid=user1,ou=Users," + testServer.GetSuffix()},
+						},
+					},
+				},
+			},
+			ldap.NeverDerefAliases,
+			0,
+		},
+		// The alias in the search scope is dereferenced with derefInSearching
+		SearchWithDerefAliases{
+			Search{
+				"ou=Sales," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeSingleLevel,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			ldap.DerefInSearching,
+			0,
+		},
+		// The duplicate entries by the aliases are eliminated
+		SearchWithDerefAliases{
+			Search{
+				"ou=Users," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeSingleLevel,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+					ExpectEntry{
+						"uid=user2",
+						"ou=Users",
+						M{
+							"cn": A{"user2"},
+						},
+					},
+				},
+			},
+			ldap.DerefAlways,
+			0,
+		},
+		// The base object isn't dereferenced with derefInSearching
+		SearchWithDerefAliases{
+			Search{
+				"uid=user1,ou=Sales," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				&AssertEntries{},
+			},
+			ldap.DerefInSearching,
+			0,
+		},
+		// The base object is dereferenced with derefFindingBaseObj through the alias chain
+		SearchWithDerefAliases{
+			Search{
+				"uid=sales-user1,ou=Users," + testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			ldap.DerefFindingBaseObj,
+			0,
+		},
+		// The alias loop is detected
+		SearchWithDerefAliases{
+			Search{
+				"cn=loop1,ou=Loops," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				nil,
+			},
+			ldap.DerefAlways,
+			ldap.LDAPResultAliasProblem,
+		},
+		SearchWithDerefAliases{
+			Search{
+				"ou=Loops," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				nil,
+			},
+			ldap.DerefInSearching,
+			ldap.LDAPResultAliasProblem,
+		},
+		// Compare the dereferenced entry
+		Compare{
+			"uid=user1", "ou=Sales",
+			"cn", "user1",
+			true,
+			nil,
+		},
+		// Bind as the dereferenced entry
+		Bind{"uid=user1,ou=Sales", "password1", &AssertResponse{}},
+		WhoAmI{
+			"dn:uid=user1,ou=Users," + testServer.GetSuffix(),
+		},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		// The alias to the deleted entry
+		Delete{
+			"uid=user2", "ou=Users",
+			&AssertNoEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Sales",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"uid=user2,ou=Users," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		SearchWithDerefAliases{
+			Search{
+				"uid=user2,ou=Sales," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				nil,
+			},
+			ldap.DerefFindingBaseObj,
+			ldap.LDAPResultAliasProblem,
+		},
+		// The alias to the entry out of the suffix
+		Add{
+			"cn=external", "ou=Loops",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"cn=external,dc=example,dc=org"},
+			},
+			&AssertEntry{},
+		},
+		SearchWithDerefAliases{
+			Search{
+				"cn=external,ou=Loops," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				nil,
+			},
+			ldap.DerefAlways,
+			ldap.LDAPResultAliasDereferencingProblem,
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestAliasesWithoutDerefOnBindAndCompare(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		AddOU("Sales"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user1"},
+				"sn":           A{"user1"},
+				"userPassword": A{"password1"},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user1", "ou=Sales",
+			M{
+				"objectClass":       A{"alias", "extensibleObject"},
+				"aliasedObjectName": A{"uid=user1,ou=Users," + testServer.GetSuffix()},
+			},
+			&AssertEntry{},
+		},
+		// Compare the alias entry itself, which doesn't have cn
+		Compare{
+			"uid=user1", "ou=Sales",
+			"cn", "user1",
+			false,
+			&AssertResponse{ldap.LDAPResultNoSuchAttribute},
+		},
+		Compare{
+			"uid=user1", "ou=Sales",
+			"aliasedObjectName", "uid=user1,ou=Users," + testServer.GetSuffix(),
+			true,
+			nil,
+		},
+		// The alias entry has no password
+		Bind{"uid=user1,ou=Sales", "password1", &AssertResponse{ldap.LDAPResultInvalidCredentials}},
+		Bind{"uid=user1,ou=Users", "password1", &AssertResponse{}},
+		WhoAmI{
+			"dn:uid=user1,ou=Users," + testServer.GetSuffix(),
+		},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestReferrals(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
+			},
+			&AssertEntry{},
+		},
+		// The subtree held by the other server
+		Add{
+			"ou=Remote", "",
+			M{
+				"objectClass": A{"referral", "extensibleObject"},
+				"ref":         A{"ldap://remote.example.org/ou=Remote,dc=example,dc=org"},
+			},
+			&AssertResponse{},
+		},
+		// The referral entry is returned as the continuation reference
+		SearchWithReferral{
+			Search{
+				testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			false,
+			[]string{"ldap://remote.example.org/ou=Remote,dc=example,dc=org??sub"},
+			0,
+		},
+		SearchWithReferral{
+			Search{
+				testServer.GetSuffix(),
+				"ou=*",
+				ldap.ScopeSingleLevel,
+				A{"ou"},
+				&AssertEntries{
+					ExpectEntry{
+						"ou=Users",
+						"",
+						M{
+							"ou": A{"Users"},
+						},
+					},
+				},
+			},
+			false,
+			[]string{"ldap://remote.example.org/ou=Remote,dc=example,dc=org??base"},
+			0,
+		},
+		// The referral entry is returned as the normal entry with the ManageDsaIT control
+		SearchWithReferral{
+			Search{
+				"ou=Remote," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeBaseObject,
+				A{"ref"},
+				&AssertEntries{
+					ExpectEntry{
+						"ou=Remote",
+						"",
+						M{
+							"ref": A{"ldap://remote.example.org/ou=Remote,dc=example,dc=org"},
+						},
+					},
+				},
+			},
+			true,
+			nil,
+			0,
+		},
+		// The operations under the referral entry are referred
+		SearchWithReferral{
+			Search{
+				"uid=user2,ou=Remote," + testServer.GetSuffix(),
+				"objectClass=*",
+				ldap.ScopeBaseObject,
+				A{"cn"},
+				nil,
+			},
+			false,
+			nil,
+			ldap.LDAPResultReferral,
+		},
+		Add{
+			"uid=user2", "ou=Remote",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
+			},
+			&AssertResponse{ldap.LDAPResultReferral},
+		},
+		Compare{
+			"uid=user2", "ou=Remote",
+			"cn", "user2",
+			false,
+			&AssertResponse{ldap.LDAPResultReferral},
+		},
+		ModifyDelete{
+			"ou=Remote", "",
+			M{
+				"ref": A{"ldap://remote.example.org/ou=Remote,dc=example,dc=org"},
+			},
+			&AssertResponse{ldap.LDAPResultReferral},
+		},
+		// The referral entry can be managed with the ManageDsaIT control
+		ModifyWithManageDsaIT{
+			"ou=Remote", "",
+			M{
+				"ref": A{"ldap://remote2.example.org/ou=Remote,dc=example,dc=org"},
+			},
+			&AssertResponse{},
+		},
+		SearchWithReferral{
+			Search{
+				testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
+					},
+				},
+			},
+			false,
+			[]string{"ldap://remote2.example.org/ou=Remote,dc=example,dc=org??sub"},
+			0,
+		},
+		Bind{"uid=user2,ou=Remote", "password", &AssertResponse{ldap.LDAPResultReferral}},
+		// The entry beneath the referral entry isn't returned as the local entry
+		AddWithManageDsaIT{
+			"uid=user3", "ou=Remote",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user3"},
+				"sn":          A{"user3"},
+			},
+			&AssertResponse{},
+		},
+		SearchWithReferral{
+			Search{
+				testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
 					},
 				},
 			},
+			false,
+			[]string{"ldap://remote2.example.org/ou=Remote,dc=example,dc=org??sub"},
+			0,
 		},
-		// Substr by Single-value
-		Search{
-			"ou=Users," + testServer.GetSuffix(),
-			"employeeNumber=emp*",
-			ldap.ScopeWholeSubtree,
-			A{"*"},
-			&AssertEntries{
-				ExpectEntry{
-					"uid=user1",
-					"ou=Users",
-					M{
-						"sn": A{"user1"},
+		SearchWithReferral{
+			Search{
+				testServer.GetSuffix(),
+				"objectClass=inetOrgPerson",
+				ldap.ScopeWholeSubtree,
+				A{"cn"},
+				&AssertEntries{
+					ExpectEntry{
+						"uid=user1",
+						"ou=Users",
+						M{
+							"cn": A{"user1"},
+						},
 					},
-				},
-				ExpectEntry{
-					"uid=user2",
-					"ou=Users",
-					M{
-						"sn": A{"user2"},
+					ExpectEntry{
+						"uid=user3",
+						"ou=Remote",
+						M{
+							"cn": A{"user3"},
+						},
 					},
 				},
 			},
+			true,
+			nil,
+			0,
 		},
 	}
 
 	runTestCases(t, tcs)
 }
 
-func TestSearchWithPaging(t *testing.T) {
+func TestSearchWithSync(t *testing.T) {
 	type A []string
 	type M map[string][]string
 
+	var cookie string
+
 	tcs := []Command{
 		Conn{},
 		Bind{"cn=Manager", "secret", &AssertResponse{}},
@@ -654,31 +2505,28 @@ func TestSearchWithPaging(t *testing.T) {
 		Add{
 			"uid=user1", "ou=Users",
 			M{
-				"objectClass":    A{"inetOrgPerson"},
-				"cn":             A{"user1"},
-				"sn":             A{"user1"},
-				"userPassword":   A{SSHA("password1")},
-				"employeeNumber": A{"emp1"},
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
 			},
 			&AssertEntry{},
 		},
 		Add{
 			"uid=user2", "ou=Users",
 			M{
-				"objectClass":    A{"inetOrgPerson"},
-				"cn":             A{"user2"},
-				"sn":             A{"user2"},
-				"userPassword":   A{SSHA("password2")},
-				"employeeNumber": A{"emp2"},
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user2"},
+				"sn":          A{"user2"},
 			},
 			&AssertEntry{},
 		},
-		SearchWithPaging{
-			Search: Search{
+		// Without the cookie, all entries are returned
+		SearchWithSync{
+			Search{
 				"ou=Users," + testServer.GetSuffix(),
-				"uid=*",
+				"objectClass=inetOrgPerson",
 				ldap.ScopeWholeSubtree,
-				A{"*"},
+				A{"sn"},
 				&AssertEntries{
 					ExpectEntry{
 						"uid=user1",
@@ -696,57 +2544,55 @@ func TestSearchWithPaging(t *testing.T) {
 					},
 				},
 			},
-			limit: 1,
+			&cookie,
 		},
-		SearchWithPaging{
-			Search: Search{
+		ModifyReplace{
+			"uid=user1", "ou=Users",
+			M{
+				"sn": A{"foo"},
+			},
+			&AssertEntry{},
+		},
+		Delete{
+			"uid=user2", "ou=Users",
+			&AssertNoEntry{},
+		},
+		// With the cookie, only the changed entries are returned. The deleted entry has no attribute.
+		SearchWithSync{
+			Search{
 				"ou=Users," + testServer.GetSuffix(),
-				"uid=*",
+				"objectClass=inetOrgPerson",
 				ldap.ScopeWholeSubtree,
-				A{"*"},
+				A{"sn"},
 				&AssertEntries{
 					ExpectEntry{
 						"uid=user1",
 						"ou=Users",
 						M{
-							"sn": A{"user1"},
+							"sn": A{"foo"},
 						},
 					},
 					ExpectEntry{
 						"uid=user2",
 						"ou=Users",
 						M{
-							"sn": A{"user2"},
+							"sn": A{},
 						},
 					},
 				},
 			},
-			limit: 2,
+			&cookie,
 		},
-		SearchWithPaging{
-			Search: Search{
+		// No change since the last cookie
+		SearchWithSync{
+			Search{
 				"ou=Users," + testServer.GetSuffix(),
-				"uid=*",
+				"objectClass=inetOrgPerson",
 				ldap.ScopeWholeSubtree,
-				A{"*"},
-				&AssertEntries{
-					ExpectEntry{
-						"uid=user1",
-						"ou=Users",
-						M{
-							"sn": A{"user1"},
-						},
-					},
-					ExpectEntry{
-						"uid=user2",
-						"ou=Users",
-						M{
-							"sn": A{"user2"},
-						},
-					},
-				},
+				A{"sn"},
+				&AssertEntries{},
 			},
-			limit: 3,
+			&cookie,
 		},
 	}
 
@@ -2085,6 +3931,140 @@ func TestAssociationWithCustomSchema(t *testing.T) {
 	runTestCases(t, tcs)
 }
 
+func TestCompare(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Groups"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"User1"},
+				"sn":           A{"user1"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user2"},
+				"sn":           A{"user2"},
+				"userPassword": A{SSHA("password2")},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"cn=A1", "ou=Groups",
+			M{
+				"objectClass": A{"groupOfNames"},
+				"member": A{
+					"uid=user1,ou=Users," + testServer.GetSuffix(),
+				},
+			},
+			&AssertEntry{},
+		},
+		// Case ignore match
+		Compare{"uid=user1", "ou=Users", "cn", "user1", true, nil},
+		Compare{"uid=user1", "ou=Users", "cn", "user2", false, nil},
+		// Absent attribute
+		Compare{"uid=user1", "ou=Users", "description", "user1", false, &AssertResponse{ldap.LDAPResultNoSuchAttribute}},
+		// Association
+		Compare{"cn=A1", "ou=Groups", "member", "UID=user1,ou=users," + testServer.GetSuffix(), true, nil},
+		Compare{"cn=A1", "ou=Groups", "member", "uid=user2,ou=Users," + testServer.GetSuffix(), false, nil},
+		// Reverse association
+		Compare{"uid=user1", "ou=Users", "memberOf", "cn=A1,ou=Groups," + testServer.GetSuffix(), true, nil},
+		Compare{"uid=user1", "ou=Users", "memberOf", "cn=A2,ou=Groups," + testServer.GetSuffix(), false, nil},
+		Compare{"uid=user2", "ou=Users", "memberOf", "cn=A1,ou=Groups," + testServer.GetSuffix(), false, &AssertResponse{ldap.LDAPResultNoSuchAttribute}},
+		// Errors
+		Compare{"uid=notfound", "ou=Users", "cn", "user1", false, &AssertResponse{ldap.LDAPResultNoSuchObject}},
+		Compare{"uid=user1", "ou=Users", "undefined", "user1", false, &AssertResponse{ldap.LDAPResultUndefinedAttributeType}},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestPasswordModify(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user1"},
+				"sn":           A{"user1"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		Add{
+			"uid=user2", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user2"},
+				"sn":           A{"user2"},
+				"userPassword": A{SSHA("password2")},
+			},
+			&AssertEntry{},
+		},
+		// Change by the manager
+		PasswordModify{"uid=user2", "ou=Users", "", "newpassword2", nil},
+		PasswordModify{"uid=user2", "ou=Users", "", "", nil},
+		PasswordModify{"uid=notfound", "ou=Users", "", "newpassword", &AssertResponse{ldap.LDAPResultNoSuchObject}},
+		// Change own password
+		Bind{"uid=user1,ou=Users", "password1", &AssertResponse{}},
+		PasswordModify{"", "", "invalid", "newpassword1", &AssertResponse{ldap.LDAPResultInvalidCredentials}},
+		PasswordModify{"", "", "password1", "newpassword1", nil},
+		Bind{"uid=user1,ou=Users", "password1", &AssertResponse{ldap.LDAPResultInvalidCredentials}},
+		Bind{"uid=user1,ou=Users", "newpassword1", &AssertResponse{}},
+		// Can't change other's password without write permission
+		PasswordModify{"uid=user2", "ou=Users", "", "newpassword2", &AssertResponse{ldap.LDAPResultInsufficientAccessRights}},
+	}
+
+	runTestCases(t, tcs)
+}
+
+func TestWhoAmI(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		WhoAmI{""},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		WhoAmI{"dn:cn=Manager," + testServer.GetSuffix()},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"user1"},
+				"sn":           A{"user1"},
+				"userPassword": A{SSHA("password1")},
+			},
+			&AssertEntry{},
+		},
+		Bind{"uid=user1,ou=Users", "password1", &AssertResponse{}},
+		WhoAmI{"dn:uid=user1,ou=Users," + testServer.GetSuffix()},
+	}
+
+	runTestCases(t, tcs)
+}
+
 func TestSearchByAssociation(t *testing.T) {
 	type A []string
 	type M map[string][]string
@@ -2841,3 +4821,96 @@ func TestSearchByAssociation(t *testing.T) {
 
 	runTestCases(t, tcs)
 }
+
+func TestMultipleSuffixes(t *testing.T) {
+	type A []string
+	type M map[string][]string
+
+	tcs := []Command{
+		Conn{},
+		Bind{"cn=Manager", "secret", &AssertResponse{}},
+		AddDC("example", "dc=com"),
+		AddOU("Users"),
+		Add{
+			"uid=user1", "ou=Users",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"user1"},
+				"sn":          A{"user1"},
+			},
+			&AssertEntry{},
+		},
+		// The other naming context has own root entry
+		AddWithDN{
+			"o=partners",
+			M{
+				"objectClass": A{"organization"},
+				"o":           A{"partners"},
+			},
+			&AssertResponse{},
+		},
+		AddWithDN{
+			"ou=Users,o=partners",
+			M{
+				"objectClass": A{"organizationalUnit"},
+			},
+			&AssertResponse{},
+		},
+		AddWithDN{
+			"uid=user1,ou=Users,o=partners",
+			M{
+				"objectClass":  A{"inetOrgPerson"},
+				"cn":           A{"partner1"},
+				"sn":           A{"partner1"},
+				"userPassword": A{SSHA("password")},
+			},
+			&AssertResponse{},
+		},
+		// Outside of all suffixes
+		AddWithDN{
+			"uid=user1,o=other",
+			M{
+				"objectClass": A{"inetOrgPerson"},
+				"cn":          A{"other1"},
+				"sn":          A{"other1"},
+			},
+			&AssertResponse{ldap.LDAPResultUnwillingToPerform},
+		},
+		// The entries with the same relative DN are isolated in each naming context
+		SearchDNs{
+			testServer.GetSuffix(),
+			"objectClass=inetOrgPerson",
+			ldap.ScopeWholeSubtree,
+			A{"uid=user1,ou=Users," + testServer.GetSuffix()},
+		},
+		SearchDNs{
+			"o=partners",
+			"objectClass=inetOrgPerson",
+			ldap.ScopeWholeSubtree,
+			A{"uid=user1,ou=Users,o=partners"},
+		},
+		SearchDNs{
+			"o=partners",
+			"objectClass=*",
+			ldap.ScopeSingleLevel,
+			A{"ou=Users,o=partners"},
+		},
+		// The entry can't be moved to the other naming context
+		ModifyDNWithDN{
+			"uid=user1,ou=Users,o=partners",
+			"uid=partner1",
+			"ou=Users," + testServer.GetSuffix(),
+			&AssertResponse{ldap.LDAPResultAffectsMultipleDSAs},
+		},
+		ModifyDNWithDN{
+			"uid=user1,ou=Users,o=partners",
+			"uid=partner1",
+			"",
+			&AssertResponse{},
+		},
+		BindWithDN{"uid=partner1,ou=Users,o=partners", "password", &AssertResponse{}},
+		BindWithDN{"uid=partner1,ou=Users,o=partners", "invalid", &AssertResponse{ldap.LDAPResultInvalidCredentials}},
+	}
+
+	runTestCases(t, tcs)
+}
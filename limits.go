@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/openstandia/goldap/message"
+	"golang.org/x/xerrors"
+)
+
+// SearchLimits is the administrative limits of the search operation for each user or group.
+type SearchLimits struct {
+	list map[string]*SearchLimit
+}
+
+// SearchLimit is the limit of the number of entries and the seconds of the search operation.
+// The zero value means unlimited.
+type SearchLimit struct {
+	SizeLimit int
+	TimeLimit int
+}
+
+func NewSearchLimits(server *Server) (*SearchLimits, error) {
+	m := map[string]*SearchLimit{}
+
+	for _, d := range server.config.SearchLimits {
+		s := strings.Split(d, ":")
+		if len(s) != 3 {
+			return nil, xerrors.Errorf("Invalid format. Need <DN(User, Group or empty(everyone))>:<Size Limit>:<Time Limit>: %s", d)
+		}
+
+		sizeLimit, err := strconv.Atoi(s[1])
+		if err != nil || sizeLimit < 0 {
+			return nil, xerrors.Errorf("Invalid size limit. Need 0 or positive number: %s", d)
+		}
+
+		timeLimit, err := strconv.Atoi(s[2])
+		if err != nil || timeLimit < 0 {
+			return nil, xerrors.Errorf("Invalid time limit. Need 0 or positive number: %s", d)
+		}
+
+		limit := &SearchLimit{
+			SizeLimit: sizeLimit,
+			TimeLimit: timeLimit,
+		}
+
+		if s[0] != "" {
+			dn, err := server.NormalizeDN(s[0])
+			if err != nil {
+				return nil, xerrors.Errorf(`Invalid DN format: %s`, d)
+			}
+			m[dn.DNNormStr()] = limit
+		} else {
+			// For everyone
+			m["_DEFAULT_"] = limit
+		}
+	}
+
+	return &SearchLimits{
+		list: m,
+	}, nil
+}
+
+// Get returns the administrative limit for the session.
+// The root DN isn't limited.
+func (s *SearchLimits) Get(session *AuthSession) *SearchLimit {
+	if session.IsRoot {
+		return &SearchLimit{}
+	}
+
+	if session.DN != nil {
+		if v, ok := s.list[session.DN.DNNormStr()]; ok {
+			return v
+		}
+		for _, m := range session.Groups {
+			if v, ok := s.list[m.DNNormStr()]; ok {
+				return v
+			}
+		}
+	}
+	if v, ok := s.list["_DEFAULT_"]; ok {
+		return v
+	}
+	return &SearchLimit{}
+}
+
+// Resolve returns the effective size limit and time limit with the client requested limits.
+// The smaller one is used if both are limited.
+func (l *SearchLimit) Resolve(sizeLimit, timeLimit int) (int, int) {
+	return minLimit(l.SizeLimit, sizeLimit), minLimit(l.TimeLimit, timeLimit)
+}
+
+// sizeLimitedHandler returns the handler which fails with sizeLimitExceeded if the entries exceed the size limit.
+// It's used for the search which returns the entries without paging such as the refresh phase of the sync search.
+func sizeLimitedHandler(sizeLimit int, handler func(entry *SearchEntry, controls *message.Controls) error) func(entry *SearchEntry, controls *message.Controls) error {
+	if sizeLimit == 0 {
+		return handler
+	}
+	sent := 0
+	return func(entry *SearchEntry, controls *message.Controls) error {
+		if sent >= sizeLimit {
+			return NewSizeLimitExceeded()
+		}
+		sent++
+		return handler(entry, controls)
+	}
+}
+
+func minLimit(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
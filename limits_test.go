@@ -0,0 +1,121 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func TestSearchLimits(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+		SearchLimits: []string{
+			":100:30",
+			"cn=reader,dc=example,dc=com:0:0",
+			"cn=group1,ou=Groups,dc=example,dc=com:10:5",
+		},
+	})
+	server.LoadSchema()
+
+	limits, err := NewSearchLimits(server)
+	if err != nil {
+		t.Fatalf("Unexpected error on NewSearchLimits: %+v", err)
+	}
+
+	reader, _ := server.NormalizeDN("cn=reader,dc=example,dc=com")
+	user1, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+	group1, _ := server.NormalizeDN("cn=group1,ou=Groups,dc=example,dc=com")
+
+	testcases := []struct {
+		Session         *AuthSession
+		SizeLimit       int
+		TimeLimit       int
+		ExpectSizeLimit int
+		ExpectTimeLimit int
+	}{
+		// Default
+		{&AuthSession{DN: user1}, 0, 0, 100, 30},
+		{&AuthSession{DN: user1}, 50, 60, 50, 30},
+		// Group
+		{&AuthSession{DN: user1, Groups: []*DN{group1}}, 0, 0, 10, 5},
+		{&AuthSession{DN: user1, Groups: []*DN{group1}}, 20, 1, 10, 1},
+		// Unlimited user
+		{&AuthSession{DN: reader}, 0, 0, 0, 0},
+		{&AuthSession{DN: reader}, 1000, 10, 1000, 10},
+		// Root
+		{&AuthSession{DN: reader, IsRoot: true}, 0, 0, 0, 0},
+	}
+
+	for i, tc := range testcases {
+		sizeLimit, timeLimit := limits.Get(tc.Session).Resolve(tc.SizeLimit, tc.TimeLimit)
+		if sizeLimit != tc.ExpectSizeLimit || timeLimit != tc.ExpectTimeLimit {
+			t.Errorf("Unexpected limits on %d: sizeLimit=%d, timeLimit=%d", i, sizeLimit, timeLimit)
+		}
+	}
+}
+
+func TestInvalidSearchLimits(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	for _, v := range []string{":100", ":-1:0", ":0:abc", "invalid:0:0"} {
+		server.config.SearchLimits = []string{v}
+		if _, err := NewSearchLimits(server); err == nil {
+			t.Errorf("Unexpected success of parsing: %s", v)
+		}
+	}
+}
+
+func TestSizeLimitedHandler(t *testing.T) {
+	for _, tc := range []struct {
+		sizeLimit int
+		entries   int
+		expect    int
+		exceeded  bool
+	}{
+		{0, 3, 3, false},
+		{2, 2, 2, false},
+		{2, 3, 2, true},
+	} {
+		handled := 0
+		handler := sizeLimitedHandler(tc.sizeLimit, func(entry *SearchEntry, controls *message.Controls) error {
+			handled++
+			return nil
+		})
+
+		var err error
+		for i := 0; i < tc.entries && err == nil; i++ {
+			err = handler(nil, nil)
+		}
+
+		if handled != tc.expect {
+			t.Errorf("Unexpected handled entries with size limit %d: %d", tc.sizeLimit, handled)
+		}
+		if lerr, ok := err.(*LDAPError); tc.exceeded != (ok && lerr.Code == ldap.LDAPResultSizeLimitExceeded) {
+			t.Errorf("Unexpected error with size limit %d: %v", tc.sizeLimit, err)
+		}
+	}
+}
+
+func TestTypesOnlySearchResultEntry(t *testing.T) {
+	e := ldap.NewSearchResultEntry("uid=user1,ou=Users,dc=example,dc=com")
+	e.AddAttribute("uid", "user1")
+	e.AddAttribute("mail", "user1@example.com", "user1@example.org")
+
+	typesOnly := newTypesOnlySearchResultEntry("uid=user1,ou=Users,dc=example,dc=com", e)
+
+	attrs := typesOnly.Attributes()
+	if len(attrs) != 2 {
+		t.Fatalf("Unexpected attributes: %d", len(attrs))
+	}
+	for i, expect := range []message.AttributeDescription{"uid", "mail"} {
+		if attrs[i].Type_() != expect || len(attrs[i].Vals()) != 0 {
+			t.Errorf("Unexpected attribute on %d: %s, %v", i, attrs[i].Type_(), attrs[i].Vals())
+		}
+	}
+}
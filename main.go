@@ -58,11 +58,6 @@ var (
 		2,
 		"DB max idle connections",
 	)
-	suffix = fs.String(
-		"suffix",
-		"",
-		"Suffix for the LDAP",
-	)
 	rootdn = fs.String(
 		"root-dn",
 		"",
@@ -148,6 +143,101 @@ var (
 		500,
 		"Default page size for search (default 500)",
 	)
+	passwordHashScheme = fs.String(
+		"password-hash-scheme",
+		"SSHA512",
+		"Hash scheme for the password changed by password modify extended operation, on of: SSHA, SSHA256, SSHA512, SCRAM-SHA-256, PLAIN",
+	)
+	tlsCertFile = fs.String(
+		"tls-cert",
+		"",
+		"TLS: Path to the PEM encoded certificate for LDAPS and StartTLS (Reloaded by SIGHUP)",
+	)
+	tlsKeyFile = fs.String(
+		"tls-key",
+		"",
+		"TLS: Path to the PEM encoded private key for LDAPS and StartTLS (Reloaded by SIGHUP)",
+	)
+	tlsCACertFile = fs.String(
+		"tls-ca-cert",
+		"",
+		"TLS: Path to the PEM encoded CA certificates for verifying client certificates (Reloaded by SIGHUP)",
+	)
+	tlsMinVersion = fs.String(
+		"tls-min-version",
+		"1.2",
+		"TLS: Minimum TLS version, on of: 1.0, 1.1, 1.2, 1.3",
+	)
+	tlsCipherSuites = fs.String(
+		"tls-cipher-suites",
+		"",
+		"TLS: Comma separated cipher suites for TLS 1.2 or lower (e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) (Use Go's default with empty)",
+	)
+	tlsRequired = fs.Bool(
+		"tls-required",
+		false,
+		"TLS: Require LDAPS or StartTLS before any bind or write operation (default false)",
+	)
+	saslAuthcIDFilter = fs.String(
+		"sasl-authcid-filter",
+		"",
+		"SASL: Filter for finding the entry by the authentication identity of PLAIN and SCRAM-SHA-256, %u is replaced with the escaped username (e.g. (uid=%u)) (Accept only dn: prefixed identity with default)",
+	)
+	saslExternalIdentity = fs.String(
+		"sasl-external-identity",
+		"subject",
+		"SASL/EXTERNAL: Identity of the client certificate mapped to DN, on of: subject, san-email, san-dns, san-uri",
+	)
+	saslExternalRegex = fs.String(
+		"sasl-external-regex",
+		"",
+		"SASL/EXTERNAL: Regex for rewriting the identity of the client certificate (e.g. ^CN=([^,]+),.*$)",
+	)
+	saslExternalReplacement = fs.String(
+		"sasl-external-replacement",
+		"",
+		"SASL/EXTERNAL: Replacement for the regex rewriting (e.g. uid=$1,ou=Users,dc=example,dc=com)",
+	)
+	saslExternalFilter = fs.String(
+		"sasl-external-filter",
+		"",
+		"SASL/EXTERNAL: Filter for finding the entry by the identity, %s is replaced with the escaped identity (e.g. (mail=%s)) (Use the identity as DN directly with default)",
+	)
+	saslPlainCleartext = fs.Bool(
+		"sasl-plain-cleartext",
+		false,
+		"SASL/PLAIN: Allow PLAIN without LDAPS or StartTLS, the password is sent in cleartext (default false)",
+	)
+	derefAliasBindCompare = fs.Bool(
+		"deref-alias-bind-compare",
+		false,
+		"Dereference the alias entry in bind and compare, then bind authenticates as the DN of the aliased entry (default false)",
+	)
+	maxTreeDeleteSize = fs.Int(
+		"max-tree-delete-size",
+		10000,
+		"Max number of entries deleted by the subtree delete control (Unlimited with 0)",
+	)
+	maxVLVWindowSize = fs.Int(
+		"max-vlv-window-size",
+		1000,
+		"Max number of entries in the window of the virtual list view, which is beforeCount + afterCount + 1 (Unlimited with 0)",
+	)
+	changeLogRetention = fs.Int(
+		"change-log-retention",
+		7,
+		"Retention days of the change log for the content synchronization, the consumer with the older cookie requires the full refresh (Unlimited with 0)",
+	)
+	defaultReferral = fs.String(
+		"default-referral",
+		"",
+		"Default referral URL for the DN outside of the suffix (e.g. ldap://ldap.example.org) (Return no global superior knowledge with default)",
+	)
+	ldapsBindAddress = fs.String(
+		"ldaps-b",
+		"",
+		"TLS: Bind address for LDAPS (e.g. 127.0.0.1:8636) (Don't start LDAPS listener with default)",
+	)
 )
 
 type arrayFlags []string
@@ -166,8 +256,17 @@ var customSchema arrayFlags
 func main() {
 	fs.Var(&customSchema, "schema", "Additional/overwriting custom schema")
 
+	var suffixFlags arrayFlags
+	fs.Var(&suffixFlags, "suffix", `Suffix for the LDAP, repeat it for multiple naming contexts: the format is <Suffix DN>[:<DB Schema>] (The suffixes without the DB schema share the DB schema of -s) (e.g. dc=example,dc=com)`)
+
 	var aclFlags arrayFlags
-	fs.Var(&aclFlags, "acl", `Simple ACL: the format is <DN(User, Group or empty(everyone))>:<Scope(R, W or RW)>:<Invisible Attributes> (e.g. cn=reader,dc=example,dc=com:R:userPassword,telephoneNumber)`)
+	fs.Var(&aclFlags, "acl", `Simple ACL: the format is <DN(User, Group or empty(everyone))>:<Scope(R, W, D, P or combination, D allows the subtree delete with W, P allows the proxied authorization)>:<Invisible Attributes> (e.g. cn=reader,dc=example,dc=com:R:userPassword,telephoneNumber)`)
+
+	var limitFlags arrayFlags
+	fs.Var(&limitFlags, "limit", `Search limits: the format is <DN(User, Group or empty(everyone))>:<Size Limit>:<Time Limit (seconds)> (Unlimited with 0, the root DN isn't limited) (e.g. :500:60)`)
+
+	var altServerFlags arrayFlags
+	fs.Var(&altServerFlags, "alt-server", `Alternative server URL listed in altServer of the root DSE, repeat it for multiple servers (e.g. ldap://ldap2.example.com)`)
 
 	fmt.Fprintf(os.Stdout, "ldap-pg %s (rev: %s)\n", version, revision)
 	fs.Usage = func() {
@@ -205,33 +304,64 @@ func main() {
 		acl = strings.Split(aclFlags.String(), "\n")
 	}
 
+	var limits []string
+	if limitFlags != nil {
+		limits = strings.Split(limitFlags.String(), "\n")
+	}
+
+	var cipherSuites []string
+	if *tlsCipherSuites != "" {
+		cipherSuites = strings.Split(*tlsCipherSuites, ",")
+	}
+
 	// When CTRL+C, SIGINT and SIGTERM signal occurs
 	// Then stop server gracefully
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	server := NewServer(&ServerConfig{
-		DBHostName:        *dbHostName,
-		DBPort:            *dbPort,
-		DBName:            *dbName,
-		DBSchema:          *dbSchema,
-		DBUser:            *dbUser,
-		DBPassword:        *dbPassword,
-		DBMaxOpenConns:    *dbMaxOpenConns,
-		DBMaxIdleConns:    *dbMaxIdleConns,
-		Suffix:            *suffix,
-		RootDN:            *rootdn,
-		RootPW:            rootPW,
-		BindAddress:       *bindAddress,
-		PassThroughConfig: passThroughConfig,
-		LogLevel:          *logLevel,
-		PProfServer:       *pprofServer,
-		GoMaxProcs:        *gomaxprocs,
-		MigrationEnabled:  *migrationEnabled,
-		QueryTranslator:   "default",
-		SimpleACL:         acl,
-		DefaultPPolicyDN:  *defaultPPolicyDN,
-		DefaultPageSize:   int32(*defaultPageSize),
+		DBHostName:              *dbHostName,
+		DBPort:                  *dbPort,
+		DBName:                  *dbName,
+		DBSchema:                *dbSchema,
+		DBUser:                  *dbUser,
+		DBPassword:              *dbPassword,
+		DBMaxOpenConns:          *dbMaxOpenConns,
+		DBMaxIdleConns:          *dbMaxIdleConns,
+		Suffixes:                suffixFlags,
+		RootDN:                  *rootdn,
+		RootPW:                  rootPW,
+		BindAddress:             *bindAddress,
+		PassThroughConfig:       passThroughConfig,
+		LogLevel:                *logLevel,
+		PProfServer:             *pprofServer,
+		GoMaxProcs:              *gomaxprocs,
+		MigrationEnabled:        *migrationEnabled,
+		QueryTranslator:         "default",
+		SimpleACL:               acl,
+		DefaultPPolicyDN:        *defaultPPolicyDN,
+		DefaultPageSize:         int32(*defaultPageSize),
+		PasswordHashScheme:      *passwordHashScheme,
+		TLSCertFile:             *tlsCertFile,
+		TLSKeyFile:              *tlsKeyFile,
+		TLSCACertFile:           *tlsCACertFile,
+		TLSMinVersion:           *tlsMinVersion,
+		TLSCipherSuites:         cipherSuites,
+		TLSRequired:             *tlsRequired,
+		LDAPSBindAddress:        *ldapsBindAddress,
+		SASLAuthcIDFilter:       *saslAuthcIDFilter,
+		SASLExternalIdentity:    *saslExternalIdentity,
+		SASLExternalRegex:       *saslExternalRegex,
+		SASLExternalReplacement: *saslExternalReplacement,
+		SASLExternalFilter:      *saslExternalFilter,
+		SASLPlainCleartext:      *saslPlainCleartext,
+		DerefAliasBindCompare:   *derefAliasBindCompare,
+		MaxTreeDeleteSize:       *maxTreeDeleteSize,
+		MaxVLVWindowSize:        *maxVLVWindowSize,
+		ChangeLogRetention:      *changeLogRetention,
+		SearchLimits:            limits,
+		DefaultReferral:         *defaultReferral,
+		AltServers:              altServerFlags,
 	})
 
 	go server.Start()
@@ -45,24 +45,36 @@ func (j *ModifyEntry) HasKey(s *AttributeType) bool {
 }
 
 func (j *ModifyEntry) HasAttr(attrName string) bool {
-	s, ok := j.schemaMap.AttributeType(attrName)
+	s, options, ok := j.schemaMap.AttributeDescription(attrName)
 	if !ok {
 		return false
 	}
 
-	_, ok = j.attributes[s.Name]
+	_, ok = j.attributes[s.Name+options]
 	return ok
 }
 
-func (j *ModifyEntry) SetDN(dn *DN) {
+// SetDN sets the DN and adds the values of the RDN if the entry doesn't have them.
+func (j *ModifyEntry) SetDN(dn *DN) error {
 	j.dn = dn
 
-	rdn := dn.RDN()
-	for k, v := range rdn {
+	for _, a := range dn.RDNs[0].Attributes {
 		// rdn is validated already, ignore error
-		sv, _ := NewSchemaValue(j.schemaMap, k, []string{v.Orig})
-		j.attributes[sv.Name()] = sv
+		sv, _ := NewSchemaValue(j.schemaMap, a.TypeNorm, []string{a.ValueOrig})
+
+		current, ok := j.attributes[sv.Name()]
+		if !ok {
+			j.attributes[sv.Name()] = sv
+			continue
+		}
+		if current.HasDuplicate(sv) {
+			continue
+		}
+		if err := current.Add(sv); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (j *ModifyEntry) DN() *DN {
@@ -217,6 +229,16 @@ func (j *ModifyEntry) replacesv(value *SchemaValue) error {
 	return nil
 }
 
+// ReplaceOperational replaces with the value(s) of the operational attribute maintained by the server.
+// Unlike Replace, it doesn't check NO-USER-MODIFICATION. The attribute is removed if the value is empty.
+func (j *ModifyEntry) ReplaceOperational(attrName string, attrValue []string) error {
+	sv, err := NewSchemaValue(j.schemaMap, attrName, attrValue)
+	if err != nil {
+		return err
+	}
+	return j.replacesv(sv)
+}
+
 // Delete from current value(s) if the value matchs.
 func (j *ModifyEntry) Delete(attrName string, attrValue []string) error {
 	sv, err := NewSchemaValue(j.schemaMap, attrName, attrValue)
@@ -279,7 +301,7 @@ func (j *ModifyEntry) Delete(attrName string, attrValue []string) error {
 
 func (j *ModifyEntry) deletesv(value *SchemaValue) error {
 	if value.IsEmpty() {
-		return j.deleteAll(value.schema)
+		return j.deleteAll(value.Name())
 	}
 
 	current, ok := j.attributes[value.Name()]
@@ -303,12 +325,12 @@ func (j *ModifyEntry) deletesv(value *SchemaValue) error {
 	}
 }
 
-func (j *ModifyEntry) deleteAll(s *AttributeType) error {
-	if !j.HasAttr(s.Name) {
+func (j *ModifyEntry) deleteAll(name string) error {
+	if _, ok := j.attributes[name]; !ok {
 		log.Printf("warn: Failed to modify/delete because of no attribute. dn: %s", j.DN().DNNormStr())
-		return NewNoSuchAttribute("modify/delete", s.Name)
+		return NewNoSuchAttribute("modify/delete", name)
 	}
-	delete(j.attributes, s.Name)
+	delete(j.attributes, name)
 	return nil
 }
 
@@ -335,6 +357,7 @@ func (j *ModifyEntry) Attrs() (map[string][]interface{}, map[string][]string) {
 		norm[k] = v.Norm()
 		orig[k] = v.Orig()
 	}
+	addSubtypeNorm(norm, j.attributes)
 	return norm, orig
 }
 
@@ -353,9 +376,42 @@ func (e *ModifyEntry) Clone() *ModifyEntry {
 	return clone
 }
 
-func (e *ModifyEntry) ModifyRDN(newDN *DN) *ModifyEntry {
+// ModifyRDN returns the entry which has the new DN.
+// The values of the new RDN are added, and the values of the old RDN which aren't in the new RDN
+// are deleted if deleteOldRDN is true.
+func (e *ModifyEntry) ModifyRDN(newDN *DN, deleteOldRDN bool) (*ModifyEntry, error) {
 	m := e.Clone()
-	m.SetDN(newDN)
 
-	return m
+	if deleteOldRDN {
+		newRDN := newDN.RDNs[0]
+		for _, a := range e.dn.RDNs[0].Attributes {
+			if newRDN.Contains(a) {
+				continue
+			}
+			sv, err := NewSchemaValue(m.schemaMap, a.TypeNorm, []string{a.ValueOrig})
+			if err != nil {
+				return nil, err
+			}
+			if current, ok := m.attributes[sv.Name()]; ok && current.HasDuplicate(sv) {
+				if err := m.deletesv(sv); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := m.SetDN(newDN); err != nil {
+		return nil, err
+	}
+
+	// Validate ObjectClass, the new RDN might not be allowed or the old RDN might be required
+	ocs, ok := m.ObjectClassesNorm()
+	if !ok {
+		return nil, NewObjectClassViolation()
+	}
+	if err := m.schemaMap.ValidateObjectClass(ocs, m.attributes); err != nil {
+		return nil, err
+	}
+
+	return m, nil
 }
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -105,3 +106,116 @@ func TestModifyEntryValidate(t *testing.T) {
 		}
 	}
 }
+
+func TestModifyEntryModifyRDN(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	dn, _ := server.NormalizeDN("cn=John Smith+uid=jsmith,ou=People,dc=example,dc=com")
+
+	testcases := []struct {
+		NewRDN        string
+		DeleteOldRDN  bool
+		ExpectedAttrs map[string][]string
+		ExpectedError error
+	}{
+		{
+			"cn=John Smith+uid=john",
+			false,
+			map[string][]string{
+				"cn":  {"John Smith", "Johnny"},
+				"uid": {"jsmith", "john"},
+			},
+			nil,
+		},
+		{
+			"cn=John Smith+uid=john",
+			true,
+			map[string][]string{
+				"cn":  {"John Smith", "Johnny"},
+				"uid": {"john"},
+			},
+			nil,
+		},
+		{
+			"uid=Johnny+cn=johnny",
+			true,
+			map[string][]string{
+				"cn":  {"Johnny"},
+				"uid": {"Johnny"},
+			},
+			nil,
+		},
+		{
+			"cn=Johnny",
+			true,
+			map[string][]string{
+				"cn":  {"Johnny"},
+				"uid": nil,
+			},
+			nil,
+		},
+		{
+			"dc=example",
+			false,
+			nil,
+			NewObjectClassViolationNotAllowed("dc"),
+		},
+	}
+
+	for i, tc := range testcases {
+		current, err := NewModifyEntry(server.schemaMap, dn, map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"cn":          {"John Smith", "Johnny"},
+			"sn":          {"Smith"},
+			"uid":         {"jsmith"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+
+		newDN, err := dn.ModifyRDN(server.schemaMap, tc.NewRDN)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+
+		newEntry, err := current.ModifyRDN(newDN, tc.DeleteOldRDN)
+		if tc.ExpectedError != nil {
+			if err == nil || err.Error() != tc.ExpectedError.Error() {
+				t.Errorf("Unexpected error on %d: [%v] expected, got [%v]", i, tc.ExpectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error on %d: %+v", i, err)
+			continue
+		}
+
+		_, orig := newEntry.Attrs()
+		for k, v := range tc.ExpectedAttrs {
+			if !reflect.DeepEqual(orig[k], v) {
+				t.Errorf("Unexpected %s on %d: %v expected, got %v", k, i, v, orig[k])
+			}
+		}
+		if err := server.schemaMap.ValidateRDN(newEntry.DN(), newEntry.attributes); err != nil {
+			t.Errorf("Unexpected error of ValidateRDN on %d: %+v", i, err)
+		}
+	}
+
+	// The value of the RDN can't be deleted
+	current, _ := NewModifyEntry(server.schemaMap, dn, map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"cn":          {"John Smith"},
+		"sn":          {"Smith"},
+		"uid":         {"jsmith", "john"},
+	})
+	if err := current.Delete("uid", []string{"jsmith"}); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	err := server.schemaMap.ValidateRDN(current.DN(), current.attributes)
+	if err == nil || err.Error() != NewNamingViolation("uid").Error() {
+		t.Errorf("Unexpected error of ValidateRDN: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// NamingContext is the tree of the entries under one suffix.
+// The DN of the entry is stored without the base DN. The base DN is the suffix itself
+// if the naming context has own DB schema. If the naming contexts share the DB schema,
+// it's the parent of the suffix, so each suffix entry becomes own root (parent_id = 0)
+// and the stored DNs keep the RDN of the suffix not to collide with the other naming contexts.
+type NamingContext struct {
+	Suffix   *DN
+	DBSchema string
+	Base     *DN
+}
+
+// parseSuffixConfig returns the suffix DN and the DB schema from the format <Suffix DN>[:<DB Schema>].
+// The DB schema is empty if it isn't specified.
+func parseSuffixConfig(value string) (string, string) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return strings.TrimSpace(value), ""
+	}
+
+	// The colon is a part of the DN, e.g. ou=a:b,o=example
+	schema := strings.TrimSpace(value[i+1:])
+	if schema == "" || strings.ContainsAny(schema, "=,") {
+		return strings.TrimSpace(value), ""
+	}
+	return strings.TrimSpace(value[:i]), schema
+}
+
+// initNamingContexts parses the suffixes of the config.
+// The naming context without the DB schema uses the default DB schema.
+// The naming contexts sharing the DB schema must have the different RDNs of the suffix.
+func (s *Server) initNamingContexts() {
+	schemas := map[string][]*NamingContext{}
+
+	for _, v := range s.config.Suffixes {
+		suffix, schema := parseSuffixConfig(v)
+		if schema == "" {
+			schema = s.config.DBSchema
+		}
+
+		dn, err := ParseDN(s.schemaMap, suffix)
+		if err != nil {
+			log.Fatalf("alert: Invalid suffix: %s, err: %+v", suffix, err)
+		}
+		if nc := s.NamingContextOf(dn); nc != nil && nc.Suffix.Equal(dn) {
+			log.Fatalf("alert: Duplicate suffix: %s", suffix)
+		}
+		for _, other := range schemas[schema] {
+			if other.Suffix.RDNNormStr() == dn.RDNNormStr() {
+				log.Fatalf("alert: The suffix %s has the same RDN as %s in the DB schema %s, specify another DB schema with <Suffix DN>:<DB Schema>",
+					suffix, other.Suffix.DNOrigStr(), schema)
+			}
+		}
+
+		nc := &NamingContext{
+			Suffix:   dn,
+			DBSchema: schema,
+			Base:     dn,
+		}
+		schemas[schema] = append(schemas[schema], nc)
+		s.namingContexts = append(s.namingContexts, nc)
+	}
+
+	if len(s.namingContexts) == 0 {
+		log.Fatalf("alert: No suffix is specified")
+	}
+
+	for _, ncs := range schemas {
+		if len(ncs) == 1 {
+			continue
+		}
+		for _, nc := range ncs {
+			nc.Base = &DN{RDNs: nc.Suffix.RDNs[1:]}
+		}
+	}
+}
+
+// NamingContexts returns the naming contexts in the order of the config.
+func (s *Server) NamingContexts() []*NamingContext {
+	return s.namingContexts
+}
+
+// NamingContextOf returns the naming context which holds the DN.
+// If the suffixes are nested, the deepest one is returned.
+// It returns nil if the DN is outside of all suffixes.
+func (s *Server) NamingContextOf(dn *DN) *NamingContext {
+	var found *NamingContext
+	for _, nc := range s.namingContexts {
+		if !dn.Equal(nc.Suffix) && !dn.IsSubOf(nc.Suffix) {
+			continue
+		}
+		if found == nil || len(nc.Suffix.RDNs) > len(found.Suffix.RDNs) {
+			found = nc
+		}
+	}
+	return found
+}
+
+// isChangeInNamingContext returns true if the change is in the naming context of the base DN.
+// The ID and the sequence of the change can't be compared with the other naming context.
+func (s *Server) isChangeInNamingContext(baseDN *DN, change *EntryChange) bool {
+	nc := s.NamingContextOf(baseDN)
+	return nc != nil && change.Suffix != nil && nc.Suffix.Equal(change.Suffix)
+}
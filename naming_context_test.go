@@ -0,0 +1,132 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSuffixConfig(t *testing.T) {
+	testcases := []struct {
+		value  string
+		suffix string
+		schema string
+	}{
+		{"dc=example,dc=com", "dc=example,dc=com", ""},
+		{"o=partners:partners", "o=partners", "partners"},
+		{" o=partners : partners ", "o=partners", "partners"},
+		{"ou=a:b,o=example", "ou=a:b,o=example", ""},
+		{"o=example:corp:corp", "o=example:corp", "corp"},
+		{"o=partners:", "o=partners:", ""},
+	}
+
+	for i, tc := range testcases {
+		suffix, schema := parseSuffixConfig(tc.value)
+		if suffix != tc.suffix || schema != tc.schema {
+			t.Errorf("#%d: unexpected suffix config. expected: %q %q, got: %q %q", i, tc.suffix, tc.schema, suffix, schema)
+		}
+	}
+}
+
+func TestNamingContextOf(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners:partners", "ou=Remote,dc=example,dc=com:remote"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	if server.GetSuffix() != "dc=example,dc=com" {
+		t.Errorf("Unexpected primary suffix: %s", server.GetSuffix())
+	}
+	if len(server.NamingContexts()) != 3 || server.NamingContexts()[0].DBSchema != "public" {
+		t.Fatalf("Unexpected naming contexts: %v", server.NamingContexts())
+	}
+
+	testcases := []struct {
+		dn       string
+		expected string
+	}{
+		{"dc=example,dc=com", "dc=example,dc=com"},
+		{"uid=user1,ou=Users,dc=example,dc=com", "dc=example,dc=com"},
+		{"o=Partners", "o=partners"},
+		{"uid=user1,o=partners", "o=partners"},
+		// The deepest suffix is selected
+		{"ou=Remote,dc=example,dc=com", "ou=remote,dc=example,dc=com"},
+		{"uid=user1,ou=Remote,dc=example,dc=com", "ou=remote,dc=example,dc=com"},
+		{"dc=com", ""},
+		{"o=other", ""},
+	}
+
+	for i, tc := range testcases {
+		dn, err := server.NormalizeDN(tc.dn)
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %+v", i, err)
+		}
+		nc := server.NamingContextOf(dn)
+		if tc.expected == "" {
+			if nc != nil {
+				t.Errorf("#%d: unexpected naming context: %s", i, nc.Suffix.DNNormStr())
+			}
+			continue
+		}
+		if nc == nil || nc.Suffix.DNNormStr() != tc.expected {
+			t.Errorf("#%d: expected naming context: %s, got: %v", i, tc.expected, nc)
+		}
+	}
+}
+
+func TestNamingContextBase(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners", "ou=Remote,dc=example,dc=com:remote"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	// The naming contexts sharing the DB schema have own root entries under the parent of the suffix
+	for i, expected := range []string{"dc=com", "", "ou=remote,dc=example,dc=com"} {
+		nc := server.NamingContexts()[i]
+		if nc.Base.DNNormStr() != expected {
+			t.Errorf("#%d: unexpected base DN of %s. expected: %q, got: %q", i, nc.Suffix.DNNormStr(), expected, nc.Base.DNNormStr())
+		}
+	}
+
+	dn, _ := server.NormalizeDN("uid=user1,o=partners")
+	partners := server.NamingContexts()[1]
+	if got := dn.DNNormStrWithoutSuffix(partners.Base); got != "uid=user1,o=partners" {
+		t.Errorf("Unexpected DN without the base DN: %s", got)
+	}
+	if got := dn.ParentDN().ParentDN().DNNormStrWithoutSuffix(partners.Base); got != "" {
+		t.Errorf("Unexpected parent DN of the root entry: %s", got)
+	}
+	if got := resolveSuffix(partners.Base, "o=Partners,"); got != "o=Partners" {
+		t.Errorf("Unexpected DN of the root entry: %s", got)
+	}
+	if got := resolveSuffix(server.NamingContexts()[0].Base, "dc=example,"); got != "dc=example,dc=com" {
+		t.Errorf("Unexpected DN of the root entry: %s", got)
+	}
+}
+
+func TestIsChangeInNamingContext(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners:partners"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	baseDN, _ := server.NormalizeDN("ou=Users,dc=example,dc=com")
+	example := server.NamingContexts()[0].Suffix
+	partners := server.NamingContexts()[1].Suffix
+
+	if !server.isChangeInNamingContext(baseDN, &EntryChange{ID: 1, Suffix: example}) {
+		t.Errorf("Expected the change in the naming context")
+	}
+	if server.isChangeInNamingContext(baseDN, &EntryChange{ID: 1, Suffix: partners}) {
+		t.Errorf("Unexpected change of the other naming context")
+	}
+	if server.isChangeInNamingContext(baseDN, &EntryChange{ID: 1}) {
+		t.Errorf("Unexpected change without the suffix")
+	}
+}
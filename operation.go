@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// Operation is the outstanding request which can be abandoned or canceled.
+// The context of the request is canceled when the request is abandoned, canceled or the client is disconnected.
+// Then the in-flight SQL is canceled since the repository begins the transaction with the context.
+type Operation struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+	cancelable bool
+
+	mutex     sync.Mutex
+	abandoned bool
+	canceled  bool
+	responded bool
+	completed bool
+}
+
+// startOperation registers the request as the outstanding operation.
+// The abandon signal is also sent by ldapserver when the client is disconnected.
+func (s *Server) startOperation(m *ldap.Message) *Operation {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	op := &Operation{
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		cancelable: isCancelableOperation(m),
+	}
+	s.operations.Store(m, op)
+
+	go func() {
+		select {
+		case <-m.Done:
+			op.abandon()
+			log.Printf("info: Abandoned the operation. messageID: %d", m.MessageID().Int())
+		case <-op.done:
+		}
+	}()
+
+	return op
+}
+
+func (s *Server) endOperation(m *ldap.Message, op *Operation) {
+	s.operations.Delete(m)
+	op.cancel()
+	close(op.done)
+}
+
+// RequestContext returns the context of the request which is canceled when the request is abandoned or canceled.
+func (s *Server) RequestContext(m *ldap.Message) context.Context {
+	if op, ok := s.operations.Load(m); ok {
+		return op.(*Operation).ctx
+	}
+	return context.Background()
+}
+
+// isCancelableOperation returns false for the operations which can't be canceled.
+// https://datatracker.ietf.org/doc/html/rfc3909#section-2
+func isCancelableOperation(m *ldap.Message) bool {
+	switch r := m.ProtocolOp().(type) {
+	case message.BindRequest:
+		return false
+	case message.ExtendedRequest:
+		return r.RequestName() != ldap.NoticeOfStartTLS && string(r.RequestName()) != CancelOID
+	}
+	return true
+}
+
+func (op *Operation) abandon() {
+	op.mutex.Lock()
+	op.abandoned = true
+	op.mutex.Unlock()
+
+	op.cancel()
+}
+
+// Cancel cancels the operation and waits for the response of it.
+// It returns the result code of the cancel operation.
+func (op *Operation) Cancel() int {
+	if !op.cancelable {
+		return LDAPResultCannotCancel
+	}
+
+	op.mutex.Lock()
+	if op.responded || op.abandoned || op.canceled {
+		op.mutex.Unlock()
+		return LDAPResultTooLate
+	}
+	op.canceled = true
+	op.mutex.Unlock()
+
+	op.cancel()
+	<-op.done
+
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	// The operation was completed before the cancel took effect
+	if op.completed {
+		return LDAPResultTooLate
+	}
+	return ldap.LDAPResultSuccess
+}
+
+// filterResponse returns the response to be written for the operation.
+// No response is returned for the abandoned operation, and the canceled operation returns canceled result code
+// unless it was completed.
+func (op *Operation) filterResponse(po message.ProtocolOp) (message.ProtocolOp, bool) {
+	op.mutex.Lock()
+	defer op.mutex.Unlock()
+
+	if op.abandoned {
+		return nil, false
+	}
+
+	switch po.(type) {
+	case message.SearchResultEntry, message.SearchResultReference, message.IntermediateResponse:
+		return po, true
+	}
+
+	op.responded = true
+
+	if !op.canceled {
+		return po, true
+	}
+
+	if code, ok := resultCode(po); ok && isCompletedResultCode(code) {
+		op.completed = true
+		return po, true
+	}
+	return canceledResponse(po), true
+}
+
+func isCompletedResultCode(code int) bool {
+	return code == ldap.LDAPResultSuccess || code == ldap.LDAPResultCompareTrue || code == ldap.LDAPResultCompareFalse
+}
+
+// canceledResponse returns the response which has the same type of the response with canceled result code.
+func canceledResponse(po message.ProtocolOp) message.ProtocolOp {
+	switch po.(type) {
+	case message.AddResponse:
+		return ldap.NewAddResponse(LDAPResultCanceled)
+	case message.DelResponse:
+		return ldap.NewDeleteResponse(LDAPResultCanceled)
+	case message.ModifyResponse:
+		return ldap.NewModifyResponse(LDAPResultCanceled)
+	case message.ModifyDNResponse:
+		return ldap.NewModifyDNResponse(LDAPResultCanceled)
+	case message.CompareResponse:
+		return ldap.NewCompareResponse(LDAPResultCanceled)
+	case message.SearchResultDone:
+		return ldap.NewSearchResultDoneResponse(LDAPResultCanceled)
+	case message.ExtendedResponse:
+		return ldap.NewExtendedResponse(LDAPResultCanceled)
+	}
+	return po
+}
+
+// operationResponseWriter writes the response filtered by the operation state.
+type operationResponseWriter struct {
+	ldap.ResponseWriter
+	op *Operation
+}
+
+func (w *operationResponseWriter) Write(po message.ProtocolOp) {
+	if po, ok := w.op.filterResponse(po); ok {
+		w.ResponseWriter.Write(po)
+	}
+}
+
+func (w *operationResponseWriter) WriteControls(po message.ProtocolOp, c *message.Controls) {
+	if po, ok := w.op.filterResponse(po); ok {
+		w.ResponseWriter.WriteControls(po, c)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build test
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+func newTestOperationMessage(id int) *ldap.Message {
+	lm := message.NewLDAPMessageWithProtocolOp(message.DelRequest("uid=user1,ou=Users,dc=example,dc=com"))
+	lm.SetMessageID(id)
+	return &ldap.Message{
+		LDAPMessage: lm,
+		Done:        make(chan bool, 2),
+	}
+}
+
+func TestOperationAbandon(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+
+	m := newTestOperationMessage(1)
+	op := server.startOperation(m)
+
+	m.Abandon()
+
+	select {
+	case <-server.RequestContext(m).Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Not canceled the context by abandon")
+	}
+
+	if _, ok := op.filterResponse(ldap.NewDeleteResponse(ldap.LDAPResultSuccess)); ok {
+		t.Errorf("Unexpected response of the abandoned operation")
+	}
+
+	server.endOperation(m, op)
+
+	if _, ok := server.operations.Load(m); ok {
+		t.Errorf("Not unregistered the operation")
+	}
+}
+
+func TestOperationCancel(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+
+	testcases := []struct {
+		Response     message.ProtocolOp
+		ExpectCode   int
+		ExpectCancel int
+	}{
+		// The operation failed by the cancel
+		{ldap.NewDeleteResponse(ldap.LDAPResultOperationsError), LDAPResultCanceled, ldap.LDAPResultSuccess},
+		// The operation was completed before the cancel took effect
+		{ldap.NewDeleteResponse(ldap.LDAPResultSuccess), ldap.LDAPResultSuccess, LDAPResultTooLate},
+	}
+
+	for i, tc := range testcases {
+		m := newTestOperationMessage(i + 1)
+		op := server.startOperation(m)
+
+		result := make(chan int)
+		go func() {
+			result <- op.Cancel()
+		}()
+
+		<-server.RequestContext(m).Done()
+
+		res, ok := op.filterResponse(tc.Response)
+		if !ok {
+			t.Fatalf("Unexpected no response on %d", i)
+		}
+		if code, _ := resultCode(res); code != tc.ExpectCode {
+			t.Errorf("Unexpected result code on %d: %d", i, code)
+		}
+
+		server.endOperation(m, op)
+
+		if code := <-result; code != tc.ExpectCancel {
+			t.Errorf("Unexpected result code of the cancel on %d: %d", i, code)
+		}
+	}
+
+	// Already responded
+	m := newTestOperationMessage(3)
+	op := server.startOperation(m)
+	op.filterResponse(ldap.NewDeleteResponse(ldap.LDAPResultSuccess))
+	if code := op.Cancel(); code != LDAPResultTooLate {
+		t.Errorf("Unexpected result code of the cancel: %d", code)
+	}
+	server.endOperation(m, op)
+
+	// Bind can't be canceled
+	lm := message.NewLDAPMessageWithProtocolOp(message.BindRequest{})
+	lm.SetMessageID(4)
+	m = &ldap.Message{LDAPMessage: lm, Done: make(chan bool, 2)}
+	op = server.startOperation(m)
+	if code := op.Cancel(); code != LDAPResultCannotCancel {
+		t.Errorf("Unexpected result code of the cancel: %d", code)
+	}
+	server.endOperation(m, op)
+}
+
+func TestParseCancelRequest(t *testing.T) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "cancelRequestValue")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 5, "cancelID"))
+	v := message.OCTETSTRING(packet.Bytes())
+
+	cancelID, err := parseCancelRequest(&v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if cancelID != 5 {
+		t.Errorf("Unexpected cancelID: %d", cancelID)
+	}
+
+	if _, err := parseCancelRequest(nil); err == nil {
+		t.Errorf("Unexpected success of parsing no value")
+	}
+}
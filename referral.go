@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/openstandia/goldap/message"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+// Referrals
+// https://datatracker.ietf.org/doc/html/rfc3296
+
+// checkReferral returns the referral error if the DN is the referral entry or its subordinate.
+// The DN outside of all suffixes is referred to the default referral if it's configured.
+// Nothing is referred with the ManageDsaIT control.
+func (s *Server) checkReferral(ctx context.Context, m *ldap.Message, dn *DN) error {
+	if s.NamingContextOf(dn) == nil {
+		if s.config.DefaultReferral != "" {
+			return s.superiorReferral()
+		}
+		return nil
+	}
+
+	if hasManageDsaITControl(m) {
+		return nil
+	}
+
+	ref, err := s.Repo().FindReferral(ctx, dn)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return nil
+	}
+
+	log.Printf("info: Referred. dn_norm: %s, referral_dn_norm: %s", dn.DNNormStr(), ref.DN.DNNormStr())
+
+	return NewReferral(rewriteReferral(ref.Ref, ref.DN, dn, ""))
+}
+
+// superiorReferral returns the default referral for the DN outside of the suffix.
+// Without the default referral, the server has no knowledge of the superior.
+func (s *Server) superiorReferral() *LDAPError {
+	if s.config.DefaultReferral == "" {
+		return NewNoGlobalSuperiorKnowledge()
+	}
+	return NewReferral([]string{s.config.DefaultReferral})
+}
+
+// isReferralEntry returns whether the entry is the referral entry.
+func isReferralEntry(entry *SearchEntry) bool {
+	_, ocs, ok := entry.GetAttrOrig("objectClass")
+	if !ok {
+		return false
+	}
+	for _, oc := range ocs {
+		if strings.EqualFold(oc, "referral") {
+			return true
+		}
+	}
+	return false
+}
+
+// newSearchResultReference returns the continuation reference for the referral entry in the search scope.
+// The scope of the reference is base for one level search, sub for subtree search.
+func newSearchResultReference(s *Server, entry *SearchEntry, scope int) (message.SearchResultReference, error) {
+	dn, err := s.NormalizeDN(entry.DNOrigWithSuffix())
+	if err != nil {
+		return nil, err
+	}
+
+	refScope := "sub"
+	if scope == 1 {
+		refScope = "base"
+	}
+
+	_, refs, _ := entry.GetAttrOrig("ref")
+	urls := rewriteReferral(refs, dn, dn, refScope)
+
+	res := make(message.SearchResultReference, len(urls))
+	for i, v := range urls {
+		res[i] = message.URI(v)
+	}
+	return res, nil
+}
+
+// rewriteReferral rewrites the ref URLs of the referral entry for the target DN.
+// The DN part of the URL is replaced with the target DN which is relative to the DN of the URL.
+// e.g. ldap://hostb/ou=people,dc=example,dc=net of ou=people,dc=example,dc=com is rewritten to
+// ldap://hostb/uid=user1,ou=people,dc=example,dc=net for uid=user1,ou=people,dc=example,dc=com.
+// If the URL doesn't have the DN part, the target DN is used.
+// The scope part is replaced if the scope isn't empty.
+func rewriteReferral(refs []string, refDN, targetDN *DN, scope string) []string {
+	var relative []string
+	for i := 0; i < len(targetDN.RDNs)-len(refDN.RDNs); i++ {
+		relative = append(relative, targetDN.RDNs[i].OrigEncodedStr())
+	}
+
+	urls := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		u, err := url.Parse(ref)
+		if err != nil {
+			log.Printf("warn: Invalid ref URL: %s, err: %v", ref, err)
+			continue
+		}
+
+		dn := strings.TrimPrefix(u.Path, "/")
+		if dn == "" {
+			dn = targetDN.DNOrigStr()
+		} else if len(relative) > 0 {
+			dn = strings.Join(relative, ",") + "," + dn
+		}
+		u.Path = "/" + dn
+		u.RawPath = ""
+
+		if scope != "" {
+			// attributes?scope?filter?extensions
+			parts := strings.SplitN(u.RawQuery, "?", 4)
+			for len(parts) < 2 {
+				parts = append(parts, "")
+			}
+			parts[1] = scope
+			u.RawQuery = strings.Join(parts, "?")
+		}
+
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// setReferral sets the referral URLs of the LDAP error to the result.
+func setReferral(res *message.LDAPResult, err *LDAPError) {
+	if len(err.Referral) == 0 {
+		return
+	}
+
+	ref := make(message.Referral, len(err.Referral))
+	for i, v := range err.Referral {
+		ref[i] = message.URI(v)
+	}
+	res.SetReferral(&ref)
+}
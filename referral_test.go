@@ -0,0 +1,101 @@
+//go:build test
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHasManageDsaITControl(t *testing.T) {
+	if !hasManageDsaITControl(newMessageWithControl(t, ManageDsaITControlOID, true, nil)) {
+		t.Errorf("Expected the ManageDsaIT control")
+	}
+	if hasManageDsaITControl(newMessageWithControl(t, "", false, nil)) {
+		t.Errorf("Unexpected ManageDsaIT control")
+	}
+}
+
+func TestRewriteReferral(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	refDN, _ := server.NormalizeDN("ou=Remote,dc=example,dc=com")
+
+	testcases := []struct {
+		refs     []string
+		targetDN string
+		scope    string
+		expected []string
+	}{
+		{
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net"},
+			"ou=Remote,dc=example,dc=com",
+			"",
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net"},
+		},
+		{
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net", "ldap://hostc:1389/ou=Remote,dc=example,dc=net"},
+			"uid=John Smith,ou=Remote,dc=example,dc=com",
+			"",
+			[]string{"ldap://hostb/uid=John%20Smith,ou=Remote,dc=example,dc=net", "ldap://hostc:1389/uid=John%20Smith,ou=Remote,dc=example,dc=net"},
+		},
+		{
+			[]string{"ldap://hostb"},
+			"uid=user1,ou=Remote,dc=example,dc=com",
+			"",
+			[]string{"ldap://hostb/uid=user1,ou=Remote,dc=example,dc=com"},
+		},
+		{
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net"},
+			"ou=Remote,dc=example,dc=com",
+			"sub",
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net??sub"},
+		},
+		{
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net?cn?one?(objectClass=*)"},
+			"ou=Remote,dc=example,dc=com",
+			"base",
+			[]string{"ldap://hostb/ou=Remote,dc=example,dc=net?cn?base?(objectClass=*)"},
+		},
+		{
+			[]string{"%zz"},
+			"ou=Remote,dc=example,dc=com",
+			"",
+			[]string{},
+		},
+	}
+
+	for i, tc := range testcases {
+		targetDN, err := server.NormalizeDN(tc.targetDN)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+
+		urls := rewriteReferral(tc.refs, refDN, targetDN, tc.scope)
+		if !reflect.DeepEqual(urls, tc.expected) {
+			t.Errorf("Unexpected referral on %d\nexpected: %v\ngot: %v", i, tc.expected, urls)
+		}
+	}
+}
+
+func TestIsReferralEntry(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	if !isReferralEntry(NewSearchEntry(server.schemaMap, "ou=Remote", map[string][]string{
+		"objectClass": {"Referral", "extensibleObject"},
+		"ref":         {"ldap://hostb/ou=Remote,dc=example,dc=net"},
+	})) {
+		t.Errorf("Expected the referral entry")
+	}
+	if isReferralEntry(NewSearchEntry(server.schemaMap, "ou=Users", map[string][]string{
+		"objectClass": {"organizationalUnit"},
+	})) {
+		t.Errorf("Unexpected referral entry")
+	}
+}
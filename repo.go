@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/openstandia/goldap/message"
+	"golang.org/x/xerrors"
 )
 
 var maxRetry = 10
@@ -33,13 +35,35 @@ func (m *StmtCache) Put(key string, value *sqlx.NamedStmt) {
 type DBRepository struct {
 	server *Server
 	db     *sqlx.DB
+	suffix *DN
+	base   *DN
+	schema string
 }
 
 func NewRepository(server *Server) (Repository, error) {
+	ncs := server.NamingContexts()
+	if len(ncs) == 1 {
+		return newHybridRepository(server, ncs[0])
+	}
+
+	repo := &NamingContextRepository{
+		server: server,
+		repos:  make([]*HybridRepository, len(ncs)),
+	}
+	for i, nc := range ncs {
+		r, err := newHybridRepository(server, nc)
+		if err != nil {
+			return nil, err
+		}
+		repo.repos[i] = r
+	}
+
+	return repo, nil
+}
+
+func newHybridRepository(server *Server, nc *NamingContext) (*HybridRepository, error) {
 	// Init DB Connection
-	db, err := sqlx.Connect("postgres", fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=disable search_path=%s",
-		server.config.DBHostName, server.config.DBPort, server.config.DBUser, server.config.DBName,
-		server.config.DBPassword, server.config.DBSchema))
+	db, err := sqlx.Connect("postgres", dataSourceName(server.config, nc.DBSchema))
 	if err != nil {
 		log.Fatalf("alert: Connect error. host=%s, port=%d, user=%s, dbname=%s, error=%s",
 			server.config.DBHostName, server.config.DBPort, server.config.DBUser, server.config.DBName, err)
@@ -48,13 +72,26 @@ func NewRepository(server *Server) (Repository, error) {
 	db.SetMaxIdleConns(server.config.DBMaxIdleConns)
 	// db.SetConnMaxLifetime(time.Hour)
 
+	// The DB schema of the additional naming context is created automatically as well as the tables
+	if nc.DBSchema != server.config.DBSchema {
+		if _, err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + pq.QuoteIdentifier(nc.DBSchema)); err != nil {
+			return nil, xerrors.Errorf("Failed to create DB schema. schema: %s, err: %w", nc.DBSchema, err)
+		}
+	}
+
 	// TODO: Enable to switch another implementation
 	repo := &HybridRepository{
 		DBRepository: &DBRepository{
 			server: server,
 			db:     db,
+			suffix: nc.Suffix,
+			base:   nc.Base,
+			schema: nc.DBSchema,
+		},
+		translator: &HybridDBFilterTranslator{
+			suffix: nc.Suffix,
+			base:   nc.Base,
 		},
-		translator: &HybridDBFilterTranslator{},
 	}
 
 	err = repo.Init()
@@ -62,15 +99,34 @@ func NewRepository(server *Server) (Repository, error) {
 		return nil, err
 	}
 
+	// The DB schema of one suffix has the container of the suffix entry with the empty dn_norm,
+	// it can't be shared since the DNs are stored without the RDN of the suffix
+	if !nc.Base.Equal(nc.Suffix) {
+		var exists bool
+		if err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM ldap_container WHERE id != 0 AND dn_norm = '')"); err != nil {
+			return nil, xerrors.Errorf("Failed to check the shared DB schema. schema: %s, err: %w", nc.DBSchema, err)
+		}
+		if exists {
+			return nil, xerrors.Errorf("The DB schema %s has the entries of one suffix, specify another DB schema for the suffix %s",
+				nc.DBSchema, nc.Suffix.DNOrigStr())
+		}
+	}
+
 	return repo, nil
 }
 
+func dataSourceName(c *ServerConfig, schema string) string {
+	return fmt.Sprintf("host=%s port=%d user=%s dbname=%s password=%s sslmode=disable search_path=%s",
+		c.DBHostName, c.DBPort, c.DBUser, c.DBName, c.DBPassword, schema)
+}
+
 type Repository interface {
 	// Init is called when initializing repository implementation.
 	Init() error
 
 	// Bind fetches the current bind entry by specified DN. Then execute callback with the entry.
 	// The callback is expected checking the credential, account lock status and so on.
+	// If the entry is an alias, the dereferenced entry is fetched.
 	// This is used for BIND operation.
 	Bind(ctx context.Context, dn *DN, callback func(current *FetchedCredential) error) error
 
@@ -79,6 +135,7 @@ type Repository interface {
 	FindPPolicyByDN(ctx context.Context, dn *DN) (*PPolicy, error)
 
 	// Search handles search request by filter.
+	// The aliases are dereferenced according to the deref aliases option.
 	// This is used for SEARCH operation.
 	Search(ctx context.Context, baseDN *DN, option *SearchOption, handler func(entry *SearchEntry) error) (int32, int64, error)
 
@@ -88,13 +145,58 @@ type Repository interface {
 
 	// UpdateDN modifies the entry DN by specified change data.
 	// This is used for MODRDN operation.
-	UpdateDN(ctx context.Context, oldDN, newDN *DN, oldRDN *RelativeDN) error
+	UpdateDN(ctx context.Context, oldDN, newDN *DN, deleteOldRDN bool) error
 
 	// Insert creates the entry by specified entry data.
 	Insert(ctx context.Context, entry *AddEntry) (int64, error)
 
 	// DeleteByDN deletes the entry by specified DN.
 	DeleteByDN(ctx context.Context, dn *DN) error
+
+	// DeleteTreeByDN deletes the entry and all subordinate entries by specified DN in one transaction.
+	// This is used for DEL operation with the subtree delete control.
+	DeleteTreeByDN(ctx context.Context, dn *DN) error
+
+	// Transaction executes the callback in one transaction of the naming context of the DN.
+	// The write operations called with the context passed to the callback join the transaction,
+	// then they are committed all together if the callback succeeds, or rolled back if not.
+	// The write operations must be in the naming context of the DN, and nil DN means no write operation.
+	// This is used for LDAP transactions.
+	Transaction(ctx context.Context, dn *DN, callback func(ctx context.Context) error) error
+
+	// Compare checks whether the entry by specified DN has the assertion value.
+	// The value is matched by the EQUALITY matching rule of the attribute.
+	// If the entry is an alias, the dereferenced entry is compared.
+	// If the entry doesn't have the attribute, it returns noSuchAttribute error instead of false.
+	// This is used for COMPARE operation.
+	Compare(ctx context.Context, dn *DN, value *SchemaValue) (bool, error)
+
+	// ListenEntryChanges listens the committed changes of the entries including other ldap-pg instances.
+	// Then execute handler with the change. It blocks until the context is done.
+	// This is used for the persistent search.
+	ListenEntryChanges(ctx context.Context, handler func(change *EntryChange)) error
+
+	// FindContextCSN returns the latest change in the change log of the naming context of baseDN.
+	// It returns the empty CSN if no change is recorded.
+	// This is used for the content synchronization.
+	FindContextCSN(ctx context.Context, baseDN *DN) (*ContextCSN, error)
+
+	// FindReferral returns the referral entry which is the entry by specified DN or its superior.
+	// It returns nil if there is no referral entry.
+	// This is used for the referral handling without the ManageDsaIT control.
+	FindReferral(ctx context.Context, dn *DN) (*FetchedReferral, error)
+
+	// FindEntryChanges returns the latest change of each entry after the change of fromCSN until the context CSN
+	// in the naming context of baseDN. The changes are sorted by the seq.
+	// The empty fromCSN means the beginning of the change log.
+	// It returns false if fromCSN isn't found in the change log.
+	// This is used for the content synchronization.
+	FindEntryChanges(ctx context.Context, baseDN *DN, fromCSN string, to *ContextCSN) ([]*EntryChange, bool, error)
+
+	// PruneEntryChanges deletes the changes recorded before the time from the change log.
+	// The latest change remains as the context CSN.
+	// This is used for the retention of the change log.
+	PruneEntryChanges(ctx context.Context, before time.Time) (int64, error)
 }
 
 type SearchOption struct {
@@ -102,9 +204,88 @@ type SearchOption struct {
 	Filter                     message.Filter
 	PageSize                   int32
 	Cursor                     *int64
+	SortKeys                   []*SortKey
+	SortCursor                 *SortCursor
+	VLV                        *VLVOption
 	RequestedAssocation        []string
 	IsMemberOfRequested        bool
 	IsHasSubordinatesRequested bool
+	MatchedValues              []message.Filter
+	EntryID                    int64
+	IsContextCSNRequested      bool
+	Deadline                   time.Time // The time limit of the whole search, the zero value means unlimited
+	DerefAliases               int
+	ManageDsaIT                bool // The entries beneath the referral entries are excluded without ManageDsaIT
+
+	// The aliases within the search scope and their dereferenced DNs, which are resolved by the repository
+	aliasIDs []int64
+	derefDNs []*DN
+}
+
+// IsDerefInSearching returns true if the aliases within the search scope should be dereferenced.
+func (o *SearchOption) IsDerefInSearching() bool {
+	return o.DerefAliases == message.SearchRequetDerefAliasesDerefInSearching ||
+		o.DerefAliases == message.SearchRequetDerefAliasesDerefAlways
+}
+
+// IsDerefFindingBaseObj returns true if the alias of the base object should be dereferenced.
+func (o *SearchOption) IsDerefFindingBaseObj() bool {
+	return o.DerefAliases == message.SearchRequetDerefAliasesDerefFindingBaseObj ||
+		o.DerefAliases == message.SearchRequetDerefAliasesDerefAlways
+}
+
+// EntryChange is the committed change of the entry. The change type is same as the persistent search.
+// Only the deleted entry has the attributes since it can't be fetched after the deletion.
+// The DN doesn't have the base DN same as the search entry, but the previous DN has.
+// The ID and the sequence are unique in the DB schema of the naming context.
+type EntryChange struct {
+	ChangeType int                 `json:"type" db:"change_type"`
+	ID         int64               `json:"id" db:"entry_id"`
+	Seq        int64               `json:"seq" db:"seq"`
+	CSN        string              `json:"csn" db:"csn"`
+	EntryUUID  string              `json:"uuid" db:"entry_uuid"`
+	DNOrig     string              `json:"dn" db:"dn_orig"`
+	PreviousDN string              `json:"previous_dn" db:"-"`
+	AttrsOrig  map[string][]string `json:"attrs" db:"-"`
+	Suffix     *DN                 `json:"-" db:"-"`
+	Base       *DN                 `json:"-" db:"-"`
+}
+
+// ContextCSN is the latest change in the change log.
+// The sequence is used for ordering the changes, and the CSN is used for the sync cookie.
+type ContextCSN struct {
+	Seq int64  `db:"seq"`
+	CSN string `db:"csn"`
+}
+
+// SortKey is the key for sorting the search result.
+// When the sort keys are specified, the sorted result is paged by SortCursor,
+// and the cursor means the offset of the VLV window.
+type SortKey struct {
+	AttributeType *AttributeType
+	ReverseOrder  bool
+}
+
+// SortCursor is the position of the last entry in the sorted page.
+// The values are the sort key values of the entry, nil if it doesn't have the attribute.
+// The next page continues after the position, so the entries added or deleted between the pages
+// don't shift the following entries. The repository sets it when the next page remains.
+type SortCursor struct {
+	Values []*string
+	ID     int64
+}
+
+// VLVOption is the option for the virtual list view. It requires the sort keys.
+// The target is specified by the offset or the assertion value for the first sort key.
+// The repository sets TargetPosition and TotalCount as the result.
+type VLVOption struct {
+	BeforeCount    int64
+	AfterCount     int64
+	Offset         int64
+	ContentCount   int64
+	AssertionValue *string
+	TargetPosition int64
+	TotalCount     int64
 }
 
 type FetchedDNOrig struct {
@@ -112,8 +293,16 @@ type FetchedDNOrig struct {
 	DNOrig string `db:"dn_orig"`
 }
 
+// FetchedReferral is the referral entry. The ref values are LDAP URLs of the other servers.
+type FetchedReferral struct {
+	DN  *DN
+	Ref []string
+}
+
 type FetchedCredential struct {
 	ID int64
+	// DN of the entry. It's the dereferenced DN if the bind DN is an alias
+	DN *DN
 	// Credential
 	Credential []string
 	// DN of the MemberOf
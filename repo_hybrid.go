@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -16,6 +17,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
 	"github.com/openstandia/goldap/message"
 	"golang.org/x/xerrors"
 )
@@ -23,9 +25,9 @@ import (
 type HybridRepository struct {
 	*DBRepository
 	translator *HybridDBFilterTranslator
-}
 
-var (
+	// The statements are prepared on the DB connection of this repository since each naming context has own one
+
 	// repo_insert
 	insertContainerStmtWithUpdateLock *sqlx.NamedStmt
 	insertEntryStmt                   *sqlx.NamedStmt
@@ -47,7 +49,10 @@ var (
 	deleteContainerStmt          *sqlx.NamedStmt
 	deleteByIDStmt               *sqlx.NamedStmt
 	deleteAllAssociationByIDStmt *sqlx.NamedStmt
+	findGroupIDsByMemberIDsStmt  *sqlx.NamedStmt
+	updateModifiedByIDsStmt      *sqlx.NamedStmt
 	hasSubStmt                   *sqlx.NamedStmt
+	findSubtreeIDsWithUpdateLock *sqlx.NamedStmt
 
 	// repo_read for bind
 	findCredByDN *sqlx.NamedStmt
@@ -57,7 +62,30 @@ var (
 
 	// repo_read for ppolicy
 	findPPolicyByDN *sqlx.NamedStmt
-)
+
+	// repo_read for alias dereferencing
+	findAliasByDN *sqlx.NamedStmt
+
+	// repo_change_log for persistent search and content synchronization
+	lockChangeLogStmt      *sqlx.NamedStmt
+	recordEntryChangeStmt  *sqlx.NamedStmt
+	findContextCSNStmt     *sqlx.NamedStmt
+	findChangeSeqByCSNStmt *sqlx.NamedStmt
+	findEntryChangesStmt   *sqlx.NamedStmt
+	pruneEntryChangesStmt  *sqlx.NamedStmt
+}
+
+// The channel of LISTEN/NOTIFY for the entry changes
+const entryChangeChannel = "ldap_pg_entry_change"
+
+// entryChangeChannel returns the notification channel of the change log.
+// The channel is shared in the database, so the additional DB schema has own channel.
+func (r *HybridRepository) entryChangeChannel() string {
+	if r.schema == r.server.config.DBSchema {
+		return entryChangeChannel
+	}
+	return entryChangeChannel + "_" + r.schema
+}
 
 func (r *HybridRepository) Init() error {
 	var err error
@@ -103,16 +131,30 @@ func (r *HybridRepository) Init() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_ldap_association_id ON ldap_association(id, name);
 	CREATE INDEX IF NOT EXISTS idx_ldap_association_member_id ON ldap_association(member_id, name);
+
+	-- The change log for the content synchronization. The deleted entry remains as the tombstone.
+	CREATE TABLE IF NOT EXISTS ldap_change_log (
+		seq BIGSERIAL PRIMARY KEY,
+		csn VARCHAR(64) NOT NULL,
+		change_type SMALLINT NOT NULL,
+		entry_id BIGINT NOT NULL,
+		entry_uuid VARCHAR(36) NOT NULL,
+		dn_orig TEXT NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS uq_idx_ldap_change_log_csn ON ldap_change_log (csn);
+	CREATE INDEX IF NOT EXISTS idx_ldap_change_log_entry_id ON ldap_change_log (entry_id, seq);
 	`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	findCredByDN, err = db.PrepareNamed(`SELECT
+	r.findCredByDN, err = db.PrepareNamed(`SELECT
 		e.id,
 		e.attrs_orig->'userPassword' AS credential,
 		e.attrs_orig->'pwdAccountLockedTime' AS locked_time,
 		e.attrs_orig->'pwdFailureTime' AS failure_time,
+		e.attrs_orig->'aliasedObjectName' AS aliased,
 		memberOf.memberOf AS memberof,
 		dpp.attrs_orig AS default_ppolicy
 	FROM
@@ -137,7 +179,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateAfterBindSuccessByDN, err = db.PrepareNamed(`UPDATE ldap_entry SET
+	r.updateAfterBindSuccessByDN, err = db.PrepareNamed(`UPDATE ldap_entry SET
 	attrs_norm = attrs_norm - 'pwdAccountLockedTime' - 'pwdFailureTime' || jsonb_build_object('authTimestamp', :auth_timestamp_norm ::::jsonb),
 	attrs_orig = attrs_orig - 'pwdAccountLockedTime' - 'pwdFailureTime' || jsonb_build_object('authTimestamp', :auth_timestamp_orig ::::jsonb)
 	WHERE id = :id`)
@@ -145,7 +187,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateAfterBindFailureByDN, err = db.PrepareNamed(`UPDATE ldap_entry SET
+	r.updateAfterBindFailureByDN, err = db.PrepareNamed(`UPDATE ldap_entry SET
 	attrs_norm = attrs_norm || jsonb_build_object('pwdAccountLockedTime', :lock_time_norm ::::jsonb) || jsonb_build_object('pwdFailureTime', :failure_time_norm ::::jsonb),
 	attrs_orig = attrs_orig || jsonb_build_object('pwdAccountLockedTime', :lock_time_orig ::::jsonb) || jsonb_build_object('pwdFailureTime', :failure_time_orig ::::jsonb)
 	WHERE id = :id`)
@@ -153,7 +195,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	findPPolicyByDN, err = db.PrepareNamed(`SELECT
+	r.findPPolicyByDN, err = db.PrepareNamed(`SELECT
 		e.id,
 		e.attrs_orig AS ppolicy
 	FROM
@@ -167,7 +209,21 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	findEntryByDNWithUpdateLock, err = db.PrepareNamed(`SELECT
+	r.findAliasByDN, err = db.PrepareNamed(`SELECT
+		e.id,
+		e.attrs_orig->'aliasedObjectName' AS aliased
+	FROM
+		ldap_entry e
+		LEFT JOIN ldap_container c ON e.parent_id = c.id
+	WHERE
+		e.rdn_norm = :rdn_norm
+		AND c.dn_norm = :parent_dn_norm
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findEntryByDNWithUpdateLock, err = db.PrepareNamed(`SELECT
 		e.id, e.parent_id, e.rdn_orig, e.attrs_orig, has_sub.has_sub
 	FROM
 		ldap_entry e
@@ -184,7 +240,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	findEntryWithAssociationByDNWithUpdateLock, err = db.PrepareNamed(`SELECT
+	r.findEntryWithAssociationByDNWithUpdateLock, err = db.PrepareNamed(`SELECT
 		e.id, e.parent_id, e.rdn_orig, e.attrs_orig, has_sub.has_sub,
 		member.member AS member, uniqueMember.uniqueMember AS uniqueMember
 	FROM
@@ -225,14 +281,14 @@ func (r *HybridRepository) Init() error {
 		AND c.dn_norm = :parent_dn_norm
 	`
 
-	findEntryIDByDNWithShareLock, err = db.PrepareNamed(findEntryIDByDN + `
+	r.findEntryIDByDNWithShareLock, err = db.PrepareNamed(findEntryIDByDN + `
 	FOR SHARE
 	`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	insertContainerStmtWithUpdateLock, err = db.PrepareNamed(`INSERT INTO ldap_container (id, dn_norm, dn_orig)
+	r.insertContainerStmtWithUpdateLock, err = db.PrepareNamed(`INSERT INTO ldap_container (id, dn_norm, dn_orig)
 	VALUES (:id, :dn_norm, :dn_orig)
 	-- Lock the record without change if already exists
 	ON CONFLICT (id) DO NOTHING`)
@@ -240,7 +296,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	deleteContainerStmt, err = db.PrepareNamed(`DELETE FROM ldap_container WHERE id = :id
+	r.deleteContainerStmt, err = db.PrepareNamed(`DELETE FROM ldap_container WHERE id = :id
 	AND
 	NOT EXISTS (SELECT 1 FROM ldap_entry WHERE parent_id = :id)
 	RETURNING id`)
@@ -248,25 +304,40 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	deleteAllAssociationByIDStmt, err = db.PrepareNamed(`DELETE FROM ldap_association WHERE id = :id OR member_id = :id`)
+	r.deleteAllAssociationByIDStmt, err = db.PrepareNamed(`DELETE FROM ldap_association WHERE id = :id OR member_id = :id`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findGroupIDsByMemberIDsStmt, err = db.PrepareNamed(`SELECT DISTINCT id FROM ldap_association
+	WHERE member_id = ANY(:ids ::::BIGINT[]) AND NOT id = ANY(:ids ::::BIGINT[])
+	ORDER BY id`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.updateModifiedByIDsStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET
+	attrs_norm = attrs_norm || :attrs_norm ::::jsonb,
+	attrs_orig = attrs_orig || :attrs_orig ::::jsonb
+	WHERE id = ANY(:ids ::::BIGINT[])`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	insertEntryStmt, err = db.PrepareNamed(`INSERT INTO ldap_entry (parent_id, rdn_norm, rdn_orig, attrs_norm, attrs_orig)
+	r.insertEntryStmt, err = db.PrepareNamed(`INSERT INTO ldap_entry (parent_id, rdn_norm, rdn_orig, attrs_norm, attrs_orig)
 	VALUES (:parent_id, :rdn_norm, :rdn_orig, :attrs_norm, :attrs_orig)
 	RETURNING id`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateAttrsByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET attrs_norm = :attrs_norm, attrs_orig = :attrs_orig
+	r.updateAttrsByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET attrs_norm = :attrs_norm, attrs_orig = :attrs_orig
 		WHERE id = :id`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET
+	r.updateDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET
 		rdn_orig = :new_rdn_orig, rdn_norm = :new_rdn_norm,
 		attrs_norm = :attrs_norm, attrs_orig = :attrs_orig,
 		parent_id = :parent_id
@@ -275,7 +346,7 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateRDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET
+	r.updateRDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_entry SET
 		rdn_orig = :new_rdn_orig, rdn_norm = :new_rdn_norm,
 		attrs_norm = :attrs_norm, attrs_orig = :attrs_orig
 		WHERE id = :id`)
@@ -283,14 +354,14 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateContainerDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_container SET
+	r.updateContainerDNByIdStmt, err = db.PrepareNamed(`UPDATE ldap_container SET
 		dn_orig = :new_dn_orig, dn_norm = :new_dn_norm
 		WHERE id = :id`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	updateContainerDNsByIdStmt, err = db.PrepareNamed(`UPDATE ldap_container SET
+	r.updateContainerDNsByIdStmt, err = db.PrepareNamed(`UPDATE ldap_container SET
 		dn_orig = regexp_replace(dn_orig, :old_dn_orig_pattern, :new_dn_orig),
 		dn_norm = regexp_replace(dn_norm, :old_dn_norm_pattern, :new_dn_norm)
 		WHERE dn_norm ~ :old_dn_norm_pattern`)
@@ -298,13 +369,145 @@ func (r *HybridRepository) Init() error {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	deleteByIDStmt, err = db.PrepareNamed(`DELETE FROM ldap_entry 
+	r.deleteByIDStmt, err = db.PrepareNamed(`DELETE FROM ldap_entry 
 		WHERE id = :id RETURNING id`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
 
-	hasSubStmt, err = db.PrepareNamed(`SELECT EXISTS (SELECT 1 FROM ldap_entry WHERE parent_id = :id)`)
+	r.hasSubStmt, err = db.PrepareNamed(`SELECT EXISTS (SELECT 1 FROM ldap_entry WHERE parent_id = :id)`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findSubtreeIDsWithUpdateLock, err = db.PrepareNamed(`WITH RECURSIVE subtree (id) AS (
+		SELECT :id ::::BIGINT
+		UNION ALL
+		SELECT e.id FROM ldap_entry e, subtree s WHERE e.parent_id = s.id
+	)
+	SELECT
+		e.id
+	FROM
+		ldap_entry e, subtree s
+	WHERE
+		e.id = s.id
+	ORDER BY e.id
+	FOR UPDATE OF e
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	// The transaction-scoped advisory lock serializes the appends to the change log until the commit.
+	// Without it, the change with the smaller seq can be committed after the larger seq is returned as the contextCSN,
+	// then the consumer which has the cookie of the larger seq never receives the change.
+	r.lockChangeLogStmt, err = db.PrepareNamed(`SELECT pg_advisory_xact_lock(hashtext(:key))`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	// Record the changes with the CSN generated from the sequence, then notify them to the listeners.
+	// The CSN is formatted as OpenLDAP (timestamp#count#sid#mod) and the count is the lower 24 bits of the sequence.
+	// The payload of NOTIFY must be shorter than 8000 bytes, drop the attributes if exceeded.
+	r.recordEntryChangeStmt, err = db.PrepareNamed(`WITH
+	changed AS (
+		SELECT
+			c.*,
+			to_char(c.changed_at AT TIME ZONE 'UTC', 'YYYYMMDDHH24MISS.US') || 'Z#' || lpad(to_hex(c.seq % 16777216), 6, '0') || '#000#000000' AS csn
+		FROM (
+			SELECT
+				nextval(pg_get_serial_sequence('ldap_change_log', 'seq')) AS seq,
+				clock_timestamp() AS changed_at,
+				e.id AS entry_id,
+				e.attrs_orig->'entryUUID'->>0 AS entry_uuid,
+				e.rdn_orig || ',' || dnc.dn_orig AS dn_orig,
+				e.attrs_orig
+			FROM
+				ldap_entry e
+			LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+			WHERE
+				e.id = ANY(:ids ::::BIGINT[])
+			ORDER BY e.id
+		) c
+	),
+	logged AS (
+		INSERT INTO ldap_change_log (seq, csn, change_type, entry_id, entry_uuid, dn_orig, changed_at)
+		SELECT seq, csn, :type ::::SMALLINT, entry_id, entry_uuid, dn_orig, changed_at FROM changed
+	),
+	stamped AS (
+		UPDATE ldap_entry e SET
+			attrs_norm = jsonb_set(e.attrs_norm, '{entryCSN}', jsonb_build_array(c.csn)),
+			attrs_orig = jsonb_set(e.attrs_orig, '{entryCSN}', jsonb_build_array(c.csn))
+		FROM changed c
+		WHERE e.id = c.entry_id AND :type ::::INT <> 2
+	)
+	SELECT
+		pg_notify(:channel, CASE WHEN octet_length(n.payload::::TEXT) < 8000 THEN n.payload::::TEXT ELSE (n.payload - 'attrs')::::TEXT END)
+	FROM (
+		SELECT
+			jsonb_build_object(
+				'type', :type ::::INT,
+				'id', c.entry_id,
+				'seq', c.seq,
+				'csn', c.csn,
+				'uuid', c.entry_uuid,
+				'dn', c.dn_orig,
+				'previous_dn', :previous_dn ::::TEXT,
+				'attrs', CASE WHEN :with_attrs ::::BOOLEAN THEN c.attrs_orig END
+			) AS payload
+		FROM
+			changed c
+	) n
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findContextCSNStmt, err = db.PrepareNamed(`SELECT
+		seq, csn
+	FROM
+		ldap_change_log
+	ORDER BY seq DESC
+	LIMIT 1
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findChangeSeqByCSNStmt, err = db.PrepareNamed(`SELECT
+		seq
+	FROM
+		ldap_change_log
+	WHERE
+		csn = :csn
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.findEntryChangesStmt, err = db.PrepareNamed(`SELECT
+		*
+	FROM (
+		SELECT DISTINCT ON (entry_id)
+			seq, csn, change_type, entry_id, entry_uuid, dn_orig
+		FROM
+			ldap_change_log
+		WHERE
+			seq > :from_seq AND seq <= :to_seq
+		ORDER BY entry_id, seq DESC
+	) c
+	ORDER BY seq
+	`)
+	if err != nil {
+		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
+	}
+
+	r.pruneEntryChangesStmt, err = db.PrepareNamed(`DELETE FROM
+		ldap_change_log
+	WHERE
+		changed_at < :before
+		AND seq < (SELECT MAX(seq) FROM ldap_change_log)
+	`)
 	if err != nil {
 		return xerrors.Errorf("Failed to initialize prepared statement: %w", err)
 	}
@@ -339,11 +542,11 @@ func (r *HybridRepository) Insert(ctx context.Context, entry *AddEntry) (int64,
 	dbEntry, association, err := r.AddEntryToDBEntry(ctx, tx, entry)
 	if err != nil {
 		log.Printf("warn: Failed to prepare insert. dn_norm: %s, newID: %d, err: %v", entry.DN().DNNormStr(), newID, err)
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return 0, err
 	}
 
-	if entry.DN().Equal(r.server.Suffix) {
+	if entry.DN().Equal(r.suffix) {
 		// Insert level 0
 		newID, err = r.insertLevel0(tx, dbEntry)
 
@@ -354,7 +557,7 @@ func (r *HybridRepository) Insert(ctx context.Context, entry *AddEntry) (int64,
 
 	if err != nil {
 		log.Printf("warn: Failed to insert entry. dn_norm: %s, err: %v", entry.DN().DNNormStr(), err)
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return 0, err
 	}
 
@@ -363,11 +566,28 @@ func (r *HybridRepository) Insert(ctx context.Context, entry *AddEntry) (int64,
 
 	if err != nil {
 		log.Printf("warn: Failed to insert association. dn_norm: %s, newID: %d, err: %v", entry.DN().DNNormStr(), newID, err)
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return 0, err
 	}
 
-	if err := commit(tx); err != nil {
+	// Assertion control, the entry to be added is evaluated
+	if err := r.assertEntry(ctx, tx, entry.DN()); err != nil {
+		r.rollback(ctx, tx)
+		return 0, err
+	}
+
+	if err := r.recordEntryChange(tx, ChangeTypeAdd, []int64{newID}, ""); err != nil {
+		r.rollback(ctx, tx)
+		return 0, err
+	}
+
+	// Post-read control
+	if err := r.readEntry(ctx, tx, entry.DN(), true); err != nil {
+		r.rollback(ctx, tx)
+		return 0, err
+	}
+
+	if err := r.commit(ctx, tx); err != nil {
 		log.Printf("error: Failed to commit insert. dn_norm: %s, newID: %d, err: %v", entry.DN().DNNormStr(), newID, err)
 		return 0, err
 	}
@@ -381,7 +601,7 @@ func (r *HybridRepository) insertLevel0(tx *sqlx.Tx, dbEntry *HybridDBEntry) (in
 	var parentId int64 = 0
 
 	// Step 1: Insert parent container for level 0 entry
-	if _, err := r.exec(tx, insertContainerStmtWithUpdateLock, map[string]interface{}{
+	if _, err := r.exec(tx, r.insertContainerStmtWithUpdateLock, map[string]interface{}{
 		"id":      parentId,
 		"dn_norm": "",
 		"dn_orig": "",
@@ -391,7 +611,7 @@ func (r *HybridRepository) insertLevel0(tx *sqlx.Tx, dbEntry *HybridDBEntry) (in
 
 	// Step 2: Insert entry
 	var newID int64
-	err := r.get(tx, insertEntryStmt, &newID, map[string]interface{}{
+	err := r.get(tx, r.insertEntryStmt, &newID, map[string]interface{}{
 		"parent_id":  parentId,
 		"rdn_norm":   dbEntry.RDNNorm,
 		"rdn_orig":   dbEntry.RDNOrig,
@@ -422,9 +642,9 @@ func (r *HybridRepository) insertInternal(tx *sqlx.Tx, dbEntry *HybridDBEntry) (
 	// When inserting new entry, we need to lock the parent DN entry while the processing
 	// because there is a chance other thread deletes the parent DN entry or container before the inserting if no lock.
 	// From a performance standpoint, lock with share mode.
-	if err := r.get(tx, findEntryIDByDNWithShareLock, &dest, map[string]interface{}{
+	if err := r.get(tx, r.findEntryIDByDNWithShareLock, &dest, map[string]interface{}{
 		"rdn_norm":       parentDN.RDNNormStr(),
-		"parent_dn_norm": parentDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
+		"parent_dn_norm": parentDN.ParentDN().DNNormStrWithoutSuffix(r.base),
 	}); err != nil {
 		if isNoResult(err) {
 			log.Printf("warn: No Parent entry but try to insert the sub. dn_norm: %s,%s",
@@ -440,10 +660,10 @@ func (r *HybridRepository) insertInternal(tx *sqlx.Tx, dbEntry *HybridDBEntry) (
 	if !dest.HasSub {
 		// Not found parent container yet
 		// We need to insert new container first and lock it
-		if _, err := r.exec(tx, insertContainerStmtWithUpdateLock, map[string]interface{}{
+		if _, err := r.exec(tx, r.insertContainerStmtWithUpdateLock, map[string]interface{}{
 			"id":      parentId,
-			"dn_norm": parentDN.DNNormStrWithoutSuffix(r.server.Suffix),
-			"dn_orig": parentDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix),
+			"dn_norm": parentDN.DNNormStrWithoutSuffix(r.base),
+			"dn_orig": parentDN.DNOrigEncodedStrWithoutSuffix(r.base),
 		}); err != nil {
 			return 0, xerrors.Errorf("Failed to insert container record.dn_norm: %s,%s, err: %w",
 				dbEntry.RDNNorm, dbEntry.ParentDN.DNNormStr(), err)
@@ -452,7 +672,7 @@ func (r *HybridRepository) insertInternal(tx *sqlx.Tx, dbEntry *HybridDBEntry) (
 
 	// Step 2: Insert entry
 	var newID int64
-	if err := r.get(tx, insertEntryStmt, &newID, map[string]interface{}{
+	if err := r.get(tx, r.insertEntryStmt, &newID, map[string]interface{}{
 		"parent_id":  parentId,
 		"rdn_norm":   dbEntry.RDNNorm,
 		"rdn_orig":   dbEntry.RDNOrig,
@@ -517,45 +737,57 @@ func (r *HybridRepository) Update(ctx context.Context, dn *DN, callback func(cur
 	// Need to fetch all associations
 	oID, oParentID, _, oJSONMap, oHasSub, err := r.findByDNForUpdate(tx, dn, true)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	newEntry, err := NewModifyEntry(r.server.schemaMap, dn, oJSONMap)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return xerrors.Errorf("Failed to map to ModifyEntry. dn_norm: %s, err: %w", dn.DNNormStr(), err)
 	}
 	newEntry.dbEntryID = oID
 	newEntry.dbParentID = oParentID
 	newEntry.hasSub = oHasSub
 
+	// Assertion control
+	if err := r.assertEntry(ctx, tx, dn); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Pre-read control
+	if err := r.readEntry(ctx, tx, dn, false); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
 	// Apply modify operations from LDAP request
 	err = callback(newEntry)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	// Then, update database
 	if newEntry.dbEntryID == 0 {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return xerrors.Errorf("Invalid dbEntryId for update DBEntry. dn_norm: %s", dn.DNNormStr())
 	}
 
 	dbEntry, addAssociation, delAssociation, err := r.modifyEntryToDBEntry(ctx, tx, newEntry)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	// Step 2: Update entry
-	if _, err := r.exec(tx, updateAttrsByIdStmt, map[string]interface{}{
+	if _, err := r.exec(tx, r.updateAttrsByIdStmt, map[string]interface{}{
 		"id":         dbEntry.ID,
 		"attrs_norm": dbEntry.AttrsNorm,
 		"attrs_orig": dbEntry.AttrsOrig,
 	}); err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return xerrors.Errorf("Failed to update entry. entry: %v, err: %w", newEntry, err)
 	}
 
@@ -581,7 +813,7 @@ func (r *HybridRepository) Update(ctx context.Context, dn *DN, callback func(cur
 
 		result, err := r.execQuery(tx, q)
 		if err != nil {
-			rollback(tx)
+			r.rollback(ctx, tx)
 			if isDuplicateKeyError(err) {
 				log.Printf("warn: The association already exists. id: %d, dn_norm: %s, dn_orig: %s, err: %v",
 					dbEntry.ID, dn.DNNormStr(), dn.DNOrigStr(), err)
@@ -617,7 +849,7 @@ func (r *HybridRepository) Update(ctx context.Context, dn *DN, callback func(cur
 
 		result, err := r.execQuery(tx, q)
 		if err != nil {
-			rollback(tx)
+			r.rollback(ctx, tx)
 			return xerrors.Errorf("Failed to delete association record. id: %d, dn_norm: %s, dn_orig: %s, err: %w",
 				dbEntry.ID, dn.DNNormStr(), dn.DNOrigStr(), err)
 		}
@@ -626,7 +858,18 @@ func (r *HybridRepository) Update(ctx context.Context, dn *DN, callback func(cur
 		}
 	}
 
-	if err := commit(tx); err != nil {
+	if err := r.recordEntryChange(tx, ChangeTypeModify, []int64{dbEntry.ID}, ""); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Post-read control
+	if err := r.readEntry(ctx, tx, dn, true); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	if err := r.commit(ctx, tx); err != nil {
 		log.Printf("error: Failed to commit update. dn_norm: %s, err: %v", dn.DNNormStr(), err)
 		return err
 	}
@@ -639,7 +882,7 @@ func (r *HybridRepository) Update(ctx context.Context, dn *DN, callback func(cur
 func (r *HybridRepository) findByDNForUpdate(tx *sqlx.Tx, dn *DN, fetchAssociation bool) (int64, int64, string, map[string][]string, bool, error) {
 	params := map[string]interface{}{
 		"rdn_norm":       dn.RDNNormStr(),
-		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
+		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
 	}
 
 	dest := struct {
@@ -654,9 +897,9 @@ func (r *HybridRepository) findByDNForUpdate(tx *sqlx.Tx, dn *DN, fetchAssociati
 
 	var err error
 	if fetchAssociation {
-		err = r.get(tx, findEntryWithAssociationByDNWithUpdateLock, &dest, params)
+		err = r.get(tx, r.findEntryWithAssociationByDNWithUpdateLock, &dest, params)
 	} else {
-		err = r.get(tx, findEntryByDNWithUpdateLock, &dest, params)
+		err = r.get(tx, r.findEntryByDNWithUpdateLock, &dest, params)
 	}
 
 	if err != nil {
@@ -687,7 +930,7 @@ func (r *HybridRepository) findByDNForUpdate(tx *sqlx.Tx, dn *DN, fetchAssociati
 			log.Printf("erro: Unexpectd umarshal error: %s", err)
 		}
 		for i, v := range jsonArray {
-			jsonArray[i] = v + "," + r.server.SuffixOrigStr()
+			jsonArray[i] = resolveSuffix(r.base, v)
 		}
 		jsonMap["member"] = jsonArray
 	}
@@ -698,7 +941,7 @@ func (r *HybridRepository) findByDNForUpdate(tx *sqlx.Tx, dn *DN, fetchAssociati
 			log.Printf("erro: Unexpectd umarshal error: %s", err)
 		}
 		for i, v := range jsonArray {
-			jsonArray[i] = v + "," + r.server.SuffixOrigStr()
+			jsonArray[i] = resolveSuffix(r.base, v)
 		}
 		jsonMap["uniqueMember"] = jsonArray
 	}
@@ -708,8 +951,8 @@ func (r *HybridRepository) findByDNForUpdate(tx *sqlx.Tx, dn *DN, fetchAssociati
 	return dest.ID, dest.ParentID, dest.RDNOrig, jsonMap, dest.HasSub, nil
 }
 
-// oldRDN: set when keeping current entry
-func (r *HybridRepository) UpdateDN(ctx context.Context, oldDN, newDN *DN, oldRDN *RelativeDN) error {
+// deleteOldRDN: delete the values of the old RDN from the entry
+func (r *HybridRepository) UpdateDN(ctx context.Context, oldDN, newDN *DN, deleteOldRDN bool) error {
 	tx, err := r.begin(ctx)
 	if err != nil {
 		return err
@@ -718,33 +961,56 @@ func (r *HybridRepository) UpdateDN(ctx context.Context, oldDN, newDN *DN, oldRD
 	// Fetch current entry with update lock
 	oID, oParentID, _, attrsOrig, oHasSub, err := r.findByDNForUpdate(tx, oldDN, false)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	entry, err := NewModifyEntry(r.server.schemaMap, oldDN, attrsOrig)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 	entry.dbEntryID = oID
 	entry.dbParentID = oParentID
 	entry.hasSub = oHasSub
 
+	// Assertion control
+	if err := r.assertEntry(ctx, tx, oldDN); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Pre-read control
+	if err := r.readEntry(ctx, tx, oldDN, false); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
 	if !oldDN.ParentDN().Equal(newDN.ParentDN()) {
 		// Move or copy under the new parent case
-		err = r.updateDNUnderNewParent(ctx, tx, oldDN, newDN, oldRDN, entry)
+		err = r.updateDNUnderNewParent(ctx, tx, oldDN, newDN, deleteOldRDN, entry)
 	} else {
 		// Update rdn only case
-		err = r.updateRDN(ctx, tx, oldDN, newDN, oldRDN, entry)
+		err = r.updateRDN(ctx, tx, oldDN, newDN, deleteOldRDN, entry)
 	}
 
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
-	if err := commit(tx); err != nil {
+	if err := r.recordEntryChange(tx, ChangeTypeModDN, []int64{oID}, oldDN.DNOrigStr()); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Post-read control
+	if err := r.readEntry(ctx, tx, newDN, true); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	if err := r.commit(ctx, tx); err != nil {
 		log.Printf("error: Failed to commit update. id: %d, old_dn_norm: %s, new_dn_norm: %s, err: %v", oID, oldDN.DNNormStr(), newDN.DNNormStr(), err)
 		return err
 	}
@@ -754,15 +1020,15 @@ func (r *HybridRepository) UpdateDN(ctx context.Context, oldDN, newDN *DN, oldRD
 	return nil
 }
 
-func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.Tx, oldDN, newDN *DN, oldRDN *RelativeDN, oldEntry *ModifyEntry) error {
+func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.Tx, oldDN, newDN *DN, deleteOldRDN bool, oldEntry *ModifyEntry) error {
 	oldParentDN := oldDN.ParentDN()
 	newParentDN := newDN.ParentDN()
 
 	var oldParentID int64
 	var newParentID int64
 
-	// Determine old parent ID
-	if oldParentDN.IsRoot() {
+	// Determine old parent ID. Only the suffix entry is the root entry of the naming context
+	if oldDN.Equal(r.suffix) {
 		oldParentID = 0
 	} else {
 		oldParentID = oldEntry.dbParentID
@@ -770,7 +1036,7 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 	}
 
 	// Determine new parent ID
-	if newParentDN.IsRoot() {
+	if newDN.Equal(r.suffix) {
 		newParentID = 0
 		// Root entry doesn't need to insert container record always
 	} else {
@@ -781,9 +1047,9 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 		}{}
 
 		// Find the new parent entry and the container with share lock
-		if err := r.get(tx, findEntryIDByDNWithShareLock, &dest, map[string]interface{}{
+		if err := r.get(tx, r.findEntryIDByDNWithShareLock, &dest, map[string]interface{}{
 			"rdn_norm":       newParentDN.RDNNormStr(),
-			"parent_dn_norm": newParentDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
+			"parent_dn_norm": newParentDN.ParentDN().DNNormStrWithoutSuffix(r.base),
 		}); err != nil {
 			if isNoResult(err) {
 				return NewNoSuchObject()
@@ -794,10 +1060,10 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 
 		// If the new parent doesn't have any sub, we need to insert new container first and lock it
 		if !dest.HasSub {
-			if _, err := r.exec(tx, insertContainerStmtWithUpdateLock, map[string]interface{}{
+			if _, err := r.exec(tx, r.insertContainerStmtWithUpdateLock, map[string]interface{}{
 				"id":      newParentID,
-				"dn_norm": newParentDN.DNNormStrWithoutSuffix(r.server.Suffix),
-				"dn_orig": newParentDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix),
+				"dn_norm": newParentDN.DNNormStrWithoutSuffix(r.base),
+				"dn_orig": newParentDN.DNOrigEncodedStrWithoutSuffix(r.base),
 			}); err != nil {
 				return xerrors.Errorf("Unexpected insert container error. id: %d, dn_norm: %s, err: %w",
 					newParentID, oldParentDN.DNNormStr(), err)
@@ -805,16 +1071,9 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 		}
 	}
 
-	newEntry := oldEntry.ModifyRDN(newDN)
-
-	// To remain old RDN, add the attribute as not a RDN value
-	if oldRDN != nil {
-		for _, attr := range oldRDN.Attributes {
-			if err := newEntry.Add(attr.TypeOrig, []string{attr.ValueOrig}); err != nil {
-				log.Printf("warn: Failed to remain old RDN, err: %s", err)
-				return err
-			}
-		}
+	newEntry, err := oldEntry.ModifyRDN(newDN, deleteOldRDN)
+	if err != nil {
+		return err
 	}
 
 	// ModifyDN doesn't affect the member, ignore it
@@ -824,7 +1083,7 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 	}
 
 	// Update RDN
-	if _, err := r.exec(tx, updateDNByIdStmt, map[string]interface{}{
+	if _, err := r.exec(tx, r.updateDNByIdStmt, map[string]interface{}{
 		"id":           oldEntry.dbEntryID,
 		"parent_id":    newParentID,
 		"new_rdn_norm": newDN.RDNNormStr(),
@@ -838,19 +1097,19 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 	// Modify DN orig of container record if the entry has sub.
 	// Don't update if the entry is root which has suffix as the RDN.
 	if oldEntry.hasSub && oldEntry.dbParentID != 0 {
-		if _, err = r.exec(tx, updateContainerDNByIdStmt, map[string]interface{}{
+		if _, err = r.exec(tx, r.updateContainerDNByIdStmt, map[string]interface{}{
 			"id":          oldEntry.dbEntryID,
-			"new_dn_norm": newDN.DNNormStrWithoutSuffix(r.server.Suffix),
-			"new_dn_orig": newDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix),
+			"new_dn_norm": newDN.DNNormStrWithoutSuffix(r.base),
+			"new_dn_orig": newDN.DNOrigEncodedStrWithoutSuffix(r.base),
 		}); err != nil {
 			return xerrors.Errorf("Failed to update container DN. oldDN: %s, newDN: %s, err: %w", oldDN.DNNormStr(), newDN.DNNormStr(), err)
 		}
 
-		if _, err = r.exec(tx, updateContainerDNsByIdStmt, map[string]interface{}{
-			"new_dn_norm":         "\\1" + newDN.DNNormStrWithoutSuffix(r.server.Suffix),
-			"new_dn_orig":         "\\1" + newDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix),
-			"old_dn_norm_pattern": "(.*,)" + escapeRegex(oldDN.DNNormStrWithoutSuffix(r.server.Suffix)) + "$",
-			"old_dn_orig_pattern": "(.*,)" + escapeRegex(oldDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)) + "$",
+		if _, err = r.exec(tx, r.updateContainerDNsByIdStmt, map[string]interface{}{
+			"new_dn_norm":         "\\1" + newDN.DNNormStrWithoutSuffix(r.base),
+			"new_dn_orig":         "\\1" + newDN.DNOrigEncodedStrWithoutSuffix(r.base),
+			"old_dn_norm_pattern": "(.*,)" + escapeRegex(oldDN.DNNormStrWithoutSuffix(r.base)) + "$",
+			"old_dn_orig_pattern": "(.*,)" + escapeRegex(oldDN.DNOrigEncodedStrWithoutSuffix(r.base)) + "$",
 		}); err != nil {
 			return xerrors.Errorf("Failed to update sub containers DN. oldDN: %s, newDN: %s, err: %w", oldDN.DNNormStr(), newDN.DNNormStr(), err)
 		}
@@ -875,16 +1134,11 @@ func (r *HybridRepository) updateDNUnderNewParent(ctx context.Context, tx *sqlx.
 	return nil
 }
 
-func (r *HybridRepository) updateRDN(ctx context.Context, tx *sqlx.Tx, oldDN, newDN *DN, oldRDN *RelativeDN, oldEntry *ModifyEntry) error {
+func (r *HybridRepository) updateRDN(ctx context.Context, tx *sqlx.Tx, oldDN, newDN *DN, deleteOldRDN bool, oldEntry *ModifyEntry) error {
 	// Update the entry even if it's same RDN to update modifyTimestamp
-	newEntry := oldEntry.ModifyRDN(newDN)
-
-	if oldRDN != nil {
-		for _, attr := range oldRDN.Attributes {
-			if err := newEntry.Add(attr.TypeOrig, []string{attr.ValueOrig}); err != nil {
-				log.Printf("info: Schema error but ignore it. err: %s", err)
-			}
-		}
+	newEntry, err := oldEntry.ModifyRDN(newDN, deleteOldRDN)
+	if err != nil {
+		return err
 	}
 
 	log.Printf("Update RDN. newDN: %s, hasSub: %v", newDN.DNOrigStr(), oldEntry.hasSub)
@@ -895,7 +1149,7 @@ func (r *HybridRepository) updateRDN(ctx context.Context, tx *sqlx.Tx, oldDN, ne
 		return err
 	}
 
-	if _, err := r.exec(tx, updateRDNByIdStmt, map[string]interface{}{
+	if _, err := r.exec(tx, r.updateRDNByIdStmt, map[string]interface{}{
 		"id":           oldEntry.dbEntryID,
 		"new_rdn_norm": newDN.RDNNormStr(),
 		"new_rdn_orig": newDN.RDNOrigEncodedStr(),
@@ -908,7 +1162,7 @@ func (r *HybridRepository) updateRDN(ctx context.Context, tx *sqlx.Tx, oldDN, ne
 	// Modify DN orig of container record if the entry has sub.
 	// Don't update if the entry is root which has suffix as the RDN.
 	if oldEntry.hasSub && oldEntry.dbParentID != 0 {
-		if _, err = r.exec(tx, updateContainerDNByIdStmt, map[string]interface{}{
+		if _, err = r.exec(tx, r.updateContainerDNByIdStmt, map[string]interface{}{
 			"id":          oldEntry.dbEntryID,
 			"new_dn_norm": newDN.RDNNormStr(),
 			"new_dn_orig": newDN.RDNOrigEncodedStr(),
@@ -916,11 +1170,11 @@ func (r *HybridRepository) updateRDN(ctx context.Context, tx *sqlx.Tx, oldDN, ne
 			return xerrors.Errorf("Failed to update container DN. oldDN: %s, newDN: %s, err: %w", oldDN.DNNormStr(), newDN.DNNormStr(), err)
 		}
 
-		if _, err = r.exec(tx, updateContainerDNByIdStmt, map[string]interface{}{
+		if _, err = r.exec(tx, r.updateContainerDNByIdStmt, map[string]interface{}{
 			"new_dn_norm":         "\\1" + newDN.RDNNormStr(),
 			"new_dn_orig":         "\\1" + newDN.RDNOrigEncodedStr(),
-			"old_dn_norm_pattern": "(.*,)" + escapeRegex(oldDN.DNNormStrWithoutSuffix(r.server.Suffix)) + "$",
-			"old_dn_orig_pattern": "(.*,)" + escapeRegex(oldDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)) + "$",
+			"old_dn_norm_pattern": "(.*,)" + escapeRegex(oldDN.DNNormStrWithoutSuffix(r.base)) + "$",
+			"old_dn_orig_pattern": "(.*,)" + escapeRegex(oldDN.DNOrigEncodedStrWithoutSuffix(r.base)) + "$",
 		}); err != nil {
 			return xerrors.Errorf("Failed to update sub containers DN. oldDN: %s, newDN: %s, err: %w", oldDN.DNNormStr(), newDN.DNNormStr(), err)
 		}
@@ -946,12 +1200,12 @@ func (r HybridRepository) DeleteByDN(ctx context.Context, dn *DN) error {
 		HasSub   bool  `db:"has_sub"`
 	}{}
 
-	err = r.get(tx, findEntryIDByDNWithShareLock, &fetchedEntry, map[string]interface{}{
+	err = r.get(tx, r.findEntryIDByDNWithShareLock, &fetchedEntry, map[string]interface{}{
 		"rdn_norm":       dn.RDNNormStr(),
-		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
+		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
 	})
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 
 		if isNoResult(err) {
 			return NewNoSuchObject()
@@ -961,42 +1215,65 @@ func (r HybridRepository) DeleteByDN(ctx context.Context, dn *DN) error {
 
 	// Not allowed error if the entry has children yet
 	if fetchedEntry.HasSub {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return NewNotAllowedOnNonLeaf()
 	}
 
+	// Assertion control
+	if err := r.assertEntry(ctx, tx, dn); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Pre-read control
+	if err := r.readEntry(ctx, tx, dn, false); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// The deleted entry is notified with the attributes before the deletion
+	if err := r.recordEntryChange(tx, ChangeTypeDelete, []int64{fetchedEntry.ID}, ""); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
 	// Step 2: Remove all association
+	if err := r.modifyGroupsOfMembers(ctx, tx, []int64{fetchedEntry.ID}); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
 	err = r.removeAssociationById(tx, fetchedEntry.ID)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	// Step 3: Delete entry
 	_, err = r.deleteByID(tx, fetchedEntry.ID)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	// Step 4: Delete container if the parent doesn't have children
 	hasSub, err := r.hasSub(tx, fetchedEntry.ParentID)
 	if err != nil {
-		rollback(tx)
+		r.rollback(ctx, tx)
 		return err
 	}
 
 	if !hasSub {
 		if err := r.deleteContainerByID(tx, fetchedEntry.ParentID); err != nil {
 			if !isNoResult(err) {
-				rollback(tx)
+				r.rollback(ctx, tx)
 				return err
 			}
 			// Other threads inserted sub. Ignore the error.
 		}
 	}
 
-	if err := commit(tx); err != nil {
+	if err := r.commit(ctx, tx); err != nil {
 		log.Printf("error: Failed to commit deletion. dn_norm: %s, err: %v", dn.DNNormStr(), err)
 		return err
 	}
@@ -1006,86 +1283,538 @@ func (r HybridRepository) DeleteByDN(ctx context.Context, dn *DN) error {
 	return nil
 }
 
-func (r *HybridRepository) hasSub(tx *sqlx.Tx, id int64) (bool, error) {
-	var hasSub bool
-	if err := r.get(tx, hasSubStmt, &hasSub, map[string]interface{}{
-		"id": id,
-	}); err != nil {
-		return false, xerrors.Errorf("Failed to check existence. id: %d, err: %w", id, err)
+func (r HybridRepository) DeleteTreeByDN(ctx context.Context, dn *DN) error {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
 	}
 
-	return hasSub, nil
-}
+	// Step 1: fetch the target entry
+	fetchedEntry := struct {
+		ID       int64 `db:"id"`
+		ParentID int64 `db:"parent_id"`
+		HasSub   bool  `db:"has_sub"`
+	}{}
 
-func (r *HybridRepository) deleteByID(tx *sqlx.Tx, id int64) (int64, error) {
-	var delID int64 = -1
+	err = r.get(tx, r.findEntryIDByDNWithShareLock, &fetchedEntry, map[string]interface{}{
+		"rdn_norm":       dn.RDNNormStr(),
+		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
+	})
+	if err != nil {
+		r.rollback(ctx, tx)
 
-	if err := r.get(tx, deleteByIDStmt, &delID, map[string]interface{}{
-		"id": id,
-	}); err != nil {
 		if isNoResult(err) {
-			return 0, NewNoSuchObject()
+			return NewNoSuchObject()
 		}
-		return 0, xerrors.Errorf("Failed to exec deleteByID query. query: %s, params: %v, err: %w",
-			deleteByIDStmt.QueryString, deleteByIDStmt.Params, err)
+		return xerrors.Errorf("Unexpected query error. dn_norm: %v, err: %w", dn.DNNormStr(), err)
 	}
 
-	// TODO need?
-	if delID == -1 {
-		return 0, NewNoSuchObject()
+	// Assertion control
+	if err := r.assertEntry(ctx, tx, dn); err != nil {
+		r.rollback(ctx, tx)
+		return err
 	}
 
-	return delID, nil
-}
+	// Pre-read control
+	if err := r.readEntry(ctx, tx, dn, false); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
 
-// deleteContainerByID deletes the container record if the container doesn't have any sub entries.
-func (r *HybridRepository) deleteContainerByID(tx *sqlx.Tx, id int64) error {
-	result, err := r.exec(tx, deleteContainerStmt, map[string]interface{}{
-		"id": id,
-	})
-	if err != nil {
-		if isNoResult(err) {
-			log.Printf("warn: the container already deleted. id: %d", id)
-			return err
+	// Step 2: fetch all entries of the subtree with lock for update.
+	// Other threads can't insert new sub entries while the deletion because they lock the parent entry with share mode.
+	var ids []int64
+	if err := r.selectAll(tx, r.findSubtreeIDsWithUpdateLock, &ids, map[string]interface{}{
+		"id": fetchedEntry.ID,
+	}); err != nil {
+		r.rollback(ctx, tx)
+		if isDeadlockError(err) {
+			return NewRetryError(err)
 		}
-		return xerrors.Errorf("Failed to delete container. id: %d, err: %w", id, err)
+		return xerrors.Errorf("Failed to fetch subtree. dn_norm: %s, err: %w", dn.DNNormStr(), err)
 	}
-	if num, err := result.RowsAffected(); err == nil {
-		log.Printf("info: Deleted container. id: %d, num: %d", id, num)
+
+	if limit := r.server.config.MaxTreeDeleteSize; limit > 0 && len(ids) > limit {
+		r.rollback(ctx, tx)
+		log.Printf("warn: Exceeded the max subtree size for deletion. dn_norm: %s, size: %d, limit: %d", dn.DNNormStr(), len(ids), limit)
+		return NewAdminLimitExceeded("subtree size exceeded the limit")
 	}
 
-	return nil
-}
+	idList := make([]string, len(ids))
+	for i, id := range ids {
+		idList[i] = strconv.FormatInt(id, 10)
+	}
+	in := strings.Join(idList, ",")
 
-func (r *HybridRepository) removeAssociationById(tx *sqlx.Tx, id int64) error {
-	result, err := r.exec(tx, deleteAllAssociationByIDStmt, map[string]interface{}{
-		"id": id,
-	})
+	if err := r.recordEntryChange(tx, ChangeTypeDelete, ids, ""); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	// Step 3: Remove all association from/to the subtree
+	if err := r.modifyGroupsOfMembers(ctx, tx, ids); err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	result, err := r.execQuery(tx, fmt.Sprintf(`DELETE FROM ldap_association WHERE id IN (%s) OR member_id IN (%s)`, in, in))
 	if err != nil {
-		return xerrors.Errorf("Failed to delete association. query: %s, id: %d, err: %w",
-			deleteAllAssociationByIDStmt.QueryString, id, err)
+		r.rollback(ctx, tx)
+		return xerrors.Errorf("Failed to delete association of the subtree. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+	if num, err := result.RowsAffected(); err == nil {
+		log.Printf("Deleted association of the subtree. dn_norm: %s, num: %d", dn.DNNormStr(), num)
 	}
 
+	// Step 4: Delete entries then containers of the subtree
+	result, err = r.execQuery(tx, fmt.Sprintf(`DELETE FROM ldap_entry WHERE id IN (%s)`, in))
+	if err != nil {
+		r.rollback(ctx, tx)
+		return xerrors.Errorf("Failed to delete entries of the subtree. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
 	if num, err := result.RowsAffected(); err == nil {
-		log.Printf("Deleted all association. id: %d, num: %d", id, num)
+		log.Printf("Deleted entries of the subtree. dn_norm: %s, num: %d", dn.DNNormStr(), num)
+	}
+
+	if _, err := r.execQuery(tx, fmt.Sprintf(`DELETE FROM ldap_container WHERE id IN (%s)`, in)); err != nil {
+		r.rollback(ctx, tx)
+		return xerrors.Errorf("Failed to delete containers of the subtree. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+
+	// Step 5: Delete container if the parent doesn't have children
+	hasSub, err := r.hasSub(tx, fetchedEntry.ParentID)
+	if err != nil {
+		r.rollback(ctx, tx)
+		return err
+	}
+
+	if !hasSub {
+		if err := r.deleteContainerByID(tx, fetchedEntry.ParentID); err != nil {
+			if !isNoResult(err) {
+				r.rollback(ctx, tx)
+				return err
+			}
+			// Other threads inserted sub. Ignore the error.
+		}
+	}
+
+	if err := r.commit(ctx, tx); err != nil {
+		log.Printf("error: Failed to commit subtree deletion. dn_norm: %s, err: %v", dn.DNNormStr(), err)
+		return err
 	}
 
+	log.Printf("info: Deleted subtree. id: %d, dn_norm: %s, size: %d", fetchedEntry.ID, dn.DNNormStr(), len(ids))
+
 	return nil
 }
 
-//////////////////////////////////////////
-// SEARCH operation
-//////////////////////////////////////////
+// modifyGroupsOfMembers updates modifyTimestamp and modifiersName of the groups which have the deleted members,
+// and records their modification to the change log since their member values are removed with the association.
+// The groups in the deleted members are excluded since they are also deleted.
+func (r *HybridRepository) modifyGroupsOfMembers(ctx context.Context, tx *sqlx.Tx, memberIDs []int64) error {
+	var groupIDs []int64
+	if err := r.selectAll(tx, r.findGroupIDsByMemberIDsStmt, &groupIDs, map[string]interface{}{
+		"ids": pq.Array(memberIDs),
+	}); err != nil {
+		return xerrors.Errorf("Failed to find groups of the members. ids: %v, err: %w", memberIDs, err)
+	}
+	if len(groupIDs) == 0 {
+		return nil
+	}
 
-type HybridFetchedDBEntry struct {
-	ID              int64          `db:"id"`
-	ParentID        int64          `db:"parent_id"`
+	updated := time.Now()
+	norm := map[string]interface{}{
+		"modifyTimestamp": []interface{}{updated.Unix()},
+	}
+	orig := map[string]interface{}{
+		"modifyTimestamp": []string{updated.In(time.UTC).Format(TIMESTAMP_FORMAT)},
+	}
+	if session, err := AuthSessionContext(ctx); err == nil {
+		norm["modifiersName"] = []interface{}{session.DN.DNOrigEncodedStrWithoutSuffix(r.base)}
+		orig["modifiersName"] = []string{session.DN.DNNormStrWithoutSuffix(r.base)}
+	}
+
+	bNorm, _ := json.Marshal(norm)
+	bOrig, _ := json.Marshal(orig)
+
+	if _, err := r.exec(tx, r.updateModifiedByIDsStmt, map[string]interface{}{
+		"attrs_norm": types.JSONText(string(bNorm)),
+		"attrs_orig": types.JSONText(string(bOrig)),
+		"ids":        pq.Array(groupIDs),
+	}); err != nil {
+		return xerrors.Errorf("Failed to update groups of the members. ids: %v, err: %w", groupIDs, err)
+	}
+
+	return r.recordEntryChange(tx, ChangeTypeModify, groupIDs, "")
+}
+
+// recordEntryChange records the change of the entries to the change log with the new CSN.
+// Also, it notifies the change to the listeners when the transaction is committed.
+func (r *HybridRepository) recordEntryChange(tx *sqlx.Tx, changeType int, ids []int64, previousDN string) error {
+	// The seq must be taken after the lock, so the seq order is same as the commit order
+	if _, err := r.exec(tx, r.lockChangeLogStmt, map[string]interface{}{
+		"key": "ldap_change_log." + r.schema,
+	}); err != nil {
+		return xerrors.Errorf("Failed to lock change log. err: %w", err)
+	}
+
+	if _, err := r.exec(tx, r.recordEntryChangeStmt, map[string]interface{}{
+		"channel":     r.entryChangeChannel(),
+		"type":        changeType,
+		"previous_dn": previousDN,
+		"with_attrs":  changeType == ChangeTypeDelete,
+		"ids":         pq.Array(ids),
+	}); err != nil {
+		return xerrors.Errorf("Failed to record entry change. type: %d, ids: %v, err: %w", changeType, ids, err)
+	}
+	return nil
+}
+
+func (r *HybridRepository) ListenEntryChanges(ctx context.Context, handler func(change *EntryChange)) error {
+	listener := pq.NewListener(dataSourceName(r.server.config, r.schema), 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("warn: Entry change listener error. event: %d, err: %v", ev, err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(r.entryChangeChannel()); err != nil {
+		return xerrors.Errorf("Failed to listen entry changes. err: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case n := <-listener.Notify:
+			// Reconnected, the changes while disconnected are lost
+			if n == nil {
+				log.Printf("warn: Reconnected entry change listener. Some changes may be lost")
+				continue
+			}
+
+			var change EntryChange
+			if err := json.Unmarshal([]byte(n.Extra), &change); err != nil {
+				log.Printf("error: Invalid entry change payload. payload: %s, err: %v", n.Extra, err)
+				continue
+			}
+			if !r.isInNamingContext(&change) {
+				continue
+			}
+			if change.AttrsOrig != nil {
+				r.resolveDNSuffix(change.AttrsOrig, "creatorsName")
+				r.resolveDNSuffix(change.AttrsOrig, "modifiersName")
+			}
+			change.Suffix = r.suffix
+			change.Base = r.base
+
+			handler(&change)
+
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+func (r *HybridRepository) FindContextCSN(ctx context.Context, baseDN *DN) (*ContextCSN, error) {
+	tx, err := r.beginReadonly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	var dest ContextCSN
+	if err := r.get(tx, r.findContextCSNStmt, &dest, map[string]interface{}{}); err != nil {
+		if isNoResult(err) {
+			// No change yet
+			return &ContextCSN{}, nil
+		}
+		return nil, xerrors.Errorf("Failed to find context CSN. err: %w", err)
+	}
+
+	return &dest, nil
+}
+
+func (r *HybridRepository) FindEntryChanges(ctx context.Context, baseDN *DN, fromCSN string, to *ContextCSN) ([]*EntryChange, bool, error) {
+	tx, err := r.beginReadonly(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rollback(tx)
+
+	var fromSeq int64
+	if fromCSN != "" {
+		if err := r.get(tx, r.findChangeSeqByCSNStmt, &fromSeq, map[string]interface{}{
+			"csn": fromCSN,
+		}); err != nil {
+			if isNoResult(err) {
+				return nil, false, nil
+			}
+			return nil, false, xerrors.Errorf("Failed to find change by CSN. csn: %s, err: %w", fromCSN, err)
+		}
+	}
+
+	var changes []*EntryChange
+	if err := r.selectAll(tx, r.findEntryChangesStmt, &changes, map[string]interface{}{
+		"from_seq": fromSeq,
+		"to_seq":   to.Seq,
+	}); err != nil {
+		return nil, false, xerrors.Errorf("Failed to find entry changes. from_seq: %d, to_seq: %d, err: %w", fromSeq, to.Seq, err)
+	}
+	filtered := changes[:0]
+	for _, change := range changes {
+		if !r.isInNamingContext(change) {
+			continue
+		}
+		change.Suffix = r.suffix
+		change.Base = r.base
+		filtered = append(filtered, change)
+	}
+
+	return filtered, true, nil
+}
+
+// isInNamingContext returns true if the change is in the naming context of the repository.
+// The naming contexts sharing the DB schema share the change log too, so the change is filtered by the DN.
+func (r *HybridRepository) isInNamingContext(change *EntryChange) bool {
+	if r.base.Equal(r.suffix) {
+		return true
+	}
+	dn, err := r.server.NormalizeDN(resolveSuffix(r.base, change.DNOrig))
+	if err != nil {
+		log.Printf("warn: Invalid DN of the entry change. dn: %s, err: %v", change.DNOrig, err)
+		return false
+	}
+	return dn.Equal(r.suffix) || dn.IsSubOf(r.suffix)
+}
+
+func (r *HybridRepository) PruneEntryChanges(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.exec(tx, r.pruneEntryChangesStmt, map[string]interface{}{
+		"before": before,
+	})
+	if err != nil {
+		rollback(tx)
+		return 0, xerrors.Errorf("Failed to prune entry changes. before: %v, err: %w", before, err)
+	}
+
+	if err := commit(tx); err != nil {
+		return 0, err
+	}
+
+	count, _ := result.RowsAffected()
+	return count, nil
+}
+
+func (r *HybridRepository) hasSub(tx *sqlx.Tx, id int64) (bool, error) {
+	var hasSub bool
+	if err := r.get(tx, r.hasSubStmt, &hasSub, map[string]interface{}{
+		"id": id,
+	}); err != nil {
+		return false, xerrors.Errorf("Failed to check existence. id: %d, err: %w", id, err)
+	}
+
+	return hasSub, nil
+}
+
+func (r *HybridRepository) deleteByID(tx *sqlx.Tx, id int64) (int64, error) {
+	var delID int64 = -1
+
+	if err := r.get(tx, r.deleteByIDStmt, &delID, map[string]interface{}{
+		"id": id,
+	}); err != nil {
+		if isNoResult(err) {
+			return 0, NewNoSuchObject()
+		}
+		return 0, xerrors.Errorf("Failed to exec deleteByID query. query: %s, params: %v, err: %w",
+			r.deleteByIDStmt.QueryString, r.deleteByIDStmt.Params, err)
+	}
+
+	// TODO need?
+	if delID == -1 {
+		return 0, NewNoSuchObject()
+	}
+
+	return delID, nil
+}
+
+// deleteContainerByID deletes the container record if the container doesn't have any sub entries.
+func (r *HybridRepository) deleteContainerByID(tx *sqlx.Tx, id int64) error {
+	result, err := r.exec(tx, r.deleteContainerStmt, map[string]interface{}{
+		"id": id,
+	})
+	if err != nil {
+		if isNoResult(err) {
+			log.Printf("warn: the container already deleted. id: %d", id)
+			return err
+		}
+		return xerrors.Errorf("Failed to delete container. id: %d, err: %w", id, err)
+	}
+	if num, err := result.RowsAffected(); err == nil {
+		log.Printf("info: Deleted container. id: %d, num: %d", id, num)
+	}
+
+	return nil
+}
+
+func (r *HybridRepository) removeAssociationById(tx *sqlx.Tx, id int64) error {
+	result, err := r.exec(tx, r.deleteAllAssociationByIDStmt, map[string]interface{}{
+		"id": id,
+	})
+	if err != nil {
+		return xerrors.Errorf("Failed to delete association. query: %s, id: %d, err: %w",
+			r.deleteAllAssociationByIDStmt.QueryString, id, err)
+	}
+
+	if num, err := result.RowsAffected(); err == nil {
+		log.Printf("Deleted all association. id: %d, num: %d", id, num)
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////
+// LDAP transaction
+//////////////////////////////////////////
+
+// txContextKey is the key of the joined transaction for each repository
+// since the naming contexts have own DB connections.
+type txContextKey struct {
+	repo *HybridRepository
+}
+
+func (r *HybridRepository) Transaction(ctx context.Context, dn *DN, callback func(ctx context.Context) error) error {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := callback(context.WithValue(ctx, txContextKey{r}, tx)); err != nil {
+		rollback(tx)
+		return err
+	}
+
+	if err := commit(tx); err != nil {
+		log.Printf("error: Failed to commit transaction. err: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+//////////////////////////////////////////
+// COMPARE operation
+//////////////////////////////////////////
+
+func (r *HybridRepository) Compare(ctx context.Context, dn *DN, value *SchemaValue) (bool, error) {
+	tx, err := r.beginReadonly(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer rollback(tx)
+
+	if r.server.config.DerefAliasBindCompare {
+		dn, err = r.derefAlias(tx, dn, false)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.assertEntry(ctx, tx, dn); err != nil {
+		return false, err
+	}
+
+	var jsb, wsb, psb strings.Builder
+	params := map[string]interface{}{
+		"rdn_norm":       dn.RDNNormStr(),
+		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
+	}
+
+	// Reuse the equality and presence filter translation.
+	// The association attributes are matched with ldap_association table.
+	result := &HybridDBFilterTranslatorResult{
+		join:   &jsb,
+		where:  &wsb,
+		params: params,
+	}
+	r.translator.EqualityMatch(value.schema.Subtype(value.options), result, value.Orig()[0], false)
+	if wsb.Len() == 0 {
+		writeFalse(&wsb)
+	}
+
+	present := &HybridDBFilterTranslatorResult{
+		join:   &jsb,
+		where:  &psb,
+		params: params,
+	}
+	r.translator.PresentMatch(value.schema.Subtype(value.options), present, false)
+
+	q := fmt.Sprintf(`SELECT
+		e.id,
+		COALESCE((%s), FALSE) AS matched,
+		COALESCE((%s), FALSE) AS present
+	FROM
+		ldap_entry e
+		LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+		%s
+	WHERE
+		e.rdn_norm = :rdn_norm
+		AND dnc.dn_norm = :parent_dn_norm
+	`, wsb.String(), psb.String(), jsb.String())
+
+	rows, err := r.namedQuery(tx, q, params)
+	if err != nil {
+		return false, xerrors.Errorf("Unexpected compare query error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+	defer rows.Close()
+
+	fetched := struct {
+		ID      int64 `db:"id"`
+		Matched bool  `db:"matched"`
+		Present bool  `db:"present"`
+	}{}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return false, xerrors.Errorf("Unexpected compare query error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+		}
+		return false, NewNoSuchObject()
+	}
+
+	if err := rows.StructScan(&fetched); err != nil {
+		return false, xerrors.Errorf("Unexpected struct scan error. err: %w", err)
+	}
+
+	// The absent attribute is an error, not compareFalse (RFC 4511 4.10)
+	if !fetched.Present {
+		return false, NewNoSuchAttribute("compare", value.Name())
+	}
+
+	log.Printf("info: Compared. id: %d, dn_norm: %s, attr: %s, matched: %v", fetched.ID, dn.DNNormStr(), value.Name(), fetched.Matched)
+
+	return fetched.Matched, nil
+}
+
+//////////////////////////////////////////
+// SEARCH operation
+//////////////////////////////////////////
+
+type HybridFetchedDBEntry struct {
+	ID              int64          `db:"id"`
+	ParentID        int64          `db:"parent_id"`
 	RDNOrig         string         `db:"rdn_orig"`
 	RawAttrsOrig    types.JSONText `db:"attrs_orig"`
 	RawMember       types.JSONText `db:"member"`       // No real column in the table
 	RawUniqueMember types.JSONText `db:"uniquemember"` // No real column in the table
 	RawMemberOf     types.JSONText `db:"memberof"`     // No real column in the table
 	HasSubordinates *bool          `db:"has_sub"`      // No real column in the table
+	ContextCSN      *string        `db:"context_csn"`  // No real column in the table
+	SortValues      types.JSONText `db:"sort_values"`  // No real column in the table
 	DNOrig          string         `db:"dn_orig"`      // No real column in the table
 	Count           int32          `db:"count"`        // No real column in the table
 }
@@ -1100,6 +1829,8 @@ func (e *HybridFetchedDBEntry) Clear() {
 	e.RawMember = nil
 	e.RawUniqueMember = nil
 	e.HasSubordinates = nil
+	e.ContextCSN = nil
+	e.SortValues = nil
 	e.Count = 0
 }
 
@@ -1120,31 +1851,265 @@ func (e *HybridFetchedDBEntry) AttrsOrig() map[string][]string {
 		jsonMap["member"] = jsonArray
 	}
 
-	if len(e.RawUniqueMember) > 0 {
-		jsonArray := []string{}
-		if err := e.RawUniqueMember.Unmarshal(&jsonArray); err != nil {
-			log.Printf("erro: Unexpectd umarshal error: %s", err)
-		}
-		jsonMap["uniqueMember"] = jsonArray
-	}
+	if len(e.RawUniqueMember) > 0 {
+		jsonArray := []string{}
+		if err := e.RawUniqueMember.Unmarshal(&jsonArray); err != nil {
+			log.Printf("erro: Unexpectd umarshal error: %s", err)
+		}
+		jsonMap["uniqueMember"] = jsonArray
+	}
+
+	if len(e.RawMemberOf) > 0 {
+		jsonArray := []string{}
+		if err := e.RawMemberOf.Unmarshal(&jsonArray); err != nil {
+			log.Printf("erro: Unexpectd umarshal error: %s", err)
+		}
+		jsonMap["memberOf"] = jsonArray
+	}
+
+	return jsonMap
+}
+
+func (r *HybridRepository) Search(ctx context.Context, baseDN *DN, option *SearchOption, handler func(entry *SearchEntry) error) (int32, int64, error) {
+	tx, err := r.beginReadonly(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, 0, NewCanceled(err)
+		}
+		return 0, 0, err
+	}
+	defer rollback(tx)
+
+	if option.IsDerefFindingBaseObj() {
+		if err := r.setStatementTimeout(tx, option); err != nil {
+			return 0, 0, err
+		}
+		baseDN, err = r.derefAlias(tx, baseDN, false)
+		if err != nil {
+			return 0, 0, searchQueryError(ctx, err)
+		}
+	}
+
+	if err := r.setStatementTimeout(tx, option); err != nil {
+		return 0, 0, err
+	}
+	if err := r.assertEntry(ctx, tx, baseDN); err != nil {
+		return 0, 0, searchQueryError(ctx, err)
+	}
+
+	option.aliasIDs = nil
+	option.derefDNs = nil
+	if option.IsDerefInSearching() && option.Scope != 0 {
+		if err := r.derefAliasesInScope(ctx, tx, baseDN, option); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return r.search(ctx, tx, baseDN, option, handler)
+}
+
+// setStatementTimeout sets the remaining time until the deadline of the search as the statement timeout.
+// The statement timeout limits each statement, so it must be set again before each statement of the search.
+func (r *HybridRepository) setStatementTimeout(tx *sqlx.Tx, option *SearchOption) error {
+	if option.Deadline.IsZero() {
+		return nil
+	}
+
+	remaining := time.Until(option.Deadline).Milliseconds()
+	if remaining <= 0 {
+		return NewTimeLimitExceeded(nil)
+	}
+	if _, err := r.execQuery(tx, fmt.Sprintf("SET LOCAL statement_timeout = %d", remaining)); err != nil {
+		return xerrors.Errorf("Failed to set statement timeout. err: %w", err)
+	}
+	return nil
+}
+
+// searchQueryError returns canceled error if the query is canceled by the abandon or cancel operation,
+// or timeLimitExceeded error if it's canceled by the statement timeout. Otherwise, it returns the error as it is.
+func searchQueryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return NewCanceled(err)
+	}
+	if isQueryCanceledError(err) {
+		return NewTimeLimitExceeded(err)
+	}
+	return err
+}
+
+// derefAlias follows the aliasedObjectName from the entry of the DN until it reaches the entry which isn't an alias.
+// The DN is returned as it is if the entry isn't an alias or doesn't exist.
+// If isAliased is true, the DN is the aliasedObjectName of other alias then the entry must exist.
+func (r *HybridRepository) derefAlias(tx *sqlx.Tx, dn *DN, isAliased bool) (*DN, error) {
+	visited := map[string]struct{}{}
+
+	for {
+		dest := struct {
+			ID             int64          `db:"id"`
+			RawAliasedOrig types.JSONText `db:"aliased"` // No real column in the table
+		}{}
+
+		if err := r.get(tx, r.findAliasByDN, &dest, map[string]interface{}{
+			"rdn_norm":       dn.RDNNormStr(),
+			"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
+		}); err != nil {
+			if isNoResult(err) {
+				if isAliased || len(visited) > 0 {
+					return nil, NewAliasProblem(fmt.Sprintf("aliased object does not exist: %s", dn.DNOrigStr()))
+				}
+				return dn, nil
+			}
+			return nil, xerrors.Errorf("Failed to find alias by DN. dn_orig: %s, err: %w", dn.DNOrigStr(), err)
+		}
+
+		if len(dest.RawAliasedOrig) == 0 {
+			return dn, nil
+		}
+		visited[dn.DNNormStr()] = struct{}{}
+
+		next, err := r.resolveAliasedObjectName(dest.RawAliasedOrig, visited)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("debug: Dereferenced alias. id: %d, dn_norm: %s, aliased_dn_norm: %s", dest.ID, dn.DNNormStr(), next.DNNormStr())
+
+		dn = next
+	}
+}
+
+// resolveAliasedObjectName parses the aliasedObjectName of the alias entry.
+// The alias which refers to the visited entry again is detected as the alias loop.
+func (r *HybridRepository) resolveAliasedObjectName(rawAliasedOrig types.JSONText, visited map[string]struct{}) (*DN, error) {
+	var aliased []string
+	if err := rawAliasedOrig.Unmarshal(&aliased); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal aliasedObjectName. err: %w", err)
+	}
+	if len(aliased) == 0 {
+		return nil, NewAliasProblem("alias has no aliasedObjectName")
+	}
+
+	dn, err := r.server.NormalizeDN(aliased[0])
+	if err != nil {
+		return nil, NewAliasProblem(fmt.Sprintf("invalid aliasedObjectName: %s", aliased[0]))
+	}
+
+	// Only the entries in this server can be dereferenced
+	if !dn.Equal(r.suffix) && !dn.IsSubOf(r.suffix) {
+		return nil, NewAliasDereferencingProblem(fmt.Sprintf("aliased object is out of the suffix: %s", aliased[0]))
+	}
+
+	if _, ok := visited[dn.DNNormStr()]; ok {
+		return nil, NewAliasProblem(fmt.Sprintf("circular alias: %s", aliased[0]))
+	}
+
+	return dn, nil
+}
+
+// derefAliasesInScope dereferences the aliases within the search scope.
+// The dereferenced entries become the base objects of the further search scopes.
+// For the one level scope, only the dereferenced entries are searched. For the subtree scopes,
+// their subtrees are also searched and the aliases in them are dereferenced again.
+func (r *HybridRepository) derefAliasesInScope(ctx context.Context, tx *sqlx.Tx, baseDN *DN, option *SearchOption) error {
+	searched := map[string]struct{}{
+		baseDN.DNNormStr(): {},
+	}
+
+	// The base object itself isn't dereferenced while searching
+	scopeDNs := []*DN{baseDN}
+	scope := option.Scope
+	if scope == 2 {
+		scope = 3
+	}
+
+	for len(scopeDNs) > 0 {
+		scopeDN := scopeDNs[0]
+		scopeDNs = scopeDNs[1:]
+
+		var scopeWhere strings.Builder
+		params := map[string]interface{}{
+			"alias": `exists($."aliasedObjectName")`,
+		}
+		r.collectScopeWhereSQL(scopeDN, &SearchOption{Scope: scope}, &scopeWhere, params)
+
+		if err := r.setStatementTimeout(tx, option); err != nil {
+			return err
+		}
+
+		q := fmt.Sprintf(`SELECT
+			e.id,
+			e.attrs_orig->'aliasedObjectName' AS aliased
+		FROM
+			ldap_entry e
+			LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+		WHERE
+			%s
+			AND e.attrs_norm @@ :alias
+		`, scopeWhere.String())
+
+		rows, err := r.namedQuery(tx, q, params)
+		if err != nil {
+			// The query is canceled by the abandon or cancel operation, otherwise by the statement timeout
+			if ctx.Err() != nil {
+				return NewCanceled(err)
+			}
+			if isQueryCanceledError(err) {
+				return NewTimeLimitExceeded(err)
+			}
+			return xerrors.Errorf("Unexpected alias query error. dn_norm: %s, err: %w", scopeDN.DNNormStr(), err)
+		}
+
+		var aliases []struct {
+			ID             int64          `db:"id"`
+			RawAliasedOrig types.JSONText `db:"aliased"` // No real column in the table
+		}
+		err = sqlx.StructScan(rows, &aliases)
+		rows.Close()
+		if err != nil {
+			if ctx.Err() != nil {
+				return NewCanceled(err)
+			}
+			if isQueryCanceledError(err) {
+				return NewTimeLimitExceeded(err)
+			}
+			return xerrors.Errorf("Unexpected struct scan error. err: %w", err)
+		}
+
+		for _, alias := range aliases {
+			option.aliasIDs = append(option.aliasIDs, alias.ID)
+
+			dn, err := r.resolveAliasedObjectName(alias.RawAliasedOrig, map[string]struct{}{})
+			if err != nil {
+				return err
+			}
+			if err := r.setStatementTimeout(tx, option); err != nil {
+				return err
+			}
+			dn, err = r.derefAlias(tx, dn, true)
+			if err != nil {
+				return searchQueryError(ctx, err)
+			}
+
+			// The same entry can be dereferenced by several aliases
+			if _, ok := searched[dn.DNNormStr()]; ok {
+				continue
+			}
+			searched[dn.DNNormStr()] = struct{}{}
 
-	if len(e.RawMemberOf) > 0 {
-		jsonArray := []string{}
-		if err := e.RawMemberOf.Unmarshal(&jsonArray); err != nil {
-			log.Printf("erro: Unexpectd umarshal error: %s", err)
+			option.derefDNs = append(option.derefDNs, dn)
+			if option.Scope != 1 {
+				scopeDNs = append(scopeDNs, dn)
+			}
 		}
-		jsonMap["memberOf"] = jsonArray
 	}
 
-	return jsonMap
+	log.Printf("debug: Dereferenced aliases in the search scope. aliases: %d, dereferenced: %d", len(option.aliasIDs), len(option.derefDNs))
+
+	return nil
 }
 
-func (r *HybridRepository) Search(ctx context.Context, baseDN *DN, option *SearchOption, handler func(entry *SearchEntry) error) (int32, int64, error) {
-	tx, err := r.beginReadonly(ctx)
-	if err != nil {
-		return 0, 0, nil
-	}
-	defer rollback(tx)
+func (r *HybridRepository) search(ctx context.Context, tx *sqlx.Tx, baseDN *DN, option *SearchOption, handler func(entry *SearchEntry) error) (int32, int64, error) {
+	var err error
 
 	log.Printf("Search option: %v", option)
 
@@ -1158,15 +2123,48 @@ func (r *HybridRepository) Search(ctx context.Context, baseDN *DN, option *Searc
 	r.collectScopeWhereSQL(baseDN, option, &scopeWhere, params)
 	r.collectFilterWhereSQL(baseDN, option, &filterJoin, &filterWhere, params)
 
+	if option.VLV != nil {
+		if err := r.setStatementTimeout(tx, option); err != nil {
+			return 0, 0, err
+		}
+		err = r.resolveVLVWindow(tx, option, scopeWhere.String(), filterJoin, filterWhere, params)
+		if err != nil {
+			return 0, 0, searchQueryError(ctx, err)
+		}
+		params["pageSize"] = option.PageSize + 1
+	}
+
 	// Projection(Association etc.)
 	var proj strings.Builder
 	var join strings.Builder
 	r.collectAssociationSQLPlanA(option, &proj, &join, params)
 	// r.collectAssociationSQLPlanB(option, &proj, &join, params)
 	r.collectHasSubordinatesSQL(option, &proj, &join)
+	r.collectContextCSNSQL(option, &proj)
 
 	pagingFilter := ""
-	if option.Cursor != nil {
+	orderBy := "e.id ASC"
+	offset := ""
+	sortProj := ""
+	sortValues := ""
+	if len(option.SortKeys) > 0 {
+		orderBy = r.collectSortSQL(option, params)
+		sortProj = r.collectSortValuesSQL(option)
+		sortValues = `, fe.sort_values`
+
+		if option.VLV != nil {
+			// The VLV window is the position in the sorted result
+			offset = "OFFSET :cursor"
+			params["cursor"] = *option.Cursor
+		} else if option.SortCursor != nil {
+			// The sorted result is paged after the last entry since the sort keys aren't unique
+			if len(option.SortCursor.Values) != len(option.SortKeys) {
+				return 0, 0, NewUnwillingToPerform("paged results cookie doesn't match the sort keys")
+			}
+			pagingFilter = `-- paging
+			AND (` + r.collectSortCursorSQL(option, params) + `)`
+		}
+	} else if option.Cursor != nil {
 		pagingFilter = `-- paging
 			AND e. id >= :cursor`
 		params["cursor"] = *option.Cursor
@@ -1179,6 +2177,7 @@ func (r *HybridRepository) Search(ctx context.Context, baseDN *DN, option *Searc
 			e.parent_id,
 			e.rdn_orig || ',' || dnc.dn_orig AS dn_orig,
 			e.attrs_orig
+			%s
 		FROM
 			ldap_entry e
 		-- DN join
@@ -1191,8 +2190,9 @@ func (r *HybridRepository) Search(ctx context.Context, baseDN *DN, option *Searc
 			-- ldap filter
 			(%s)
 			%s
-		ORDER BY e.id ASC
+		ORDER BY %s
 		LIMIT :pageSize
+		%s
 	)
 SELECT
 	fe.id,
@@ -1200,10 +2200,15 @@ SELECT
 	fe.dn_orig,
 	fe.attrs_orig
 	%s
+	%s
 FROM
 	filtered_entry fe
 %s
-	`, strings.Join(filterJoin, ""), scopeWhere.String(), strings.Join(filterWhere, " AND "), pagingFilter, proj.String(), join.String())
+	`, sortProj, strings.Join(filterJoin, ""), scopeWhere.String(), strings.Join(filterWhere, " AND "), pagingFilter, orderBy, offset, sortValues, proj.String(), join.String())
+
+	if err := r.setStatementTimeout(tx, option); err != nil {
+		return 0, 0, err
+	}
 
 	start := time.Now()
 	rows, err := r.namedQuery(tx, q, params)
@@ -1216,12 +2221,20 @@ FROM
 			// Need to return successful response
 			return 0, 0, nil
 		}
+		if ctx.Err() != nil {
+			return 0, 0, NewCanceled(err)
+		}
+		if isQueryCanceledError(err) {
+			return 0, 0, NewTimeLimitExceeded(err)
+		}
 		return 0, 0, xerrors.Errorf("Unexpected search query error. err: %w", err)
 	}
+	defer rows.Close()
 
 	var count int32 = 0
 	var nextId int64 = 0
 	var dbEntry HybridFetchedDBEntry
+	var last SortCursor
 
 	for rows.Next() {
 		err = rows.StructScan(&dbEntry)
@@ -1231,11 +2244,25 @@ FROM
 
 		// Detected remaining next page
 		if option.PageSize == count {
-			nextId = dbEntry.ID
+			if option.VLV != nil {
+				nextId = *option.Cursor + int64(count)
+			} else if len(option.SortKeys) > 0 {
+				nextId = last.ID
+				option.SortCursor = &last
+			} else {
+				nextId = dbEntry.ID
+			}
 			count++
 			break
 		}
 
+		if len(option.SortKeys) > 0 {
+			last = SortCursor{ID: dbEntry.ID}
+			if err := dbEntry.SortValues.Unmarshal(&last.Values); err != nil {
+				return 0, 0, xerrors.Errorf("Unexpected unmarshal error of the sort values. err: %w", err)
+			}
+		}
+
 		readEntry := r.toSearchEntry(&dbEntry)
 
 		err = handler(readEntry)
@@ -1248,9 +2275,127 @@ FROM
 		dbEntry.Clear()
 	}
 
+	// The statement timeout can be exceeded while fetching the rows, then the returned entries are partial results
+	if err := rows.Err(); err != nil {
+		// The query is canceled by the abandon or cancel operation, otherwise by the statement timeout
+		if ctx.Err() != nil {
+			return 0, 0, NewCanceled(err)
+		}
+		if isQueryCanceledError(err) {
+			return 0, 0, NewTimeLimitExceeded(err)
+		}
+		return 0, 0, xerrors.Errorf("Unexpected search rows error. err: %w", err)
+	}
+
 	return count, nextId, nil
 }
 
+// readEntry reads the entry for the pre-read or post-read control in the transaction of the update operation.
+// It does nothing if the control isn't requested.
+func (r *HybridRepository) readEntry(ctx context.Context, tx *sqlx.Tx, dn *DN, isPostRead bool) error {
+	req, ok := ReadEntryContext(ctx)
+	if !ok || (isPostRead && req.PostRead == nil) || (!isPostRead && req.PreRead == nil) {
+		return nil
+	}
+
+	f, err := compileFilter("(objectClass=*)")
+	if err != nil {
+		return err
+	}
+
+	var cursor int64
+	var entry *SearchEntry
+
+	_, _, err = r.search(ctx, tx, dn, &SearchOption{
+		Scope:                      0, // base
+		Filter:                     f,
+		PageSize:                   1,
+		Cursor:                     &cursor,
+		RequestedAssocation:        getAllMemberAttrs(),
+		IsMemberOfRequested:        true,
+		IsHasSubordinatesRequested: true,
+	}, func(e *SearchEntry) error {
+		entry = e
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("Failed to read entry for the control. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+
+	if isPostRead {
+		req.PostReadEntry = entry
+	} else {
+		req.PreReadEntry = entry
+	}
+	return nil
+}
+
+// assertEntry evaluates the filter of the assertion control against the entry in the transaction.
+// It does nothing if the control isn't requested.
+func (r *HybridRepository) assertEntry(ctx context.Context, tx *sqlx.Tx, dn *DN) error {
+	filter, ok := AssertionContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var scopeWhere, jsb, wsb strings.Builder
+	params := map[string]interface{}{}
+
+	r.collectScopeWhereSQL(dn, &SearchOption{Scope: 0}, &scopeWhere, params)
+
+	// Reuse the search filter translation
+	result := &HybridDBFilterTranslatorResult{
+		join:   &jsb,
+		where:  &wsb,
+		params: params,
+	}
+	if err := r.translator.translate(r.server.schemaMap, filter, result, false); err != nil {
+		return err
+	}
+	if wsb.Len() == 0 {
+		wsb.WriteString(`TRUE`)
+	}
+
+	q := fmt.Sprintf(`SELECT
+		e.id,
+		COALESCE((%s), FALSE) AS matched
+	FROM
+		ldap_entry e
+		LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+		%s
+	WHERE
+		%s
+	`, wsb.String(), jsb.String(), scopeWhere.String())
+
+	rows, err := r.namedQuery(tx, q, params)
+	if err != nil {
+		return xerrors.Errorf("Unexpected assertion query error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+	defer rows.Close()
+
+	fetched := struct {
+		ID      int64 `db:"id"`
+		Matched bool  `db:"matched"`
+	}{}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return xerrors.Errorf("Unexpected assertion query error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+		}
+		return NewNoSuchObject()
+	}
+
+	if err := rows.StructScan(&fetched); err != nil {
+		return xerrors.Errorf("Unexpected struct scan error. err: %w", err)
+	}
+
+	if !fetched.Matched {
+		log.Printf("info: Assertion failed. id: %d, dn_norm: %s", fetched.ID, dn.DNNormStr())
+		return NewAssertionFailed()
+	}
+	return nil
+}
+
 func (r *HybridRepository) toSearchEntry(dbEntry *HybridFetchedDBEntry) *SearchEntry {
 	orig := dbEntry.AttrsOrig()
 
@@ -1259,6 +2404,11 @@ func (r *HybridRepository) toSearchEntry(dbEntry *HybridFetchedDBEntry) *SearchE
 		orig["hasSubordinates"] = []string{strings.ToUpper(strconv.FormatBool(*dbEntry.HasSubordinates))}
 	}
 
+	// contextCSN
+	if dbEntry.ContextCSN != nil {
+		orig["contextCSN"] = []string{*dbEntry.ContextCSN}
+	}
+
 	// resolve association suffix
 	r.resolveDNSuffix(orig, "member")
 	r.resolveDNSuffix(orig, "uniqueMember")
@@ -1269,6 +2419,7 @@ func (r *HybridRepository) toSearchEntry(dbEntry *HybridFetchedDBEntry) *SearchE
 	r.resolveDNSuffix(orig, "modifiersName")
 
 	readEntry := NewSearchEntry(r.server.schemaMap, dbEntry.DNOrig, orig)
+	readEntry.base = r.base
 
 	return readEntry
 }
@@ -1277,7 +2428,7 @@ func (r *HybridRepository) resolveDNSuffix(attrsOrig map[string][]string, attrNa
 	um := attrsOrig[attrName]
 	if len(um) > 0 {
 		for i, v := range um {
-			um[i] = resolveSuffix(r.server, v)
+			um[i] = resolveSuffix(r.base, v)
 		}
 	}
 }
@@ -1306,7 +2457,9 @@ LEFT JOIN LATERAL (
 	FROM ldap_association ra, ldap_entry rae, ldap_container rc
 	WHERE fe.id = ra.id AND ra.name = :`)
 		join.WriteString(key)
-		join.WriteString(` AND rae.id = ra.member_id AND rc.id = rae.parent_id
+		join.WriteString(` AND rae.id = ra.member_id AND rc.id = rae.parent_id`)
+		r.collectMatchedValuesSQL(v, option, join, params)
+		join.WriteString(`
 ) AS `)
 		join.WriteString(v)
 		join.WriteString(` ON true`)
@@ -1335,13 +2488,104 @@ LEFT JOIN LATERAL (
 		join.WriteString(v)
 		join.WriteString(`
 	FROM ldap_association ra, ldap_entry rae, ldap_container rc
-	WHERE fe.id = ra.member_id AND rae.id = ra.id AND rc.id = rae.parent_id
+	WHERE fe.id = ra.member_id AND rae.id = ra.id AND rc.id = rae.parent_id`)
+		r.collectMatchedValuesSQL(v, option, join, params)
+		join.WriteString(`
 ) AS `)
 		join.WriteString(v)
 		join.WriteString(` ON true`)
 	}
 }
 
+// collectMatchedValuesSQL writes the condition of the matched values control for the association values.
+// The values are filtered by SQL to avoid fetching all members of the large group.
+// It writes nothing if some filter item can't be translated, the server filters the values after fetching in any case.
+func (r *HybridRepository) collectMatchedValuesSQL(attrName string, option *SearchOption, join *strings.Builder, params map[string]interface{}) {
+	if len(option.MatchedValues) == 0 {
+		return
+	}
+
+	s, ok := r.server.schemaMap.AttributeType(attrName)
+	if !ok {
+		return
+	}
+
+	items := matchedValuesFilterItems(r.server.schemaMap, option.MatchedValues, s)
+	if len(items) == 0 {
+		return
+	}
+
+	var cond strings.Builder
+
+	for i, f := range items {
+		if i > 0 {
+			cond.WriteString(` OR `)
+		}
+
+		switch ff := f.(type) {
+		case message.FilterEqualityMatch:
+			reqDN, err := r.server.NormalizeDN(string(ff.AssertionValue()))
+			if err != nil {
+				writeFalse(&cond)
+				continue
+			}
+
+			rdnNormKey := strconv.Itoa(len(params))
+			params[rdnNormKey] = reqDN.RDNNormStr()
+
+			parentDNNormKey := strconv.Itoa(len(params))
+			params[parentDNNormKey] = reqDN.ParentDN().DNNormStrWithoutSuffix(r.base)
+
+			cond.WriteString(`(rae.rdn_norm = :`)
+			cond.WriteString(rdnNormKey)
+			cond.WriteString(` AND rc.dn_norm = :`)
+			cond.WriteString(parentDNNormKey)
+			cond.WriteString(`)`)
+
+		case message.FilterSubstrings:
+			initial, middle, final := substringValues(s, ff)
+			pattern := escapeLike(initial) + "%"
+			for _, v := range middle {
+				pattern += escapeLike(v) + "%"
+			}
+			pattern += escapeLike(final)
+
+			r.writeMatchedValuesLikeSQL(&cond, pattern, params)
+
+		case message.FilterApproxMatch:
+			pattern := "%" + escapeLike(normalizeSubstringValue(s, string(ff.AssertionValue()))) + "%"
+
+			r.writeMatchedValuesLikeSQL(&cond, pattern, params)
+
+		default:
+			// Present or ordering
+			return
+		}
+	}
+
+	join.WriteString(`
+		-- matched values
+		AND (`)
+	join.WriteString(cond.String())
+	join.WriteString(`)`)
+}
+
+// writeMatchedValuesLikeSQL writes the condition which matches the normalized DN of the association value with the pattern.
+func (r *HybridRepository) writeMatchedValuesLikeSQL(cond *strings.Builder, pattern string, params map[string]interface{}) {
+	baseKey := strconv.Itoa(len(params))
+	params[baseKey] = r.base.DNNormStr()
+
+	patternKey := strconv.Itoa(len(params))
+	params[patternKey] = pattern
+
+	// The container of the root entry has the empty dn_norm, and the base DN is empty
+	// if the root entry is a single RDN suffix sharing the DB schema
+	cond.WriteString(`concat_ws(',', rae.rdn_norm, NULLIF(rc.dn_norm, ''), NULLIF(:`)
+	cond.WriteString(baseKey)
+	cond.WriteString(`, '')) LIKE :`)
+	cond.WriteString(patternKey)
+}
+
 func (r *HybridRepository) collectAssociationSQLPlanB(option *SearchOption, proj, join *strings.Builder, params map[string]interface{}) {
 	for _, v := range option.RequestedAssocation {
 		proj.WriteString(`,`)
@@ -1400,9 +2644,19 @@ LEFT JOIN LATERAL (
 	}
 }
 
+// collectContextCSNSQL projects the latest CSN of the change log for the suffix entry whose parent container is 0.
+func (r *HybridRepository) collectContextCSNSQL(option *SearchOption, proj *strings.Builder) {
+	if option.IsContextCSNRequested {
+		proj.WriteString(`,`)
+		proj.WriteString(`
+-- requested context_csn
+CASE WHEN fe.parent_id = 0 THEN (SELECT csn FROM ldap_change_log ORDER BY seq DESC LIMIT 1) END AS context_csn`)
+	}
+}
+
 func (r *HybridRepository) collectScopeWhereSQL(baseDN *DN, option *SearchOption, where *strings.Builder, params map[string]interface{}) {
 	// Always return not found for parents of the server suffix
-	if baseDN.IsDC() && !baseDN.Equal(r.server.Suffix) {
+	if baseDN.IsDC() && !baseDN.Equal(r.suffix) {
 		where.WriteString(`FALSE`)
 		return
 	}
@@ -1415,17 +2669,17 @@ func (r *HybridRepository) collectScopeWhereSQL(baseDN *DN, option *SearchOption
 	if option.Scope == 0 {
 		where.WriteString(`e.rdn_norm = :rdn_norm AND dnc.dn_norm = :parent_dn_norm`)
 		params["rdn_norm"] = baseDN.RDNNormStr()
-		params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix)
+		params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.base)
 
 	} else if option.Scope == 1 {
-		if baseDN.Equal(r.server.Suffix) {
+		if baseDN.Equal(r.base) {
 			where.WriteString(`e.parent_id = (SELECT
 					c.id
 				FROM
 					ldap_container c
 				WHERE
 					c.id != 0 AND c.dn_norm = :parent_dn_norm)`)
-			params["parent_dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.server.Suffix)
+			params["parent_dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.base)
 		} else {
 			where.WriteString(`e.parent_id = (SELECT
 					c.id
@@ -1433,62 +2687,361 @@ func (r *HybridRepository) collectScopeWhereSQL(baseDN *DN, option *SearchOption
 					ldap_container c
 				WHERE
 					c.dn_norm = :parent_dn_norm)`)
-			params["parent_dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.server.Suffix)
+			params["parent_dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.base)
+		}
+	} else {
+		var subWhere string
+		if baseDN.Equal(r.base) {
+			subWhere = `
+				e.parent_id IN (
+					SELECT
+						id
+					FROM
+						ldap_container c
+					WHERE
+						id != 0
+				)`
+		} else {
+			if baseDN.ParentDN().DNNormStrWithoutSuffix(r.base) == "" {
+				subWhere = `
+				e.parent_id IN (SELECT
+						c.id
+					FROM
+						ldap_container c
+					WHERE
+						c.dn_norm = :dn_norm
+						OR
+						REVERSE(c.dn_norm) LIKE REVERSE('%,' || :dn_norm)
+				)`
+			} else {
+				subWhere = `
+				e.parent_id IN (SELECT
+						c.id
+					FROM
+						ldap_container c
+					WHERE
+						c.dn_norm = :dn_norm
+						OR
+						REVERSE(c.dn_norm) LIKE REVERSE('%,' || :dn_norm)
+				)`
+			}
+		}
+
+		if option.Scope == 2 {
+			where.WriteString(`(e.rdn_norm = :rdn_norm AND dnc.dn_norm = :parent_dn_norm
+				OR`)
+			where.WriteString(subWhere)
+			where.WriteString(`
+			)`)
+			params["rdn_norm"] = baseDN.RDNNormStr()
+			params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.base)
+			params["dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.base)
+		} else {
+			// scope == 3
+			where.WriteString(subWhere)
+			params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.base)
+			params["dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.base)
+		}
+	}
+
+	// Add the search scopes of the dereferenced entries, and exclude the aliases themselves
+	if len(option.aliasIDs) > 0 {
+		r.collectDerefScopeWhereSQL(option, where, params)
+	}
+
+	// The entries beneath the referral entries are held by the other server, they aren't the local entries
+	if option.Scope != 0 && !option.ManageDsaIT {
+		where.WriteString(`
+			AND NOT EXISTS (SELECT
+					1
+				FROM
+					ldap_container rc
+					JOIN ldap_entry re ON re.id = rc.id
+				WHERE
+					re.attrs_norm @@ :referral
+					AND (dnc.dn_norm = rc.dn_norm OR REVERSE(dnc.dn_norm) LIKE REVERSE('%,' || rc.dn_norm))
+			)`)
+		params["referral"] = `$."objectClass" == "referral"`
+	}
+
+	// The persistent search fetches only the changed entry
+	if option.EntryID != 0 {
+		where.WriteString(` AND e.id = :entry_id`)
+		params["entry_id"] = option.EntryID
+	}
+}
+
+func (r *HybridRepository) collectDerefScopeWhereSQL(option *SearchOption, where *strings.Builder, params map[string]interface{}) {
+	scopeWhere := where.String()
+	where.Reset()
+
+	where.WriteString(`(`)
+	where.WriteString(scopeWhere)
+
+	for i, dn := range option.derefDNs {
+		rdnKey := fmt.Sprintf("deref_rdn_norm_%d", i)
+		parentKey := fmt.Sprintf("deref_parent_dn_norm_%d", i)
+		params[rdnKey] = dn.RDNNormStr()
+		params[parentKey] = dn.ParentDN().DNNormStrWithoutSuffix(r.base)
+
+		where.WriteString(`
+			OR (e.rdn_norm = :`)
+		where.WriteString(rdnKey)
+		where.WriteString(` AND dnc.dn_norm = :`)
+		where.WriteString(parentKey)
+		where.WriteString(`)`)
+
+		// The subtree of the dereferenced entry
+		if option.Scope != 1 {
+			if dn.Equal(r.base) {
+				where.WriteString(`
+			OR e.parent_id IN (
+				SELECT
+					id
+				FROM
+					ldap_container c
+				WHERE
+					id != 0
+			)`)
+			} else {
+				dnKey := fmt.Sprintf("deref_dn_norm_%d", i)
+				params[dnKey] = dn.DNNormStrWithoutSuffix(r.base)
+
+				where.WriteString(`
+			OR e.parent_id IN (SELECT
+					c.id
+				FROM
+					ldap_container c
+				WHERE
+					c.dn_norm = :`)
+				where.WriteString(dnKey)
+				where.WriteString(`
+					OR
+					REVERSE(c.dn_norm) LIKE REVERSE('%,' || :`)
+				where.WriteString(dnKey)
+				where.WriteString(`)
+			)`)
+			}
+		}
+	}
+
+	where.WriteString(`)
+			AND e.id != ALL(:alias_ids ::::BIGINT[])`)
+	params["alias_ids"] = pq.Array(option.aliasIDs)
+}
+
+type HybridFetchedVLVCount struct {
+	Count  int64 `db:"count"`
+	Before int64 `db:"before"`
+}
+
+// resolveVLVWindow counts the entries of the search result then calculates the target position.
+// The page size and the cursor are replaced with the window of the target.
+// https://datatracker.ietf.org/doc/html/draft-ietf-ldapext-ldapv3-vlv-09#section-6.2
+func (r *HybridRepository) resolveVLVWindow(tx *sqlx.Tx, option *SearchOption, scopeWhere string, filterJoin, filterWhere []string, params map[string]interface{}) error {
+	vlv := option.VLV
+
+	// Count the entries before the first entry which is greater than or equal to the assertion value
+	beforeFilter := "FALSE"
+	if vlv.AssertionValue != nil {
+		k := option.SortKeys[0]
+		key := "vlvSortKey"
+		params[key] = k.AttributeType.Name
+		params["vlvValue"] = *vlv.AssertionValue
+
+		value := `:vlvValue COLLATE "C"`
+		if k.AttributeType.IsNumberNormalized() {
+			value = `CAST(:vlvValue AS numeric)`
+		}
+
+		if k.ReverseOrder {
+			expr := sortKeySQL(k, key)
+			beforeFilter = expr + ` > ` + value + ` OR ` + expr + ` IS NULL`
+		} else {
+			beforeFilter = sortKeySQL(k, key) + ` < ` + value
+		}
+	}
+
+	q := fmt.Sprintf(`SELECT
+	COUNT(*) AS count,
+	COUNT(*) FILTER (WHERE %s) AS before
+FROM
+	ldap_entry e
+-- DN join
+LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+%s
+WHERE
+	-- scope filter
+	%s
+	AND
+	-- ldap filter
+	(%s)
+	`, beforeFilter, strings.Join(filterJoin, ""), scopeWhere, strings.Join(filterWhere, " AND "))
+
+	rows, err := r.namedQuery(tx, q, params)
+	if err != nil {
+		return xerrors.Errorf("Unexpected VLV count query error. err: %w", err)
+	}
+	defer rows.Close()
+
+	var fetched HybridFetchedVLVCount
+	if rows.Next() {
+		if err := rows.StructScan(&fetched); err != nil {
+			return xerrors.Errorf("Unexpected struct scan error. err: %w", err)
+		}
+	}
+
+	vlv.TotalCount = fetched.Count
+
+	if vlv.AssertionValue != nil {
+		vlv.TargetPosition = fetched.Before + 1
+	} else if vlv.ContentCount == 0 || vlv.ContentCount == fetched.Count {
+		vlv.TargetPosition = vlv.Offset
+	} else if vlv.Offset == vlv.ContentCount {
+		vlv.TargetPosition = fetched.Count
+	} else {
+		// Estimate the position by the ratio of the client's content count
+		vlv.TargetPosition = vlv.Offset * fetched.Count / vlv.ContentCount
+		if vlv.TargetPosition < 1 {
+			vlv.TargetPosition = 1
+		}
+	}
+	if vlv.AssertionValue == nil && vlv.TargetPosition > fetched.Count {
+		vlv.TargetPosition = fetched.Count
+	}
+
+	first := vlv.TargetPosition - vlv.BeforeCount
+	if first < 1 {
+		first = 1
+	}
+	last := vlv.TargetPosition + vlv.AfterCount
+
+	size := last - first + 1
+	if size < 0 {
+		size = 0
+	}
+	if size > math.MaxInt32-1 {
+		size = math.MaxInt32 - 1
+	}
+
+	cursor := first - 1
+	option.Cursor = &cursor
+	option.PageSize = int32(size)
+
+	log.Printf("info: VLV window: target: %d, total: %d, offset: %d, size: %d", vlv.TargetPosition, vlv.TotalCount, cursor, size)
+
+	return nil
+}
+
+// collectSortSQL returns ORDER BY clause for the sort keys.
+// Multi-valued attribute is sorted by the least value, or the greatest value with the reverse order.
+// The entry which doesn't have the attribute is sorted as the greatest value.
+func (r *HybridRepository) collectSortSQL(option *SearchOption, params map[string]interface{}) string {
+	var sb strings.Builder
+
+	for i, k := range option.SortKeys {
+		key := "sortKey" + strconv.Itoa(i)
+		params[key] = k.AttributeType.Name
+
+		sb.WriteString(sortKeySQL(k, key))
+		if k.ReverseOrder {
+			sb.WriteString(` DESC NULLS FIRST, `)
+		} else {
+			sb.WriteString(` ASC NULLS LAST, `)
 		}
-	} else {
-		var subWhere string
-		if baseDN.Equal(r.server.Suffix) {
-			subWhere = `
-				e.parent_id IN (
-					SELECT
-						id
-					FROM
-						ldap_container c
-					WHERE
-						id != 0
-				)`
+	}
+
+	// Stable order for paging
+	sb.WriteString("e.id ASC")
+
+	return sb.String()
+}
+
+// collectSortValuesSQL returns the projection of the sort key values as the JSON array of the texts.
+// They are kept as the sort cursor of the next page.
+func (r *HybridRepository) collectSortValuesSQL(option *SearchOption) string {
+	var sb strings.Builder
+
+	sb.WriteString(`, jsonb_build_array(`)
+	for i, k := range option.SortKeys {
+		if i > 0 {
+			sb.WriteString(`, `)
+		}
+		sb.WriteString(sortKeySQL(k, "sortKey"+strconv.Itoa(i)))
+		sb.WriteString(`::::text`)
+	}
+	sb.WriteString(`) AS sort_values`)
+
+	return sb.String()
+}
+
+// collectSortCursorSQL returns the condition of the entries after the sort cursor in the order of collectSortSQL.
+//
+//	(k1 after v1) OR (k1 = v1 AND k2 after v2) OR ... OR (k1 = v1 AND ... AND e.id > id)
+func (r *HybridRepository) collectSortCursorSQL(option *SearchOption, params map[string]interface{}) string {
+	var sb strings.Builder
+	same := []string{}
+
+	for i, k := range option.SortKeys {
+		expr := sortKeySQL(k, "sortKey"+strconv.Itoa(i))
+
+		var after, equal string
+		if v := option.SortCursor.Values[i]; v == nil {
+			// The entry without the attribute is the greatest value
+			equal = expr + ` IS NULL`
+			if k.ReverseOrder {
+				after = expr + ` IS NOT NULL`
+			} else {
+				after = `FALSE`
+			}
 		} else {
-			if baseDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix) == "" {
-				subWhere = `
-				e.parent_id IN (SELECT
-						c.id
-					FROM
-						ldap_container c
-					WHERE
-						c.dn_norm = :dn_norm
-						OR
-						REVERSE(c.dn_norm) LIKE REVERSE('%,' || :dn_norm)
-				)`
+			key := "sortCursor" + strconv.Itoa(i)
+			params[key] = *v
+
+			value := `:` + key + ` COLLATE "C"`
+			if k.AttributeType.IsNumberNormalized() {
+				value = `CAST(:` + key + ` AS numeric)`
+			}
+
+			equal = expr + ` = ` + value
+			if k.ReverseOrder {
+				after = expr + ` < ` + value
 			} else {
-				subWhere = `
-				e.parent_id IN (SELECT
-						c.id
-					FROM
-						ldap_container c
-					WHERE
-						c.dn_norm = :dn_norm
-						OR
-						REVERSE(c.dn_norm) LIKE REVERSE('%,' || :dn_norm)
-				)`
+				after = `(` + expr + ` > ` + value + ` OR ` + expr + ` IS NULL)`
 			}
 		}
 
-		if option.Scope == 2 {
-			where.WriteString(`(e.rdn_norm = :rdn_norm AND dnc.dn_norm = :parent_dn_norm
-				OR`)
-			where.WriteString(subWhere)
-			where.WriteString(`
-			)`)
-			params["rdn_norm"] = baseDN.RDNNormStr()
-			params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix)
-			params["dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.server.Suffix)
-		} else {
-			// scope == 3
-			where.WriteString(subWhere)
-			params["parent_dn_norm"] = baseDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix)
-			params["dn_norm"] = baseDN.DNNormStrWithoutSuffix(r.server.Suffix)
-		}
+		sb.WriteString(`(`)
+		sb.WriteString(strings.Join(append(same, after), ` AND `))
+		sb.WriteString(`) OR `)
+
+		same = append(same, equal)
+	}
+
+	params["sortCursorID"] = option.SortCursor.ID
+
+	sb.WriteString(`(`)
+	sb.WriteString(strings.Join(append(same, `e.id > :sortCursorID`), ` AND `))
+	sb.WriteString(`)`)
+
+	return sb.String()
+}
+
+// sortKeySQL returns the expression of the sort key value.
+// The attribute name is bound by the parameter key.
+func sortKeySQL(k *SortKey, key string) string {
+	agg := "min"
+	if k.ReverseOrder {
+		agg = "max"
+	}
+
+	// Normalized values are compared by the binary order
+	value := `v COLLATE "C"`
+	if k.AttributeType.IsNumberNormalized() {
+		value = "v::::numeric"
 	}
+
+	return `(SELECT ` + agg + `(` + value + `) FROM jsonb_array_elements_text(e.attrs_norm->:` + key + `) v)`
 }
 
 func (r *HybridRepository) collectFilterWhereSQL(baseDN *DN, option *SearchOption, join *[]string, where *[]string, params map[string]interface{}) error {
@@ -1519,6 +3072,8 @@ func (r *HybridRepository) collectFilterWhereSQL(baseDN *DN, option *SearchOptio
 }
 
 type HybridDBFilterTranslator struct {
+	suffix *DN
+	base   *DN
 }
 
 type HybridDBFilterTranslatorResult struct {
@@ -1579,7 +3134,7 @@ func (t *HybridDBFilterTranslator) translate(schemaMap *SchemaMap, packet messag
 		attrName := string(f.Type_())
 
 		var s *AttributeType
-		s, ok := schemaMap.AttributeType(attrName)
+		s, ok := findSchema(schemaMap, attrName)
 		if !ok {
 			q.where.WriteString("FALSE")
 			return
@@ -1648,6 +3203,16 @@ func (t *HybridDBFilterTranslator) translate(schemaMap *SchemaMap, packet messag
 		} else {
 			q.where.WriteString("FALSE")
 		}
+	case message.FilterExtensibleMatch:
+		m := parseExtensibleMatch(f)
+		if m.Type == "" {
+			log.Printf("Extensible match without attribute type isn't supported")
+			q.where.WriteString("FALSE")
+		} else if s, ok := findSchema(schemaMap, m.Type); ok {
+			t.ExtensibleMatch(schemaMap, s, q, m, isNot)
+		} else {
+			q.where.WriteString("FALSE")
+		}
 	}
 
 	return nil
@@ -1733,6 +3298,11 @@ func (t *HybridDBFilterTranslator) EqualityMatch(s *AttributeType, q *HybridDBFi
 			q.where.WriteString(`FALSE`)
 			return
 		}
+		// The member in the other naming context isn't associated
+		if !reqDN.Equal(t.suffix) && !reqDN.IsSubOf(t.suffix) {
+			q.where.WriteString(`FALSE`)
+			return
+		}
 
 		nameKey := q.nextParamKey(s.Name)
 		q.params[nameKey] = s.Name
@@ -1741,7 +3311,7 @@ func (t *HybridDBFilterTranslator) EqualityMatch(s *AttributeType, q *HybridDBFi
 		q.params[rdnNormKey] = reqDN.RDNNormStr()
 
 		parentDNNormKey := q.nextParamKey(s.Name)
-		q.params[parentDNNormKey] = reqDN.ParentDN().DNNormStrWithoutSuffix(s.schemaDef.server.Suffix)
+		q.params[parentDNNormKey] = reqDN.ParentDN().DNNormStrWithoutSuffix(t.base)
 
 		/*
 			-- association filter by uniqueMember
@@ -1826,7 +3396,7 @@ func (t *HybridDBFilterTranslator) EqualityMatch(s *AttributeType, q *HybridDBFi
 		q.params[rdnNormKey] = reqDN.RDNNormStr()
 
 		parentDNNormKey := q.nextParamKey(s.Name)
-		q.params[parentDNNormKey] = reqDN.ParentDN().DNNormStrWithoutSuffix(s.schemaDef.server.Suffix)
+		q.params[parentDNNormKey] = reqDN.ParentDN().DNNormStrWithoutSuffix(t.base)
 
 		/*
 			-- association filter by memberOf
@@ -2095,6 +3665,173 @@ func (t *HybridDBFilterTranslator) ApproxMatch(s *AttributeType, q *HybridDBFilt
 	q.where.WriteString(filterKey)
 }
 
+// ExtensibleMatch matches the attribute values by the requested matching rule.
+// The equality rule of the attribute is used if the matching rule isn't specified.
+// If the dnAttributes flag is set, the RDN components of the entry's DN are also matched.
+func (t *HybridDBFilterTranslator) ExtensibleMatch(schemaMap *SchemaMap, s *AttributeType, q *HybridDBFilterTranslatorResult, m *ExtensibleMatch, isNot bool) {
+	rule := s.Equality
+	if m.MatchingRule != "" {
+		var ok bool
+		rule, ok = resolveMatchingRule(m.MatchingRule)
+		if !ok {
+			log.Printf("Unsupported matching rule of extensible match. rule: %s", m.MatchingRule)
+			writeFalse(q.where)
+			return
+		}
+	}
+
+	if m.DNAttributes {
+		q.where.WriteString("(")
+	}
+
+	switch rule {
+	case s.Equality:
+		t.EqualityMatch(s, q, m.MatchValue, isNot)
+	case "caseIgnoreMatch", "caseIgnoreIA5Match":
+		if s.IsCaseIgnore() {
+			t.EqualityMatch(s, q, m.MatchValue, isNot)
+		} else {
+			t.OrigValueMatch(s, q, m.MatchValue, true, isNot)
+		}
+	case "caseExactMatch", "caseExactIA5Match", "octetStringMatch":
+		t.OrigValueMatch(s, q, m.MatchValue, false, isNot)
+	case "integerBitAndMatch", "integerBitOrMatch":
+		t.BitwiseMatch(s, q, m.MatchValue, rule == "integerBitAndMatch", isNot)
+	default:
+		log.Printf("Inappropriate matching rule of extensible match. attrName: %s, rule: %s", s.Name, rule)
+		writeFalse(q.where)
+	}
+
+	if m.DNAttributes {
+		if isNot {
+			q.where.WriteString(" AND ")
+		} else {
+			q.where.WriteString(" OR ")
+		}
+		t.DNAttributesMatch(schemaMap, q, m.Type, m.MatchValue, isNot)
+		q.where.WriteString(")")
+	}
+}
+
+// OrigValueMatch matches the original attribute values exactly or ignoring case.
+// It's used when the matching rule is different from the equality rule of the attribute.
+func (t *HybridDBFilterTranslator) OrigValueMatch(s *AttributeType, q *HybridDBFilterTranslatorResult, val string, ignoreCase, isNot bool) {
+	if s.IsAssociationAttribute() || s.IsReverseAssociationAttribute() {
+		log.Printf("Filter for association doesn't support extensible match")
+		writeFalse(q.where)
+		return
+	}
+
+	var sb strings.Builder
+	sb.Grow(30 + len(s.Name) + len(val))
+
+	if isNot {
+		sb.WriteString(`!(`)
+	}
+	sb.WriteString(`$."`)
+	sb.WriteString(escapeName(s.Name))
+	if ignoreCase {
+		sb.WriteString(`" like_regex "^`)
+		sb.WriteString(escapeRegex(val))
+		sb.WriteString(`$" flag "i"`)
+	} else {
+		sb.WriteString(`" == "`)
+		sb.WriteString(escapeValue(val))
+		sb.WriteString(`"`)
+	}
+	if isNot {
+		sb.WriteString(`)`)
+	}
+
+	filterKey := q.nextParamKey(s.Name)
+	q.params[filterKey] = sb.String()
+
+	// attrs_orig @@ '$.cn == "Foo"';
+	q.where.WriteString(`e.attrs_orig @@ :`)
+	q.where.WriteString(filterKey)
+}
+
+// BitwiseMatch matches the integer values by the bitwise AND or OR like Active Directory.
+func (t *HybridDBFilterTranslator) BitwiseMatch(s *AttributeType, q *HybridDBFilterTranslatorResult, val string, isAnd, isNot bool) {
+	if s.Equality != "integerMatch" {
+		log.Printf("Not integer doesn't support bitwise match")
+		writeFalse(q.where)
+		return
+	}
+
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		log.Printf("warn: Ignore filter due to invalid syntax. attrName: %s, value: %s", s.Name, val)
+		writeFalse(q.where)
+		return
+	}
+
+	nameKey := q.nextParamKey(s.Name)
+	q.params[nameKey] = s.Name
+
+	valueKey := q.nextParamKey(s.Name)
+	q.params[valueKey] = v
+
+	/*
+		-- bitwise AND
+		EXISTS (SELECT 1 FROM jsonb_array_elements_text(e.attrs_norm->'userAccountControl') v WHERE (v::bigint & 2) = 2)
+
+		-- bitwise OR
+		EXISTS (SELECT 1 FROM jsonb_array_elements_text(e.attrs_norm->'userAccountControl') v WHERE (v::bigint & 2) <> 0)
+	*/
+	if isNot {
+		q.where.WriteString(`NOT `)
+	}
+	q.where.WriteString(`EXISTS (SELECT 1 FROM jsonb_array_elements_text(e.attrs_norm->:`)
+	q.where.WriteString(nameKey)
+	q.where.WriteString(`) v WHERE (v::::bigint & :`)
+	q.where.WriteString(valueKey)
+	if isAnd {
+		q.where.WriteString(`) = :`)
+		q.where.WriteString(valueKey)
+	} else {
+		q.where.WriteString(`) <> 0`)
+	}
+	q.where.WriteString(`)`)
+}
+
+// DNAttributesMatch matches the RDN components of the entry's DN.
+// The DN of the entry is stored without the base DN, so the base DN components match all entries.
+func (t *HybridDBFilterTranslator) DNAttributesMatch(schemaMap *SchemaMap, q *HybridDBFilterTranslatorResult, attrName, val string, isNot bool) {
+	dn, err := ParseDN(schemaMap, attrName+"="+encodeDN(val))
+	if err != nil || len(dn.RDNs) != 1 {
+		log.Printf("warn: Ignore filter due to invalid DN syntax. attrName: %s, value: %s", attrName, val)
+		writeFalse(q.where)
+		return
+	}
+	rdnNorm := dn.RDNNormStr()
+
+	if t.base != nil {
+		for _, rdn := range t.base.RDNs {
+			if rdn.NormStr() == rdnNorm {
+				if isNot {
+					writeFalse(q.where)
+				} else {
+					q.where.WriteString(`TRUE`)
+				}
+				return
+			}
+		}
+	}
+
+	filterKey := q.nextParamKey(attrName)
+	q.params[filterKey] = `(^|[,+])` + escapeRegex(rdnNorm) + `([,+]|$)`
+
+	// e.rdn_norm || ',' || dnc.dn_norm ~ '(^|[,+])ou=people([,+]|$)'
+	q.where.WriteString(`(e.rdn_norm || ',' || COALESCE(dnc.dn_norm, ''))`)
+	if isNot {
+		q.where.WriteString(` !~ :`)
+	} else {
+		q.where.WriteString(` ~ :`)
+	}
+	q.where.WriteString(filterKey)
+}
+
 //////////////////////////////////////////
 // Mapping
 //////////////////////////////////////////
@@ -2143,19 +3880,19 @@ func (r *HybridRepository) AddEntryToDBEntry(ctx context.Context, tx *sqlx.Tx, e
 			// Migration mode
 			// It's already normlized
 			creatorsDN, _ := r.server.NormalizeDN(v[0])
-			norm["creatorsName"] = []interface{}{creatorsDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)}
-			orig["creatorsName"] = []string{creatorsDN.DNNormStrWithoutSuffix(r.server.Suffix)}
+			norm["creatorsName"] = []interface{}{creatorsDN.DNOrigEncodedStrWithoutSuffix(r.base)}
+			orig["creatorsName"] = []string{creatorsDN.DNNormStrWithoutSuffix(r.base)}
 		} else {
-			norm["creatorsName"] = []interface{}{session.DN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)}
-			orig["creatorsName"] = []string{session.DN.DNNormStrWithoutSuffix(r.server.Suffix)}
+			norm["creatorsName"] = []interface{}{session.DN.DNOrigEncodedStrWithoutSuffix(r.base)}
+			orig["creatorsName"] = []string{session.DN.DNNormStrWithoutSuffix(r.base)}
 		}
 		// If migration mode is enabled, we use the specified values
 		if v, ok := orig["modifiersName"]; ok {
 			// Migration mode
 			// It's already normlized
 			modifiersDN, _ := r.server.NormalizeDN(v[0])
-			norm["modifiersName"] = []interface{}{modifiersDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)}
-			orig["modifiersName"] = []string{modifiersDN.DNNormStrWithoutSuffix(r.server.Suffix)}
+			norm["modifiersName"] = []interface{}{modifiersDN.DNOrigEncodedStrWithoutSuffix(r.base)}
+			orig["modifiersName"] = []string{modifiersDN.DNNormStrWithoutSuffix(r.base)}
 		} else {
 			norm["modifiersName"] = norm["creatorsName"]
 			orig["modifiersName"] = orig["creatorsName"]
@@ -2240,9 +3977,13 @@ func (r *HybridRepository) dnArrayToIDArray(tx *sqlx.Tx, norm map[string][]inter
 		if !ok {
 			return nil, NewInvalidPerSyntax(attrName, i)
 		}
-		indexMap[dn.DNNormStrWithoutSuffix(r.server.Suffix)] = i
+		// The association is resolved only in the naming context
+		if !dn.Equal(r.suffix) && !dn.IsSubOf(r.suffix) {
+			return nil, NewInvalidPerSyntax(attrName, i)
+		}
+		indexMap[dn.DNNormStrWithoutSuffix(r.base)] = i
 
-		parentDNNorm := dn.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix)
+		parentDNNorm := dn.ParentDN().DNNormStrWithoutSuffix(r.base)
 		if set, ok := dnMap[parentDNNorm]; ok {
 			set.Add(dn.RDNNormStr())
 		} else {
@@ -2387,11 +4128,11 @@ func (r *HybridRepository) modifyEntryToDBEntry(ctx context.Context, tx *sqlx.Tx
 			// Migration mode
 			// It's already normlized
 			modifiersDN, _ := r.server.NormalizeDN(v[0])
-			norm["modifiersName"] = []interface{}{modifiersDN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)}
-			orig["modifiersName"] = []string{modifiersDN.DNNormStrWithoutSuffix(r.server.Suffix)}
+			norm["modifiersName"] = []interface{}{modifiersDN.DNOrigEncodedStrWithoutSuffix(r.base)}
+			orig["modifiersName"] = []string{modifiersDN.DNNormStrWithoutSuffix(r.base)}
 		} else {
-			norm["modifiersName"] = []interface{}{session.DN.DNOrigEncodedStrWithoutSuffix(r.server.Suffix)}
-			orig["modifiersName"] = []string{session.DN.DNNormStrWithoutSuffix(r.server.Suffix)}
+			norm["modifiersName"] = []interface{}{session.DN.DNOrigEncodedStrWithoutSuffix(r.base)}
+			orig["modifiersName"] = []string{session.DN.DNNormStrWithoutSuffix(r.base)}
 		}
 	}
 
@@ -2432,6 +4173,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 		RawCredentialOrig  types.JSONText `db:"credential"`      // No real column in the table
 		RawLockedTimeOrig  types.JSONText `db:"locked_time"`     // No real column in the table
 		RawFailureTimeOrig types.JSONText `db:"failure_time"`    // No real column in the table
+		RawAliasedOrig     types.JSONText `db:"aliased"`         // No real column in the table
 		RawMemberOf        types.JSONText `db:"memberof"`        // No real column in the table
 		RawDefaultPPolicy  types.JSONText `db:"default_ppolicy"` // No real column in the table
 	}{}
@@ -2441,21 +4183,41 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 
 	if !r.server.defaultPPolicyDN.IsAnonymous() {
 		dppRDNNorm = r.server.defaultPPolicyDN.RDNNormStr()
-		dppParentDNNorm = r.server.defaultPPolicyDN.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix)
+		dppParentDNNorm = r.server.defaultPPolicyDN.ParentDN().DNNormStrWithoutSuffix(r.base)
 	}
 
-	if err := r.get(tx, findCredByDN, &dest, map[string]interface{}{
-		"rdn_norm":           dn.RDNNormStr(),
-		"parent_dn_norm":     dn.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
-		"dpp_rdn_norm":       dppRDNNorm,
-		"dpp_parent_dn_norm": dppParentDNNorm,
-	}); err != nil {
+	findCred := func(dn *DN) error {
+		if err := r.get(tx, r.findCredByDN, &dest, map[string]interface{}{
+			"rdn_norm":           dn.RDNNormStr(),
+			"parent_dn_norm":     dn.ParentDN().DNNormStrWithoutSuffix(r.base),
+			"dpp_rdn_norm":       dppRDNNorm,
+			"dpp_parent_dn_norm": dppParentDNNorm,
+		}); err != nil {
+			if isNoResult(err) {
+				// Return Invalid credentials (49) if no user
+				return NewInvalidCredentials()
+			}
+			return xerrors.Errorf("Failed to find cred by DN. dn_orig: %s, err: %w", dn.DNOrigStr(), err)
+		}
+		return nil
+	}
+
+	if err := findCred(dn); err != nil {
 		rollback(tx)
-		if isNoResult(err) {
-			// Return Invalid credentials (49) if no user
-			return NewInvalidCredentials()
+		return err
+	}
+
+	// Bind as the dereferenced entry if the entry is an alias and it's enabled
+	if len(dest.RawAliasedOrig) > 0 && r.server.config.DerefAliasBindCompare {
+		dn, err = r.derefAlias(tx, dn, false)
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+		if err := findCred(dn); err != nil {
+			rollback(tx)
+			return err
 		}
-		return xerrors.Errorf("Failed to find cred by DN. dn_orig: %s, err: %w", dn.DNOrigStr(), err)
 	}
 
 	attrsOrig := struct {
@@ -2498,7 +4260,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 
 		memberOfDN = make([]*DN, len(memberOf))
 		for i, v := range memberOf {
-			memberOfDN[i], err = r.server.NormalizeDN(resolveSuffix(r.server, v))
+			memberOfDN[i], err = r.server.NormalizeDN(resolveSuffix(r.base, v))
 			if err != nil {
 				rollback(tx)
 				return xerrors.Errorf("Failed to normalize memberOf. dn_orig: %s, err: %w", dn.DNOrigStr(), err)
@@ -2551,6 +4313,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 
 	fc := &FetchedCredential{
 		ID:                   dest.ID,
+		DN:                   dn,
 		Credential:           attrsOrig.Credentials,
 		MemberOf:             memberOfDN,
 		PPolicy:              &ppolicy,
@@ -2568,7 +4331,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 		isLDAPError := xerrors.As(callbackErr, &lerr)
 		if !isLDAPError || !lerr.IsInvalidCredentials() {
 			rollback(tx)
-			return err
+			return callbackErr
 		}
 
 		if lerr.IsAccountLocked() {
@@ -2598,7 +4361,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 			ftn, fto := timesToJSONAttrs(TIMESTAMP_NANO_FORMAT, currentPwdFailureTime)
 
 			// Don't rollback, commit the transaction.
-			if _, err := r.exec(tx, updateAfterBindFailureByDN, map[string]interface{}{
+			if _, err := r.exec(tx, r.updateAfterBindFailureByDN, map[string]interface{}{
 				"id":                dest.ID,
 				"lock_time_norm":    ltn,
 				"lock_time_orig":    lto,
@@ -2621,7 +4384,7 @@ func (r *HybridRepository) Bind(ctx context.Context, dn *DN, callback func(curre
 			}
 			n, o := nowTimeToJSONAttrs(TIMESTAMP_FORMAT)
 
-			if _, err := r.exec(tx2, updateAfterBindSuccessByDN, map[string]interface{}{
+			if _, err := r.exec(tx2, r.updateAfterBindSuccessByDN, map[string]interface{}{
 				"id":                  dest.ID,
 				"auth_timestamp_norm": n,
 				"auth_timestamp_orig": o,
@@ -2660,9 +4423,9 @@ func (r *HybridRepository) FindPPolicyByDN(ctx context.Context, dn *DN) (*PPolic
 		RawPPolicy types.JSONText `db:"ppolicy"` // No real column in the table
 	}{}
 
-	if err := r.get(tx, findPPolicyByDN, &dest, map[string]interface{}{
+	if err := r.get(tx, r.findPPolicyByDN, &dest, map[string]interface{}{
 		"rdn_norm":       dn.RDNNormStr(),
-		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.server.Suffix),
+		"parent_dn_norm": dn.ParentDN().DNNormStrWithoutSuffix(r.base),
 	}); err != nil {
 		if isNoResult(err) {
 			// Don't return error
@@ -2689,11 +4452,113 @@ func (r *HybridRepository) FindPPolicyByDN(ctx context.Context, dn *DN) (*PPolic
 	}
 }
 
+//////////////////////////////////////////
+// Referral
+//////////////////////////////////////////
+
+func (r *HybridRepository) FindReferral(ctx context.Context, dn *DN) (*FetchedReferral, error) {
+	tx, err := r.beginReadonly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	// The entry of the DN and its superiors until the suffix
+	var where strings.Builder
+	params := map[string]interface{}{
+		"referral": `$."objectClass" == "referral"`,
+	}
+	candidates := map[string]*DN{}
+
+	for d, i := dn, 0; d.Equal(r.suffix) || d.IsSubOf(r.suffix); d, i = d.ParentDN(), i+1 {
+		rdnKey := fmt.Sprintf("rdn_norm_%d", i)
+		parentKey := fmt.Sprintf("parent_dn_norm_%d", i)
+		params[rdnKey] = d.RDNNormStr()
+		params[parentKey] = d.ParentDN().DNNormStrWithoutSuffix(r.base)
+		candidates[d.RDNNormStr()+","+d.ParentDN().DNNormStrWithoutSuffix(r.base)] = d
+
+		if i > 0 {
+			where.WriteString(`
+			OR `)
+		}
+		where.WriteString(`(e.rdn_norm = :`)
+		where.WriteString(rdnKey)
+		where.WriteString(` AND dnc.dn_norm = :`)
+		where.WriteString(parentKey)
+		where.WriteString(`)`)
+	}
+	if where.Len() == 0 {
+		return nil, nil
+	}
+
+	q := fmt.Sprintf(`SELECT
+		e.rdn_norm,
+		dnc.dn_norm AS parent_dn_norm,
+		e.attrs_orig->'ref' AS ref
+	FROM
+		ldap_entry e
+		LEFT JOIN ldap_container dnc ON e.parent_id = dnc.id
+	WHERE
+		(%s)
+		AND e.attrs_norm @@ :referral
+	`, where.String())
+
+	rows, err := r.namedQuery(tx, q, params)
+	if err != nil {
+		return nil, xerrors.Errorf("Unexpected referral query error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+	defer rows.Close()
+
+	var ref *FetchedReferral
+
+	for rows.Next() {
+		fetched := struct {
+			RDNNorm      string         `db:"rdn_norm"`
+			ParentDNNorm string         `db:"parent_dn_norm"`
+			RawRef       types.JSONText `db:"ref"` // No real column in the table
+		}{}
+		if err := rows.StructScan(&fetched); err != nil {
+			return nil, xerrors.Errorf("Unexpected struct scan error. err: %w", err)
+		}
+
+		d, ok := candidates[fetched.RDNNorm+","+fetched.ParentDNNorm]
+		if !ok {
+			continue
+		}
+
+		// The nearest referral entry from the suffix is used since the subordinates are held by the other server
+		if ref != nil && len(ref.DN.RDNs) < len(d.RDNs) {
+			continue
+		}
+
+		var urls []string
+		if len(fetched.RawRef) > 0 {
+			if err := fetched.RawRef.Unmarshal(&urls); err != nil {
+				return nil, xerrors.Errorf("Failed to unmarshal ref. dn_orig: %s, err: %w", d.DNOrigStr(), err)
+			}
+		}
+		ref = &FetchedReferral{
+			DN:  d,
+			Ref: urls,
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.Errorf("Unexpected referral rows error. dn_norm: %s, err: %w", dn.DNNormStr(), err)
+	}
+
+	return ref, nil
+}
+
 //////////////////////////////////////////
 // Utilities
 //////////////////////////////////////////
 
 func (r *HybridRepository) begin(ctx context.Context) (*sqlx.Tx, error) {
+	// Join the transaction of the LDAP transaction
+	if tx, ok := r.joinedTx(ctx); ok {
+		return tx, nil
+	}
+
 	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{
 		Isolation: sql.LevelReadCommitted,
 	})
@@ -2722,6 +4587,29 @@ func (r *HybridRepository) beginReadonly(ctx context.Context) (*sqlx.Tx, error)
 	return tx, nil
 }
 
+// rollback rolls back the transaction unless it's joined to the LDAP transaction.
+// The joined transaction is rolled back by Transaction when the error is returned.
+func (r *HybridRepository) rollback(ctx context.Context, tx *sqlx.Tx) {
+	if _, ok := r.joinedTx(ctx); ok {
+		return
+	}
+	rollback(tx)
+}
+
+// commit commits the transaction unless it's joined to the LDAP transaction.
+// The joined transaction is committed by Transaction after all operations succeed.
+func (r *HybridRepository) commit(ctx context.Context, tx *sqlx.Tx) error {
+	if _, ok := r.joinedTx(ctx); ok {
+		return nil
+	}
+	return commit(tx)
+}
+
+func (r *HybridRepository) joinedTx(ctx context.Context) (*sqlx.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{r}).(*sqlx.Tx)
+	return tx, ok
+}
+
 func (r *HybridRepository) exec(tx *sqlx.Tx, stmt *sqlx.NamedStmt, params map[string]interface{}) (sql.Result, error) {
 	debugSQL(r.server.config.LogLevel, stmt.QueryString, params)
 	result, err := tx.NamedStmt(stmt).Exec(params)
@@ -2752,6 +4640,16 @@ func (r *HybridRepository) namedQuery(tx *sqlx.Tx, query string, params map[stri
 	return rows, err
 }
 
+func (r *HybridRepository) selectAll(tx *sqlx.Tx, stmt *sqlx.NamedStmt, dest interface{}, params map[string]interface{}) error {
+	debugSQL(r.server.config.LogLevel, stmt.QueryString, params)
+	err := tx.NamedStmt(stmt).Select(dest, params)
+	errorSQL(err, stmt.QueryString, params)
+	if isForeignKeyError(err) {
+		return NewRetryError(err)
+	}
+	return err
+}
+
 func (r *HybridRepository) get(tx *sqlx.Tx, stmt *sqlx.NamedStmt, dest interface{}, params map[string]interface{}) error {
 	debugSQL(r.server.config.LogLevel, stmt.QueryString, params)
 	err := tx.NamedStmt(stmt).Get(dest, params)
@@ -2801,14 +4699,24 @@ func errorSQL(err error, query string, params map[string]interface{}) {
 	}
 }
 
+// findSchema returns the attribute type for the filter.
+// If the attribute description has the options, it returns the subtype to filter by the options, e.g. cn;lang-ja.
+// Otherwise, the filter matches the subtypes too since attrs_norm contains the values of the subtypes.
 func findSchema(schemaMap *SchemaMap, attrName string) (*AttributeType, bool) {
-	var s *AttributeType
-	s, ok := schemaMap.AttributeType(attrName)
+	s, options, ok := schemaMap.AttributeDescription(attrName)
 	if !ok {
 		log.Printf("Unsupported filter attribute: %s", attrName)
 		return nil, false
 	}
-	return s, true
+	return s.Subtype(options), true
+}
+
+// escapeLike escapes meta characters used in PostgreSQL LIKE pattern.
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `%`, `\%`)
+	s = strings.ReplaceAll(s, `_`, `\_`)
+	return s
 }
 
 func escapeRegex(s string) string {
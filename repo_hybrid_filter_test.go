@@ -346,3 +346,348 @@ func createHybridFilterTestData() (ret []HybridFilterTestData) {
 		},
 	}
 }
+
+func TestHybridExtensibleMatchFilter(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix:          "dc=example,dc=com",
+		QueryTranslator: "default",
+	})
+	server.LoadSchema()
+
+	translator := HybridDBFilterTranslator{}
+
+	testcases := []struct {
+		Filter string
+		Where  string
+		Params map[string]interface{}
+	}{
+		{
+			"(cn:=Foo)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `$."cn" == "foo"`,
+			},
+		},
+		{
+			"(cn:caseIgnoreMatch:=Foo)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `$."cn" == "foo"`,
+			},
+		},
+		{
+			"(cn:2.5.13.5:=Foo)",
+			"e.attrs_orig @@ :0",
+			map[string]interface{}{
+				"0": `$."cn" == "Foo"`,
+			},
+		},
+		{
+			"(!(cn:caseExactMatch:=Foo))",
+			"e.attrs_orig @@ :0",
+			map[string]interface{}{
+				"0": `!($."cn" == "Foo")`,
+			},
+		},
+		{
+			"(uidNumber:1.2.840.113556.1.4.803:=6)",
+			"EXISTS (SELECT 1 FROM jsonb_array_elements_text(e.attrs_norm->:0) v WHERE (v::::bigint & :1) = :1)",
+			map[string]interface{}{
+				"0": "uidNumber",
+				"1": int64(6),
+			},
+		},
+		{
+			"(!(uidNumber:1.2.840.113556.1.4.804:=6))",
+			"NOT EXISTS (SELECT 1 FROM jsonb_array_elements_text(e.attrs_norm->:0) v WHERE (v::::bigint & :1) <> 0)",
+			map[string]interface{}{
+				"0": "uidNumber",
+				"1": int64(6),
+			},
+		},
+		{
+			"(ou:dn:=People)",
+			"(e.attrs_norm @@ :0 OR (e.rdn_norm || ',' || COALESCE(dnc.dn_norm, '')) ~ :1)",
+			map[string]interface{}{
+				"0": `$."ou" == "people"`,
+				"1": `(^|[,+])ou=people([,+]|$)`,
+			},
+		},
+		{
+			"(!(ou:dn:=People))",
+			"(e.attrs_norm @@ :0 AND (e.rdn_norm || ',' || COALESCE(dnc.dn_norm, '')) !~ :1)",
+			map[string]interface{}{
+				"0": `!($."ou" == "people")`,
+				"1": `(^|[,+])ou=people([,+]|$)`,
+			},
+		},
+		// Unsupported
+		{
+			"(cn:1.2.3.4:=Foo)",
+			"FALSE",
+			map[string]interface{}{},
+		},
+		{
+			"(cn:1.2.840.113556.1.4.803:=6)",
+			"FALSE",
+			map[string]interface{}{},
+		},
+		{
+			"(:caseExactMatch:=Foo)",
+			"FALSE",
+			map[string]interface{}{},
+		},
+	}
+
+	for i, tc := range testcases {
+		f, err := compileFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+
+		var sb strings.Builder
+		q := &HybridDBFilterTranslatorResult{
+			where:  &sb,
+			params: map[string]interface{}{},
+		}
+
+		if err := translator.translate(server.schemaMap, f, q, false); err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+		if q.where.String() != tc.Where || !reflect.DeepEqual(q.params, tc.Params) {
+			t.Errorf(`#%d: %s
+GOT:
+	where: %s
+	params: %v
+EXPECTED:
+	where: %s
+	params: %v`, i, tc.Filter, q.where.String(), q.params, tc.Where, tc.Params)
+		}
+	}
+}
+
+func TestHybridAttributeOptionsFilter(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix:          "dc=example,dc=com",
+		QueryTranslator: "default",
+	})
+	server.LoadSchema()
+
+	translator := HybridDBFilterTranslator{}
+
+	testcases := []struct {
+		Filter string
+		Where  string
+		Params map[string]interface{}
+	}{
+		// attrs_norm of the attribute type contains the values of the subtypes
+		{
+			"(cn=Foo)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `$."cn" == "foo"`,
+			},
+		},
+		{
+			"(CN;Lang-JA=Foo)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `$."cn;lang-ja" == "foo"`,
+			},
+		},
+		{
+			"(displayName;lang-en=Foo*)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `$."displayName;lang-en" starts with "foo"`,
+			},
+		},
+		{
+			"(!(cn;lang-ja=*))",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `!(exists($."cn;lang-ja"))`,
+			},
+		},
+		// The binary transfer option isn't a subtype
+		{
+			"(userCertificate;binary=*)",
+			"e.attrs_norm @@ :0",
+			map[string]interface{}{
+				"0": `exists($."userCertificate")`,
+			},
+		},
+		// Unsupported
+		{
+			"(cn;binary=Foo)",
+			"FALSE",
+			map[string]interface{}{},
+		},
+		{
+			"(cn;x-foo=Foo)",
+			"FALSE",
+			map[string]interface{}{},
+		},
+	}
+
+	for i, tc := range testcases {
+		f, err := compileFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+
+		var sb strings.Builder
+		q := &HybridDBFilterTranslatorResult{
+			where:  &sb,
+			params: map[string]interface{}{},
+		}
+
+		if err := translator.translate(server.schemaMap, f, q, false); err != nil {
+			t.Fatalf("Unexpected error on %d: %+v", i, err)
+		}
+		if q.where.String() != tc.Where || !reflect.DeepEqual(q.params, tc.Params) {
+			t.Errorf(`#%d: %s
+GOT:
+	where: %s
+	params: %v
+EXPECTED:
+	where: %s
+	params: %v`, i, tc.Filter, q.where.String(), q.params, tc.Where, tc.Params)
+		}
+	}
+}
+
+func TestHybridDerefScope(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix:          "dc=example,dc=com",
+		QueryTranslator: "default",
+	})
+	server.LoadSchema()
+	server.Suffix, _ = ParseDN(server.schemaMap, "dc=example,dc=com")
+
+	r := &HybridRepository{
+		DBRepository: &DBRepository{
+			server: server,
+			suffix: server.Suffix,
+			base:   server.Suffix,
+		},
+	}
+
+	baseDN, _ := server.NormalizeDN("ou=Groups,dc=example,dc=com")
+	derefDN, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+
+	for i, test := range []struct {
+		scope  int
+		params map[string]interface{}
+		subs   []string
+	}{
+		{
+			scope: 1,
+			params: map[string]interface{}{
+				"parent_dn_norm":         "ou=groups",
+				"deref_rdn_norm_0":       "uid=user1",
+				"deref_parent_dn_norm_0": "ou=users",
+			},
+			subs: []string{"OR (e.rdn_norm = :deref_rdn_norm_0 AND dnc.dn_norm = :deref_parent_dn_norm_0)", "AND e.id != ALL(:alias_ids ::::BIGINT[])"},
+		},
+		{
+			scope: 2,
+			params: map[string]interface{}{
+				"rdn_norm":               "ou=groups",
+				"parent_dn_norm":         "",
+				"dn_norm":                "ou=groups",
+				"deref_rdn_norm_0":       "uid=user1",
+				"deref_parent_dn_norm_0": "ou=users",
+				"deref_dn_norm_0":        "uid=user1,ou=users",
+			},
+			subs: []string{"OR (e.rdn_norm = :deref_rdn_norm_0 AND dnc.dn_norm = :deref_parent_dn_norm_0)", "c.dn_norm = :deref_dn_norm_0", "AND e.id != ALL(:alias_ids ::::BIGINT[])"},
+		},
+	} {
+		var where strings.Builder
+		params := map[string]interface{}{}
+		option := &SearchOption{
+			Scope:       test.scope,
+			ManageDsaIT: true,
+			aliasIDs:    []int64{10},
+			derefDNs:    []*DN{derefDN},
+		}
+		r.collectScopeWhereSQL(baseDN, option, &where, params)
+
+		if !strings.HasPrefix(where.String(), "(") {
+			t.Errorf("#%d: the scope isn't grouped. got: %s", i, where.String())
+		}
+		for _, sub := range test.subs {
+			if !strings.Contains(where.String(), sub) {
+				t.Errorf("#%d: expected %q in the scope. got: %s", i, sub, where.String())
+			}
+		}
+		if _, ok := params["alias_ids"]; !ok {
+			t.Errorf("#%d: expected alias_ids param", i)
+		}
+		delete(params, "alias_ids")
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("#%d: unexpected params\ngot: %v\nexpected: %v", i, params, test.params)
+		}
+	}
+}
+
+func TestHybridReferralSubtreeScope(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix:          "dc=example,dc=com",
+		QueryTranslator: "default",
+	})
+	server.LoadSchema()
+	server.Suffix, _ = ParseDN(server.schemaMap, "dc=example,dc=com")
+
+	r := &HybridRepository{
+		DBRepository: &DBRepository{
+			server: server,
+			suffix: server.Suffix,
+			base:   server.Suffix,
+		},
+	}
+
+	baseDN, _ := server.NormalizeDN("ou=Users,dc=example,dc=com")
+
+	for i, test := range []struct {
+		scope       int
+		manageDsaIT bool
+		excluded    bool
+	}{
+		{scope: 0, manageDsaIT: false, excluded: false},
+		{scope: 1, manageDsaIT: false, excluded: true},
+		{scope: 2, manageDsaIT: false, excluded: true},
+		{scope: 3, manageDsaIT: false, excluded: true},
+		{scope: 2, manageDsaIT: true, excluded: false},
+	} {
+		var where strings.Builder
+		params := map[string]interface{}{}
+		r.collectScopeWhereSQL(baseDN, &SearchOption{Scope: test.scope, ManageDsaIT: test.manageDsaIT}, &where, params)
+
+		_, ok := params["referral"]
+		if ok != test.excluded || strings.Contains(where.String(), "NOT EXISTS") != test.excluded {
+			t.Errorf("#%d: unexpected exclusion of the referral subtree. got: %s", i, where.String())
+		}
+	}
+}
+
+func TestSearchOptionDerefAliases(t *testing.T) {
+	for i, test := range []struct {
+		deref          int
+		inSearching    bool
+		findingBaseObj bool
+	}{
+		{message.SearchRequetDerefAliasesNeverDerefAliases, false, false},
+		{message.SearchRequetDerefAliasesDerefInSearching, true, false},
+		{message.SearchRequetDerefAliasesDerefFindingBaseObj, false, true},
+		{message.SearchRequetDerefAliasesDerefAlways, true, true},
+	} {
+		option := &SearchOption{DerefAliases: test.deref}
+		if option.IsDerefInSearching() != test.inSearching {
+			t.Errorf("#%d: unexpected IsDerefInSearching. got: %v", i, option.IsDerefInSearching())
+		}
+		if option.IsDerefFindingBaseObj() != test.findingBaseObj {
+			t.Errorf("#%d: unexpected IsDerefFindingBaseObj. got: %v", i, option.IsDerefFindingBaseObj())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// NamingContextRepository routes the operations to the repository of the naming context by the DN.
+// Each naming context has own repository and DB connections even if it shares the DB schema,
+// so one operation can't span several naming contexts.
+type NamingContextRepository struct {
+	server *Server
+	repos  []*HybridRepository
+}
+
+const namingContextTxnContextKey contextKey = "namingContextTxn"
+
+// namingContextTxn holds the repository which the LDAP transaction writes into.
+type namingContextTxn struct {
+	repo *HybridRepository
+}
+
+func (r *NamingContextRepository) Init() error {
+	for _, repo := range r.repos {
+		if err := repo.Init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repoOf returns the repository of the naming context which holds the DN.
+func (r *NamingContextRepository) repoOf(dn *DN) (*HybridRepository, bool) {
+	nc := r.server.NamingContextOf(dn)
+	if nc == nil {
+		return nil, false
+	}
+	for _, repo := range r.repos {
+		if repo.suffix.Equal(nc.Suffix) {
+			return repo, true
+		}
+	}
+	return nil, false
+}
+
+// writableRepoOf returns the repository for the write operation.
+// The write operations in one LDAP transaction must be in the same naming context
+// since the transaction can't be committed atomically across the DB connections.
+func (r *NamingContextRepository) writableRepoOf(ctx context.Context, dn *DN) (*HybridRepository, error) {
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return nil, NewNoSuchObject()
+	}
+
+	if txn, ok := ctx.Value(namingContextTxnContextKey).(*namingContextTxn); ok {
+		if txn.repo == nil {
+			txn.repo = repo
+		} else if txn.repo != repo {
+			return nil, NewAffectsMultipleDSAs()
+		}
+	}
+	return repo, nil
+}
+
+func (r *NamingContextRepository) Bind(ctx context.Context, dn *DN, callback func(current *FetchedCredential) error) error {
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return NewInvalidCredentials()
+	}
+	return repo.Bind(ctx, dn, callback)
+}
+
+func (r *NamingContextRepository) FindPPolicyByDN(ctx context.Context, dn *DN) (*PPolicy, error) {
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return nil, NewNoSuchObject()
+	}
+	return repo.FindPPolicyByDN(ctx, dn)
+}
+
+func (r *NamingContextRepository) Search(ctx context.Context, baseDN *DN, option *SearchOption, handler func(entry *SearchEntry) error) (int32, int64, error) {
+	repo, ok := r.repoOf(baseDN)
+	if !ok {
+		// Same as the parents of the suffix
+		return 0, 0, nil
+	}
+	return repo.Search(ctx, baseDN, option, handler)
+}
+
+func (r *NamingContextRepository) Update(ctx context.Context, dn *DN, callback func(current *ModifyEntry) error) error {
+	repo, err := r.writableRepoOf(ctx, dn)
+	if err != nil {
+		return err
+	}
+	return repo.Update(ctx, dn, callback)
+}
+
+func (r *NamingContextRepository) UpdateDN(ctx context.Context, oldDN, newDN *DN, deleteOldRDN bool) error {
+	repo, err := r.writableRepoOf(ctx, oldDN)
+	if err != nil {
+		return err
+	}
+
+	// Moving the entry to another naming context is not supported
+	if newRepo, ok := r.repoOf(newDN); !ok || newRepo != repo {
+		return NewAffectsMultipleDSAs()
+	}
+	return repo.UpdateDN(ctx, oldDN, newDN, deleteOldRDN)
+}
+
+func (r *NamingContextRepository) Insert(ctx context.Context, entry *AddEntry) (int64, error) {
+	repo, err := r.writableRepoOf(ctx, entry.DN())
+	if err != nil {
+		return 0, err
+	}
+	return repo.Insert(ctx, entry)
+}
+
+func (r *NamingContextRepository) DeleteByDN(ctx context.Context, dn *DN) error {
+	repo, err := r.writableRepoOf(ctx, dn)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteByDN(ctx, dn)
+}
+
+func (r *NamingContextRepository) DeleteTreeByDN(ctx context.Context, dn *DN) error {
+	repo, err := r.writableRepoOf(ctx, dn)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteTreeByDN(ctx, dn)
+}
+
+// Transaction begins the transaction only on the repository of the naming context of the DN.
+// The atomicity across the naming contexts isn't guaranteed since they have own DB connections,
+// so the write operations to the other naming contexts fail with affectsMultipleDSAs.
+func (r *NamingContextRepository) Transaction(ctx context.Context, dn *DN, callback func(ctx context.Context) error) error {
+	if dn == nil {
+		return callback(ctx)
+	}
+
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return NewNoSuchObject()
+	}
+
+	ctx = context.WithValue(ctx, namingContextTxnContextKey, &namingContextTxn{repo: repo})
+	return repo.Transaction(ctx, dn, callback)
+}
+
+func (r *NamingContextRepository) Compare(ctx context.Context, dn *DN, value *SchemaValue) (bool, error) {
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return false, NewNoSuchObject()
+	}
+	return repo.Compare(ctx, dn, value)
+}
+
+// ListenEntryChanges listens the changes of all naming contexts.
+// If one of the listeners stops, the others are stopped too.
+func (r *NamingContextRepository) ListenEntryChanges(ctx context.Context, handler func(change *EntryChange)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(r.repos))
+	for _, repo := range r.repos {
+		go func(repo *HybridRepository) {
+			errs <- repo.ListenEntryChanges(ctx, handler)
+		}(repo)
+	}
+
+	err := <-errs
+	cancel()
+	for i := 1; i < len(r.repos); i++ {
+		<-errs
+	}
+	return err
+}
+
+func (r *NamingContextRepository) FindContextCSN(ctx context.Context, baseDN *DN) (*ContextCSN, error) {
+	repo, ok := r.repoOf(baseDN)
+	if !ok {
+		return &ContextCSN{}, nil
+	}
+	return repo.FindContextCSN(ctx, baseDN)
+}
+
+func (r *NamingContextRepository) FindReferral(ctx context.Context, dn *DN) (*FetchedReferral, error) {
+	repo, ok := r.repoOf(dn)
+	if !ok {
+		return nil, nil
+	}
+	return repo.FindReferral(ctx, dn)
+}
+
+func (r *NamingContextRepository) FindEntryChanges(ctx context.Context, baseDN *DN, fromCSN string, to *ContextCSN) ([]*EntryChange, bool, error) {
+	repo, ok := r.repoOf(baseDN)
+	if !ok {
+		return nil, false, nil
+	}
+	return repo.FindEntryChanges(ctx, baseDN, fromCSN, to)
+}
+
+func (r *NamingContextRepository) PruneEntryChanges(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	for _, repo := range r.repos {
+		n, err := repo.PruneEntryChanges(ctx, before)
+		if err != nil {
+			return count, err
+		}
+		count += n
+	}
+	return count, nil
+}
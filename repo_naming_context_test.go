@@ -0,0 +1,131 @@
+//go:build test
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func newTestNamingContextRepository(t *testing.T) (*Server, *NamingContextRepository) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners:partners"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	repo := &NamingContextRepository{
+		server: server,
+	}
+	for _, nc := range server.NamingContexts() {
+		repo.repos = append(repo.repos, &HybridRepository{
+			DBRepository: &DBRepository{
+				server: server,
+				suffix: nc.Suffix,
+				base:   nc.Base,
+				schema: nc.DBSchema,
+			},
+		})
+	}
+	return server, repo
+}
+
+func TestNamingContextRepositoryRouting(t *testing.T) {
+	server, repo := newTestNamingContextRepository(t)
+
+	for i, tc := range []struct {
+		dn       string
+		expected int
+	}{
+		{"uid=user1,ou=Users,dc=example,dc=com", 0},
+		{"o=partners", 1},
+		{"uid=user1,o=partners", 1},
+		{"o=other", -1},
+	} {
+		dn, _ := server.NormalizeDN(tc.dn)
+		r, ok := repo.repoOf(dn)
+		if tc.expected < 0 {
+			if ok {
+				t.Errorf("#%d: unexpected repository: %s", i, r.suffix.DNNormStr())
+			}
+			continue
+		}
+		if !ok || r != repo.repos[tc.expected] {
+			t.Errorf("#%d: unexpected repository for %s", i, tc.dn)
+		}
+	}
+}
+
+func TestHybridRepositoryIsInNamingContext(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema: "public",
+		Suffixes: []string{"dc=example,dc=com", "o=partners"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	repos := []*HybridRepository{}
+	for _, nc := range server.NamingContexts() {
+		repos = append(repos, &HybridRepository{
+			DBRepository: &DBRepository{
+				server: server,
+				suffix: nc.Suffix,
+				base:   nc.Base,
+				schema: nc.DBSchema,
+			},
+		})
+	}
+
+	// The DNs in the shared change log keep the RDN of the suffix
+	for i, tc := range []struct {
+		dnOrig   string
+		expected int
+	}{
+		{"dc=example,", 0},
+		{"uid=user1,ou=Users,dc=example", 0},
+		{"o=Partners,", 1},
+		{"uid=user1,o=Partners", 1},
+	} {
+		for j, r := range repos {
+			if got := r.isInNamingContext(&EntryChange{DNOrig: tc.dnOrig}); got != (j == tc.expected) {
+				t.Errorf("#%d: unexpected result of %s for %s: %v", i, r.suffix.DNNormStr(), tc.dnOrig, got)
+			}
+		}
+	}
+}
+
+func TestNamingContextRepositoryAffectsMultipleDSAs(t *testing.T) {
+	server, repo := newTestNamingContextRepository(t)
+
+	exampleDN, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+	partnersDN, _ := server.NormalizeDN("uid=user1,o=partners")
+
+	// Moving the entry to another naming context
+	err := repo.UpdateDN(context.Background(), exampleDN, partnersDN, true)
+	if lerr, ok := err.(*LDAPError); !ok || lerr.Code != ldap.LDAPResultAffectsMultipleDSAs {
+		t.Errorf("Expected affectsMultipleDSAs, got: %v", err)
+	}
+
+	// The write operations in one LDAP transaction are restricted to one naming context
+	ctx := context.WithValue(context.Background(), namingContextTxnContextKey, &namingContextTxn{})
+	if r, err := repo.writableRepoOf(ctx, exampleDN); err != nil || r != repo.repos[0] {
+		t.Errorf("Unexpected repository: %v, err: %v", r, err)
+	}
+	if r, err := repo.writableRepoOf(ctx, exampleDN); err != nil || r != repo.repos[0] {
+		t.Errorf("Unexpected repository: %v, err: %v", r, err)
+	}
+	_, err = repo.writableRepoOf(ctx, partnersDN)
+	if lerr, ok := err.(*LDAPError); !ok || lerr.Code != ldap.LDAPResultAffectsMultipleDSAs {
+		t.Errorf("Expected affectsMultipleDSAs, got: %v", err)
+	}
+
+	// Out of the suffixes
+	otherDN, _ := server.NormalizeDN("uid=user1,o=other")
+	_, err = repo.writableRepoOf(context.Background(), otherDN)
+	if lerr, ok := err.(*LDAPError); !ok || !lerr.IsNoSuchObjectError() {
+		t.Errorf("Expected noSuchObject, got: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The vendorName of the root DSE
+// https://datatracker.ietf.org/doc/html/rfc3045
+const vendorName = "OpenStandia"
+
+// Feature OID for requesting all operational attributes with "+"
+// https://datatracker.ietf.org/doc/html/rfc3673
+const AllOperationalAttributesFeatureOID = "1.3.6.1.4.1.4203.1.5.1"
+
+// rootDSERegistry holds the OIDs listed in the root DSE with the function
+// which returns true if it can be used with the server configuration.
+type rootDSERegistry map[string]func(s *Server) bool
+
+var (
+	supportedControls   = rootDSERegistry{}
+	supportedExtensions = rootDSERegistry{}
+	supportedFeatures   = rootDSERegistry{}
+)
+
+// RegisterSupportedControl adds the control into supportedControl of the root DSE.
+// The control is listed if isAvailable is nil or returns true.
+func RegisterSupportedControl(oid string, isAvailable func(s *Server) bool) {
+	supportedControls[oid] = isAvailable
+}
+
+// RegisterSupportedExtension adds the extended operation into supportedExtension of the root DSE.
+// The extended operation is listed if isAvailable is nil or returns true.
+func RegisterSupportedExtension(oid string, isAvailable func(s *Server) bool) {
+	supportedExtensions[oid] = isAvailable
+}
+
+// RegisterSupportedFeature adds the feature into supportedFeatures of the root DSE.
+// The feature is listed if isAvailable is nil or returns true.
+func RegisterSupportedFeature(oid string, isAvailable func(s *Server) bool) {
+	supportedFeatures[oid] = isAvailable
+}
+
+// available returns the sorted OIDs which can be used with the server configuration.
+func (r rootDSERegistry) available(s *Server) []string {
+	oids := []string{}
+	for k, v := range r {
+		if v == nil || v(s) {
+			oids = append(oids, k)
+		}
+	}
+	sort.Strings(oids)
+	return oids
+}
+
+// vendorVersion returns the build version with the revision, or empty if it isn't set by the build.
+func vendorVersion() string {
+	if version == "" {
+		return ""
+	}
+	if revision == "" {
+		return version
+	}
+	return fmt.Sprintf("%s (rev: %s)", version, revision)
+}
+
+// rootDSEAttrs returns the attributes of the root DSE built from the registries and the server configuration.
+// The contextCSN is added by the caller since it requires the DB access.
+func rootDSEAttrs(s *Server) map[string][]string {
+	namingContexts := make([]string, len(s.NamingContexts()))
+	for i, nc := range s.NamingContexts() {
+		namingContexts[i] = nc.Suffix.DNOrigStr()
+	}
+
+	attrs := map[string][]string{
+		"objectClass":          {"top"},
+		"subschemaSubentry":    {"cn=Subschema"},
+		"namingContexts":       namingContexts,
+		"supportedLDAPVersion": {"3"},
+		"vendorName":           {vendorName},
+	}
+
+	if v := vendorVersion(); v != "" {
+		attrs["vendorVersion"] = []string{v}
+	}
+	if v := supportedControls.available(s); len(v) > 0 {
+		attrs["supportedControl"] = v
+	}
+	if v := supportedExtensions.available(s); len(v) > 0 {
+		attrs["supportedExtension"] = v
+	}
+	if v := supportedFeatures.available(s); len(v) > 0 {
+		attrs["supportedFeatures"] = v
+	}
+	if v := supportedSASLMechanisms(s); len(v) > 0 {
+		attrs["supportedSASLMechanisms"] = v
+	}
+	if len(s.config.AltServers) > 0 {
+		attrs["altServer"] = s.config.AltServers
+	}
+
+	return attrs
+}
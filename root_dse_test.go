@@ -0,0 +1,102 @@
+//go:build test
+
+package main
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestRootDSERegistry(t *testing.T) {
+	registry := rootDSERegistry{
+		"1.3.6.1.1.21.1": nil,
+		"1.3.6.1.1.12": func(s *Server) bool {
+			return true
+		},
+		"1.3.6.1.4.1.1466.20037": func(s *Server) bool {
+			return s.tlsConfig != nil
+		},
+	}
+
+	server := NewServer(&ServerConfig{})
+	if got := registry.available(server); !reflect.DeepEqual(got, []string{"1.3.6.1.1.12", "1.3.6.1.1.21.1"}) {
+		t.Errorf("Unexpected OIDs without TLS: %v", got)
+	}
+
+	server.tlsConfig = &tls.Config{}
+	if got := registry.available(server); !reflect.DeepEqual(got, []string{"1.3.6.1.1.12", "1.3.6.1.1.21.1", "1.3.6.1.4.1.1466.20037"}) {
+		t.Errorf("Unexpected OIDs with TLS: %v", got)
+	}
+}
+
+func TestRootDSEAttrs(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		DBSchema:   "public",
+		Suffixes:   []string{"dc=example,dc=com", "o=partners:partners"},
+		AltServers: []string{"ldap://ldap2.example.com"},
+	})
+	server.LoadSchema()
+	server.initNamingContexts()
+
+	attrs := rootDSEAttrs(server)
+
+	if !reflect.DeepEqual(attrs["namingContexts"], []string{"dc=example,dc=com", "o=partners"}) {
+		t.Errorf("Unexpected namingContexts: %v", attrs["namingContexts"])
+	}
+	if !reflect.DeepEqual(attrs["altServer"], []string{"ldap://ldap2.example.com"}) {
+		t.Errorf("Unexpected altServer: %v", attrs["altServer"])
+	}
+	if !reflect.DeepEqual(attrs["vendorName"], []string{vendorName}) {
+		t.Errorf("Unexpected vendorName: %v", attrs["vendorName"])
+	}
+	if _, ok := attrs["vendorVersion"]; ok && version == "" {
+		t.Errorf("Unexpected vendorVersion without the build version: %v", attrs["vendorVersion"])
+	}
+	if !reflect.DeepEqual(attrs["supportedFeatures"], []string{AllOperationalAttributesFeatureOID}) {
+		t.Errorf("Unexpected supportedFeatures: %v", attrs["supportedFeatures"])
+	}
+
+	// All controls and extended operations register themselves
+	controls := NewStringSet(attrs["supportedControl"]...)
+	for _, oid := range []string{PagedResultsControlOID, SortRequestControlOID, VLVRequestControlOID, SyncRequestControlOID, ManageDsaITControlOID} {
+		if !controls.Contains(oid) {
+			t.Errorf("Expected supportedControl: %s, got: %v", oid, attrs["supportedControl"])
+		}
+	}
+
+	extensions := NewStringSet(attrs["supportedExtension"]...)
+	for _, oid := range []string{StartTransactionOID, EndTransactionOID, CancelOID} {
+		if !extensions.Contains(oid) {
+			t.Errorf("Expected supportedExtension: %s, got: %v", oid, attrs["supportedExtension"])
+		}
+	}
+	// StartTLS isn't available without the certificate
+	if extensions.Contains("1.3.6.1.4.1.1466.20037") {
+		t.Errorf("Unexpected StartTLS: %v", attrs["supportedExtension"])
+	}
+}
+
+func TestVendorVersion(t *testing.T) {
+	defer func(v, r string) {
+		version, revision = v, r
+	}(version, revision)
+
+	testcases := []struct {
+		version  string
+		revision string
+		expected string
+	}{
+		{"", "", ""},
+		{"", "abc1234", ""},
+		{"v1.2.0", "", "v1.2.0"},
+		{"v1.2.0", "abc1234", "v1.2.0 (rev: abc1234)"},
+	}
+
+	for i, tc := range testcases {
+		version, revision = tc.version, tc.revision
+		if got := vendorVersion(); got != tc.expected {
+			t.Errorf("#%d: unexpected vendorVersion. expected: %q, got: %q", i, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+)
+
+// SASLMechanism is the server side implementation of the SASL mechanism used by SASL bind.
+type SASLMechanism interface {
+	// Name returns the mechanism name listed in supportedSASLMechanisms (e.g. PLAIN).
+	Name() string
+
+	// IsAvailable returns true if the mechanism can be used with the server configuration.
+	IsAvailable(s *Server) bool
+
+	// Step processes the credentials sent by the client.
+	// The state is the one returned by the previous step, or nil at the first step.
+	// It returns the next state and the challenge to continue the exchange,
+	// or nil state when the authentication is completed. The challenge of the completed step
+	// is sent with the success response as the additional data.
+	Step(ctx context.Context, s *Server, m *ldap.Message, state interface{}, cred []byte) (interface{}, []byte, error)
+}
+
+var saslMechanisms = map[string]SASLMechanism{}
+
+// RegisterSASLMechanism adds the mechanism into the registry used by SASL bind.
+func RegisterSASLMechanism(mech SASLMechanism) {
+	saslMechanisms[strings.ToUpper(mech.Name())] = mech
+}
+
+func getSASLMechanism(s *Server, name string) (SASLMechanism, bool) {
+	mech, ok := saslMechanisms[strings.ToUpper(name)]
+	if !ok || !mech.IsAvailable(s) {
+		return nil, false
+	}
+	return mech, true
+}
+
+// supportedSASLMechanisms returns the sorted names of the available mechanisms.
+func supportedSASLMechanisms(s *Server) []string {
+	names := []string{}
+	for k, v := range saslMechanisms {
+		if v.IsAvailable(s) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SASLBindState is the in-progress state of multi-step SASL bind kept per connection.
+type SASLBindState struct {
+	Mechanism string
+	State     interface{}
+}
+
+func getSASLBindState(m *ldap.Message) *SASLBindState {
+	session := getSession(m)
+	if state, ok := session["sasl"]; ok {
+		return state.(*SASLBindState)
+	}
+	return nil
+}
+
+func saveSASLBindState(m *ldap.Message, state *SASLBindState) {
+	session := getSession(m)
+	session["sasl"] = state
+}
+
+func clearSASLBindState(m *ldap.Message) {
+	session := getSession(m)
+	delete(session, "sasl")
+}
+
+// resolveAuthcID returns the DN of the authentication identity.
+// "dn:" prefixed identity is used as the DN directly, otherwise the entry is found by the configured filter.
+func (s *Server) resolveAuthcID(ctx context.Context, authcID string) (*DN, error) {
+	if strings.HasPrefix(authcID, "dn:") {
+		dn, err := s.NormalizeDN(strings.TrimPrefix(authcID, "dn:"))
+		if err != nil {
+			log.Printf("info: Bind failed - Invalid authcid DN: %s, err: %s", authcID, err)
+			return nil, NewInvalidCredentials()
+		}
+		return dn, nil
+	}
+
+	if s.config.SASLAuthcIDFilter == "" {
+		log.Printf("info: Bind failed - No sasl-authcid-filter for authcid: %s", authcID)
+		return nil, NewInvalidCredentials()
+	}
+
+	user := strings.TrimPrefix(authcID, "u:")
+
+	return s.findDNByFilter(ctx, strings.ReplaceAll(s.config.SASLAuthcIDFilter, "%u", goldap.EscapeFilter(user)))
+}
+
+// checkAuthzID validates the authorization identity requested by the client.
+// It must be same as the authentication identity if specified.
+func (s *Server) checkAuthzID(authzID string, dn *DN) error {
+	if authzID == "" {
+		return nil
+	}
+
+	authzDN, err := s.NormalizeDN(strings.TrimPrefix(authzID, "dn:"))
+	if err != nil || !authzDN.Equal(dn) {
+		log.Printf("info: Bind failed - Unauthorized authzId: %s, dn_norm: %s", authzID, dn.DNNormStr())
+		return NewInsufficientAccess()
+	}
+	return nil
+}
+
+// findDNByFilter returns the DN of the only entry matched the filter under the suffixes.
+func (s *Server) findDNByFilter(ctx context.Context, filter string) (*DN, error) {
+	f, err := compileFilter(filter)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to compile the mapping filter: %s, err: %w", filter, err)
+	}
+
+	var cursor int64
+	var dnOrig []string
+
+	for _, nc := range s.NamingContexts() {
+		cursor = 0
+		_, _, err = s.Repo().Search(ctx, nc.Suffix, &SearchOption{
+			Scope:    2, // sub
+			Filter:   f,
+			PageSize: 2,
+			Cursor:   &cursor,
+		}, func(entry *SearchEntry) error {
+			dnOrig = append(dnOrig, entry.DNOrigWithSuffix())
+			return nil
+		})
+		if err != nil {
+			var lerr *LDAPError
+			if ok := xerrors.As(err, &lerr); ok && lerr.IsNoSuchObjectError() {
+				continue
+			}
+			return nil, err
+		}
+	}
+
+	if len(dnOrig) != 1 {
+		log.Printf("info: Bind failed - The mapping filter must match only one entry. filter: %s, count: %d", filter, len(dnOrig))
+		return nil, NewInvalidCredentials()
+	}
+
+	return s.NormalizeDN(dnOrig[0])
+}
+
+// findCredentialsByDN returns the userPassword values of the entry.
+func (s *Server) findCredentialsByDN(ctx context.Context, dn *DN) ([]string, error) {
+	f, err := compileFilter("(objectClass=*)")
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor int64
+	var creds []string
+
+	_, _, err = s.Repo().Search(ctx, dn, &SearchOption{
+		Scope:    0, // base
+		Filter:   f,
+		PageSize: 1,
+		Cursor:   &cursor,
+	}, func(entry *SearchEntry) error {
+		if _, v, ok := entry.GetAttrOrig("userPassword"); ok {
+			creds = v
+		}
+		return nil
+	})
+	if err != nil {
+		var lerr *LDAPError
+		if ok := xerrors.As(err, &lerr); ok && lerr.IsNoSuchObjectError() {
+			return nil, NewInvalidCredentials()
+		}
+		return nil, err
+	}
+
+	return creds, nil
+}
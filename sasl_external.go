@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func init() {
+	RegisterSASLMechanism(&SASLExternal{})
+}
+
+// SASLExternal authenticates the client by the TLS client certificate.
+// https://datatracker.ietf.org/doc/html/rfc4422#appendix-A
+type SASLExternal struct{}
+
+func (x *SASLExternal) Name() string {
+	return "EXTERNAL"
+}
+
+// IsAvailable returns true if the client certificates are verified by the CA.
+func (x *SASLExternal) IsAvailable(s *Server) bool {
+	return s.tlsConfig != nil && s.config.TLSCACertFile != ""
+}
+
+func (x *SASLExternal) Step(ctx context.Context, s *Server, m *ldap.Message, state interface{}, cred []byte) (interface{}, []byte, error) {
+	tlsConn, ok := m.Client.GetConn().(*tls.Conn)
+	if !ok {
+		log.Printf("info: Bind failed - SASL/EXTERNAL requires TLS")
+		return nil, nil, NewInappropriateAuthentication("SASL/EXTERNAL requires TLS")
+	}
+
+	connState := tlsConn.ConnectionState()
+	if len(connState.VerifiedChains) == 0 || len(connState.PeerCertificates) == 0 {
+		log.Printf("info: Bind failed - No verified client certificate")
+		return nil, nil, NewInappropriateAuthentication("no verified client certificate")
+	}
+
+	dn, err := s.mapCertificateToDN(ctx, connState.PeerCertificates[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The client can request the authorization identity
+	if err := s.checkAuthzID(string(cred), dn); err != nil {
+		return nil, nil, err
+	}
+
+	if dn.Equal(s.GetRootDN()) {
+		saveAuthencatedDNAsRoot(m, dn)
+		return nil, nil, nil
+	}
+
+	err = s.Repo().Bind(ctx, dn, func(current *FetchedCredential) error {
+		if isLocked(current) {
+			log.Printf("info: Bind failed - Account locked. dn_norm: %s", dn.DNNormStr())
+			return NewAccountLocked()
+		}
+
+		saveAuthencatedDN(m, dn, current.MemberOf)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nil, nil, nil
+}
+
+// certificateIdentities returns the identities of the certificate by the configured source.
+func certificateIdentities(cert *x509.Certificate, source string) []string {
+	switch strings.ToLower(source) {
+	case "san-email":
+		return cert.EmailAddresses
+	case "san-dns":
+		return cert.DNSNames
+	case "san-uri":
+		ids := make([]string, len(cert.URIs))
+		for i, v := range cert.URIs {
+			ids[i] = v.String()
+		}
+		return ids
+	}
+	return []string{cert.Subject.String()}
+}
+
+// mapCertificateToDN resolves the entry DN from the certificate.
+// The identity is rewritten by the regex if configured, then it's used as the DN directly
+// or used for finding the entry by the filter.
+func (s *Server) mapCertificateToDN(ctx context.Context, cert *x509.Certificate) (*DN, error) {
+	for _, id := range certificateIdentities(cert, s.config.SASLExternalIdentity) {
+		if s.saslExternalRegex != nil {
+			if !s.saslExternalRegex.MatchString(id) {
+				log.Printf("debug: Unmatched certificate identity: %s", id)
+				continue
+			}
+			id = s.saslExternalRegex.ReplaceAllString(id, s.config.SASLExternalReplacement)
+		}
+
+		if s.config.SASLExternalFilter != "" {
+			return s.findDNByFilter(ctx, strings.ReplaceAll(s.config.SASLExternalFilter, "%s", goldap.EscapeFilter(id)))
+		}
+
+		dn, err := s.NormalizeDN(id)
+		if err != nil {
+			log.Printf("info: Bind failed - Invalid DN mapped from the certificate: %s, err: %s", id, err)
+			return nil, NewInvalidCredentials()
+		}
+		return dn, nil
+	}
+
+	log.Printf("info: Bind failed - No certificate identity mapped to DN. subject: %s", cert.Subject.String())
+	return nil, NewInvalidCredentials()
+}
@@ -0,0 +1,109 @@
+//go:build test
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"regexp"
+	"testing"
+
+	"github.com/openstandia/goldap/message"
+)
+
+func TestMapCertificateToDN(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "user1",
+			OrganizationalUnit: []string{"Users"},
+			Organization:       []string{"Example"},
+		},
+		EmailAddresses: []string{"user1@example.com"},
+	}
+
+	testcases := []struct {
+		Identity    string
+		Regex       string
+		Replacement string
+		Expected    string
+		Err         bool
+	}{
+		{
+			"subject",
+			"",
+			"",
+			"cn=user1,ou=users,o=example",
+			false,
+		},
+		{
+			"subject",
+			"^CN=([^,]+),.*$",
+			"uid=$1,ou=Users,dc=example,dc=com",
+			"uid=user1,ou=users,dc=example,dc=com",
+			false,
+		},
+		{
+			"san-email",
+			"^([^@]+)@example\\.com$",
+			"uid=$1,ou=Users,dc=example,dc=com",
+			"uid=user1,ou=users,dc=example,dc=com",
+			false,
+		},
+		{
+			"san-email",
+			"^([^@]+)@example\\.org$",
+			"uid=$1,ou=Users,dc=example,dc=com",
+			"",
+			true,
+		},
+		{
+			"san-dns",
+			"",
+			"",
+			"",
+			true,
+		},
+	}
+
+	for i, tc := range testcases {
+		server := NewServer(&ServerConfig{
+			Suffix:                  "dc=example,dc=com",
+			SASLExternalIdentity:    tc.Identity,
+			SASLExternalReplacement: tc.Replacement,
+		})
+		server.LoadSchema()
+		if tc.Regex != "" {
+			server.saslExternalRegex = regexp.MustCompile(tc.Regex)
+		}
+
+		dn, err := server.mapCertificateToDN(context.Background(), cert)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Unexpected success on %d: got %s", i, dn.DNNormStr())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error on %d: %+v", i, err)
+			continue
+		}
+		if dn.DNNormStr() != tc.Expected {
+			t.Errorf("Unexpected DN on %d: expected %s, got %s", i, tc.Expected, dn.DNNormStr())
+		}
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	f, err := compileFilter("(&(objectClass=inetOrgPerson)(mail=user1@example.com))")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if _, ok := f.(message.FilterAnd); !ok {
+		t.Errorf("Unexpected filter: %#v", f)
+	}
+
+	if _, err := compileFilter("(mail=user1"); err == nil {
+		t.Errorf("Unexpected success of compiling invalid filter")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	ldap "github.com/openstandia/ldapserver"
+)
+
+func init() {
+	RegisterSASLMechanism(&SASLPlain{})
+}
+
+// SASLPlain authenticates the client by the password.
+// https://datatracker.ietf.org/doc/html/rfc4616
+//
+//	message = [authzid] UTF8NUL authcid UTF8NUL passwd
+type SASLPlain struct{}
+
+type saslPlainWaiting struct{}
+
+func (x *SASLPlain) Name() string {
+	return "PLAIN"
+}
+
+// IsAvailable returns true if TLS is configured since the password is sent in cleartext,
+// or the cleartext is allowed explicitly.
+func (x *SASLPlain) IsAvailable(s *Server) bool {
+	return s.tlsConfig != nil || s.config.SASLPlainCleartext
+}
+
+func (x *SASLPlain) Step(ctx context.Context, s *Server, m *ldap.Message, state interface{}, cred []byte) (interface{}, []byte, error) {
+	if !isTLSConn(m) && !s.config.SASLPlainCleartext {
+		log.Printf("info: Bind failed - SASL/PLAIN requires TLS")
+		return nil, nil, NewConfidentialityRequired()
+	}
+
+	// The client didn't send the initial response, request it by the empty challenge
+	if state == nil && len(cred) == 0 {
+		return &saslPlainWaiting{}, []byte{}, nil
+	}
+
+	parts := strings.Split(string(cred), "\x00")
+	if len(parts) != 3 || parts[1] == "" {
+		log.Printf("info: Bind failed - Invalid SASL/PLAIN message")
+		return nil, nil, NewProtocolError("invalid SASL/PLAIN message")
+	}
+	authzID, authcID, passwd := parts[0], parts[1], parts[2]
+
+	dn, err := s.resolveAuthcID(ctx, authcID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.checkAuthzID(authzID, dn); err != nil {
+		return nil, nil, err
+	}
+
+	if err := bindByPassword(ctx, s, m, dn, passwd); err != nil {
+		return nil, nil, err
+	}
+
+	return nil, nil, nil
+}
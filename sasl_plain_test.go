@@ -0,0 +1,30 @@
+//go:build test
+
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestSASLPlainIsAvailable(t *testing.T) {
+	mech := &SASLPlain{}
+
+	server := NewServer(&ServerConfig{})
+	if mech.IsAvailable(server) {
+		t.Errorf("Unexpected PLAIN without TLS")
+	}
+	if NewStringSet(supportedSASLMechanisms(server)...).Contains("PLAIN") {
+		t.Errorf("Unexpected PLAIN in supportedSASLMechanisms without TLS")
+	}
+
+	server.tlsConfig = &tls.Config{}
+	if !mech.IsAvailable(server) {
+		t.Errorf("Expected PLAIN with TLS")
+	}
+
+	server = NewServer(&ServerConfig{SASLPlainCleartext: true})
+	if !mech.IsAvailable(server) {
+		t.Errorf("Expected PLAIN with the cleartext allowed")
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	RegisterSASLMechanism(&SASLScramSHA256{})
+}
+
+const (
+	scramSHA256Prefix     = "{SCRAM-SHA-256}"
+	scramSHA256Iterations = 4096
+	scramSaltLength       = 16
+	scramNonceLength      = 18
+)
+
+// SCRAMCredential is the stored key credential of SCRAM-SHA-256 kept in userPassword.
+// The format is "{SCRAM-SHA-256}<iterations>,<salt>,<StoredKey>,<ServerKey>" with base64 encoded values.
+// https://datatracker.ietf.org/doc/html/rfc5802#section-3
+type SCRAMCredential struct {
+	Iterations int
+	Salt       []byte
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+func NewSCRAMCredential(password string, salt []byte, iterations int) *SCRAMCredential {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := scramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	return &SCRAMCredential{
+		Iterations: iterations,
+		Salt:       salt,
+		StoredKey:  storedKey[:],
+		ServerKey:  scramHMAC(saltedPassword, "Server Key"),
+	}
+}
+
+// generateSCRAMCredential returns the stored key credential with random salt.
+func generateSCRAMCredential(password string) (string, error) {
+	salt := make([]byte, scramSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", xerrors.Errorf("Failed to generate salt. err: %w", err)
+	}
+	return NewSCRAMCredential(password, salt, scramSHA256Iterations).String(), nil
+}
+
+func ParseSCRAMCredential(cred string) (*SCRAMCredential, error) {
+	if !strings.HasPrefix(cred, scramSHA256Prefix) {
+		return nil, xerrors.Errorf("Not SCRAM-SHA-256 credential")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(cred, scramSHA256Prefix), ",")
+	if len(parts) != 4 {
+		return nil, xerrors.Errorf("Invalid SCRAM-SHA-256 credential format")
+	}
+
+	iterations, err := strconv.Atoi(parts[0])
+	if err != nil || iterations <= 0 {
+		return nil, xerrors.Errorf("Invalid SCRAM-SHA-256 iterations: %s", parts[0])
+	}
+
+	values := make([][]byte, 3)
+	for i, v := range parts[1:] {
+		values[i], err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, xerrors.Errorf("Invalid SCRAM-SHA-256 credential encoding. err: %w", err)
+		}
+	}
+
+	return &SCRAMCredential{
+		Iterations: iterations,
+		Salt:       values[0],
+		StoredKey:  values[1],
+		ServerKey:  values[2],
+	}, nil
+}
+
+func (c *SCRAMCredential) String() string {
+	return fmt.Sprintf("%s%d,%s,%s,%s", scramSHA256Prefix, c.Iterations,
+		base64.StdEncoding.EncodeToString(c.Salt),
+		base64.StdEncoding.EncodeToString(c.StoredKey),
+		base64.StdEncoding.EncodeToString(c.ServerKey))
+}
+
+// ValidatePassword checks the password for simple bind.
+func (c *SCRAMCredential) ValidatePassword(password string) bool {
+	input := NewSCRAMCredential(password, c.Salt, c.Iterations)
+	return subtle.ConstantTimeCompare(input.StoredKey, c.StoredKey) == 1
+}
+
+// VerifyClientProof checks the ClientProof sent by the client.
+//
+//	ClientSignature := HMAC(StoredKey, AuthMessage)
+//	ClientKey       := ClientProof XOR ClientSignature
+//	StoredKey       == H(ClientKey)
+func (c *SCRAMCredential) VerifyClientProof(authMessage string, proof []byte) bool {
+	clientSignature := scramHMAC(c.StoredKey, authMessage)
+	if len(proof) != len(clientSignature) {
+		return false
+	}
+
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+
+	return subtle.ConstantTimeCompare(storedKey[:], c.StoredKey) == 1
+}
+
+// ServerSignature returns the signature sent by the server-final-message.
+func (c *SCRAMCredential) ServerSignature(authMessage string) []byte {
+	return scramHMAC(c.ServerKey, authMessage)
+}
+
+func scramHMAC(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// SASLScramSHA256 authenticates the client by SCRAM-SHA-256 without channel binding.
+// https://datatracker.ietf.org/doc/html/rfc7677
+type SASLScramSHA256 struct{}
+
+type scramServerState struct {
+	dn              *DN
+	authzID         string
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+	cred            *SCRAMCredential
+}
+
+func (x *SASLScramSHA256) Name() string {
+	return "SCRAM-SHA-256"
+}
+
+func (x *SASLScramSHA256) IsAvailable(s *Server) bool {
+	return true
+}
+
+func (x *SASLScramSHA256) Step(ctx context.Context, s *Server, m *ldap.Message, state interface{}, cred []byte) (interface{}, []byte, error) {
+	if state == nil {
+		return x.stepClientFirst(ctx, s, string(cred))
+	}
+	return x.stepClientFinal(ctx, s, m, state.(*scramServerState), string(cred))
+}
+
+// SCRAMClientFirst is the parsed client-first-message.
+//
+//	client-first-message = gs2-header client-first-message-bare
+//	gs2-header = gs2-cbind-flag "," [ authzid ] ","
+//	client-first-message-bare = [reserved-mext ","] username "," nonce ["," extensions]
+type SCRAMClientFirst struct {
+	GS2Header string
+	AuthzID   string
+	Username  string
+	Nonce     string
+	Bare      string
+}
+
+func ParseSCRAMClientFirst(msg string) (*SCRAMClientFirst, error) {
+	parts := strings.SplitN(msg, ",", 3)
+	if len(parts) != 3 {
+		return nil, NewProtocolError("invalid SCRAM client-first-message")
+	}
+
+	switch {
+	case parts[0] == "n", parts[0] == "y":
+	case strings.HasPrefix(parts[0], "p="):
+		return nil, NewInappropriateAuthentication("SCRAM channel binding not supported")
+	default:
+		return nil, NewProtocolError("invalid SCRAM gs2-cbind-flag")
+	}
+
+	first := &SCRAMClientFirst{
+		GS2Header: parts[0] + "," + parts[1] + ",",
+		Bare:      parts[2],
+	}
+
+	if parts[1] != "" {
+		if !strings.HasPrefix(parts[1], "a=") {
+			return nil, NewProtocolError("invalid SCRAM authzid")
+		}
+		first.AuthzID = decodeSCRAMName(parts[1][2:])
+	}
+
+	for _, attr := range strings.Split(first.Bare, ",") {
+		switch {
+		case strings.HasPrefix(attr, "m="):
+			return nil, NewProtocolError("SCRAM mandatory extension not supported")
+		case strings.HasPrefix(attr, "n="):
+			first.Username = decodeSCRAMName(attr[2:])
+		case strings.HasPrefix(attr, "r="):
+			first.Nonce = attr[2:]
+		}
+	}
+
+	if first.Username == "" || first.Nonce == "" {
+		return nil, NewProtocolError("invalid SCRAM client-first-message")
+	}
+	return first, nil
+}
+
+// SCRAMClientFinal is the parsed client-final-message.
+//
+//	client-final-message = client-final-message-without-proof "," proof
+//	client-final-message-without-proof = channel-binding "," nonce ["," extensions]
+type SCRAMClientFinal struct {
+	ChannelBinding string
+	Nonce          string
+	Proof          []byte
+	WithoutProof   string
+}
+
+func ParseSCRAMClientFinal(msg string) (*SCRAMClientFinal, error) {
+	i := strings.LastIndex(msg, ",p=")
+	if i == -1 {
+		return nil, NewProtocolError("invalid SCRAM client-final-message")
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(msg[i+3:])
+	if err != nil {
+		return nil, NewProtocolError("invalid SCRAM proof")
+	}
+
+	final := &SCRAMClientFinal{
+		Proof:        proof,
+		WithoutProof: msg[:i],
+	}
+
+	for _, attr := range strings.Split(final.WithoutProof, ",") {
+		switch {
+		case strings.HasPrefix(attr, "c="):
+			final.ChannelBinding = attr[2:]
+		case strings.HasPrefix(attr, "r="):
+			final.Nonce = attr[2:]
+		}
+	}
+	return final, nil
+}
+
+// decodeSCRAMName decodes saslname which encodes "," and "=" as "=2C" and "=3D".
+func decodeSCRAMName(name string) string {
+	return strings.NewReplacer("=2C", ",", "=3D", "=").Replace(name)
+}
+
+func (x *SASLScramSHA256) stepClientFirst(ctx context.Context, s *Server, msg string) (interface{}, []byte, error) {
+	first, err := ParseSCRAMClientFirst(msg)
+	if err != nil {
+		log.Printf("info: Bind failed - Invalid SCRAM client-first-message. err: %v", err)
+		return nil, nil, err
+	}
+
+	dn, err := s.resolveAuthcID(ctx, first.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	creds, err := s.findCredentialsByDN(ctx, dn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cred *SCRAMCredential
+	for _, v := range creds {
+		if c, err := ParseSCRAMCredential(v); err == nil {
+			cred = c
+			break
+		}
+	}
+	if cred == nil {
+		log.Printf("info: Bind failed - Not found SCRAM-SHA-256 credential. dn_norm: %s", dn.DNNormStr())
+		return nil, nil, NewInvalidCredentials()
+	}
+
+	b := make([]byte, scramNonceLength)
+	if _, err := rand.Read(b); err != nil {
+		return nil, nil, xerrors.Errorf("Failed to generate nonce. err: %w", err)
+	}
+	nonce := first.Nonce + base64.RawStdEncoding.EncodeToString(b)
+
+	serverFirst := fmt.Sprintf("r=%s,s=%s,i=%d", nonce, base64.StdEncoding.EncodeToString(cred.Salt), cred.Iterations)
+
+	return &scramServerState{
+		dn:              dn,
+		authzID:         first.AuthzID,
+		gs2Header:       first.GS2Header,
+		clientFirstBare: first.Bare,
+		serverFirst:     serverFirst,
+		nonce:           nonce,
+		cred:            cred,
+	}, []byte(serverFirst), nil
+}
+
+func (x *SASLScramSHA256) stepClientFinal(ctx context.Context, s *Server, m *ldap.Message, state *scramServerState, msg string) (interface{}, []byte, error) {
+	final, err := ParseSCRAMClientFinal(msg)
+	if err != nil {
+		log.Printf("info: Bind failed - Invalid SCRAM client-final-message. err: %v", err)
+		return nil, nil, err
+	}
+
+	if final.ChannelBinding != base64.StdEncoding.EncodeToString([]byte(state.gs2Header)) {
+		log.Printf("info: Bind failed - Unmatched SCRAM channel binding. dn_norm: %s", state.dn.DNNormStr())
+		return nil, nil, NewInvalidCredentials()
+	}
+	if final.Nonce != state.nonce {
+		log.Printf("info: Bind failed - Unmatched SCRAM nonce. dn_norm: %s", state.dn.DNNormStr())
+		return nil, nil, NewInvalidCredentials()
+	}
+
+	authMessage := state.clientFirstBare + "," + state.serverFirst + "," + final.WithoutProof
+
+	// Verify the proof in the bind transaction to apply the password policy
+	err = s.Repo().Bind(ctx, state.dn, func(current *FetchedCredential) error {
+		if isLocked(current) {
+			log.Printf("info: Bind failed - Account locked. dn_norm: %s", state.dn.DNNormStr())
+			return NewAccountLocked()
+		}
+
+		if !state.cred.VerifyClientProof(authMessage, final.Proof) {
+			if current.PPolicy.ShouldLockout(current.PwdFailureCount) {
+				log.Printf("info: Bind failed - Invalid credentials then locking now. dn_norm: %s", state.dn.DNNormStr())
+				return NewAccountLocking()
+			}
+
+			log.Printf("info: Bind failed - Invalid credentials. dn_norm: %s", state.dn.DNNormStr())
+			return NewInvalidCredentials()
+		}
+
+		if err := s.checkAuthzID(state.authzID, state.dn); err != nil {
+			return err
+		}
+
+		saveAuthencatedDN(m, state.dn, current.MemberOf)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverFinal := "v=" + base64.StdEncoding.EncodeToString(state.cred.ServerSignature(authMessage))
+
+	return nil, []byte(serverFinal), nil
+}
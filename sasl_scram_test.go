@@ -0,0 +1,134 @@
+//go:build test
+
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// Test vector from https://datatracker.ietf.org/doc/html/rfc7677#section-3
+func TestSCRAMSHA256Exchange(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	cred := NewSCRAMCredential("pencil", salt, 4096)
+
+	first, err := ParseSCRAMClientFirst("n,,n=user,r=rOprNGfwEbeRWgbNEkqO")
+	if err != nil {
+		t.Fatalf("Unexpected error on ParseSCRAMClientFirst: %+v", err)
+	}
+	if first.GS2Header != "n,," || first.Username != "user" || first.Nonce != "rOprNGfwEbeRWgbNEkqO" {
+		t.Errorf("Unexpected client-first: %#v", first)
+	}
+
+	serverFirst := "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+
+	final, err := ParseSCRAMClientFinal("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")
+	if err != nil {
+		t.Fatalf("Unexpected error on ParseSCRAMClientFinal: %+v", err)
+	}
+	if final.ChannelBinding != base64.StdEncoding.EncodeToString([]byte(first.GS2Header)) {
+		t.Errorf("Unexpected channel binding: %s", final.ChannelBinding)
+	}
+
+	authMessage := first.Bare + "," + serverFirst + "," + final.WithoutProof
+
+	if !cred.VerifyClientProof(authMessage, final.Proof) {
+		t.Errorf("Expected valid client proof")
+	}
+
+	signature := base64.StdEncoding.EncodeToString(cred.ServerSignature(authMessage))
+	if signature != "6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=" {
+		t.Errorf("Unexpected server signature: %s", signature)
+	}
+
+	invalid := NewSCRAMCredential("invalid", salt, 4096)
+	if invalid.VerifyClientProof(authMessage, final.Proof) {
+		t.Errorf("Expected invalid client proof")
+	}
+}
+
+func TestParseSCRAMClientFirst(t *testing.T) {
+	testcases := []struct {
+		Message  string
+		Username string
+		AuthzID  string
+		Err      bool
+	}{
+		{
+			"n,,n=user,r=abc",
+			"user",
+			"",
+			false,
+		},
+		{
+			"y,a=dn:uid=user=2Cou=Users,n=us=3Der,r=abc",
+			"us=er",
+			"dn:uid=user,ou=Users",
+			false,
+		},
+		{
+			"p=tls-unique,,n=user,r=abc",
+			"",
+			"",
+			true,
+		},
+		{
+			"n,,m=ext,n=user,r=abc",
+			"",
+			"",
+			true,
+		},
+		{
+			"n,,n=user",
+			"",
+			"",
+			true,
+		},
+	}
+
+	for i, tc := range testcases {
+		first, err := ParseSCRAMClientFirst(tc.Message)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Unexpected success on %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error on %d: %+v", i, err)
+			continue
+		}
+		if first.Username != tc.Username || first.AuthzID != tc.AuthzID {
+			t.Errorf("Unexpected result on %d: %#v", i, first)
+		}
+	}
+}
+
+func TestSCRAMCredential(t *testing.T) {
+	cred, err := hashPassword("SCRAM-SHA-256", "password")
+	if err != nil {
+		t.Fatalf("Unexpected error on hashPassword: %+v", err)
+	}
+
+	c, err := ParseSCRAMCredential(cred)
+	if err != nil {
+		t.Fatalf("Unexpected error on ParseSCRAMCredential: %+v", err)
+	}
+	if c.Iterations != scramSHA256Iterations || len(c.Salt) != scramSaltLength {
+		t.Errorf("Unexpected credential: %s", cred)
+	}
+	if c.String() != cred {
+		t.Errorf("Unexpected string: %s, expected: %s", c.String(), cred)
+	}
+
+	if !validateCred(nil, "password", cred) {
+		t.Errorf("Expected valid password")
+	}
+	if validateCred(nil, "invalid", cred) {
+		t.Errorf("Expected invalid password")
+	}
+
+	if _, err := ParseSCRAMCredential("{SCRAM-SHA-256}4096,invalid"); err == nil {
+		t.Errorf("Expected error on invalid format")
+	}
+}
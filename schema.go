@@ -5,6 +5,7 @@ import (
 	"log"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -32,17 +33,54 @@ func (s *SchemaMap) PutObjectClass(k string, objectClass *ObjectClass) {
 	s.ObjectClasses[strings.ToLower(k)] = objectClass
 }
 
+// AttributeType returns the attribute type of the attribute description.
+// The options of the attribute description (e.g. cn;lang-ja) are ignored.
 func (s *SchemaMap) AttributeType(k string) (*AttributeType, bool) {
+	if i := strings.IndexByte(k, ';'); i >= 0 {
+		k = k[:i]
+	}
 	schema, ok := s.AttributeTypes[strings.ToLower(k)]
 	return schema, ok
 }
 
+// AttributeDescription returns the attribute type and the normalized options of the attribute description.
+// The options are returned as the suffix of the attribute type name, e.g. ";lang-ja".
+// Only language tags and the binary transfer option are supported.
+// https://datatracker.ietf.org/doc/html/rfc4512#section-2.5
+func (s *SchemaMap) AttributeDescription(k string) (*AttributeType, string, bool) {
+	schema, ok := s.AttributeType(k)
+	if !ok {
+		return nil, "", false
+	}
+
+	var sb strings.Builder
+	for _, o := range parseAttributeOptions(k) {
+		if o == "binary" {
+			// The binary transfer option isn't a subtype, so we store the value as the attribute type
+			// https://datatracker.ietf.org/doc/html/rfc4522
+			if !schema.IsBinaryTransferRequired() {
+				return nil, "", false
+			}
+		} else if isLanguageTag(o) {
+			if !schema.IsLanguageTagAllowed() {
+				return nil, "", false
+			}
+			sb.WriteString(";")
+			sb.WriteString(o)
+		} else {
+			return nil, "", false
+		}
+	}
+	return schema, sb.String(), true
+}
+
 func (s *SchemaMap) PutAttributeType(k string, attributeType *AttributeType) {
 	s.AttributeTypes[strings.ToLower(k)] = attributeType
 }
 
 func (s *SchemaMap) ValidateObjectClass(ocs []string, attrs map[string]*SchemaValue) *LDAPError {
 	stoc := []*ObjectClass{}
+	extensible := false
 	for i, v := range ocs {
 		oc, ok := s.ObjectClass(v)
 		if !ok {
@@ -57,6 +95,9 @@ func (s *SchemaMap) ValidateObjectClass(ocs []string, attrs map[string]*SchemaVa
 		if oc.Structural {
 			stoc = append(stoc, oc)
 		}
+		if oc.Name == "extensibleObject" {
+			extensible = true
+		}
 
 		for _, mv := range oc.Must() {
 			_, ok := attrs[mv]
@@ -78,6 +119,12 @@ func (s *SchemaMap) ValidateObjectClass(ocs []string, attrs map[string]*SchemaVa
 		return err
 	}
 
+	// The extensibleObject permits any user attribute, e.g. the naming attribute of the alias entry
+	// https://datatracker.ietf.org/doc/html/rfc4512#section-4.3
+	if extensible {
+		return nil
+	}
+
 	for k, sv := range attrs {
 		if k == "objectClass" {
 			continue
@@ -96,7 +143,7 @@ func (s *SchemaMap) ValidateObjectClass(ocs []string, attrs map[string]*SchemaVa
 				return NewInvalidPerSyntax("objectClass", i)
 			}
 
-			if oc.Contains(k) {
+			if oc.Contains(sv.schema.Name) {
 				contains = true
 				break
 			}
@@ -113,6 +160,30 @@ func (s *SchemaMap) ValidateObjectClass(ocs []string, attrs map[string]*SchemaVa
 	return nil
 }
 
+// ValidateRDN validates that the entry has all values of the RDN.
+// The RDN can be multi-valued, e.g. cn=John Smith+uid=jsmith.
+func (s *SchemaMap) ValidateRDN(dn *DN, attrs map[string]*SchemaValue) *LDAPError {
+	if len(dn.RDNs) == 0 {
+		return nil
+	}
+
+	for _, a := range dn.RDNs[0].Attributes {
+		sv, err := NewSchemaValue(s, a.TypeNorm, []string{a.ValueOrig})
+		if err != nil {
+			return NewInvalidDNSyntax()
+		}
+
+		current, ok := attrs[sv.Name()]
+		if !ok || !current.HasDuplicate(sv) {
+			// e.g.
+			// ldap_add: Naming violation (64)
+			//   additional info: value of naming attribute 'uid' is not present in entry
+			return NewNamingViolation(a.TypeOrig)
+		}
+	}
+	return nil
+}
+
 // TODO
 var mergedSchema string = ""
 
@@ -550,6 +621,7 @@ func (m SchemaValueMap) Has(val string) bool {
 
 type SchemaValue struct {
 	schema    *AttributeType
+	options   string
 	value     []string
 	norm      []interface{}
 	normStr   []string
@@ -558,7 +630,7 @@ type SchemaValue struct {
 
 func NewSchemaValue(schemaMap *SchemaMap, attrName string, attrValue []string) (*SchemaValue, error) {
 	// TODO refactoring
-	s, ok := schemaMap.AttributeType(attrName)
+	s, options, ok := schemaMap.AttributeDescription(attrName)
 	if !ok {
 		return nil, NewUndefinedType(attrName)
 	}
@@ -568,8 +640,9 @@ func NewSchemaValue(schemaMap *SchemaMap, attrName string, attrValue []string) (
 	}
 
 	sv := &SchemaValue{
-		schema: s,
-		value:  attrValue,
+		schema:  s,
+		options: options,
+		value:   attrValue,
 	}
 
 	err := sv.normalize()
@@ -580,8 +653,15 @@ func NewSchemaValue(schemaMap *SchemaMap, attrName string, attrValue []string) (
 	return sv, nil
 }
 
+// Name returns the attribute description with the options, e.g. cn;lang-ja.
+// It's used as the key of the attributes.
 func (s *SchemaValue) Name() string {
-	return s.schema.Name
+	return s.schema.Name + s.options
+}
+
+// IsSubtype returns true if the value is the subtype of the attribute type with the options.
+func (s *SchemaValue) IsSubtype() bool {
+	return s.options != ""
 }
 
 func (s *SchemaValue) HasDuplicate(value *SchemaValue) bool {
@@ -618,8 +698,9 @@ func (s *SchemaValue) Clone() *SchemaValue {
 	copy(newValue, s.value)
 
 	nsv := &SchemaValue{
-		schema: s.schema,
-		value:  newValue,
+		schema:  s.schema,
+		options: s.options,
+		value:   newValue,
 	}
 
 	err := nsv.normalize()
@@ -843,6 +924,48 @@ func (s *SchemaValue) normalize() error {
 	}
 }
 
+// parseAttributeOptions returns the options of the attribute description.
+// The options are lower-cased and sorted since they are case-insensitive and unordered.
+func parseAttributeOptions(k string) []string {
+	s := strings.Split(strings.ToLower(k), ";")
+	if len(s) == 1 {
+		return nil
+	}
+	sort.Strings(s[1:])
+	options := []string{}
+	for i, o := range s[1:] {
+		// Remove duplicate options
+		if i > 0 && o == options[len(options)-1] {
+			continue
+		}
+		options = append(options, o)
+	}
+	return options
+}
+
+var LANGUAGE_TAG_PATTERN = regexp.MustCompile(`^lang-[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// isLanguageTag returns true if the option is the language tag, e.g. lang-ja.
+// https://datatracker.ietf.org/doc/html/rfc3866
+func isLanguageTag(o string) bool {
+	return LANGUAGE_TAG_PATTERN.MatchString(o)
+}
+
+// addSubtypeNorm adds the normalized values of the subtypes (e.g. cn;lang-ja) to the attribute type (e.g. cn).
+// The filter of the attribute type matches the subtypes too by the index.
+// Note: It isn't stored in attrs_orig since attrs_orig is used to build the entry.
+func addSubtypeNorm(norm map[string][]interface{}, attributes map[string]*SchemaValue) {
+	for _, v := range attributes {
+		if !v.IsSubtype() {
+			continue
+		}
+		name := v.schema.Name
+		merged := make([]interface{}, 0, len(norm[name])+len(v.Norm()))
+		merged = append(merged, norm[name]...)
+		norm[name] = append(merged, v.Norm()...)
+	}
+}
+
 func toNormStr(norm interface{}) string {
 	switch v := norm.(type) {
 	case string:
@@ -895,6 +1018,33 @@ func (s *AttributeType) IsReverseAssociationAttribute() bool {
 	return s.Name == "memberOf"
 }
 
+// IsBinaryTransferRequired returns true if the values must be transferred with ;binary option.
+func (s *AttributeType) IsBinaryTransferRequired() bool {
+	return s.Syntax == "1.3.6.1.4.1.1466.115.121.1.8" ||
+		s.Syntax == "1.3.6.1.4.1.1466.115.121.1.9" ||
+		s.Syntax == "1.3.6.1.4.1.1466.115.121.1.10"
+}
+
+// IsLanguageTagAllowed returns false for the attributes which can't have language tags.
+// The association attributes are excluded since they are stored in the association table.
+func (s *AttributeType) IsLanguageTagAllowed() bool {
+	return s.Name != "objectClass" &&
+		!s.IsOperationalAttribute() &&
+		!s.IsAssociationAttribute() &&
+		!s.IsReverseAssociationAttribute()
+}
+
+// Subtype returns the attribute type whose name has the options, e.g. cn;lang-ja.
+// It's used for the filter of the subtype.
+func (s *AttributeType) Subtype(options string) *AttributeType {
+	if options == "" {
+		return s
+	}
+	subtype := *s
+	subtype.Name = s.Name + options
+	return &subtype
+}
+
 func (s *AttributeType) IsNumberOrdering() bool {
 	return s.Ordering == "generalizedTimeOrderingMatch" ||
 		s.Ordering == "integerOrderingMatch" ||
@@ -902,6 +1052,20 @@ func (s *AttributeType) IsNumberOrdering() bool {
 		s.Ordering == "UUIDOrderingMatch"
 }
 
+// IsSortable returns true if the values can be sorted by the server side sort control.
+func (s *AttributeType) IsSortable() bool {
+	if s.IsAssociationAttribute() || s.IsReverseAssociationAttribute() {
+		return false
+	}
+	return s.Ordering != "" || s.Equality != ""
+}
+
+// IsNumberNormalized returns true if the normalized value is stored as a number.
+func (s *AttributeType) IsNumberNormalized() bool {
+	return s.Equality == "integerMatch" ||
+		s.Equality == "generalizedTimeMatch"
+}
+
 func (s *AttributeType) IsNanoFormat() bool {
 	return s.Name == "pwdFailureTime"
 }
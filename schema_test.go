@@ -235,3 +235,97 @@ func TestObjectClassNormalization(t *testing.T) {
 		}
 	}
 }
+
+func TestAttributeDescription(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	testcases := []struct {
+		Desc         string
+		ExpectedName string
+		ExpectedOK   bool
+	}{
+		{"cn", "cn", true},
+		{"CN;Lang-JA", "cn;lang-ja", true},
+		{"displayName;lang-en-US", "displayName;lang-en-us", true},
+		{"cn;lang-ja;lang-en", "cn;lang-en;lang-ja", true},
+		{"cn;lang-ja;LANG-JA", "cn;lang-ja", true},
+		{"userCertificate;binary", "userCertificate", true},
+		// Unsupported options
+		{"cn;binary", "", false},
+		{"cn;x-foo", "", false},
+		{"cn;lang-", "", false},
+		{"objectClass;lang-ja", "", false},
+		{"member;lang-ja", "", false},
+		{"entryUUID;lang-ja", "", false},
+		{"unknown;lang-ja", "", false},
+	}
+
+	for i, tc := range testcases {
+		s, options, ok := server.schemaMap.AttributeDescription(tc.Desc)
+		if ok != tc.ExpectedOK {
+			t.Errorf("Unexpected result on %d: %s -> %v", i, tc.Desc, ok)
+			continue
+		}
+		if ok && s.Name+options != tc.ExpectedName {
+			t.Errorf("Unexpected name on %d: %s -> %s", i, tc.Desc, s.Name+options)
+		}
+	}
+}
+
+func TestSubtypeSchemaValue(t *testing.T) {
+	server := NewServer(&ServerConfig{
+		Suffix: "dc=example,dc=com",
+	})
+	server.LoadSchema()
+
+	dn, _ := server.NormalizeDN("uid=user1,ou=Users,dc=example,dc=com")
+	entry := NewAddEntry(server.schemaMap, dn)
+
+	for k, v := range map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"cn":           {"Taro Yamada"},
+		"cn;lang-ja":   {"山田 太郎"},
+		"CN;LANG-EN":   {"Taro  Yamada"},
+		"sn;lang-ja":   {"山田"},
+		"displayName":  {"Taro"},
+		"description":  {"foo"},
+		"uid":          {"user1"},
+		"sn":           {"Yamada"},
+		"givenName;x":  {"Taro"},
+		"cn;lang-ja;x": {"Taro"},
+	} {
+		err := entry.Add(k, v)
+		if k == "givenName;x" || k == "cn;lang-ja;x" {
+			if err == nil {
+				t.Errorf("Unexpected success of adding unsupported option: %s", k)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error on adding %s: %+v", k, err)
+		}
+	}
+
+	if err := entry.Validate(); err != nil {
+		t.Fatalf("Unexpected error on Validate: %+v", err)
+	}
+
+	norm, orig := entry.Attrs()
+
+	if !reflect.DeepEqual(orig["cn;lang-ja"], []string{"山田 太郎"}) {
+		t.Errorf("Unexpected cn;lang-ja: %v", orig["cn;lang-ja"])
+	}
+	if !reflect.DeepEqual(orig["cn"], []string{"Taro Yamada"}) {
+		t.Errorf("Unexpected cn: %v", orig["cn"])
+	}
+	// The normalized values of the subtypes are added to the attribute type to be matched by the filter
+	if len(norm["cn"]) != 3 || len(norm["cn;lang-en"]) != 1 || len(norm["sn"]) != 2 {
+		t.Errorf("Unexpected norm: %v", norm)
+	}
+	if !entry.HasAttr("cn;lang-ja") || entry.HasAttr("cn;lang-fr") {
+		t.Errorf("Unexpected HasAttr")
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
+import (
+	"strings"
+)
+
 type SearchEntry struct {
 	schemaMap  *SchemaMap
 	dnOrig     string
 	attributes map[string][]string
+	base       *DN
 }
 
 func NewSearchEntry(schemaMap *SchemaMap, dnOrig string, valuesOrig map[string][]string) *SearchEntry {
@@ -19,21 +24,50 @@ func (j *SearchEntry) DNOrig() string {
 	return j.dnOrig
 }
 
+// DNOrigWithSuffix returns the DN with the base DN of the naming context which the entry belongs to.
+func (j *SearchEntry) DNOrigWithSuffix() string {
+	return resolveSuffix(j.base, j.dnOrig)
+}
+
 func (j *SearchEntry) GetAttrsOrig() map[string][]string {
 	return j.attributes
 }
 
 func (j *SearchEntry) GetAttrOrig(attrName string) (string, []string, bool) {
-	s, ok := j.schemaMap.AttributeType(attrName)
+	s, options, ok := j.schemaMap.AttributeDescription(attrName)
 	if !ok {
 		return "", nil, false
 	}
 
-	v, ok := j.attributes[s.Name]
+	v, ok := j.attributes[s.Name+options]
 	if !ok {
 		return "", nil, false
 	}
-	return s.Name, v, true
+	return s.Name + options, v, true
+}
+
+// GetAttrsOrigWithSubtypes returns the values of the attribute and its subtypes.
+// e.g. cn returns the values of cn, cn;lang-ja and cn;lang-en.
+func (j *SearchEntry) GetAttrsOrigWithSubtypes(attrName string) (map[string][]string, bool) {
+	s, options, ok := j.schemaMap.AttributeDescription(attrName)
+	if !ok {
+		return nil, false
+	}
+
+	m := attrsOrigWithSubtypes(j.attributes, s.Name+options)
+	if len(m) == 0 {
+		return nil, false
+	}
+	return m, true
+}
+
+// TransferAttributeDescription returns the attribute description which is returned to the client.
+// The attribute which requires binary transfer is returned with ;binary option, e.g. userCertificate;binary.
+func (j *SearchEntry) TransferAttributeDescription(k string) string {
+	if s, ok := j.schemaMap.AttributeType(k); ok && s.IsBinaryTransferRequired() {
+		return k + ";binary"
+	}
+	return k
 }
 
 func (j *SearchEntry) GetAttrsOrigWithoutOperationalAttrs() map[string][]string {
@@ -59,3 +93,13 @@ func (j *SearchEntry) GetOperationalAttrsOrig() map[string][]string {
 	}
 	return m
 }
+
+func attrsOrigWithSubtypes(attrs map[string][]string, name string) map[string][]string {
+	m := map[string][]string{}
+	for k, v := range attrs {
+		if k == name || strings.HasPrefix(k, name+";") {
+			m[k] = v
+		}
+	}
+	return m
+}
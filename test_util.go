@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/jsimonetti/pwscheme/ssha512"
 	_ "github.com/lib/pq"
 	"golang.org/x/xerrors"
+	ber "gopkg.in/asn1-ber.v1"
 )
 
 func IntegrationTestRunner(m *testing.M) int {
@@ -193,7 +195,7 @@ type ModifyDelete struct {
 	rdn    string
 	baseDN string
 	attrs  map[string][]string
-	assert *AssertEntry
+	assert Assert
 }
 
 type ModifyDN struct {
@@ -212,6 +214,89 @@ type Delete struct {
 	assert *AssertNoEntry
 }
 
+type Compare struct {
+	rdn    string
+	baseDN string
+	attr   string
+	value  string
+	expect bool
+	assert *AssertResponse
+}
+
+func (c Compare) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(c.rdn, c.baseDN)
+
+	matched, err := conn.Compare(dn, c.attr, c.value)
+
+	if c.assert != nil {
+		if err := c.assert.AssertResponse(conn, err); err != nil {
+			return conn, err
+		}
+		if c.assert.expect != 0 {
+			return conn, nil
+		}
+	} else if err != nil {
+		return conn, err
+	}
+
+	if matched != c.expect {
+		return conn, xerrors.Errorf("Unexpected compare result. dn: %s, attr: %s, value: %s, want: %v, got: %v", dn, c.attr, c.value, c.expect, matched)
+	}
+	return conn, nil
+}
+
+type PasswordModify struct {
+	rdn         string
+	baseDN      string
+	oldPassword string
+	newPassword string
+	assert      *AssertResponse
+}
+
+func (c PasswordModify) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	var dn string
+	if c.rdn != "" {
+		dn = resolveDN(c.rdn, c.baseDN)
+	}
+
+	res, err := conn.PasswordModify(ldap.NewPasswordModifyRequest(dn, c.oldPassword, c.newPassword))
+
+	if c.assert != nil {
+		if err := c.assert.AssertResponse(conn, err); err != nil {
+			return conn, err
+		}
+		if c.assert.expect != 0 {
+			return conn, nil
+		}
+	} else if err != nil {
+		return conn, err
+	}
+
+	// The server generates new password if it isn't specified
+	if c.newPassword == "" && res.GeneratedPassword == "" {
+		return conn, xerrors.Errorf("Unexpected password modify result. dn: %s, the generated password is empty", dn)
+	}
+	if c.newPassword != "" && res.GeneratedPassword != "" {
+		return conn, xerrors.Errorf("Unexpected password modify result. dn: %s, got generated password", dn)
+	}
+	return conn, nil
+}
+
+type WhoAmI struct {
+	expect string
+}
+
+func (c WhoAmI) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	res, err := conn.WhoAmI(nil)
+	if err != nil {
+		return conn, err
+	}
+	if res.AuthzID != c.expect {
+		return conn, xerrors.Errorf("Unexpected authzId. want: %s, got: %s", c.expect, res.AuthzID)
+	}
+	return conn, nil
+}
+
 type Search struct {
 	baseDN string
 	filter string
@@ -249,7 +334,9 @@ func (s Search) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
 
 type SearchWithPaging struct {
 	Search
-	limit uint32
+	limit           uint32
+	sizeLimit       int
+	expectErrorCode uint16
 }
 
 func (s SearchWithPaging) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
@@ -257,15 +344,16 @@ func (s SearchWithPaging) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error)
 		s.baseDN,
 		s.scope,
 		ldap.NeverDerefAliases,
-		0, // Size Limit
-		0, // Time Limit
+		s.sizeLimit, // Size Limit
+		0,           // Time Limit
 		false,
 		"("+s.filter+")", // The filter to apply
 		s.attrs,          // A list attributes to retrieve
 		nil,
 	)
+	// The entries until the previous page are returned with the error
 	sr, err := conn.SearchWithPaging(search, s.limit)
-	if err != nil {
+	if err := (AssertResponse{s.expectErrorCode}).AssertResponse(conn, err); err != nil {
 		return conn, err
 	}
 
@@ -279,6 +367,735 @@ func (s SearchWithPaging) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error)
 	return conn, nil
 }
 
+type SearchWithSort struct {
+	Search
+	keys   []string // "-" prefix means reverse order
+	limit  uint32
+	expect []string // RDNs in the expected order
+}
+
+func newSortControl(keys []string) ldap.Control {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKeyList")
+	for _, k := range keys {
+		kp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "SortKey")
+		kp.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, strings.TrimPrefix(k, "-"), "attributeType"))
+		if strings.HasPrefix(k, "-") {
+			kp.AppendChild(ber.NewBoolean(ber.ClassContext, ber.TypePrimitive, 1, true, "reverseOrder"))
+		}
+		packet.AppendChild(kp)
+	}
+	return ldap.NewControlString(SortRequestControlOID, true, string(packet.Bytes()))
+}
+
+func assertEntryOrder(sr *ldap.SearchResult, expect []string) error {
+	if len(sr.Entries) != len(expect) {
+		return xerrors.Errorf("Unexpected entry size. want = [%d] got = %d", len(expect), len(sr.Entries))
+	}
+	for i, v := range sr.Entries {
+		if !strings.HasPrefix(strings.ToLower(v.DN), strings.ToLower(expect[i])+",") {
+			return xerrors.Errorf("Unexpected entry order at %d. want = [%s] got = %s", i, expect[i], v.DN)
+		}
+	}
+	return nil
+}
+
+func (s SearchWithSort) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		[]ldap.Control{newSortControl(s.keys)},
+	)
+
+	var sr *ldap.SearchResult
+	var err error
+	if s.limit > 0 {
+		sr, err = conn.SearchWithPaging(search, s.limit)
+	} else {
+		sr, err = conn.Search(search)
+	}
+	if err != nil {
+		return conn, err
+	}
+
+	return conn, assertEntryOrder(sr, s.expect)
+}
+
+// SearchWithSortBetweenPages runs the command between the first page and the rest of the sorted paged search.
+type SearchWithSortBetweenPages struct {
+	Search
+	keys    []string // "-" prefix means reverse order
+	limit   uint32
+	between Command
+	expect  []string // RDNs in the expected order
+}
+
+func (s SearchWithSortBetweenPages) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	paging := ldap.NewControlPaging(s.limit)
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		[]ldap.Control{newSortControl(s.keys), paging},
+	)
+
+	result := &ldap.SearchResult{}
+	for i := 0; ; i++ {
+		sr, err := conn.Search(search)
+		if err != nil {
+			return conn, err
+		}
+		result.Entries = append(result.Entries, sr.Entries...)
+
+		c, ok := ldap.FindControl(sr.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging)
+		if !ok || len(c.Cookie) == 0 {
+			break
+		}
+		if i == 0 {
+			if conn, err = s.between.Run(t, conn); err != nil {
+				return conn, err
+			}
+		}
+		paging.SetCookie(c.Cookie)
+	}
+
+	return conn, assertEntryOrder(result, s.expect)
+}
+
+type SearchWithVLV struct {
+	Search
+	keys        []string
+	before      int64
+	after       int64
+	offset      int64  // Target by the offset if the assertion is empty
+	assertion   string // Target by the assertion value
+	contextID   string
+	sizeLimit   int
+	expect      []string
+	expectCount int64
+	// The search fails with the error code if it's not zero, the entries are the partial results
+	expectErrorCode uint16
+}
+
+func (s SearchWithVLV) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "VirtualListViewRequest")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, s.before, "beforeCount"))
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, s.after, "afterCount"))
+	if s.assertion != "" {
+		packet.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, s.assertion, "greaterThanOrEqual"))
+	} else {
+		target := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "byOffset")
+		target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, s.offset, "offset"))
+		target.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 0, "contentCount"))
+		packet.AppendChild(target)
+	}
+	if s.contextID != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s.contextID, "contextID"))
+	}
+
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		s.sizeLimit, // Size Limit
+		0,           // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		[]ldap.Control{
+			newSortControl(s.keys),
+			ldap.NewControlString(VLVRequestControlOID, true, string(packet.Bytes())),
+		},
+	)
+
+	sr, err := conn.Search(search)
+	if s.expectErrorCode != 0 {
+		if err := (AssertResponse{s.expectErrorCode}).AssertResponse(conn, err); err != nil {
+			return conn, err
+		}
+		return conn, assertEntryOrder(sr, s.expect)
+	}
+	if err != nil {
+		return conn, err
+	}
+
+	if err := assertEntryOrder(sr, s.expect); err != nil {
+		return conn, err
+	}
+
+	c := ldap.FindControl(sr.Controls, VLVResponseControlOID)
+	if c == nil {
+		return conn, xerrors.Errorf("Not found VLV response control")
+	}
+	res, err := ber.DecodePacketErr([]byte(c.(*ldap.ControlString).ControlValue))
+	if err != nil {
+		return conn, xerrors.Errorf("Invalid VLV response control. err: %w", err)
+	}
+	if count := res.Children[1].Value.(int64); count != s.expectCount {
+		return conn, xerrors.Errorf("Unexpected VLV content count. want = [%d] got = %d", s.expectCount, count)
+	}
+	if s.contextID != "" && (len(res.Children) < 4 || res.Children[3].Data.String() != s.contextID) {
+		return conn, xerrors.Errorf("Unexpected VLV contextID. want = [%s] got = %s", s.contextID, ber.DecodeString(res.Bytes()))
+	}
+
+	return conn, nil
+}
+
+type SearchWithMatchedValues struct {
+	Search
+	filters []string
+}
+
+func newMatchedValuesControl(filters []string) (ldap.Control, error) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "ValuesReturnFilter")
+	for _, f := range filters {
+		fp, err := ldap.CompileFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		packet.AppendChild(ber.DecodePacket(fp.Bytes()))
+	}
+	return ldap.NewControlString(MatchedValuesControlOID, true, string(packet.Bytes())), nil
+}
+
+func (s SearchWithMatchedValues) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	control, err := newMatchedValuesControl(s.filters)
+	if err != nil {
+		return conn, err
+	}
+
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		[]ldap.Control{control},
+	)
+	sr, err := conn.Search(search)
+	if err != nil {
+		return conn, err
+	}
+	if s.assert != nil {
+		return conn, s.assert.AssertEntries(conn, err, sr)
+	}
+	return conn, nil
+}
+
+// SearchWithLimits executes the search with the size limit and types only.
+// The partial results are asserted even if the search exceeds the limit.
+type SearchWithLimits struct {
+	Search
+	sizeLimit       int
+	typesOnly       bool
+	expectErrorCode uint16
+}
+
+func (s SearchWithLimits) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		s.sizeLimit, // Size Limit
+		0,           // Time Limit
+		s.typesOnly,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		nil,
+	)
+	sr, err := conn.Search(search)
+	if err := (AssertResponse{s.expectErrorCode}).AssertResponse(conn, err); err != nil {
+		return conn, err
+	}
+	if s.assert != nil {
+		return conn, s.assert.AssertEntries(conn, nil, sr)
+	}
+	return conn, nil
+}
+
+// SearchWithDerefAliases executes the search with dereferencing the aliases.
+type SearchWithDerefAliases struct {
+	Search
+	derefAliases    int
+	expectErrorCode uint16
+}
+
+func (s SearchWithDerefAliases) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		s.derefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		nil,
+	)
+	sr, err := conn.Search(search)
+	if err := (AssertResponse{s.expectErrorCode}).AssertResponse(conn, err); err != nil {
+		return conn, err
+	}
+	if s.assert != nil {
+		return conn, s.assert.AssertEntries(conn, nil, sr)
+	}
+	return conn, nil
+}
+
+// SearchWithReferral executes the search then asserts the continuation references.
+// The referral entries are returned as the normal entries with the ManageDsaIT control.
+type SearchWithReferral struct {
+	Search
+	manageDsaIT     bool
+	referrals       []string
+	expectErrorCode uint16
+}
+
+func (s SearchWithReferral) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	var controls []ldap.Control
+	if s.manageDsaIT {
+		controls = append(controls, ldap.NewControlManageDsaIT(true))
+	}
+
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		controls,
+	)
+	sr, err := conn.Search(search)
+	if err := (AssertResponse{s.expectErrorCode}).AssertResponse(conn, err); err != nil {
+		return conn, err
+	}
+	if s.expectErrorCode != 0 {
+		return conn, nil
+	}
+	if !reflect.DeepEqual(sr.Referrals, s.referrals) {
+		return conn, xerrors.Errorf("Unexpected referrals. want: %v got: %v", s.referrals, sr.Referrals)
+	}
+	if s.assert != nil {
+		return conn, s.assert.AssertEntries(conn, nil, sr)
+	}
+	return conn, nil
+}
+
+// SearchWithSync executes the content synchronization with the refreshOnly mode.
+// The cookie is sent if it's not empty, then it's updated by the cookie of the sync done control.
+type SearchWithSync struct {
+	Search
+	cookie *string
+}
+
+func newSyncRequestControl(cookie string) ldap.Control {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "syncRequestValue")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, SyncModeRefreshOnly, "mode"))
+	if cookie != "" {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie, "cookie"))
+	}
+	return ldap.NewControlString(SyncRequestControlOID, true, string(packet.Bytes()))
+}
+
+func (s SearchWithSync) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		s.attrs,          // A list attributes to retrieve
+		[]ldap.Control{newSyncRequestControl(*s.cookie)},
+	)
+	sr, err := conn.Search(search)
+	if err != nil {
+		return conn, err
+	}
+
+	control := ldap.FindControl(sr.Controls, SyncDoneControlOID)
+	if control == nil {
+		return conn, xerrors.Errorf("Not found sync done control")
+	}
+	packet, err := ber.DecodePacketErr([]byte(control.(*ldap.ControlString).ControlValue))
+	if err != nil {
+		return conn, xerrors.Errorf("Invalid sync done control. err: %w", err)
+	}
+	if len(packet.Children) > 0 && packet.Children[0].Tag == ber.TagOctetString {
+		*s.cookie = packet.Children[0].Data.String()
+	}
+
+	if s.assert != nil {
+		return conn, s.assert.AssertEntries(conn, err, sr)
+	}
+	return conn, nil
+}
+
+type ModifyWithReadEntry struct {
+	rdn        string
+	baseDN     string
+	attrs      map[string][]string
+	preRead    []string
+	postRead   []string
+	expectPre  map[string][]string
+	expectPost map[string][]string
+}
+
+func newReadEntryControl(oid string, attrs []string) ldap.Control {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "AttributeSelection")
+	for _, a := range attrs {
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a, "attribute"))
+	}
+	return ldap.NewControlString(oid, true, string(packet.Bytes()))
+}
+
+func assertReadEntryControl(controls []ldap.Control, oid string, expect map[string][]string) error {
+	c := ldap.FindControl(controls, oid)
+	if c == nil {
+		return xerrors.Errorf("Not found read entry response control. oid: %s", oid)
+	}
+	res, err := ber.DecodePacketErr([]byte(c.(*ldap.ControlString).ControlValue))
+	if err != nil || len(res.Children) != 2 {
+		return xerrors.Errorf("Invalid read entry response control. oid: %s, err: %w", oid, err)
+	}
+
+	got := map[string][]string{}
+	for _, ap := range res.Children[1].Children {
+		var vals []string
+		for _, v := range ap.Children[1].Children {
+			vals = append(vals, v.Data.String())
+		}
+		got[strings.ToLower(ap.Children[0].Data.String())] = vals
+	}
+
+	for k, v := range expect {
+		if !reflect.DeepEqual(got[strings.ToLower(k)], v) {
+			return xerrors.Errorf("Unexpected read entry attribute. oid: %s, attr: %s, want = %v got = %v", oid, k, v, got[strings.ToLower(k)])
+		}
+	}
+	if len(got) != len(expect) {
+		return xerrors.Errorf("Unexpected read entry attribute size. oid: %s, want = [%d] got = %d", oid, len(expect), len(got))
+	}
+	return nil
+}
+
+func (m ModifyWithReadEntry) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(m.rdn, m.baseDN)
+
+	var controls []ldap.Control
+	if m.preRead != nil {
+		controls = append(controls, newReadEntryControl(PreReadControlOID, m.preRead))
+	}
+	if m.postRead != nil {
+		controls = append(controls, newReadEntryControl(PostReadControlOID, m.postRead))
+	}
+
+	modify := ldap.NewModifyRequest(dn, controls)
+	for k, v := range m.attrs {
+		modify.Replace(k, v)
+	}
+
+	log.Printf("info: Exec modify(replace) operation with read entry controls: %v", modify)
+
+	res, err := conn.ModifyWithResult(modify)
+	if err != nil {
+		return conn, err
+	}
+
+	if m.preRead != nil {
+		if err := assertReadEntryControl(res.Controls, PreReadControlOID, m.expectPre); err != nil {
+			return conn, err
+		}
+	}
+	if m.postRead != nil {
+		if err := assertReadEntryControl(res.Controls, PostReadControlOID, m.expectPost); err != nil {
+			return conn, err
+		}
+	}
+	return conn, nil
+}
+
+type ModifyWithAssertion struct {
+	rdn    string
+	baseDN string
+	attrs  map[string][]string
+	filter string
+	assert *AssertResponse
+}
+
+func (m ModifyWithAssertion) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(m.rdn, m.baseDN)
+
+	fp, err := ldap.CompileFilter("(" + m.filter + ")")
+	if err != nil {
+		return conn, err
+	}
+
+	modify := ldap.NewModifyRequest(dn, []ldap.Control{
+		ldap.NewControlString(AssertionControlOID, true, string(fp.Bytes())),
+	})
+	for k, v := range m.attrs {
+		modify.Replace(k, v)
+	}
+
+	log.Printf("info: Exec modify(replace) operation with assertion control: %v", modify)
+
+	err = conn.Modify(modify)
+
+	if m.assert != nil {
+		return conn, m.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+// ModifyWithManageDsaIT executes the modify(replace) operation with the ManageDsaIT control.
+type ModifyWithManageDsaIT struct {
+	rdn    string
+	baseDN string
+	attrs  map[string][]string
+	assert *AssertResponse
+}
+
+func (m ModifyWithManageDsaIT) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(m.rdn, m.baseDN)
+
+	modify := ldap.NewModifyRequest(dn, []ldap.Control{
+		ldap.NewControlManageDsaIT(true),
+	})
+	for k, v := range m.attrs {
+		modify.Replace(k, v)
+	}
+
+	log.Printf("info: Exec modify(replace) operation with ManageDsaIT control: %v", modify)
+
+	err := conn.Modify(modify)
+
+	if m.assert != nil {
+		return conn, m.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+// AddWithManageDsaIT executes the add operation with the ManageDsaIT control, e.g. under the referral entry.
+type AddWithManageDsaIT struct {
+	rdn    string
+	baseDN string
+	attrs  map[string][]string
+	assert *AssertResponse
+}
+
+func (a AddWithManageDsaIT) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	add := ldap.NewAddRequest(resolveDN(a.rdn, a.baseDN), []ldap.Control{
+		ldap.NewControlManageDsaIT(true),
+	})
+	for k, v := range a.attrs {
+		add.Attribute(k, v)
+	}
+
+	log.Printf("info: Exec add operation with ManageDsaIT control: %v", add)
+
+	err := conn.Add(add)
+
+	if a.assert != nil {
+		return conn, a.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+// AddWithDN executes the add operation by the DN with the suffix, e.g. for the other naming context.
+type AddWithDN struct {
+	dn     string
+	attrs  map[string][]string
+	assert *AssertResponse
+}
+
+func (a AddWithDN) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	add := ldap.NewAddRequest(a.dn, nil)
+	for k, v := range a.attrs {
+		add.Attribute(k, v)
+	}
+
+	log.Printf("info: Exec add operation: %v", add)
+
+	err := conn.Add(add)
+
+	if a.assert != nil {
+		return conn, a.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+// BindWithDN executes the simple bind by the DN with the suffix.
+type BindWithDN struct {
+	dn       string
+	password string
+	assert   *AssertResponse
+}
+
+func (c BindWithDN) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	err := conn.Bind(c.dn, c.password)
+	return conn, c.assert.AssertResponse(conn, err)
+}
+
+// ModifyDNWithDN executes the modifyDN operation by the DNs with the suffix.
+type ModifyDNWithDN struct {
+	dn     string
+	newRDN string
+	newSup string
+	assert *AssertResponse
+}
+
+func (m ModifyDNWithDN) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	modifyDN := ldap.NewModifyDNRequest(m.dn, m.newRDN, true, m.newSup)
+
+	log.Printf("info: Exec modifyDN operation: %v", modifyDN)
+
+	err := conn.ModifyDN(modifyDN)
+
+	if m.assert != nil {
+		return conn, m.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+// SearchDNs executes the search operation by the base DN with the suffix, then asserts the DNs of the entries.
+type SearchDNs struct {
+	baseDN string
+	filter string
+	scope  int
+	dns    []string
+}
+
+func (s SearchDNs) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	search := ldap.NewSearchRequest(
+		s.baseDN,
+		s.scope,
+		ldap.NeverDerefAliases,
+		0, // Size Limit
+		0, // Time Limit
+		false,
+		"("+s.filter+")", // The filter to apply
+		[]string{"1.1"},  // No attributes
+		nil,
+	)
+	sr, err := conn.Search(search)
+	if err != nil {
+		return conn, xerrors.Errorf("Unexpected error response. err: %w", err)
+	}
+
+	dns := []string{}
+	for _, entry := range sr.Entries {
+		dns = append(dns, strings.ToLower(entry.DN))
+	}
+	sort.Strings(dns)
+
+	expected := make([]string, len(s.dns))
+	for i, dn := range s.dns {
+		expected[i] = strings.ToLower(dn)
+	}
+	sort.Strings(expected)
+
+	if !reflect.DeepEqual(dns, expected) {
+		return conn, xerrors.Errorf("Unexpected entries. want: %v got: %v", expected, dns)
+	}
+	return conn, nil
+}
+
+type ModifyWithProxiedAuthz struct {
+	rdn     string
+	baseDN  string
+	attrs   map[string][]string
+	authzID string
+	assert  *AssertResponse
+}
+
+func (m ModifyWithProxiedAuthz) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(m.rdn, m.baseDN)
+
+	modify := ldap.NewModifyRequest(dn, []ldap.Control{
+		ldap.NewControlString(ProxiedAuthzControlOID, true, m.authzID),
+	})
+	for k, v := range m.attrs {
+		modify.Replace(k, v)
+	}
+
+	log.Printf("info: Exec modify(replace) operation with proxied authorization control: %v", modify)
+
+	err := conn.Modify(modify)
+
+	if m.assert != nil {
+		return conn, m.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
+type WhoAmIWithProxiedAuthz struct {
+	authzID string
+	expect  string
+	assert  *AssertResponse
+}
+
+func (c WhoAmIWithProxiedAuthz) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	res, err := conn.WhoAmI([]ldap.Control{
+		ldap.NewControlString(ProxiedAuthzControlOID, true, c.authzID),
+	})
+	if c.assert != nil {
+		if err := c.assert.AssertResponse(conn, err); err != nil {
+			return conn, err
+		}
+	} else if err != nil {
+		return conn, err
+	}
+	if err == nil && res.AuthzID != c.expect {
+		return conn, xerrors.Errorf("Unexpected authzId. want: %s, got: %s", c.expect, res.AuthzID)
+	}
+	return conn, nil
+}
+
+type DeleteTree struct {
+	rdn        string
+	baseDN     string
+	treeDelete bool
+	assert     *AssertResponse
+}
+
+func (d DeleteTree) Run(t *testing.T, conn *ldap.Conn) (*ldap.Conn, error) {
+	dn := resolveDN(d.rdn, d.baseDN)
+
+	var controls []ldap.Control
+	if d.treeDelete {
+		controls = append(controls, ldap.NewControlString(TreeDeleteControlOID, true, ""))
+	}
+
+	del := ldap.NewDelRequest(dn, controls)
+
+	log.Printf("info: Exec delete operation with tree delete control: %v", del)
+
+	err := conn.Del(del)
+
+	if d.assert != nil {
+		return conn, d.assert.AssertResponse(conn, err)
+	}
+	return conn, err
+}
+
 func resolveDN(rdn, baseDN string) string {
 	dn := rdn
 	if baseDN != "" {
@@ -713,25 +1530,28 @@ func setupLDAPServer() *Server {
 	// 	"objectClasses: ( 2.5.6.9 NAME 'groupOfNames' DESC 'RFC2256: a group of names (DNs)' SUP top STRUCTURAL MUST cn MAY ( businessCategory $ seeAlso $ owner $ ou $ o $ description $ member $ uniqueMember $ displayName ) )",
 	// }
 	testServer = NewServer(&ServerConfig{
-		DBHostName:       "localhost",
-		DBPort:           testPGPort,
-		DBName:           "ldap",
-		DBSchema:         "public",
-		DBUser:           "dev",
-		DBPassword:       "dev",
-		DBMaxOpenConns:   2,
-		DBMaxIdleConns:   1,
-		Suffix:           "dc=example,dc=com",
-		RootDN:           "cn=Manager,dc=example,dc=com",
-		RootPW:           "secret",
-		BindAddress:      "127.0.0.1:8389",
-		LogLevel:         "warn",
-		PProfServer:      "127.0.0.1:10000",
-		GoMaxProcs:       0,
-		QueryTranslator:  "default",
-		DefaultPPolicyDN: "cn=standard-policy,ou=Policies,dc=examle,dc=com",
-		DefaultPageSize:  500,
-		SimpleACL:        []string{"uid=op1,ou=users,dc=example,dc=com:RW:", "uid=op2,ou=users,dc=example,dc=com:RW:"},
+		DBHostName:         "localhost",
+		DBPort:             testPGPort,
+		DBName:             "ldap",
+		DBSchema:           "public",
+		DBUser:             "dev",
+		DBPassword:         "dev",
+		DBMaxOpenConns:     2,
+		DBMaxIdleConns:     1,
+		Suffixes:           []string{"dc=example,dc=com", "o=partners:partners"},
+		RootDN:             "cn=Manager,dc=example,dc=com",
+		RootPW:             "secret",
+		BindAddress:        "127.0.0.1:8389",
+		LogLevel:           "warn",
+		PProfServer:        "127.0.0.1:10000",
+		GoMaxProcs:         0,
+		QueryTranslator:    "default",
+		DefaultPPolicyDN:   "cn=standard-policy,ou=Policies,dc=examle,dc=com",
+		DefaultPageSize:    500,
+		PasswordHashScheme: "SSHA512",
+		SimpleACL:          []string{"uid=op1,ou=users,dc=example,dc=com:RW:", "uid=op2,ou=users,dc=example,dc=com:RW:", "uid=proxy,ou=users,dc=example,dc=com:RWP:", "uid=limited,ou=users,dc=example,dc=com:R:"},
+		SearchLimits:       []string{"uid=limited,ou=users,dc=example,dc=com:1:0"},
+		MaxVLVWindowSize:   10,
 	})
 	go testServer.Start()
 
@@ -760,7 +1580,13 @@ func truncateTables() {
 	}
 	defer db.Close()
 
-	_, err = db.Exec("TRUNCATE ldap_entry, ldap_container, ldap_association")
+	_, err = db.Exec("TRUNCATE ldap_entry, ldap_container, ldap_association, ldap_change_log")
+	if err != nil {
+		log.Fatal("truncate table error:", err)
+	}
+
+	// The naming context of o=partners
+	_, err = db.Exec("TRUNCATE partners.ldap_entry, partners.ldap_container, partners.ldap_association, partners.ldap_change_log")
 	if err != nil {
 		log.Fatal("truncate table error:", err)
 	}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	ldap "github.com/openstandia/ldapserver"
+	"golang.org/x/xerrors"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func init() {
+	// StartTLS is available only with the certificate
+	RegisterSupportedExtension(string(ldap.NoticeOfStartTLS), func(s *Server) bool {
+		return s.tlsConfig != nil
+	})
+}
+
+// TLSCertLoader holds the certificate and the CA certificates loaded from the files.
+// They are replaced by Load so that the certificate rotation doesn't need a restart.
+type TLSCertLoader struct {
+	certFile   string
+	keyFile    string
+	caCertFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func NewTLSCertLoader(certFile, keyFile, caCertFile string) (*TLSCertLoader, error) {
+	l := &TLSCertLoader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		caCertFile: caCertFile,
+	}
+	if err := l.Load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Load reads the certificate files. The current certificate is kept if it fails.
+func (l *TLSCertLoader) Load() error {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return xerrors.Errorf("Failed to load the certificate. cert: %s, key: %s, err: %w", l.certFile, l.keyFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if l.caCertFile != "" {
+		pem, err := os.ReadFile(l.caCertFile)
+		if err != nil {
+			return xerrors.Errorf("Failed to read the CA certificate. ca: %s, err: %w", l.caCertFile, err)
+		}
+		clientCAs = x509.NewCertPool()
+		if ok := clientCAs.AppendCertsFromPEM(pem); !ok {
+			return xerrors.Errorf("No valid CA certificate. ca: %s", l.caCertFile)
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cert = &cert
+	l.clientCAs = clientCAs
+
+	return nil
+}
+
+// ReloadOnSignal reloads the certificate files when SIGHUP is received.
+func (l *TLSCertLoader) ReloadOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	for range ch {
+		if err := l.Load(); err != nil {
+			log.Printf("error: Failed to reload TLS certificate. Keep the current one. err: %+v", err)
+			continue
+		}
+		log.Printf("info: Reloaded TLS certificate. cert: %s", l.certFile)
+	}
+}
+
+func (l *TLSCertLoader) current() (*tls.Certificate, *x509.CertPool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.cert, l.clientCAs
+}
+
+// NewTLSConfig returns a tls configuration used
+// to build a TLS listener for LDAPS or StartTLS.
+func NewTLSConfig(c *ServerConfig, loader *TLSCertLoader) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.TLSMinVersion]
+	if !ok {
+		return nil, xerrors.Errorf("Unsupported TLS version: %s", c.TLSMinVersion)
+	}
+
+	var cipherSuites []uint16
+	if len(c.TLSCipherSuites) > 0 {
+		supported := map[string]uint16{}
+		for _, v := range tls.CipherSuites() {
+			supported[v.Name] = v.ID
+		}
+		for _, name := range c.TLSCipherSuites {
+			id, ok := supported[strings.TrimSpace(name)]
+			if !ok {
+				return nil, xerrors.Errorf("Unsupported cipher suite: %s", name)
+			}
+			cipherSuites = append(cipherSuites, id)
+		}
+	}
+
+	base := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}
+
+	// Resolve the certificate per connection to apply the reloaded one
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, clientCAs := loader.current()
+
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*cert}
+		if clientCAs != nil {
+			config.ClientCAs = clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+		return config, nil
+	}
+
+	return base, nil
+}
+
+func isTLSConn(m *ldap.Message) bool {
+	_, ok := m.Client.GetConn().(*tls.Conn)
+	return ok
+}
+
+// RequiredTLS returns false if TLS is required by the configuration
+// but the connection isn't protected by LDAPS or StartTLS yet.
+func (s *Server) RequiredTLS(m *ldap.Message) bool {
+	if !s.config.TLSRequired {
+		return true
+	}
+	return isTLSConn(m)
+}
+
+func handleStartTLS(s *Server, w ldap.ResponseWriter, m *ldap.Message) {
+	res := ldap.NewExtendedResponse(ldap.LDAPResultSuccess)
+	res.SetResponseName(ldap.NoticeOfStartTLS)
+
+	if s.tlsConfig == nil {
+		log.Printf("warn: StartTLS failed - TLS isn't configured")
+		res.SetResultCode(ldap.LDAPResultUnavailable)
+		res.SetDiagnosticMessage("TLS not configured")
+		w.Write(res)
+		return
+	}
+
+	if isTLSConn(m) {
+		log.Printf("warn: StartTLS failed - TLS already started")
+		res.SetResultCode(ldap.LDAPResultOperationsError)
+		res.SetDiagnosticMessage("TLS already started")
+		w.Write(res)
+		return
+	}
+
+	tlsConn := tls.Server(m.Client.GetConn(), s.tlsConfig)
+	w.Write(res)
+
+	if err := tlsConn.Handshake(); err != nil {
+		// The client can't read the response anymore because the handshake already started
+		log.Printf("warn: StartTLS Handshake error %+v", err)
+		return
+	}
+
+	m.Client.SetConn(tlsConn)
+	log.Printf("info: StartTLS OK")
+}
@@ -0,0 +1,141 @@
+//go:build test
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, dir, cn string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "test")
+
+	loader, err := NewTLSCertLoader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	testcases := []struct {
+		MinVersion   string
+		CipherSuites []string
+		Expected     uint16
+		Err          bool
+	}{
+		{"1.2", nil, tls.VersionTLS12, false},
+		{"1.3", nil, tls.VersionTLS13, false},
+		{"1.2", []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}, tls.VersionTLS12, false},
+		{"3.0", nil, 0, true},
+		{"1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}, 0, true},
+	}
+
+	for i, tc := range testcases {
+		config, err := NewTLSConfig(&ServerConfig{
+			TLSMinVersion:   tc.MinVersion,
+			TLSCipherSuites: tc.CipherSuites,
+		}, loader)
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Unexpected success on %d", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error on %d: %+v", i, err)
+			continue
+		}
+		if config.MinVersion != tc.Expected {
+			t.Errorf("Unexpected min version on %d: expected %d, got %d", i, tc.Expected, config.MinVersion)
+		}
+	}
+}
+
+func TestTLSCertLoaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "old")
+
+	loader, err := NewTLSCertLoader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	config, err := NewTLSConfig(&ServerConfig{TLSMinVersion: "1.2"}, loader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	commonName := func() string {
+		c, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		cert, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		return cert.Subject.CommonName
+	}
+
+	if cn := commonName(); cn != "old" {
+		t.Errorf("Unexpected certificate: %s", cn)
+	}
+
+	writeTestCert(t, dir, "new")
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if cn := commonName(); cn != "new" {
+		t.Errorf("Unexpected certificate after reload: %s", cn)
+	}
+
+	// Keep the current certificate if the reload fails
+	if err := os.WriteFile(keyFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Load(); err == nil {
+		t.Errorf("Unexpected success of reloading invalid key")
+	}
+	if cn := commonName(); cn != "new" {
+		t.Errorf("Unexpected certificate after failed reload: %s", cn)
+	}
+}
@@ -55,19 +55,31 @@ func getAuthSession(m *ldap.Message) *AuthSession {
 	}
 }
 
-func getPageSession(m *ldap.Message) map[string]int64 {
+// PageState is the state of the paged results search kept with the cookie.
+// The size limit applies to the total entries across the pages, so the remaining size is carried over.
+type PageState struct {
+	Cursor        int64
+	SortCursor    *SortCursor
+	RemainingSize int // Unlimited with 0
+}
+
+func getPageSession(m *ldap.Message) map[string]*PageState {
 	session := getSession(m)
 	if pageSession, ok := session["page"]; ok {
-		return pageSession.(map[string]int64)
+		return pageSession.(map[string]*PageState)
 	} else {
-		pageSession := map[string]int64{}
+		pageSession := map[string]*PageState{}
 		session["page"] = pageSession
 		return pageSession
 	}
 }
 
 func isOperationalAttributesRequested(r message.SearchRequest) bool {
-	for _, attr := range r.Attributes() {
+	return isOperationalAttributesSelected(r.Attributes())
+}
+
+func isOperationalAttributesSelected(attrs message.AttributeSelection) bool {
+	for _, attr := range attrs {
 		if string(attr) == "+" {
 			return true
 		}
@@ -76,10 +88,14 @@ func isOperationalAttributesRequested(r message.SearchRequest) bool {
 }
 
 func isAllAttributesRequested(r message.SearchRequest) bool {
-	if len(r.Attributes()) == 0 {
+	return isAllAttributesSelected(r.Attributes())
+}
+
+func isAllAttributesSelected(attrs message.AttributeSelection) bool {
+	if len(attrs) == 0 {
 		return true
 	}
-	for _, attr := range r.Attributes() {
+	for _, attr := range attrs {
 		if string(attr) == "*" {
 			return true
 		}
@@ -105,6 +121,15 @@ func isHasSubOrdinatesRequested(r message.SearchRequest) bool {
 	return false
 }
 
+func isContextCSNRequested(r message.SearchRequest) bool {
+	for _, attr := range r.Attributes() {
+		if strings.EqualFold(string(attr), "contextcsn") || string(attr) == "+" {
+			return true
+		}
+	}
+	return false
+}
+
 func getRequestedMemberAttrs(r message.SearchRequest) []string {
 	if len(r.Attributes()) == 0 {
 		return getAllMemberAttrs()
@@ -373,6 +398,10 @@ func ParseDN(schemaMap *SchemaMap, str string) (*DN, error) {
 			attribute.ValueOrig = orig
 			attribute.ValueOrigEncoded = encodeDN(orig)
 			attribute.ValueNorm = norm
+			if rdn.Contains(attribute) {
+				log.Printf("warn: Invalid DN syntax, duplicate RDN component. dn_orig: %s", str)
+				return nil, NewInvalidDNSyntax()
+			}
 			rdn.Attributes = append(rdn.Attributes, attribute)
 			attribute = new(AttributeTypeAndValue)
 			if char == ',' {
@@ -405,6 +434,10 @@ func ParseDN(schemaMap *SchemaMap, str string) (*DN, error) {
 		attribute.ValueOrig = orig
 		attribute.ValueOrigEncoded = encodeDN(orig)
 		attribute.ValueNorm = norm
+		if rdn.Contains(attribute) {
+			log.Printf("warn: Invalid DN syntax, duplicate RDN component. dn_orig: %s", str)
+			return nil, NewInvalidDNSyntax()
+		}
 		rdn.Attributes = append(rdn.Attributes, attribute)
 		dn.RDNs = append(dn.RDNs, rdn)
 	}
@@ -482,6 +515,16 @@ func isDeadlockError(err error) bool {
 	return false
 }
 
+func isQueryCanceledError(err error) bool {
+	// The error code is 57014. It's returned when the statement timeout is exceeded or the query is canceled.
+	// see https://www.postgresql.org/docs/13/errcodes-appendix.html
+	var pqErr *pq.Error
+	if xerrors.As(err, &pqErr) {
+		return pqErr.Code == pq.ErrorCode("57014")
+	}
+	return false
+}
+
 func rollback(tx *sqlx.Tx) {
 	err := tx.Rollback()
 	if err != nil {
@@ -498,17 +541,23 @@ func commit(tx *sqlx.Tx) error {
 	return err
 }
 
-func resolveSuffix(s *Server, dnOrig string) string {
+// resolveSuffix appends the base DN of the naming context to the DN stored in the repository.
+// The base DN is the suffix, or the parent of the suffix if the naming contexts share the DB schema.
+func resolveSuffix(base *DN, dnOrig string) string {
+	// The root entry of the single RDN suffix sharing the DB schema
+	if len(base.RDNs) == 0 {
+		return strings.TrimSuffix(dnOrig, ",")
+	}
 	// Suffix DN or Level 1 DN have comma with end
 	if strings.HasSuffix(dnOrig, ",") {
 		// Detect whether the dnOrig is Suffix DN (The DN should have same RDN)
-		if s.Suffix.RDNNormStr() == strings.ToLower(strings.TrimSuffix(dnOrig, ",")) {
-			dnOrig = s.SuffixOrigStr()
+		if base.RDNNormStr() == strings.ToLower(strings.TrimSuffix(dnOrig, ",")) {
+			dnOrig = base.DNNormStr()
 		} else {
-			dnOrig += s.SuffixOrigStr()
+			dnOrig += base.DNNormStr()
 		}
 	} else {
-		dnOrig += "," + s.SuffixOrigStr()
+		dnOrig += "," + base.DNNormStr()
 	}
 	return dnOrig
 }
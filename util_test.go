@@ -5,6 +5,9 @@ package main
 import (
 	"reflect"
 	"testing"
+
+	"github.com/lib/pq"
+	"golang.org/x/xerrors"
 )
 
 func TestNormalize(t *testing.T) {
@@ -150,6 +153,24 @@ func TestSortObjectClassesAndVerifyChain(t *testing.T) {
 	}
 }
 
+func TestIsQueryCanceledError(t *testing.T) {
+	canceled := &pq.Error{Code: "57014"}
+
+	for _, tc := range []struct {
+		err    error
+		expect bool
+	}{
+		{canceled, true},
+		{xerrors.Errorf("Failed to find alias by DN. err: %w", canceled), true},
+		{&pq.Error{Code: "40P01"}, false},
+		{xerrors.New("other error"), false},
+	} {
+		if got := isQueryCanceledError(tc.err); got != tc.expect {
+			t.Errorf("Unexpected result for %v: %v", tc.err, got)
+		}
+	}
+}
+
 func TestDiffDN(t *testing.T) {
 	server := NewServer(&ServerConfig{
 		Suffix: "dc=example,dc=com",